@@ -22,6 +22,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/flatcar/mantle/kola"
+	"github.com/flatcar/mantle/kola/register"
 )
 
 var (
@@ -35,13 +36,19 @@ Check console output for expressions matching failure messages logged
 by a Container Linux instance.
 
 If no files are specified as arguments, stdin is checked.
+
+The built-in rules are extended by those of --console-rules. Rules and
+suppressions scoped to tests apply if --test is given; those scoped to
+platforms and versions use --platform and --image-version.
 `}
 
 	checkConsoleVerbose bool
+	checkConsoleTest    string
 )
 
 func init() {
 	cmdCheckConsole.Flags().BoolVarP(&checkConsoleVerbose, "verbose", "v", false, "output user input prompts")
+	cmdCheckConsole.Flags().StringVar(&checkConsoleTest, "test", "", "name of the test which produced the output")
 	root.AddCommand(cmdCheckConsole)
 }
 
@@ -51,6 +58,22 @@ func runCheckConsole(cmd *cobra.Command, args []string) {
 		args = append(args, "-")
 	}
 
+	rules, err := kola.LoadConsoleRules(kola.ConsoleRulesFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	ctx := kola.ConsoleContext{
+		Platform: kolaPlatform,
+		Version:  kolaImageVersion,
+	}
+	if checkConsoleTest != "" {
+		ctx.Test = register.Tests[checkConsoleTest]
+		if ctx.Test == nil {
+			ctx.Test = &register.Test{Name: checkConsoleTest}
+		}
+	}
+
 	errors := 0
 	for _, arg := range args {
 		var console []byte
@@ -70,9 +93,16 @@ func runCheckConsole(cmd *cobra.Command, args []string) {
 			errors += 1
 			continue
 		}
-		for _, badness := range kola.CheckConsole(console, nil) {
-			fmt.Printf("%v: %v\n", sourceName, badness)
-			errors += 1
+		for _, m := range rules.Check(console, ctx) {
+			switch {
+			case m.SuppressedBy != "":
+				fmt.Printf("%v:%d: %v [suppressed: %s]\n", sourceName, m.Line, m, m.SuppressedBy)
+			case m.Severity == kola.SeverityWarn:
+				fmt.Printf("%v:%d: %v [warning]\n", sourceName, m.Line, m)
+			default:
+				fmt.Printf("%v:%d: %v\n", sourceName, m.Line, m)
+				errors += 1
+			}
 		}
 	}
 	if errors > 0 {
@@ -40,26 +40,17 @@ var (
 	kolaImageVersion            string // ${VERSION_ID} or ${VERSION_ID}+${BUILD_ID}
 	kolaDisableSELinuxAVCChecks bool
 	defaultTargetBoard          = sdk.DefaultBoard()
-	kolaArchitectures           = []string{"amd64", "arm64"}
-	kolaPlatforms               = []string{"akamai", "aws", "azure", "brightbox", "do", "esx", "external", "gce", "hetzner", "openstack", "oraclecloud", "qemu", "qemu-unpriv", "scaleway", "stackit"}
+	kolaArchitectures           = []string{"amd64", "arm64", "riscv64"}
+	kolaPlatforms               = []string{"akamai", "aws", "azure", "brightbox", "do", "esx", "external", "gce", "hetzner", "libvirt", "microvm", "openstack", "oraclecloud", "qemu", "qemu-unpriv", "scaleway", "stackit"}
 	kolaDistros                 = []string{"cl", "fcos", "rhcos"}
 	kolaChannels                = []string{"alpha", "beta", "stable", "edge", "lts"}
 	kolaOfferings               = []string{"basic", "pro"}
-	kolaDefaultImages           = map[string]string{
-		"amd64-usr": sdk.BuildRoot() + "/images/amd64-usr/latest/flatcar_production_image.bin",
-		"arm64-usr": sdk.BuildRoot() + "/images/arm64-usr/latest/flatcar_production_image.bin",
-	}
 	kolaIgnitionVersionDefaults = map[string]string{
 		"cl":    "v2",
 		"fcos":  "v3",
 		"rhcos": "v3",
 	}
 
-	kolaDefaultFirmware = map[string]string{
-		"amd64-usr": "bios-256k.bin",
-		"arm64-usr": sdk.BuildRoot() + "/images/arm64-usr/latest/flatcar_production_qemu_uefi_efi_code.qcow2",
-	}
-
 	kolaSSHRetries = 60
 	kolaSSHTimeout = 10 * time.Second
 )
@@ -68,6 +59,7 @@ func init() {
 	sv := root.PersistentFlags().StringVar
 	bv := root.PersistentFlags().BoolVar
 	ss := root.PersistentFlags().StringSlice
+	ssv := root.PersistentFlags().StringSliceVar
 	dv := root.PersistentFlags().DurationVar
 	iv := root.PersistentFlags().IntVar
 	f32v := root.PersistentFlags().Float32Var
@@ -75,6 +67,8 @@ func init() {
 	// general options
 	sv(&outputDir, "output-dir", "", "Temporary output directory for test data and logs")
 	sv(&kola.TorcxManifestFile, "torcx-manifest", "", "Path to a torcx manifest that should be made available to tests")
+	sv(&kola.ConsoleRulesFile, "console-rules", "", "Path to a YAML file with additional console/journal badness rules and known-issue suppressions")
+	sv(&kola.KnownIssuesFile, "known-issues", "", "Path to a YAML file with known issues marking tests to skip or whose failures are expected")
 	sv(&kola.DevcontainerURL, "devcontainer-url", "http://bincache.flatcar-linux.net/images/@ARCH@/@VERSION@", "URL to a dev container archive that should be made available to tests")
 	sv(&kola.DevcontainerFile, "devcontainer-file", "", "Path to a dev container archive that should be made available to tests as alternative to devcontainer-url, note that a working devcontainer-binhost-url is still needed")
 	sv(&kola.DevcontainerBinhostURL, "devcontainer-binhost-url", "http://bincache.flatcar-linux.net/boards/@ARCH@-usr/@VERSION@/pkgs", "URL to a binary host that the devcontainer test should use")
@@ -90,8 +84,12 @@ func init() {
 	ss("debug-systemd-unit", []string{}, "full-unit-name.service to enable SYSTEMD_LOG_LEVEL=debug on. Specify multiple times for multiple units.")
 	sv(&kola.UpdatePayloadFile, "update-payload", "", "Path to an update payload that should be made available to tests")
 	bv(&kola.ForceFlatcarKey, "force-flatcar-key", false, "Use the Flatcar production key to verify update payload")
+	ssv(&kola.UpgradePath, "upgrade-path", nil, "Versions cl.update.path upgrades the image through, as VERSION or VERSION=PAYLOAD")
+	sv(&kola.UpgradePayloadURL, "upgrade-payload-url", "https://update.release.flatcar-linux.net/@ARCH@-usr/@VERSION@/flatcar_production_update.gz", "URL of update payloads of --upgrade-path versions without one")
+	ssv(&kola.UpgradeTests, "upgrade-tests", nil, "Patterns of tests cl.update.path runs on the upgraded machine")
 	sv(&kola.Options.IgnitionVersion, "ignition-version", "", "Ignition version override: v2, v3")
 	bv(&kola.Options.EnableSecureboot, "enable-secureboot", false, "Instantiate a Secureboot Machine")
+	bv(&kola.Options.StrictConfig, "strict-config", false, "Fail tests whose userdata validation reports warnings")
 	iv(&kola.Options.SSHRetries, "ssh-retries", kolaSSHRetries, "Number of retries with the SSH timeout when starting the machine")
 	dv(&kola.Options.SSHTimeout, "ssh-timeout", kolaSSHTimeout, "A timeout for a single try of establishing an SSH connection when starting the machine")
 
@@ -211,7 +209,7 @@ func init() {
 	root.PersistentFlags().MarkDeprecated("qemu-bios", "use --qemu-firmware")
 	sv(&kola.QEMUOptions.Firmware, "qemu-firmware", "", "firmware image to use for QEMU vm")
 	sv(&kola.QEMUOptions.VNC, "qemu-vnc", "", "VNC port (0 for 5900, 1 for 5901, etc.)")
-	sv(&kola.QEMUOptions.OVMFVars, "qemu-ovmf-vars", "", "OVMF vars file to use for QEMU vm")
+	sv(&kola.QEMUOptions.OVMFVars, "qemu-ovmf-vars", "", "OVMF vars file to use for QEMU vm (default depends on --board)")
 	bv(&kola.QEMUOptions.UseVanillaImage, "qemu-skip-mangle", false, "don't modify CL disk image to capture console log")
 	sv(&kola.QEMUOptions.ExtraBaseDiskSize, "qemu-grow-base-disk-by", "", "grow base disk by the given size in bytes, following optional 1024-based suffixes are allowed: b (ignored), k, K, M, G, T")
 	bv(&kola.QEMUOptions.EnableTPM, "qemu-tpm", false, "enable TPM device in QEMU. Requires installing swtpm. Use only with 'kola spawn', test cases are responsible for creating a VM with TPM explicitly.")
@@ -238,6 +236,25 @@ func init() {
 	sv(&kola.HetznerOptions.Image, "hetzner-image", "", "Hetzner image ID")
 	sv(&kola.HetznerOptions.ServerType, "hetzner-server-type", "cpx22", "Hetzner instance type")
 
+	// libvirt specific options
+	sv(&kola.LibvirtOptions.URI, "libvirt-uri", "qemu:///system", "libvirt connection URI")
+	sv(&kola.LibvirtOptions.Pool, "libvirt-pool", "default", "libvirt storage pool")
+	sv(&kola.LibvirtOptions.Network, "libvirt-network", "", "libvirt network to attach machines to (default: create a network per cluster)")
+	sv(&kola.LibvirtOptions.Image, "libvirt-image", "", "libvirt volume to boot machines from")
+	sv(&kola.LibvirtOptions.DomainType, "libvirt-domain-type", "", "libvirt domain type, kvm or qemu (default depends on --board)")
+	iv(&kola.LibvirtOptions.Memory, "libvirt-memory", 2048, "libvirt memory per machine in MiB")
+	iv(&kola.LibvirtOptions.CPUs, "libvirt-cpus", 2, "libvirt virtual CPUs per machine")
+
+	// microVM specific options
+	sv(&kola.MicroVMOptions.VMM, "microvm-vmm", "firecracker", "microVM monitor, firecracker or cloud-hypervisor")
+	sv(&kola.MicroVMOptions.Binary, "microvm-binary", "", "microVM monitor binary (default: --microvm-vmm)")
+	sv(&kola.MicroVMOptions.Kernel, "microvm-kernel", "", "uncompressed kernel to boot microVMs with")
+	sv(&kola.MicroVMOptions.Initrd, "microvm-initrd", "", "initramfs for kernels without an embedded one")
+	sv(&kola.MicroVMOptions.DiskImage, "microvm-image", "", "raw disk image to boot microVMs from")
+	sv(&kola.MicroVMOptions.KernelArgs, "microvm-kernel-args", "", "additional kernel command line arguments")
+	iv(&kola.MicroVMOptions.Memory, "microvm-memory", 1024, "microVM memory in MiB")
+	iv(&kola.MicroVMOptions.CPUs, "microvm-cpus", 2, "microVM virtual CPUs")
+
 	// Akamai specific options
 	sv(&kola.AkamaiOptions.Token, "akamai-token", "", "Akamai access token")
 	sv(&kola.AkamaiOptions.Image, "akamai-image", "", "Akamai image ID")
@@ -270,6 +287,8 @@ func syncOptions() error {
 	kola.BrightboxOptions.Board = board
 	kola.ScalewayOptions.Board = board
 	kola.HetznerOptions.Board = board
+	kola.LibvirtOptions.Board = board
+	kola.MicroVMOptions.Board = board
 	kola.AkamaiOptions.Board = board
 	kola.OracleCloudOptions.Board = board
 	kola.STACKITOptions.Board = board
@@ -281,7 +300,9 @@ func syncOptions() error {
 		case "arm64-usr":
 			kola.OracleCloudOptions.Shape = "VM.Standard.A1.Flex"
 		default:
-			return fmt.Errorf("unsupported Oracle Cloud board %q", board)
+			if kolaPlatform == "oraclecloud" {
+				return fmt.Errorf("unsupported Oracle Cloud board %q", board)
+			}
 		}
 	}
 
@@ -310,17 +331,24 @@ func syncOptions() error {
 		return err
 	}
 
-	image, ok := kolaDefaultImages[kola.QEMUOptions.Board]
-	if !ok {
-		return fmt.Errorf("unsupport board %q", kola.QEMUOptions.Board)
+	qemuBoard, err := platform.GetQEMUBoard(kola.QEMUOptions.Board)
+	if err != nil {
+		return err
 	}
+	imageDir := sdk.BuildImageDir(kola.QEMUOptions.Board, "latest")
 
 	if kola.QEMUOptions.DiskImage == "" {
-		kola.QEMUOptions.DiskImage = image
+		kola.QEMUOptions.DiskImage = filepath.Join(imageDir, "flatcar_production_image.bin")
 	}
 
 	if kola.QEMUOptions.Firmware == "" {
-		kola.QEMUOptions.Firmware = kolaDefaultFirmware[kola.QEMUOptions.Board]
+		kola.QEMUOptions.Firmware = qemuBoard.Firmware
+		if qemuBoard.FirmwareFromImage {
+			kola.QEMUOptions.Firmware = filepath.Join(imageDir, qemuBoard.Firmware)
+		}
+	}
+	if kola.QEMUOptions.OVMFVars == "" && qemuBoard.Vars != "" {
+		kola.QEMUOptions.OVMFVars = filepath.Join(imageDir, qemuBoard.Vars)
 	}
 	if kolaPlatform == "qemu" && kola.QEMUOptions.EnableSecureboot && kola.QEMUOptions.OVMFVars == "" {
 		return fmt.Errorf("secureboot requires OVMF vars file")
@@ -339,6 +367,7 @@ func syncOptions() error {
 	}
 
 	if kola.Options.IgnitionVersion == "" {
+		var ok bool
 		kola.Options.IgnitionVersion, ok = kolaIgnitionVersionDefaults[kola.Options.Distribution]
 		if !ok {
 			return fmt.Errorf("distribution %q has no default Ignition version", kola.Options.Distribution)
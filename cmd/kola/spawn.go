@@ -30,6 +30,7 @@ import (
 	"github.com/flatcar/mantle/platform/machine/qemu"
 	"github.com/flatcar/mantle/sdk"
 	"github.com/flatcar/mantle/sdk/omaha"
+	"github.com/flatcar/mantle/update/generator"
 
 	"github.com/coreos/pkg/capnslog"
 )
@@ -44,8 +45,10 @@ var (
 
 	spawnNodeCount      int
 	spawnUserData       string
+	spawnTemplate       bool
 	spawnDetach         bool
 	spawnOmahaPackage   string
+	spawnOmahaCompress  []string
 	spawnShell          bool
 	spawnRemove         bool
 	spawnMachineOptions string
@@ -56,8 +59,10 @@ var (
 func init() {
 	cmdSpawn.Flags().IntVarP(&spawnNodeCount, "nodecount", "c", 1, "number of nodes to spawn")
 	cmdSpawn.Flags().StringVarP(&spawnUserData, "userdata", "u", "", "file containing userdata to pass to the instances")
+	cmdSpawn.Flags().BoolVar(&spawnTemplate, "template", false, "execute the userdata as a template with machine and cluster facts")
 	cmdSpawn.Flags().BoolVarP(&spawnDetach, "detach", "t", false, "-kv --shell=false --remove=false")
 	cmdSpawn.Flags().StringVar(&spawnOmahaPackage, "omaha-package", "", "add an update payload to the Omaha server, referenced by image version (e.g. 'latest')")
+	cmdSpawn.Flags().StringSliceVar(&spawnOmahaCompress, "omaha-compress", []string{"bzip2"}, "compressors to try for each chunk of the --omaha-package payload (bzip2, xz, zstd); Flatcar's update_engine can only apply bzip2 payloads and no update_engine can apply zstd ones")
 	cmdSpawn.Flags().BoolVarP(&spawnShell, "shell", "s", true, "spawn a shell in an instance before exiting")
 	cmdSpawn.Flags().BoolVarP(&spawnRemove, "remove", "r", true, "remove instances after shell exits")
 	cmdSpawn.Flags().StringVar(&spawnMachineOptions, "qemu-options", "", "experimental: path to QEMU machine options json")
@@ -94,6 +99,9 @@ func doSpawn(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("Reading userdata failed: %v", err)
 		}
 		userdata = conf.Unknown(string(userbytes))
+		if spawnTemplate {
+			userdata = userdata.Template()
+		}
 	}
 	if spawnSetSSHKeys {
 		if userdata == nil {
@@ -143,11 +151,15 @@ func doSpawn(cmd *cobra.Command, args []string) error {
 			//TODO(lucab): expand platform support
 			return errors.New("--omaha-package is currently only supported on qemu")
 		}
+		compressors, err := generator.ParseCompressors(spawnOmahaCompress)
+		if err != nil {
+			return err
+		}
 		dir := sdk.BuildImageDir(kola.QEMUOptions.Board, spawnOmahaPackage)
-		if err := omaha.GenerateFullUpdate(dir); err != nil {
+		if err := omaha.GenerateFullUpdate(dir, nil, compressors...); err != nil {
 			return fmt.Errorf("Building full update failed: %v", err)
 		}
-		updatePayload := filepath.Join(dir, "coreos_production_update.gz")
+		updatePayload := filepath.Join(dir, "flatcar_production_update.gz")
 		if err := qc.OmahaServer.AddPackage(updatePayload, "update.gz"); err != nil {
 			return fmt.Errorf("bad payload: %v", err)
 		}
@@ -0,0 +1,81 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar/mantle/platform/conf"
+)
+
+var (
+	cmdTranslateConfig = &cobra.Command{
+		Use:   "translate-config [input-file]",
+		Run:   runTranslateConfig,
+		Short: "Translate an Ignition 2.x config or CLC to Ignition 3.x.",
+		Long: `
+Translate an Ignition 2.x config or a Container Linux Config to the newest
+Ignition 3.x spec supported by kola and print the result.
+
+Files written to filesystems other than "root" need the mount path of
+their filesystem, e.g. --fs-path oem=/oem.
+
+If no file is specified as argument, stdin is translated.
+`}
+
+	translateFSPaths    map[string]string
+	translateCTPlatform string
+)
+
+func init() {
+	cmdTranslateConfig.Flags().StringToStringVar(&translateFSPaths, "fs-path", nil, "mount path of a named filesystem (name=path)")
+	cmdTranslateConfig.Flags().StringVar(&translateCTPlatform, "ct-platform", "", "platform to render Container Linux Configs for")
+	root.AddCommand(cmdTranslateConfig)
+}
+
+func runTranslateConfig(cmd *cobra.Command, args []string) {
+	if err := translateConfig(args); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func translateConfig(args []string) error {
+	var data []byte
+	var err error
+	switch len(args) {
+	case 0:
+		data, err = io.ReadAll(os.Stdin)
+	case 1:
+		data, err = os.ReadFile(args[0])
+	default:
+		return fmt.Errorf("too many arguments")
+	}
+	if err != nil {
+		return err
+	}
+
+	userdata := conf.Unknown(string(data))
+	if !userdata.IsIgnitionCompatible() {
+		return fmt.Errorf("input is neither an Ignition config nor a Container Linux Config")
+	}
+	c, err := userdata.TranslateV3(translateFSPaths).Render(translateCTPlatform)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, c.Bytes(), "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err = out.WriteTo(os.Stdout)
+	return err
+}
@@ -244,7 +244,7 @@ func newPayload() string {
 
 	// check for update file, generate if it doesn't exist
 	dir := sdk.BuildImageDir(kola.QEMUOptions.Board, "latest")
-	if err := sdkomaha.GenerateFullUpdate(dir); err != nil {
+	if err := sdkomaha.GenerateFullUpdate(dir, nil); err != nil {
 		plog.Fatalf("Building full update failed: %v", err)
 	}
 
@@ -0,0 +1,82 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar/mantle/platform/conf"
+)
+
+var (
+	cmdValidateConfig = &cobra.Command{
+		Use:   "validate-config [input-file...]",
+		Run:   runValidateConfig,
+		Short: "Validate and lint userdata.",
+		Long: `
+Validate Ignition configs, Container Linux Configs, Butane configs and
+cloud-configs, reporting parser and validator messages with their line and
+column, and lint the resulting Ignition config for common mistakes on
+Flatcar:
+
+- writing below the read-only /usr
+- units referencing files neither written by the config nor part of the OS
+- units with an [Install] section which are not enabled
+
+If no files are specified as arguments, stdin is validated.
+`}
+
+	validateStrict     bool
+	validateCTPlatform string
+)
+
+func init() {
+	cmdValidateConfig.Flags().BoolVar(&validateStrict, "strict", false, "fail on warnings")
+	cmdValidateConfig.Flags().StringVar(&validateCTPlatform, "ct-platform", "", "platform to render Container Linux Configs for")
+	root.AddCommand(cmdValidateConfig)
+}
+
+func runValidateConfig(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		// default to stdin
+		args = append(args, "-")
+	}
+
+	failed := false
+	for _, arg := range args {
+		var data []byte
+		var err error
+		sourceName := arg
+		if arg == "-" {
+			sourceName = "stdin"
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(arg)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			failed = true
+			continue
+		}
+
+		rpt := conf.Unknown(string(data)).Validate(validateCTPlatform)
+		for _, entry := range rpt.Entries {
+			if entry.Line != 0 {
+				fmt.Printf("%s:%v\n", sourceName, entry)
+			} else {
+				fmt.Printf("%s: %v\n", sourceName, entry)
+			}
+		}
+		if rpt.IsFatal() || (validateStrict && rpt.HasWarnings()) {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
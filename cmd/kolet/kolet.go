@@ -15,12 +15,14 @@
 package main
 
 import (
+	"io"
 	"os"
 
 	"github.com/coreos/pkg/capnslog"
 	"github.com/spf13/cobra"
 
 	"github.com/flatcar/mantle/cli"
+	"github.com/flatcar/mantle/kola/native"
 	"github.com/flatcar/mantle/kola/register"
 
 	// Register any tests that we may wish to execute in kolet.
@@ -41,6 +43,11 @@ var (
 		Short: "Run a given test's native function",
 		Run:   run,
 	}
+
+	// report results as kolet protocol messages, see kola/native
+	jsonOutput bool
+	// read JSON encoded arguments for the native test from stdin
+	argsStdin bool
 )
 
 func run(cmd *cobra.Command, args []string) {
@@ -49,23 +56,34 @@ func run(cmd *cobra.Command, args []string) {
 }
 
 func main() {
+	cmdRun.PersistentFlags().BoolVar(&jsonOutput, "json", false, "report results as kolet protocol messages")
+	cmdRun.PersistentFlags().BoolVar(&argsStdin, "args-stdin", false, "read JSON encoded arguments from stdin")
+
 	for testName, testObj := range register.Tests {
-		if len(testObj.NativeFuncs) == 0 {
+		natives := testObj.Natives()
+		if len(natives) == 0 {
 			continue
 		}
 		testCmd := &cobra.Command{
 			Use: testName + " [func]",
 			Run: run,
 		}
-		for nativeName := range testObj.NativeFuncs {
-			nativeFunc := testObj.NativeFuncs[nativeName]
+		for nativeName, nativeTest := range natives {
 			nativeRun := func(cmd *cobra.Command, args []string) {
 				if len(args) != 0 {
 					cmd.Usage()
 					os.Exit(2)
 				}
-				if err := nativeFunc(); err != nil {
-					plog.Fatal(err)
+				var nativeArgs []byte
+				if argsStdin {
+					var err error
+					nativeArgs, err = io.ReadAll(os.Stdin)
+					if err != nil {
+						plog.Fatalf("reading arguments: %v", err)
+					}
+				}
+				if !native.Main(os.Stdout, jsonOutput, nativeName, nativeArgs, nativeTest) {
+					os.Exit(1)
 				}
 				// Explicitly exit successfully.
 				os.Exit(0)
@@ -0,0 +1,46 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package akamai
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/akamai"
+	"github.com/flatcar/mantle/platform/api/akamai/akamaitest"
+)
+
+func TestGC(t *testing.T) {
+	srv := akamaitest.NewServer()
+	defer srv.Close()
+
+	mantle := []string{"mantle"}
+	srv.AddInstance("old", time.Now().Add(-6*time.Hour), mantle)
+	young := srv.AddInstance("young", time.Now(), mantle)
+
+	var err error
+	api, err = akamai.New(&akamai.Options{
+		Options:  &platform.Options{},
+		Token:    "token",
+		Region:   akamaitest.Region,
+		Endpoint: srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmdGC.SetContext(context.Background())
+	if err := cmdGC.ParseFlags([]string{"--duration", "5h"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGC(cmdGC, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if instances := srv.Instances(); len(instances) != 1 || instances[0].ID != young {
+		t.Errorf("unexpected instances after gc: %+v", instances)
+	}
+}
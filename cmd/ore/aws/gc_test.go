@@ -0,0 +1,50 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/aws"
+	"github.com/flatcar/mantle/platform/api/aws/awstest"
+)
+
+func TestGC(t *testing.T) {
+	srv := awstest.NewServer()
+	defer srv.Close()
+
+	mantle := map[string]string{"CreatedBy": "mantle"}
+	old := srv.AddInstance("old", time.Now().Add(-6*time.Hour), mantle)
+	srv.AddInstance("young", time.Now(), mantle)
+
+	var err error
+	API, err = aws.New(&aws.Options{
+		Options:     &platform.Options{},
+		Region:      awstest.Region,
+		AccessKeyID: awstest.AccessKeyID,
+		SecretKey:   awstest.SecretKey,
+		Endpoint:    srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmdGC.ParseFlags([]string{"--duration", "5h"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGC(cmdGC, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, inst := range srv.Instances() {
+		terminated := *inst.State.Name == ec2.InstanceStateNameTerminated
+		if terminated != (*inst.InstanceId == old) {
+			t.Errorf("unexpected state of %s after gc: %s", *inst.InstanceId, *inst.State.Name)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package do
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/do"
+	"github.com/flatcar/mantle/platform/api/do/dotest"
+)
+
+func TestGC(t *testing.T) {
+	srv := dotest.NewServer()
+	defer srv.Close()
+
+	srv.AddDroplet("old", time.Now().Add(-6*time.Hour), []string{"mantle"})
+	young := srv.AddDroplet("young", time.Now(), []string{"mantle"})
+
+	var err error
+	API, err = do.New(&do.Options{
+		Options:     &platform.Options{},
+		AccessToken: "token",
+		Region:      "nyc3",
+		Endpoint:    srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmdGC.ParseFlags([]string{"--duration", "5h"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGC(cmdGC, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if droplets := srv.Droplets(); len(droplets) != 1 || droplets[0].ID != young {
+		t.Errorf("unexpected droplets after gc: %+v", droplets)
+	}
+}
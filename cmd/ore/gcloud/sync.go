@@ -36,8 +36,13 @@ var (
 	syncIndexTitle string
 	cmdSync        = &cobra.Command{
 		Use:   "sync gs://src/foo gs://dst/bar",
-		Short: "Copy objects between GS buckets",
+		Short: "Copy objects between buckets",
 		Run:   runSync,
+		Long: `Copy objects between Google Storage buckets.
+
+Either bucket may also be an S3 bucket (s3://bucket/prefix), configured
+like the AWS CLI and with $AWS_ENDPOINT_URL for S3-compatible services, or
+a local directory (file:///path).`,
 	}
 )
 
@@ -61,7 +66,7 @@ func init() {
 
 func runSync(cmd *cobra.Command, args []string) {
 	if len(args) != 2 {
-		fmt.Fprintf(os.Stderr, "Expected exactly two gs:// URLs. Got: %v\n", args)
+		fmt.Fprintf(os.Stderr, "Expected exactly two bucket URLs. Got: %v\n", args)
 		os.Exit(2)
 	}
 
@@ -0,0 +1,46 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package hetzner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/hetzner"
+	"github.com/flatcar/mantle/platform/api/hetzner/hetznertest"
+)
+
+func TestGC(t *testing.T) {
+	srv := hetznertest.NewServer()
+	defer srv.Close()
+
+	mantle := map[string]string{"managed-by": "mantle"}
+	srv.AddServer("old", time.Now().Add(-6*time.Hour), mantle)
+	young := srv.AddServer("young", time.Now(), mantle)
+
+	var err error
+	API, err = hetzner.New(&hetzner.Options{
+		Options:    &platform.Options{},
+		ServerType: hetznertest.ServerType,
+		Location:   hetznertest.Location,
+		Endpoint:   srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmdGC.SetContext(context.Background())
+	if err := cmdGC.ParseFlags([]string{"--duration", "5h"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGC(cmdGC, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if servers := srv.Servers(); len(servers) != 1 || servers[0].ID != young {
+		t.Errorf("unexpected servers after gc: %+v", servers)
+	}
+}
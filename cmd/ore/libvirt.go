@@ -0,0 +1,12 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"github.com/flatcar/mantle/cmd/ore/libvirt"
+)
+
+func init() {
+	root.AddCommand(libvirt.Libvirt)
+}
@@ -0,0 +1,40 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package libvirt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdGC = &cobra.Command{
+		Use:   "gc",
+		Short: "GC resources in libvirt",
+		Long: `Delete domains, volumes and networks created over the given duration ago.
+
+Volumes and networks are only deleted if their name starts with the given
+prefix and no remaining domain uses them.`,
+		RunE: runGC,
+	}
+
+	gcDuration time.Duration
+	gcPrefix   string
+)
+
+func init() {
+	Libvirt.AddCommand(cmdGC)
+	cmdGC.Flags().DurationVar(&gcDuration, "duration", 5*time.Hour, "how old resources must be before they're considered garbage")
+	cmdGC.Flags().StringVar(&gcPrefix, "prefix", "kola-", "name prefix of volumes and networks to delete")
+}
+
+func runGC(cmd *cobra.Command, args []string) error {
+	if err := API.GC(gcPrefix, gcDuration); err != nil {
+		return fmt.Errorf("running garbage collection: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package libvirt
+
+import (
+	"fmt"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar/mantle/cli"
+	"github.com/flatcar/mantle/platform/api/libvirt"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "ore/libvirt")
+
+	Libvirt = &cobra.Command{
+		Use:   "libvirt [command]",
+		Short: "libvirt image utilities",
+	}
+
+	API     *libvirt.API
+	options libvirt.Options
+)
+
+func init() {
+	cli.WrapPreRun(Libvirt, preflightCheck)
+	Libvirt.PersistentFlags().StringVar(&options.URI, "libvirt-uri", "qemu:///system", "libvirt connection URI")
+	Libvirt.PersistentFlags().StringVar(&options.Pool, "libvirt-pool", "default", "libvirt storage pool")
+}
+
+func preflightCheck(cmd *cobra.Command, args []string) error {
+	api, err := libvirt.New(&options)
+	if err != nil {
+		return fmt.Errorf("creating the libvirt API client: %w", err)
+	}
+
+	API = api
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package libvirt
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdUpload = &cobra.Command{
+		Use:   "upload-image",
+		Short: "Upload an image to a libvirt storage pool",
+		Long: `Upload a Flatcar image to a libvirt storage pool.
+
+The volume name is printed and can be passed to kola with --libvirt-image.`,
+		RunE: runUpload,
+	}
+
+	uploadFile  string
+	uploadName  string
+	uploadForce bool
+)
+
+func init() {
+	Libvirt.AddCommand(cmdUpload)
+	cmdUpload.Flags().StringVar(&uploadFile, "file", "flatcar_production_qemu_image.img", "path to the image to upload")
+	cmdUpload.Flags().StringVar(&uploadName, "name", "", "name of the volume (default: file name)")
+	cmdUpload.Flags().BoolVar(&uploadForce, "force", false, "replace an existing volume")
+}
+
+func runUpload(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unrecognized args in libvirt upload-image cmd: %v", args)
+	}
+
+	name := uploadName
+	if name == "" {
+		name = filepath.Base(uploadFile)
+	}
+
+	volumes, err := API.ListVolumes()
+	if err != nil {
+		return fmt.Errorf("listing volumes: %w", err)
+	}
+	for _, vol := range volumes {
+		if vol != name {
+			continue
+		}
+		if !uploadForce {
+			return fmt.Errorf("volume %q already exists, use --force to replace it", name)
+		}
+		plog.Infof("deleting existing volume %v", name)
+		if err := API.DeleteVolume(name); err != nil {
+			return fmt.Errorf("deleting volume %v: %w", name, err)
+		}
+	}
+
+	plog.Infof("uploading %v to volume %v", uploadFile, name)
+	if err := API.UploadVolume(name, uploadFile); err != nil {
+		return fmt.Errorf("uploading image: %w", err)
+	}
+
+	fmt.Println(name)
+	return nil
+}
@@ -0,0 +1,10 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import "github.com/flatcar/mantle/cmd/ore/payload"
+
+func init() {
+	root.AddCommand(payload.Payload)
+}
@@ -0,0 +1,62 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package payload
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar/mantle/update"
+)
+
+var (
+	cmdExtract = &cobra.Command{
+		Use:   "extract PAYLOAD",
+		Short: "Apply an update payload to produce its images",
+		Long: `Write the /usr partition image and optionally the kernel contained in
+an update payload. Delta payloads require the source /usr image they
+were generated against.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runExtract,
+	}
+
+	extractSource string
+	extractOutput string
+	extractKernel string
+	extractKeys   []string
+)
+
+func init() {
+	Payload.AddCommand(cmdExtract)
+	cmdExtract.Flags().StringVar(&extractSource, "source", "", "source /usr image, required for delta payloads")
+	cmdExtract.Flags().StringVar(&extractOutput, "output", "usr.img", "where to write the /usr image")
+	cmdExtract.Flags().StringVar(&extractKernel, "kernel", "", "where to write the kernel, if included")
+	cmdExtract.Flags().StringSliceVar(&extractKeys, "key", nil, "PEM public key to verify signatures with, may be repeated (default: the developer key)")
+}
+
+func runExtract(cmd *cobra.Command, args []string) error {
+	verifier, err := loadVerifier(extractKeys)
+	if err != nil {
+		return err
+	}
+
+	updater := update.Updater{
+		SrcPartition: extractSource,
+		DstPartition: extractOutput,
+		DstKernel:    extractKernel,
+		Verifier:     verifier,
+	}
+	if err := updater.OpenPayload(args[0]); err != nil {
+		return err
+	}
+	if err := updater.Update(); err != nil {
+		return fmt.Errorf("applying %s: %v", args[0], err)
+	}
+	plog.Noticef("Wrote %s", extractOutput)
+	if extractKernel != "" {
+		plog.Noticef("Wrote %s", extractKernel)
+	}
+	return nil
+}
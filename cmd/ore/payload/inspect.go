@@ -0,0 +1,89 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package payload
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar/mantle/update"
+)
+
+var (
+	cmdInspect = &cobra.Command{
+		Use:   "inspect PAYLOAD",
+		Short: "Describe an update payload",
+		Long: `Print the header, manifest and signatures of an update payload,
+summarizing the operations of each procedure.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runInspect,
+	}
+
+	inspectJSON bool
+)
+
+func init() {
+	Payload.AddCommand(cmdInspect)
+	cmdInspect.Flags().BoolVar(&inspectJSON, "json", false, "output JSON")
+}
+
+func runInspect(cmd *cobra.Command, args []string) error {
+	p, f, err := openPayload(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := p.ReadSignatures(); err != nil {
+		return fmt.Errorf("reading signatures: %v", err)
+	}
+	info := p.Info()
+
+	if inspectJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+	return printInfo(os.Stdout, info)
+}
+
+func printInfo(out io.Writer, info *update.Info) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Version:\t%d\n", info.Version)
+	fmt.Fprintf(w, "Manifest size:\t%d\n", info.ManifestSize)
+	fmt.Fprintf(w, "Block size:\t%d\n", info.BlockSize)
+	fmt.Fprintf(w, "Signatures:\t%d bytes at offset %d\n", info.SignaturesSize, info.SignaturesOffset)
+	for i, sig := range info.Signatures {
+		fmt.Fprintf(w, "  %d:\tversion %d, %d bytes\n", i, sig.Version, sig.Size)
+	}
+
+	for _, proc := range info.Procedures {
+		fmt.Fprintf(w, "\nProcedure %s:\n", proc.Type)
+		if proc.OldInfo != nil {
+			fmt.Fprintf(w, "  Old:\t%d bytes, sha256 %s\n", proc.OldInfo.Size, proc.OldInfo.Hash)
+		} else {
+			fmt.Fprintf(w, "  Old:\tnone, full update\n")
+		}
+		if proc.NewInfo != nil {
+			fmt.Fprintf(w, "  New:\t%d bytes, sha256 %s\n", proc.NewInfo.Size, proc.NewInfo.Hash)
+		}
+		fmt.Fprintf(w, "  Operation\tCount\tBlocks\tData\n")
+		types := make([]string, 0, len(proc.Operations))
+		for typ := range proc.Operations {
+			types = append(types, typ)
+		}
+		slices.Sort(types)
+		for _, typ := range types {
+			ops := proc.Operations[typ]
+			fmt.Fprintf(w, "  %s\t%d\t%d\t%d\n", typ, ops.Count, ops.Blocks, ops.DataSize)
+		}
+	}
+	return w.Flush()
+}
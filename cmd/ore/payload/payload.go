@@ -0,0 +1,49 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package payload
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar/mantle/update"
+	"github.com/flatcar/mantle/update/signature"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "ore/payload")
+
+	Payload = &cobra.Command{
+		Use:   "payload [command]",
+		Short: "update payload utilities",
+	}
+)
+
+// openPayload opens the payload file, reading its header and manifest.
+// The file must be closed by the caller.
+func openPayload(path string) (*update.Payload, *os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := update.NewPayloadFrom(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("reading payload %s: %v", path, err)
+	}
+	return p, f, nil
+}
+
+// loadVerifier returns a verifier for the public keys at paths, or the
+// developer key if there are none.
+func loadVerifier(paths []string) (*signature.Verifier, error) {
+	if len(paths) == 0 {
+		plog.Notice("No keys given, verifying with the developer key")
+		return signature.DeveloperVerifier, nil
+	}
+	return signature.LoadVerifier(paths...)
+}
@@ -0,0 +1,50 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package payload
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdVerify = &cobra.Command{
+		Use:   "verify PAYLOAD",
+		Short: "Verify an update payload",
+		Long: `Check the data hash of every operation of an update payload and its
+signatures. Like update_engine, the payload is accepted if any of its
+signatures is valid for one of the given public keys; other signatures,
+e.g. by keys being rotated out, are ignored.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runVerify,
+	}
+
+	verifyKeys []string
+)
+
+func init() {
+	Payload.AddCommand(cmdVerify)
+	cmdVerify.Flags().StringSliceVar(&verifyKeys, "key", nil, "PEM public key to verify signatures with, may be repeated (default: the developer key)")
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	verifier, err := loadVerifier(verifyKeys)
+	if err != nil {
+		return err
+	}
+
+	p, f, err := openPayload(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	p.Verifier = verifier
+	if err := p.Verify(); err != nil {
+		return fmt.Errorf("verifying %s: %v", args[0], err)
+	}
+	fmt.Printf("%s: OK\n", args[0])
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package scaleway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/scaleway"
+	"github.com/flatcar/mantle/platform/api/scaleway/scalewaytest"
+)
+
+func TestGC(t *testing.T) {
+	srv := scalewaytest.NewServer()
+	defer srv.Close()
+
+	mantle := []string{"mantle"}
+	srv.AddServer("old", time.Now().Add(-6*time.Hour), mantle)
+	young := srv.AddServer("young", time.Now(), mantle)
+
+	var err error
+	API, err = scaleway.New(&scaleway.Options{
+		Options:        &platform.Options{},
+		AccessKey:      scalewaytest.AccessKey,
+		SecretKey:      scalewaytest.SecretKey,
+		OrganizationID: scalewaytest.OrganizationID,
+		Region:         scalewaytest.Region,
+		Zone:           scalewaytest.Zone,
+		Endpoint:       srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmdGC.ParseFlags([]string{"--duration", "5h"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGC(cmdGC, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if servers := srv.Servers(); len(servers) != 1 || servers[0].ID != young {
+		t.Errorf("unexpected servers after gc: %+v", servers)
+	}
+}
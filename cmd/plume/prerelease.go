@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -194,11 +195,11 @@ func runCLPreRelease(cmd *cobra.Command) error {
 
 // getImageFile downloads a bzipped Flatcar image, verifies its signature,
 // decompresses it, and returns the decompressed path.
-func getImageFile(client *http.Client, spec *channelSpec, src *storage.Bucket, fileName string) (string, error) {
-	return getCLImageFile(client, src, fileName)
+func getImageFile(ctx context.Context, client *http.Client, spec *channelSpec, src *storage.Bucket, fileName string) (string, error) {
+	return getCLImageFile(ctx, client, src, fileName)
 }
 
-func getCLImageFile(client *http.Client, src *storage.Bucket, fileName string) (string, error) {
+func getCLImageFile(ctx context.Context, client *http.Client, src *storage.Bucket, fileName string) (string, error) {
 	cacheDir := filepath.Join(sdk.RepoCache(), "images", specChannel, specBoard, specVersion)
 	bzipPath := filepath.Join(cacheDir, fileName)
 	imagePath := strings.TrimSuffix(bzipPath, filepath.Ext(bzipPath))
@@ -214,17 +215,30 @@ func getCLImageFile(client *http.Client, src *storage.Bucket, fileName string) (
 		}
 	}
 
-	bzipUri, err := url.Parse(fileName)
-	if err != nil {
-		return "", err
-	}
+	if scheme := src.URL().Scheme; scheme == "http" || scheme == "https" {
+		bzipUri, err := url.Parse(fileName)
+		if err != nil {
+			return "", err
+		}
 
-	bzipUri = src.URL().ResolveReference(bzipUri)
+		bzipUri = src.URL().ResolveReference(bzipUri)
 
-	plog.Printf("Downloading image %q to %q", bzipUri, bzipPath)
+		plog.Printf("Downloading image %q to %q", bzipUri, bzipPath)
 
-	if err := sdk.UpdateSignedFile(bzipPath, bzipUri.String(), client, verifyKeyFile); err != nil {
-		return "", err
+		if err := sdk.UpdateSignedFile(bzipPath, bzipUri.String(), client, verifyKeyFile); err != nil {
+			return "", err
+		}
+	} else {
+		// fetch the image in parallel, checked against its hashes
+		bzipName := path.Join(src.Prefix(), fileName)
+		for _, name := range []string{bzipName + ".sig", bzipName} {
+			if err := src.Download(ctx, name, filepath.Join(cacheDir, path.Base(name))); err != nil {
+				return "", err
+			}
+		}
+		if err := sdk.VerifyFile(bzipPath, verifyKeyFile); err != nil {
+			return "", err
+		}
 	}
 
 	// decompress it
@@ -287,7 +301,7 @@ func azurePreRelease(ctx context.Context, client *http.Client, src *storage.Buck
 	}
 
 	// download azure vhd image and unzip it
-	vhdfile, err := getImageFile(client, spec, src, specAzure.Image)
+	vhdfile, err := getImageFile(ctx, client, spec, src, specAzure.Image)
 	if err != nil {
 		return err
 	}
@@ -602,7 +616,7 @@ func awsPreRelease(ctx context.Context, client *http.Client, src *storage.Bucket
 
 	imageFileName := awsImageMetadata["imageFileName"]
 
-	imagePath, err := getImageFile(client, spec, src, imageFileName)
+	imagePath, err := getImageFile(ctx, client, spec, src, imageFileName)
 	if err != nil {
 		return err
 	}
@@ -132,6 +132,28 @@ func TestSubTests(t *testing.T) {
 				})
 			})
 		},
+	}, {
+		desc:   "allowed failure doesn't propagate upwards",
+		chatty: true,
+		output: `
+=== RUN   allowed failure doesn't propagate upwards
+=== RUN   allowed failure doesn't propagate upwards/known
+=== RUN   allowed failure doesn't propagate upwards/known/sub
+--- PASS: allowed failure doesn't propagate upwards (N.NNs)
+    --- KNOWN-FAIL: allowed failure doesn't propagate upwards/known (N.NNs)
+        --- FAIL: allowed failure doesn't propagate upwards/known/sub (N.NNs)
+		`,
+		f: func(t *H) {
+			t.Run("known", func(t *H) {
+				t.AllowFail("known issue")
+				t.Run("sub", func(t *H) {
+					t.Fail()
+				})
+			})
+			if t.Failed() {
+				realTest.Error("allowed failure propagated")
+			}
+		},
 	}, {
 		desc:   "skipping without message, chatty",
 		chatty: true,
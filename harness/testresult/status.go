@@ -18,6 +18,10 @@ const (
 	Fail TestResult = "FAIL"
 	Skip TestResult = "SKIP"
 	Pass TestResult = "PASS"
+
+	// KnownFail is the result of a failed test which was expected to
+	// fail, see H.AllowFail.
+	KnownFail TestResult = "KNOWN-FAIL"
 )
 
 type TestResult string
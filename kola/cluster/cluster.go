@@ -17,6 +17,7 @@ package cluster
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -24,6 +25,7 @@ import (
 
 	"github.com/coreos/pkg/capnslog"
 	"github.com/flatcar/mantle/harness"
+	"github.com/flatcar/mantle/kola/native"
 	"github.com/flatcar/mantle/platform"
 )
 
@@ -37,6 +39,10 @@ type TestCluster struct {
 	*harness.H
 	platform.Cluster
 	NativeFuncs []string
+	NativeArgs  map[string]interface{}
+	// TestName is the registered test kolet runs native functions of,
+	// the name of H if empty.
+	TestName string
 
 	// If set to true and a sub-test fails all future sub-tests will be skipped
 	FailFast   bool
@@ -59,11 +65,28 @@ func (t *TestCluster) Run(name string, f func(c TestCluster)) bool {
 
 }
 
-// RunNative runs a registered NativeFunc on a remote machine
-func (t *TestCluster) RunNative(funcName string, m platform.Machine) bool {
-	command := fmt.Sprintf("./kolet run %q %q", t.H.Name(), funcName)
+// RunNative runs a registered native function or test on a remote machine,
+// reporting its subtests, skips and artifacts as subtests of a test named
+// funcName. A native test may be passed one argument, which is encoded as
+// JSON, see native.WithArgs; the registered NativeArgs are used otherwise.
+func (t *TestCluster) RunNative(funcName string, m platform.Machine, args ...interface{}) bool {
+	testName := t.TestName
+	if testName == "" {
+		testName = t.H.Name()
+	}
+	command := fmt.Sprintf("./kolet run --json %q %q", testName, funcName)
 	logger.Infof("RunNative: running command %s", command)
 	return t.Run(funcName, func(c TestCluster) {
+		var nativeArgs interface{}
+		switch len(args) {
+		case 0:
+			nativeArgs = t.NativeArgs[funcName]
+		case 1:
+			nativeArgs = args[0]
+		default:
+			c.Fatalf("RunNative: got %d arguments, want at most one", len(args))
+		}
+
 		client, err := m.SSHClient()
 		if err != nil {
 			c.Fatalf("kolet SSH client: %v", err)
@@ -76,12 +99,38 @@ func (t *TestCluster) RunNative(funcName string, m platform.Machine) bool {
 		}
 		defer session.Close()
 
-		b, err := session.CombinedOutput(command)
-		b = bytes.TrimSpace(b)
-		if len(b) > 0 {
-			t.Logf("kolet:\n%s", b)
+		if nativeArgs != nil {
+			b, err := json.Marshal(nativeArgs)
+			if err != nil {
+				c.Fatalf("encoding kolet arguments: %v", err)
+			}
+			session.Stdin = bytes.NewReader(b)
+			command = fmt.Sprintf("./kolet run --json --args-stdin %q %q", testName, funcName)
 		}
+
+		var stderr bytes.Buffer
+		session.Stderr = &stderr
+		defer func() {
+			if b := bytes.TrimSpace(stderr.Bytes()); len(b) > 0 {
+				c.Logf("kolet:\n%s", b)
+			}
+		}()
+		stdout, err := session.StdoutPipe()
 		if err != nil {
+			c.Fatalf("kolet SSH session: %v", err)
+		}
+		if err := session.Start(command); err != nil {
+			c.Fatalf("kolet: %v", err)
+		}
+
+		ended := native.Replay(stdout, c.H)
+		err = session.Wait()
+		if !ended {
+			if err == nil {
+				err = fmt.Errorf("exited without reporting a result")
+			}
+			c.Errorf("kolet: %v", err)
+		} else if err != nil && !c.Failed() {
 			c.Errorf("kolet: %v", err)
 		}
 	})
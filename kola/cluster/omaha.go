@@ -0,0 +1,59 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cluster
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/flatcar/mantle/network/omaha"
+	"github.com/flatcar/mantle/platform"
+)
+
+// OmahaCluster is a cluster with a local Omaha server, such as qemu.
+type OmahaCluster interface {
+	GetOmahaServer() *omaha.Server
+}
+
+// OmahaServer returns the local Omaha server of the cluster or fails the
+// test.
+func (t *TestCluster) OmahaServer() *omaha.Server {
+	oc, ok := t.Cluster.(OmahaCluster)
+	if !ok || oc.GetOmahaServer() == nil {
+		t.Fatalf("platform has no local Omaha server")
+	}
+	return oc.GetOmahaServer()
+}
+
+// machineID returns the machine ID m reports to Omaha servers.
+func (t *TestCluster) machineID(m platform.Machine) string {
+	return strings.TrimSpace(string(t.MustSSH(m, "cat /etc/machine-id")))
+}
+
+// OmahaHistory returns the requests m made to the local Omaha server.
+func (t *TestCluster) OmahaHistory(m platform.Machine) []omaha.Record {
+	return t.OmahaServer().History(t.machineID(m))
+}
+
+// WaitForOmahaRecord waits up to timeout for a request of m to the local
+// Omaha server for which match returns true, including requests made
+// before the call, and returns it. It fails the test on timeout,
+// reporting the history of m.
+func (t *TestCluster) WaitForOmahaRecord(m platform.Machine, match func(omaha.Record) bool, timeout time.Duration) omaha.Record {
+	srv := t.OmahaServer()
+	machineID := t.machineID(m)
+
+	ctx, cancel := context.WithTimeout(t.Context(), timeout)
+	defer cancel()
+	r, err := srv.Wait(ctx, machineID, match)
+	if err != nil {
+		var history []string
+		for _, r := range srv.History(machineID) {
+			history = append(history, r.String())
+		}
+		t.Fatalf("machine %s: %v waiting for Omaha request, history:\n%s", m.ID(), err, strings.Join(history, "\n"))
+	}
+	return r
+}
@@ -0,0 +1,25 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cluster
+
+import (
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+
+	"github.com/flatcar/mantle/kola/state"
+	"github.com/flatcar/mantle/platform"
+)
+
+// AssertState gathers the state of m described by spec in a single SSH
+// session and fails the test listing all mismatches.
+func (t *TestCluster) AssertState(m platform.Machine, spec state.Spec) {
+	out, err := t.SSH(m, "sudo sh -c "+shellquote.Join(spec.Script()))
+	if err != nil {
+		t.Fatalf("machine %s: gathering state: %v", m.ID(), err)
+	}
+	if mismatches := spec.Check(string(out)); len(mismatches) != 0 {
+		t.Fatalf("machine %s doesn't have the expected state:\n%s", m.ID(), strings.Join(mismatches, "\n"))
+	}
+}
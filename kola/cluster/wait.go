@@ -0,0 +1,95 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/flatcar/mantle/network/journal"
+	"github.com/flatcar/mantle/platform"
+)
+
+// machineJournal returns the journal recorder of m or fails the test.
+func (t *TestCluster) machineJournal(m platform.Machine) *platform.Journal {
+	jm, ok := m.(platform.JournalMachine)
+	if !ok || jm.Journal() == nil {
+		t.Fatalf("machine %s doesn't record its journal", m.ID())
+	}
+	return jm.Journal()
+}
+
+// WaitForJournalEntry waits up to timeout for an entry matching match in
+// the journal of m, including entries logged before the call, and
+// returns it. It fails the test on timeout, reporting the last entry.
+func (t *TestCluster) WaitForJournalEntry(m platform.Machine, match platform.JournalMatch, timeout time.Duration) journal.Entry {
+	ctx, cancel := context.WithTimeout(t.Context(), timeout)
+	defer cancel()
+
+	entry, err := t.machineJournal(m).WaitForEntry(ctx, match)
+	if err != nil {
+		t.Fatalf("machine %s: %v", m.ID(), err)
+	}
+	return entry
+}
+
+// WaitForUnitState waits up to timeout for unit on m to be in state, an
+// ActiveState such as "active", "inactive" or "failed". Changes are taken
+// from the journal, the unit is only queried over SSH before waiting and
+// on timeout. It fails the test on timeout, reporting the last state.
+func (t *TestCluster) WaitForUnitState(m platform.Machine, unit, state string, timeout time.Duration) {
+	current := func() string {
+		out, _ := t.SSH(m, fmt.Sprintf("systemctl show --property=ActiveState --value %q", unit))
+		return string(out)
+	}
+	if current() == state {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), timeout)
+	defer cancel()
+	if _, err := t.machineJournal(m).WaitForUnitState(ctx, unit, state); err == nil {
+		return
+	}
+	// units which log nothing about the change, e.g. when entering
+	// the state implicitly
+	if s := current(); s != state {
+		t.Fatalf("machine %s: unit %s not %s after %v: state %s", m.ID(), unit, state, timeout, s)
+	}
+}
+
+// waitRemote runs check on m once per second until it succeeds, in a
+// single SSH session, and returns the output of report if it doesn't
+// within timeout.
+func (t *TestCluster) waitRemote(m platform.Machine, check, report string, timeout time.Duration) (string, bool) {
+	secs := int((timeout + time.Second - 1) / time.Second)
+	cmd := fmt.Sprintf("for i in $(seq %d); do if %s; then exit 0; fi; sleep 1; done; %s; exit 1", secs, check, report)
+	out, err := t.SSH(m, cmd)
+	if err == nil {
+		return "", true
+	}
+	return strings.TrimSpace(string(out)), false
+}
+
+// WaitForFile waits up to timeout for path to exist on m. It fails the
+// test on timeout, reporting the contents of the parent directory.
+func (t *TestCluster) WaitForFile(m platform.Machine, path string, timeout time.Duration) {
+	check := fmt.Sprintf("test -e %q", path)
+	report := fmt.Sprintf("ls -la \"$(dirname %q)\" 2>&1", path)
+	if out, ok := t.waitRemote(m, check, report, timeout); !ok {
+		t.Fatalf("machine %s: %s doesn't exist after %v:\n%s", m.ID(), path, timeout, out)
+	}
+}
+
+// WaitForPort waits up to timeout for a TCP listener on port of m. It
+// fails the test on timeout, reporting the listening sockets.
+func (t *TestCluster) WaitForPort(m platform.Machine, port int, timeout time.Duration) {
+	check := fmt.Sprintf("ss -Hltn 'sport = :%d' | grep -q .", port)
+	report := "ss -Hltn"
+	if out, ok := t.waitRemote(m, check, report, timeout); !ok {
+		t.Fatalf("machine %s: nothing listening on port %d after %v:\n%s", m.ID(), port, timeout, out)
+	}
+}
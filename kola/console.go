@@ -0,0 +1,312 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package kola
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/coreos/go-semver/semver"
+	"gopkg.in/yaml.v3"
+
+	"github.com/flatcar/mantle/harness"
+	"github.com/flatcar/mantle/kola/register"
+)
+
+// Severities of console rules.
+const (
+	SeverityFail = "fail"
+	SeverityWarn = "warn"
+)
+
+// ConsoleScope restricts a console rule or suppression to tests,
+// platforms and versions. Empty fields match everything.
+type ConsoleScope struct {
+	Tests      []string `yaml:"tests"` // glob patterns
+	Platforms  []string `yaml:"platforms"`
+	MinVersion string   `yaml:"min_version"`
+	EndVersion string   `yaml:"end_version"` // exclusive
+}
+
+// ConsoleRule describes badness in console or journal output.
+type ConsoleRule struct {
+	Desc         string `yaml:"desc"`
+	Match        string `yaml:"match"`
+	SkipIfMatch  string `yaml:"skip_if_match"` // the rule doesn't apply if the output matches
+	Severity     string `yaml:"severity"`      // "fail" (the default) or "warn"
+	Issue        string `yaml:"issue"`
+	ConsoleScope `yaml:",inline"`
+
+	match       *regexp.Regexp
+	skipIfMatch *regexp.Regexp
+	skipFlag    *register.Flag
+}
+
+// ConsoleSuppression suppresses matches of rules caused by a known issue.
+type ConsoleSuppression struct {
+	Rule         string `yaml:"rule"`  // Desc of the rule, any rule if empty
+	Match        string `yaml:"match"` // matched against the text the rule matched
+	Issue        string `yaml:"issue"`
+	ConsoleScope `yaml:",inline"`
+
+	match *regexp.Regexp
+}
+
+// ConsoleRules are the rules and suppressions used to check console and
+// journal output.
+type ConsoleRules struct {
+	Rules        []ConsoleRule        `yaml:"rules"`
+	Suppressions []ConsoleSuppression `yaml:"suppressions"`
+}
+
+// ConsoleContext is what is being checked, for scoping rules.
+type ConsoleContext struct {
+	Test     *register.Test // its flags disable built-in rules
+	Platform string
+	Version  string
+}
+
+// ConsoleMatch is a rule matching some output.
+type ConsoleMatch struct {
+	Rule     string
+	Severity string
+	Issue    string
+	Text     string // the matched text
+	Detail   string // the first subexpression, if any
+	Line     int
+	// SuppressedBy is the issue of the suppression which applies, or
+	// "-" for suppressions without an issue.
+	SuppressedBy string
+}
+
+func (m ConsoleMatch) String() string {
+	s := m.Rule
+	if m.Detail != "" {
+		s += fmt.Sprintf(" (%s)", m.Detail)
+	}
+	if m.Issue != "" {
+		s += ", see " + m.Issue
+	}
+	return s
+}
+
+// ConsoleRulesFile is a file with additional console rules, see
+// LoadConsoleRules.
+var ConsoleRulesFile string
+
+// consoleRules are the built-in rules and those of ConsoleRulesFile,
+// loaded by RunTests.
+var consoleRules = builtinConsoleRules()
+
+func builtinConsoleRules() *ConsoleRules {
+	var rules ConsoleRules
+	for _, check := range consoleChecks {
+		rules.Rules = append(rules.Rules, ConsoleRule{
+			Desc:        check.desc,
+			Severity:    SeverityFail,
+			match:       check.match,
+			skipIfMatch: check.skipIfMatch,
+			skipFlag:    check.skipFlag,
+		})
+	}
+	return &rules
+}
+
+// LoadConsoleRules returns the built-in rules extended by the YAML rules
+// file at path, if set.
+func LoadConsoleRules(path string) (*ConsoleRules, error) {
+	rules := builtinConsoleRules()
+	if path == "" {
+		return rules, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var extra ConsoleRules
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&extra); err != nil {
+		return nil, fmt.Errorf("parsing console rules %s: %v", path, err)
+	}
+
+	for i := range extra.Rules {
+		r := &extra.Rules[i]
+		if r.Desc == "" || r.Match == "" {
+			return nil, fmt.Errorf("console rule %d: desc and match are required", i)
+		}
+		switch r.Severity {
+		case "":
+			r.Severity = SeverityFail
+		case SeverityFail, SeverityWarn:
+		default:
+			return nil, fmt.Errorf("console rule %q: unknown severity %q", r.Desc, r.Severity)
+		}
+		if r.match, err = regexp.Compile(r.Match); err != nil {
+			return nil, fmt.Errorf("console rule %q: %v", r.Desc, err)
+		}
+		if r.SkipIfMatch != "" {
+			if r.skipIfMatch, err = regexp.Compile(r.SkipIfMatch); err != nil {
+				return nil, fmt.Errorf("console rule %q: %v", r.Desc, err)
+			}
+		}
+		if err := r.ConsoleScope.validate(); err != nil {
+			return nil, fmt.Errorf("console rule %q: %v", r.Desc, err)
+		}
+	}
+	for i := range extra.Suppressions {
+		s := &extra.Suppressions[i]
+		if s.Match != "" {
+			if s.match, err = regexp.Compile(s.Match); err != nil {
+				return nil, fmt.Errorf("console suppression %d: %v", i, err)
+			}
+		}
+		if err := s.ConsoleScope.validate(); err != nil {
+			return nil, fmt.Errorf("console suppression %d: %v", i, err)
+		}
+	}
+
+	rules.Rules = append(rules.Rules, extra.Rules...)
+	rules.Suppressions = append(rules.Suppressions, extra.Suppressions...)
+	return rules, nil
+}
+
+func (s ConsoleScope) validate() error {
+	for _, v := range []string{s.MinVersion, s.EndVersion} {
+		if v == "" {
+			continue
+		}
+		if _, err := semver.NewVersion(v); err != nil {
+			return fmt.Errorf("invalid version %q: %v", v, err)
+		}
+	}
+	for _, pattern := range s.Tests {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid test pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+func (s ConsoleScope) applies(ctx ConsoleContext) bool {
+	if len(s.Tests) != 0 {
+		if ctx.Test == nil {
+			return false
+		}
+		var found bool
+		for _, pattern := range s.Tests {
+			if ok, _ := filepath.Match(pattern, ctx.Test.Name); ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(s.Platforms) != 0 && !slices.Contains(s.Platforms, ctx.Platform) {
+		return false
+	}
+	if s.MinVersion != "" || s.EndVersion != "" {
+		version, err := semver.NewVersion(ctx.Version)
+		if err != nil {
+			// an unknown version is in no range
+			return false
+		}
+		if s.MinVersion != "" && version.LessThan(*semver.New(s.MinVersion)) {
+			return false
+		}
+		if s.EndVersion != "" && !version.LessThan(*semver.New(s.EndVersion)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check returns the matches of the rules in output, including those
+// which are suppressed. For each rule the first unsuppressed occurrence
+// is returned, or the first occurrence if all of them are suppressed.
+func (rules *ConsoleRules) Check(output []byte, ctx ConsoleContext) []ConsoleMatch {
+	var ret []ConsoleMatch
+	for _, rule := range rules.Rules {
+		if rule.skipFlag != nil && ctx.Test != nil && ctx.Test.HasFlag(*rule.skipFlag) {
+			continue
+		}
+		if !rule.applies(ctx) {
+			continue
+		}
+		locs := rule.match.FindAllSubmatchIndex(output, -1)
+		if locs == nil {
+			continue
+		}
+		if rule.skipIfMatch != nil && rule.skipIfMatch.Match(output) {
+			continue
+		}
+		var first *ConsoleMatch
+		for _, loc := range locs {
+			m := ConsoleMatch{
+				Rule:     rule.Desc,
+				Severity: rule.Severity,
+				Issue:    rule.Issue,
+				Text:     string(output[loc[0]:loc[1]]),
+				Line:     bytes.Count(output[:loc[0]], []byte("\n")) + 1,
+			}
+			if len(loc) > 2 && loc[2] >= 0 {
+				// include first subexpression
+				m.Detail = string(output[loc[2]:loc[3]])
+			}
+			m.SuppressedBy = rules.suppression(rule, m.Text, ctx)
+			if first == nil || m.SuppressedBy == "" {
+				first = &m
+			}
+			if m.SuppressedBy == "" {
+				break
+			}
+		}
+		ret = append(ret, *first)
+	}
+	return ret
+}
+
+// suppression returns the issue of the first suppression covering text
+// matched by rule, "-" if it has none, or "" if text isn't suppressed.
+func (rules *ConsoleRules) suppression(rule ConsoleRule, text string, ctx ConsoleContext) string {
+	for _, s := range rules.Suppressions {
+		if s.Rule != "" && s.Rule != rule.Desc {
+			continue
+		}
+		if s.match != nil && !s.match.MatchString(text) {
+			continue
+		}
+		if !s.applies(ctx) {
+			continue
+		}
+		if s.Issue == "" {
+			return "-"
+		}
+		return s.Issue
+	}
+	return ""
+}
+
+// reportConsole reports the matches of the console rules in the output
+// of a machine to h. Matches of rules with "warn" severity and
+// suppressed matches are only logged.
+func reportConsole(h *harness.H, output []byte, ctx ConsoleContext, where string) {
+	for _, m := range consoleRules.Check(output, ctx) {
+		switch {
+		case m.SuppressedBy != "":
+			h.Logf("Found %s on %s line %d, suppressed as known issue %s", m, where, m.Line, m.SuppressedBy)
+		case m.Severity == SeverityWarn:
+			h.Logf("Warning: found %s on %s line %d", m, where, m.Line)
+		default:
+			h.Errorf("Found %s on %s line %d", m, where, m.Line)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package kola
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/flatcar/mantle/kola/register"
+)
+
+func writeRules(t *testing.T, rules string) string {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConsoleRules(t *testing.T) {
+	rules, err := LoadConsoleRules(writeRules(t, `
+rules:
+  - desc: disk error
+    match: 'I/O error, dev (\w+)'
+    issue: https://example.com/issues/1
+  - desc: slow boot
+    match: 'boot took \d+s'
+    severity: warn
+    platforms: [qemu]
+suppressions:
+  - rule: disk error
+    match: dev vdb
+    tests: [cl.disk.*]
+    min_version: 3000.0.0
+    end_version: 3100.0.0
+    issue: https://example.com/issues/2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := []byte("booting\nboot took 90s\nI/O error, dev vdb, sector 0\n")
+	test := &register.Test{Name: "cl.disk.raid"}
+
+	got := rules.Check(output, ConsoleContext{Test: test, Platform: "qemu", Version: "3033.1.0+build"})
+	expect := []ConsoleMatch{
+		{
+			Rule:         "disk error",
+			Severity:     SeverityFail,
+			Issue:        "https://example.com/issues/1",
+			Text:         "I/O error, dev vdb",
+			Detail:       "vdb",
+			Line:         3,
+			SuppressedBy: "https://example.com/issues/2",
+		},
+		{
+			Rule:     "slow boot",
+			Severity: SeverityWarn,
+			Text:     "boot took 90s",
+			Line:     2,
+		},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got %+v, want %+v", got, expect)
+	}
+
+	// a suppressed occurrence doesn't hide a later unsuppressed one
+	got = rules.Check([]byte("I/O error, dev vdb\nI/O error, dev vda\n"), ConsoleContext{Test: test, Platform: "qemu", Version: "3033.1.0"})
+	if len(got) != 1 || got[0].SuppressedBy != "" || got[0].Detail != "vda" || got[0].Line != 2 {
+		t.Errorf("got %+v", got)
+	}
+
+	// out of scope of the suppression and the warning
+	got = rules.Check(output, ConsoleContext{Test: test, Platform: "aws", Version: "3100.0.0"})
+	if len(got) != 1 || got[0].SuppressedBy != "" {
+		t.Errorf("got %+v", got)
+	}
+	if s := got[0].String(); s != "disk error (vdb), see https://example.com/issues/1" {
+		t.Errorf("got %q", s)
+	}
+}
+
+func TestConsoleRulesBuiltin(t *testing.T) {
+	rules, err := LoadConsoleRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := rules.Check([]byte("x\nKernel panic - not syncing: oops\n"), ConsoleContext{})
+	if len(got) != 1 || got[0].Line != 2 || got[0].Severity != SeverityFail {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestLoadConsoleRulesInvalid(t *testing.T) {
+	for _, rules := range []string{
+		"rules:\n  - desc: a\n",
+		"rules:\n  - desc: a\n    match: b\n    severity: fatal\n",
+		"rules:\n  - desc: a\n    match: '('\n",
+		"suppressions:\n  - min_version: three\n",
+		"suppressions:\n  - issu: typo\n",
+	} {
+		if _, err := LoadConsoleRules(writeRules(t, rules)); err == nil {
+			t.Errorf("rules accepted:\n%s", rules)
+		}
+	}
+}
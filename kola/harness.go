@@ -47,6 +47,7 @@ import (
 	esxapi "github.com/flatcar/mantle/platform/api/esx"
 	gcloudapi "github.com/flatcar/mantle/platform/api/gcloud"
 	hetznerapi "github.com/flatcar/mantle/platform/api/hetzner"
+	libvirtapi "github.com/flatcar/mantle/platform/api/libvirt"
 	openstackapi "github.com/flatcar/mantle/platform/api/openstack"
 	oraclecloudapi "github.com/flatcar/mantle/platform/api/oraclecloud"
 	scalewayapi "github.com/flatcar/mantle/platform/api/scaleway"
@@ -61,6 +62,8 @@ import (
 	"github.com/flatcar/mantle/platform/machine/external"
 	"github.com/flatcar/mantle/platform/machine/gcloud"
 	"github.com/flatcar/mantle/platform/machine/hetzner"
+	"github.com/flatcar/mantle/platform/machine/libvirt"
+	"github.com/flatcar/mantle/platform/machine/microvm"
 	"github.com/flatcar/mantle/platform/machine/openstack"
 	"github.com/flatcar/mantle/platform/machine/oraclecloud"
 	"github.com/flatcar/mantle/platform/machine/qemu"
@@ -91,6 +94,8 @@ var (
 	QEMUOptions        = qemu.Options{Options: &Options}           // glue to set platform options from main
 	ScalewayOptions    = scalewayapi.Options{Options: &Options}    // glue to set platform options from main
 	HetznerOptions     = hetznerapi.Options{Options: &Options}     // glue to set platform options from main
+	LibvirtOptions     = libvirtapi.Options{Options: &Options}     // glue to set platform options from main
+	MicroVMOptions     = microvm.Options{Options: &Options}        // glue to set platform options from main
 
 	TestParallelism        int    //glue var to set test parallelism from main
 	TAPFile                string // if not "", write TAP results here
@@ -267,6 +272,10 @@ func NewFlight(pltfrm string) (flight platform.Flight, err error) {
 		flight, err = gcloud.NewFlight(&GCEOptions)
 	case "hetzner":
 		flight, err = hetzner.NewFlight(&HetznerOptions)
+	case "libvirt":
+		flight, err = libvirt.NewFlight(&LibvirtOptions)
+	case "microvm":
+		flight, err = microvm.NewFlight(&MicroVMOptions)
 	case "openstack":
 		flight, err = openstack.NewFlight(&OpenStackOptions)
 	case "oraclecloud":
@@ -300,6 +309,11 @@ func hasPattern(patterns []string) bool {
 func FilterTests(tests map[string]*register.Test, patterns []string, channel, offering string, pltfrm string, version semver.Version) (map[string]*register.Test, error) {
 	r := make(map[string]*register.Test)
 
+	knownIssues, err := loadKnownIssues()
+	if err != nil {
+		return nil, err
+	}
+
 	checkPlatforms := []string{pltfrm}
 
 	// qemu-unpriv has the same restrictions as QEMU but might also want additional restrictions due to the lack of a Local cluster
@@ -386,6 +400,11 @@ func FilterTests(tests map[string]*register.Test, patterns []string, channel, of
 			continue
 		}
 
+		if k := knownIssues.Lookup(t.Name, pltfrm, architecture(pltfrm), channel, version, time.Now()); k != nil && k.Action == KnownIssueSkip {
+			plog.Infof("Skipping %s because of known issue %s", t.Name, k.Issue)
+			continue
+		}
+
 		r[name] = t
 	}
 
@@ -444,6 +463,24 @@ func RunTests(patterns []string, channel, offering, pltfrm, outputDir string, ss
 		torcxManifestFile.Close()
 	}
 
+	rules, err := LoadConsoleRules(ConsoleRulesFile)
+	if err != nil {
+		return fmt.Errorf("loading console rules: %v", err)
+	}
+	consoleRules = rules
+
+	knownIssues, err := loadKnownIssues()
+	if err != nil {
+		return err
+	}
+	for _, k := range knownIssues.Expired(time.Now()) {
+		plog.Warningf("Known issue %s for %s expired on %s, it is ignored", k.Issue, strings.Join(k.Tests, ", "), k.Expires)
+	}
+
+	if err := filterUpgradeTests(channel, offering, pltfrm); err != nil {
+		return fmt.Errorf("upgrade path: %v", err)
+	}
+
 	flight, err := NewFlight(pltfrm)
 	if err != nil {
 		plog.Fatalf("creating flight for RunTests failed: %v", err)
@@ -468,6 +505,12 @@ func RunTests(patterns []string, channel, offering, pltfrm, outputDir string, ss
 		haveVersion = true
 	}
 
+	if imageVersion != "" {
+		Options.Version = imageVersion
+	} else if haveVersion {
+		Options.Version = imageSemver.String()
+	}
+
 	tests, err := FilterTests(register.Tests, patterns, channel, offering, pltfrm, imageSemver)
 	if err != nil {
 		plog.Fatal(err)
@@ -498,6 +541,14 @@ func RunTests(patterns []string, channel, offering, pltfrm, outputDir string, ss
 		run := func(h *harness.H) {
 			runTest(h, test, pltfrm, flight, remove)
 		}
+		// tests with known issues to skip are already filtered out
+		if k := knownIssues.Lookup(test.Name, pltfrm, architecture(pltfrm), channel, imageSemver, time.Now()); k != nil && k.Action == KnownIssueAllowFail {
+			run = func(h *harness.H) {
+				h.AllowFail("known issue " + k.Issue)
+				h.Logf("Failures are expected because of known issue %s", k.Issue)
+				runTest(h, test, pltfrm, flight, remove)
+			}
+		}
 		htests.Add(test.Name, run)
 	}
 
@@ -616,24 +667,33 @@ func runTest(h *harness.H, t *register.Test, pltfrm string, flight platform.Flig
 		if remove {
 			c.Destroy()
 		}
+		ctx := ConsoleContext{Test: t, Platform: pltfrm, Version: Options.Version}
 		for id, output := range c.ConsoleOutput() {
-			for _, badness := range CheckConsole([]byte(output), t) {
-				h.Errorf("Found %s on machine %s console", badness, id)
-			}
+			reportConsole(h, []byte(output), ctx, fmt.Sprintf("machine %s console", id))
 		}
 		for id, output := range c.JournalOutput() {
-			for _, badness := range CheckConsole([]byte(output), t) {
-				h.Errorf("Found %s on machine %s journal", badness, id)
-			}
+			reportConsole(h, []byte(output), ctx, fmt.Sprintf("machine %s journal", id))
 		}
 	}()
 
 	if t.ClusterSize > 0 {
 		var userdata *conf.UserData
-		if Options.IgnitionVersion == "v2" {
+		if t.Config != nil {
+			target, err := conf.TargetForIgnitionVersion(Options.IgnitionVersion)
+			if err != nil {
+				h.Fatalf("Rendering config: %v", err)
+			}
+			userdata, err = t.Config.UserData(target)
+			if err != nil {
+				h.Fatalf("Rendering config: %v", err)
+			}
+		} else if Options.IgnitionVersion == "v2" {
 			userdata = t.UserData
 		} else if Options.IgnitionVersion == "v3" {
 			userdata = t.UserDataV3
+			if userdata == nil && t.TranslateV3 && t.UserData != nil && t.UserData.IsIgnitionCompatible() {
+				userdata = t.UserData.TranslateV3(nil)
+			}
 		}
 		if userdata != nil && userdata.Contains("$discovery") {
 			url, err := c.GetDiscoveryURL(t.ClusterSize)
@@ -654,7 +714,7 @@ func runTest(h *harness.H, t *register.Test, pltfrm string, flight platform.Flig
 
 	// pass along all registered native functions
 	var names []string
-	for k := range t.NativeFuncs {
+	for k := range t.Natives() {
 		names = append(names, k)
 	}
 
@@ -663,11 +723,12 @@ func runTest(h *harness.H, t *register.Test, pltfrm string, flight platform.Flig
 		H:           h,
 		Cluster:     c,
 		NativeFuncs: names,
+		NativeArgs:  t.NativeArgs,
 		FailFast:    t.FailFast,
 	}
 
 	// drop kolet binary on machines
-	if t.NativeFuncs != nil {
+	if len(names) != 0 {
 		ScpKolet(tcluster, architecture(pltfrm))
 	}
 
@@ -696,6 +757,12 @@ func architecture(pltfrm string) string {
 	if pltfrm == "hetzner" && HetznerOptions.Board != "" {
 		nativeArch = boardToArch(HetznerOptions.Board)
 	}
+	if pltfrm == "libvirt" && LibvirtOptions.Board != "" {
+		nativeArch = boardToArch(LibvirtOptions.Board)
+	}
+	if pltfrm == "microvm" && MicroVMOptions.Board != "" {
+		nativeArch = boardToArch(MicroVMOptions.Board)
+	}
 	if pltfrm == "oraclecloud" && OracleCloudOptions.Board != "" {
 		nativeArch = boardToArch(OracleCloudOptions.Board)
 	}
@@ -763,27 +830,13 @@ func ScpKolet(c cluster.TestCluster, mArch string) {
 
 // CheckConsole checks some console output for badness and returns short
 // descriptions of any badness it finds. If t is specified, its flags are
-// respected.
+// respected. Only unsuppressed matches of rules with "fail" severity are
+// returned, use ConsoleRules.Check for all matches.
 func CheckConsole(output []byte, t *register.Test) []string {
 	var ret []string
-	for _, check := range consoleChecks {
-		if check.skipFlag != nil && t != nil && t.HasFlag(*check.skipFlag) {
-			continue
-		}
-		match := check.match.FindSubmatch(output)
-		if match != nil {
-			if check.skipIfMatch != nil {
-				skipMatch := check.skipIfMatch.FindSubmatch(output)
-				if skipMatch != nil {
-					continue
-				}
-			}
-			badness := check.desc
-			if len(match) > 1 {
-				// include first subexpression
-				badness += fmt.Sprintf(" (%s)", match[1])
-			}
-			ret = append(ret, badness)
+	for _, m := range consoleRules.Check(output, ConsoleContext{Test: t, Version: Options.Version}) {
+		if m.Severity == SeverityFail && m.SuppressedBy == "" {
+			ret = append(ret, m.String())
 		}
 	}
 	return ret
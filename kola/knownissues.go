@@ -0,0 +1,170 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package kola
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"gopkg.in/yaml.v3"
+)
+
+// Actions of known issues.
+const (
+	// KnownIssueSkip skips the affected tests.
+	KnownIssueSkip = "skip"
+	// KnownIssueAllowFail runs the affected tests, reporting failures
+	// as known failures which don't fail the run.
+	KnownIssueAllowFail = "allow-fail"
+)
+
+// knownIssueDate is the format of KnownIssue.Expires.
+const knownIssueDate = "2006-01-02"
+
+// KnownIssue marks tests which are expected to fail because of a tracked
+// bug. Empty fields match everything.
+type KnownIssue struct {
+	Tests         []string `yaml:"tests"` // glob patterns
+	Platforms     []string `yaml:"platforms"`
+	Architectures []string `yaml:"architectures"`
+	Channels      []string `yaml:"channels"`
+	MinVersion    string   `yaml:"min_version"`
+	EndVersion    string   `yaml:"end_version"` // exclusive
+	Issue         string   `yaml:"issue"`
+	Expires       string   `yaml:"expires"` // YYYY-MM-DD, the entry is ignored from then on
+	Action        string   `yaml:"action"`  // "skip" or "allow-fail"
+
+	minVersion semver.Version
+	endVersion semver.Version
+	expires    time.Time
+}
+
+// KnownIssuesFile is a YAML file with a list of known issues, see
+// LoadKnownIssues.
+var KnownIssuesFile string
+
+// loadKnownIssues loads KnownIssuesFile, if set.
+func loadKnownIssues() (KnownIssues, error) {
+	if KnownIssuesFile == "" {
+		return nil, nil
+	}
+	issues, err := LoadKnownIssues(KnownIssuesFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading known issues: %v", err)
+	}
+	return issues, nil
+}
+
+// KnownIssues is a known-issue database.
+type KnownIssues []KnownIssue
+
+// LoadKnownIssues reads the known-issue database at path.
+func LoadKnownIssues(path string) (KnownIssues, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var issues KnownIssues
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&issues); err != nil {
+		return nil, fmt.Errorf("parsing known issues %s: %v", path, err)
+	}
+	for i := range issues {
+		if err := issues[i].parse(); err != nil {
+			return nil, fmt.Errorf("known issue %d: %v", i, err)
+		}
+	}
+	return issues, nil
+}
+
+func (k *KnownIssue) parse() error {
+	if k.Issue == "" {
+		return fmt.Errorf("issue is required")
+	}
+	if len(k.Tests) == 0 {
+		return fmt.Errorf("tests are required")
+	}
+	for _, pattern := range k.Tests {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid test pattern %q: %v", pattern, err)
+		}
+	}
+	switch k.Action {
+	case KnownIssueSkip, KnownIssueAllowFail:
+	default:
+		return fmt.Errorf("action must be %q or %q, not %q", KnownIssueSkip, KnownIssueAllowFail, k.Action)
+	}
+	if k.MinVersion != "" {
+		if err := k.minVersion.Set(k.MinVersion); err != nil {
+			return fmt.Errorf("invalid min_version: %v", err)
+		}
+	}
+	if k.EndVersion != "" {
+		if err := k.endVersion.Set(k.EndVersion); err != nil {
+			return fmt.Errorf("invalid end_version: %v", err)
+		}
+	}
+	if k.Expires != "" {
+		var err error
+		if k.expires, err = time.Parse(knownIssueDate, k.Expires); err != nil {
+			return fmt.Errorf("invalid expires: %v", err)
+		}
+	}
+	return nil
+}
+
+// Expired reports whether the entry is past its expiry date at now.
+func (k *KnownIssue) Expired(now time.Time) bool {
+	return !k.expires.IsZero() && !now.Before(k.expires)
+}
+
+// Expired returns the entries past their expiry date at now.
+func (issues KnownIssues) Expired(now time.Time) []*KnownIssue {
+	var ret []*KnownIssue
+	for i := range issues {
+		if issues[i].Expired(now) {
+			ret = append(ret, &issues[i])
+		}
+	}
+	return ret
+}
+
+// Lookup returns the first unexpired entry which applies to the test. A
+// zero version matches no entry with a version range.
+func (issues KnownIssues) Lookup(test, pltfrm, arch, channel string, version semver.Version, now time.Time) *KnownIssue {
+	for i := range issues {
+		k := &issues[i]
+		if k.Expired(now) {
+			continue
+		}
+		if !slices.ContainsFunc(k.Tests, func(pattern string) bool {
+			match, _ := filepath.Match(pattern, test)
+			return match
+		}) {
+			continue
+		}
+		if len(k.Platforms) != 0 && !slices.Contains(k.Platforms, pltfrm) {
+			continue
+		}
+		if len(k.Architectures) != 0 && !slices.Contains(k.Architectures, arch) {
+			continue
+		}
+		if len(k.Channels) != 0 && !slices.Contains(k.Channels, channel) {
+			continue
+		}
+		if k.MinVersion != "" || k.EndVersion != "" {
+			if version == (semver.Version{}) || versionOutsideRange(version, k.minVersion, k.endVersion) {
+				continue
+			}
+		}
+		return k
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package kola
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+
+	"github.com/flatcar/mantle/kola/register"
+)
+
+func TestKnownIssues(t *testing.T) {
+	issues, err := LoadKnownIssues(writeRules(t, `
+- tests: [cl.network.*]
+  platforms: [azure]
+  issue: https://example.com/issues/1
+  expires: 2024-01-01
+  action: skip
+- tests: [cl.network.*, cl.etcd]
+  architectures: [arm64]
+  channels: [alpha]
+  min_version: 3000.0.0
+  end_version: 3100.0.0
+  issue: https://example.com/issues/2
+  action: allow-fail
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if expired := issues.Expired(now); len(expired) != 1 || expired[0].Issue != "https://example.com/issues/1" {
+		t.Errorf("got expired %v", expired)
+	}
+	before := now.Add(-time.Hour)
+	version := *semver.New("3033.1.0")
+
+	for _, tc := range []struct {
+		test, pltfrm, arch, channel string
+		version                     semver.Version
+		now                         time.Time
+		issue                       string
+	}{
+		{"cl.network.listeners", "azure", "amd64", "stable", version, before, "https://example.com/issues/1"},
+		{"cl.network.listeners", "azure", "amd64", "stable", version, now, ""},
+		{"cl.network.listeners", "aws", "arm64", "alpha", version, now, "https://example.com/issues/2"},
+		{"cl.etcd", "aws", "arm64", "alpha", version, now, "https://example.com/issues/2"},
+		{"cl.etcd", "aws", "arm64", "alpha", *semver.New("3100.0.0"), now, ""},
+		{"cl.etcd", "aws", "arm64", "alpha", semver.Version{}, now, ""},
+		{"cl.etcd", "aws", "arm64", "beta", version, now, ""},
+		{"cl.etcd", "aws", "amd64", "alpha", version, now, ""},
+		{"cl.basic", "azure", "amd64", "stable", version, before, ""},
+	} {
+		k := issues.Lookup(tc.test, tc.pltfrm, tc.arch, tc.channel, tc.version, tc.now)
+		var issue string
+		if k != nil {
+			issue = k.Issue
+		}
+		if issue != tc.issue {
+			t.Errorf("%+v: got issue %q", tc, issue)
+		}
+	}
+}
+
+func TestLoadKnownIssuesInvalid(t *testing.T) {
+	for _, issues := range []string{
+		"- tests: [a]\n  action: skip\n",
+		"- tests: [a]\n  issue: x\n  action: ignore\n",
+		"- tests: ['[']\n  issue: x\n  action: skip\n",
+		"- tests: [a]\n  issue: x\n  action: skip\n  expires: tomorrow\n",
+		"- tests: [a]\n  issue: x\n  action: skip\n  end_version: three\n",
+		"- test: [a]\n  issue: x\n  action: skip\n",
+	} {
+		if _, err := LoadKnownIssues(writeRules(t, issues)); err == nil {
+			t.Errorf("known issues accepted:\n%s", issues)
+		}
+	}
+}
+
+func TestFilterTestsKnownIssues(t *testing.T) {
+	KnownIssuesFile = writeRules(t, `
+- tests: [cl.skipped]
+  platforms: [qemu]
+  issue: https://example.com/issues/1
+  action: skip
+- tests: [cl.failing]
+  issue: https://example.com/issues/2
+  action: allow-fail
+`)
+	defer func() { KnownIssuesFile = "" }()
+
+	tests := map[string]*register.Test{
+		"cl.skipped": {Name: "cl.skipped"},
+		"cl.failing": {Name: "cl.failing"},
+	}
+	got, err := FilterTests(tests, []string{"*"}, "stable", "basic", "qemu", semver.Version{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got["cl.failing"] == nil {
+		t.Errorf("got tests %v", got)
+	}
+
+	got, err = FilterTests(tests, []string{"*"}, "stable", "basic", "aws", semver.Version{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Errorf("got tests %v", got)
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package native implements native tests run by kolet on the machines and
+// the protocol kolet uses to report their results to kola.
+//
+// In protocol mode kolet writes one JSON encoded Message per line to
+// stdout. Messages apply to the innermost running test: "run" starts a
+// subtest of it, "pass", "fail" and "skip" end it, the first of them
+// ending the native function itself. Anything on stdout which isn't a
+// message is treated as a log line.
+package native
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Actions of a Message.
+const (
+	ActionLog      = "log"
+	ActionError    = "error"
+	ActionRun      = "run"
+	ActionPass     = "pass"
+	ActionFail     = "fail"
+	ActionSkip     = "skip"
+	ActionArtifact = "artifact"
+)
+
+// Message is a kolet protocol message.
+type Message struct {
+	Action string `json:"action"`
+	// Test is the name of the subtest started by "run".
+	Test string `json:"test,omitempty"`
+	// Output is the text of "log", "error" and "skip".
+	Output string `json:"output,omitempty"`
+	// Name and Data are the file name and contents of an "artifact".
+	Name string `json:"name,omitempty"`
+	Data []byte `json:"data,omitempty"`
+}
+
+// writer serializes the messages of a test and its subtests.
+type writer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	json bool
+}
+
+func (w *writer) send(depth int, msg Message) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.json {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			panic(err)
+		}
+		w.w.Write(append(b, '\n'))
+		return
+	}
+
+	// plain text for humans running kolet by hand
+	indent := strings.Repeat("    ", depth)
+	switch msg.Action {
+	case ActionLog, ActionError, ActionSkip:
+		if msg.Output == "" {
+			break
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(msg.Output, "\n"), "\n") {
+			fmt.Fprintf(w.w, "%s%s\n", indent, line)
+		}
+	case ActionRun:
+		fmt.Fprintf(w.w, "%s=== RUN %s\n", indent, msg.Test)
+	case ActionArtifact:
+		fmt.Fprintf(w.w, "%sartifact %s (%d bytes)\n", indent, msg.Name, len(msg.Data))
+	}
+	if msg.Action == ActionPass || msg.Action == ActionFail || msg.Action == ActionSkip {
+		fmt.Fprintf(w.w, "%s--- %s\n", indent, strings.ToUpper(msg.Action))
+	}
+}
+
+// T is passed to native tests, it mirrors the parts of harness.H which
+// make sense on a machine.
+type T struct {
+	w      *writer
+	name   string
+	depth  int
+	args   []byte
+	mu     sync.Mutex
+	failed bool
+	done   bool
+}
+
+// Name returns the name of the running (sub)test.
+func (t *T) Name() string {
+	return t.name
+}
+
+// Args decodes the JSON encoded arguments passed to the native test by
+// the host into v. Subtests have no arguments.
+func (t *T) Args(v interface{}) error {
+	if len(t.args) == 0 {
+		return errors.New("no arguments were passed")
+	}
+	return json.Unmarshal(t.args, v)
+}
+
+// Log formats its arguments like fmt.Println and logs them.
+func (t *T) Log(args ...interface{}) {
+	t.w.send(t.depth, Message{Action: ActionLog, Output: fmt.Sprintln(args...)})
+}
+
+// Logf formats its arguments like fmt.Printf and logs them.
+func (t *T) Logf(format string, args ...interface{}) {
+	t.w.send(t.depth, Message{Action: ActionLog, Output: fmt.Sprintf(format, args...) + "\n"})
+}
+
+// Fail marks the test as failed but continues execution.
+func (t *T) Fail() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failed = true
+}
+
+// Failed reports whether the test has failed.
+func (t *T) Failed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.failed
+}
+
+// Error is equivalent to Log followed by Fail.
+func (t *T) Error(args ...interface{}) {
+	t.w.send(t.depth, Message{Action: ActionError, Output: fmt.Sprintln(args...)})
+	t.Fail()
+}
+
+// Errorf is equivalent to Logf followed by Fail.
+func (t *T) Errorf(format string, args ...interface{}) {
+	t.w.send(t.depth, Message{Action: ActionError, Output: fmt.Sprintf(format, args...) + "\n"})
+	t.Fail()
+}
+
+// FailNow marks the test as failed and stops its execution.
+func (t *T) FailNow() {
+	t.Fail()
+	t.end(Message{Action: ActionFail})
+	runtime.Goexit()
+}
+
+// Fatal is equivalent to Log followed by FailNow.
+func (t *T) Fatal(args ...interface{}) {
+	t.Error(args...)
+	t.FailNow()
+}
+
+// Fatalf is equivalent to Logf followed by FailNow.
+func (t *T) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+	t.FailNow()
+}
+
+// Skip marks the test as skipped with the reason formatted like
+// fmt.Println and stops its execution.
+func (t *T) Skip(args ...interface{}) {
+	t.end(Message{Action: ActionSkip, Output: fmt.Sprintln(args...)})
+	runtime.Goexit()
+}
+
+// Skipf marks the test as skipped with the reason formatted like
+// fmt.Printf and stops its execution.
+func (t *T) Skipf(format string, args ...interface{}) {
+	t.end(Message{Action: ActionSkip, Output: fmt.Sprintf(format, args...) + "\n"})
+	runtime.Goexit()
+}
+
+// Artifact stores data as a file in the output directory of the test on
+// the host.
+func (t *T) Artifact(name string, data []byte) {
+	t.w.send(t.depth, Message{Action: ActionArtifact, Name: name, Data: data})
+}
+
+// ArtifactFile stores a file of the machine in the output directory of
+// the test on the host, using its base name.
+func (t *T) ArtifactFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	t.Artifact(filepath.Base(path), data)
+	return nil
+}
+
+// Run runs f as a subtest of t called name and reports whether f
+// succeeded. Subtests run sequentially.
+func (t *T) Run(name string, f func(t *T)) bool {
+	sub := &T{w: t.w, name: t.name + "/" + name, depth: t.depth + 1}
+	t.w.send(t.depth, Message{Action: ActionRun, Test: name})
+	sub.run(f)
+	if sub.Failed() {
+		t.Fail()
+		return false
+	}
+	return true
+}
+
+// end reports the result of the test once.
+func (t *T) end(msg Message) {
+	t.mu.Lock()
+	done := t.done
+	t.done = true
+	t.mu.Unlock()
+	if !done {
+		t.w.send(t.depth, msg)
+	}
+}
+
+// run runs f in a new goroutine so that FailNow and Skip can stop it,
+// and reports the result.
+func (t *T) run(f func(t *T)) {
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		defer func() {
+			if err := recover(); err != nil {
+				t.Errorf("panic: %v", err)
+				t.end(Message{Action: ActionFail})
+			}
+		}()
+		f(t)
+	}()
+	<-finished
+	if t.Failed() {
+		t.end(Message{Action: ActionFail})
+	} else {
+		t.end(Message{Action: ActionPass})
+	}
+}
+
+// Main runs the native test f called name with the JSON encoded args,
+// writing its results to w as protocol messages if jsonOutput is set and
+// as text otherwise. It returns true if the test didn't fail.
+func Main(w io.Writer, jsonOutput bool, name string, args []byte, f func(t *T)) bool {
+	t := &T{w: &writer{w: w, json: jsonOutput}, name: name, args: args}
+	t.run(f)
+	return !t.Failed()
+}
+
+// Func adapts a native function which only returns an error.
+func Func(f func() error) func(t *T) {
+	return func(t *T) {
+		if err := f(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// WithArgs adapts a native test taking arguments of type A, see T.Args.
+func WithArgs[A any](f func(t *T, args A)) func(t *T) {
+	return func(t *T) {
+		var args A
+		if err := t.Args(&args); err != nil {
+			t.Fatalf("decoding arguments: %v", err)
+		}
+		f(t, args)
+	}
+}
+
+// Table adapts a table driven native test. Its arguments are a map of
+// cases by name, f is run as a subtest for each of them in the order of
+// their names.
+func Table[C any](f func(t *T, c C)) func(t *T) {
+	return WithArgs(func(t *T, cases map[string]C) {
+		names := make([]string, 0, len(cases))
+		for name := range cases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			t.Run(name, func(t *T) {
+				f(t, cases[name])
+			})
+		}
+	})
+}
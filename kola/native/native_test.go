@@ -0,0 +1,176 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package native
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flatcar/mantle/harness"
+	"github.com/flatcar/mantle/harness/reporters"
+	"github.com/flatcar/mantle/harness/testresult"
+)
+
+type resultReporter struct {
+	mu      sync.Mutex
+	results map[string]testresult.TestResult
+}
+
+func (r *resultReporter) ReportTest(name string, result testresult.TestResult, _ time.Duration, _ []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[name] = result
+}
+
+func (r *resultReporter) Output(string) error             { return nil }
+func (r *resultReporter) SetResult(testresult.TestResult) {}
+
+// replay runs a kola test which replays the output of a native test.
+func replay(t *testing.T, args []byte, f func(t *T)) (map[string]testresult.TestResult, string) {
+	var out bytes.Buffer
+	Main(&out, true, "native", args, f)
+
+	dir := t.TempDir()
+	rep := &resultReporter{results: make(map[string]testresult.TestResult)}
+	suite := harness.NewSuite(harness.Options{
+		OutputDir: filepath.Join(dir, "_kola_temp"),
+		Reporters: reporters.Reporters{rep},
+	}, harness.Tests{
+		"native": func(h *harness.H) {
+			if !Replay(strings.NewReader(out.String()), h) {
+				h.Errorf("no result")
+			}
+		},
+	})
+	suite.Run()
+	return rep.results, filepath.Join(dir, "_kola_temp")
+}
+
+func TestReplay(t *testing.T) {
+	results, dir := replay(t, nil, func(t *T) {
+		t.Log("hello")
+		t.Run("pass", func(t *T) {
+			t.Artifact("data.txt", []byte("data"))
+			t.Run("nested", func(t *T) {})
+		})
+		t.Run("skip", func(t *T) {
+			t.Skip("not today")
+			t.Error("not reached")
+		})
+		t.Run("fail", func(t *T) {
+			t.Fatal("boom")
+		})
+		t.Run("after", func(t *T) {})
+	})
+
+	expect := map[string]testresult.TestResult{
+		"native":             testresult.Fail,
+		"native/pass":        testresult.Pass,
+		"native/pass/nested": testresult.Pass,
+		"native/skip":        testresult.Skip,
+		"native/fail":        testresult.Fail,
+		"native/after":       testresult.Pass,
+	}
+	if !reflect.DeepEqual(results, expect) {
+		t.Errorf("got %v, want %v", results, expect)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "native", "pass", "data.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "data" {
+		t.Errorf("got artifact %q", data)
+	}
+}
+
+func TestReplaySkip(t *testing.T) {
+	results, _ := replay(t, nil, func(t *T) {
+		t.Skipf("skipping %d", 1)
+	})
+	if results["native"] != testresult.Skip {
+		t.Errorf("got %v", results)
+	}
+}
+
+func TestReplayPanic(t *testing.T) {
+	results, _ := replay(t, nil, Func(func() error {
+		panic("oops")
+	}))
+	if results["native"] != testresult.Fail {
+		t.Errorf("got %v", results)
+	}
+}
+
+func TestTextOutput(t *testing.T) {
+	var out bytes.Buffer
+	ok := Main(&out, false, "native", nil, func(t *T) {
+		t.Log("hello")
+		t.Run("sub", func(t *T) {
+			t.Error("bad")
+		})
+	})
+	if ok {
+		t.Error("test didn't fail")
+	}
+	expect := `hello
+=== RUN sub
+    bad
+    --- FAIL
+--- FAIL
+`
+	if out.String() != expect {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), expect)
+	}
+}
+
+func TestArgs(t *testing.T) {
+	type args struct {
+		Units []string
+	}
+	var got args
+	results, _ := replay(t, []byte(`{"Units": ["a.service"]}`), WithArgs(func(t *T, a args) {
+		got = a
+	}))
+	if results["native"] != testresult.Pass {
+		t.Errorf("got %v", results)
+	}
+	if !reflect.DeepEqual(got, args{Units: []string{"a.service"}}) {
+		t.Errorf("got %+v", got)
+	}
+
+	results, _ = replay(t, nil, WithArgs(func(t *T, a args) {}))
+	if results["native"] != testresult.Fail {
+		t.Errorf("got %v without arguments", results)
+	}
+}
+
+func TestTable(t *testing.T) {
+	var order []string
+	results, _ := replay(t, []byte(`{"b": 2, "a": 1, "c": 3}`), Table(func(t *T, n int) {
+		order = append(order, t.Name())
+		if n == 2 {
+			t.Errorf("bad case")
+		}
+	}))
+
+	expect := map[string]testresult.TestResult{
+		"native":   testresult.Fail,
+		"native/a": testresult.Pass,
+		"native/b": testresult.Fail,
+		"native/c": testresult.Pass,
+	}
+	if !reflect.DeepEqual(results, expect) {
+		t.Errorf("got %v, want %v", results, expect)
+	}
+	if !reflect.DeepEqual(order, []string{"native/a", "native/b", "native/c"}) {
+		t.Errorf("got order %v", order)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package native
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flatcar/mantle/harness"
+)
+
+// maxMessageSize limits the size of a message, artifacts included.
+const maxMessageSize = 64 << 20
+
+type replayer struct {
+	s *bufio.Scanner
+}
+
+// Replay reads the messages of a native test from r and reports them
+// to h, mapping subtests onto h.Run. It returns true once the native
+// test reported its result, and false if r ended before. If the native
+// test was skipped, h is skipped too, which stops the calling goroutine.
+func Replay(r io.Reader, h *harness.H) bool {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxMessageSize)
+	rp := &replayer{s: s}
+
+	var ended bool
+	rp.replay(h, &ended)
+	if err := s.Err(); err != nil {
+		h.Errorf("kolet: reading messages: %v", err)
+	}
+	return ended
+}
+
+// replay handles the messages of one (sub)test until its end. ended is
+// set before h is skipped since that doesn't return.
+func (rp *replayer) replay(h *harness.H, ended *bool) {
+	for rp.s.Scan() {
+		line := rp.s.Text()
+		var msg Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil || msg.Action == "" {
+			h.Log(line)
+			continue
+		}
+
+		output := strings.TrimSuffix(msg.Output, "\n")
+		switch msg.Action {
+		case ActionLog:
+			h.Log(output)
+		case ActionError:
+			h.Error(output)
+		case ActionArtifact:
+			name := filepath.Join(h.OutputDir(), filepath.Base(msg.Name))
+			if err := os.WriteFile(name, msg.Data, 0644); err != nil {
+				h.Errorf("kolet: writing artifact: %v", err)
+			}
+		case ActionRun:
+			var subEnded bool
+			h.Run(msg.Test, func(sub *harness.H) {
+				rp.replay(sub, &subEnded)
+			})
+			if !subEnded {
+				return
+			}
+		case ActionPass:
+			*ended = true
+			return
+		case ActionFail:
+			*ended = true
+			h.Fail()
+			return
+		case ActionSkip:
+			*ended = true
+			if output != "" {
+				h.Skip(output)
+			}
+			h.SkipNow()
+		default:
+			h.Logf("kolet: unknown message %q", msg.Action)
+		}
+	}
+}
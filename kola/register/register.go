@@ -21,6 +21,7 @@ import (
 	"github.com/coreos/go-semver/semver"
 
 	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/native"
 	"github.com/flatcar/mantle/platform/conf"
 )
 
@@ -45,8 +46,12 @@ type Test struct {
 	Name             string // should be unique
 	Run              func(cluster.TestCluster)
 	NativeFuncs      map[string]func() error
+	NativeTests      map[string]func(*native.T) // like NativeFuncs, but can report subtests, skips and artifacts
+	NativeArgs       map[string]interface{}     // arguments passed to native tests by RunNative unless given explicitly
 	UserData         *conf.UserData
 	UserDataV3       *conf.UserData
+	TranslateV3      bool          // translate UserData when running with Ignition v3 and UserDataV3 is unset
+	Config           *conf.Builder // rendered for the Ignition version under test, overrides UserData and UserDataV3
 	ClusterSize      int
 	Platforms        []string // whitelist of platforms to run test against -- defaults to all
 	ExcludePlatforms []string // blacklist of platforms to ignore -- defaults to none
@@ -97,9 +102,33 @@ func Register(t *Test) {
 		panic(fmt.Sprintf("test %v has an invalid version range", t.Name))
 	}
 
+	for name := range t.NativeTests {
+		if _, ok := t.NativeFuncs[name]; ok {
+			panic(fmt.Sprintf("test %v has native function %v registered twice", t.Name, name))
+		}
+	}
+	for name := range t.NativeArgs {
+		if _, ok := t.NativeTests[name]; !ok {
+			panic(fmt.Sprintf("test %v has arguments for unknown native test %v", t.Name, name))
+		}
+	}
+
 	Tests[t.Name] = t
 }
 
+// Natives returns the native functions and tests of the test as native
+// tests, by name.
+func (t *Test) Natives() map[string]func(*native.T) {
+	natives := make(map[string]func(*native.T), len(t.NativeFuncs)+len(t.NativeTests))
+	for name, f := range t.NativeFuncs {
+		natives[name] = native.Func(f)
+	}
+	for name, f := range t.NativeTests {
+		natives[name] = f
+	}
+	return natives
+}
+
 func (t *Test) HasFlag(flag Flag) bool {
 	for _, f := range t.Flags {
 		if f == flag {
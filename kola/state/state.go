@@ -0,0 +1,420 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package state describes the expected state of a machine declaratively
+// and checks it with a single script run on the machine.
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is the expected state of a machine. Only what is listed is
+// checked, and unset fields of the items aren't.
+type Spec struct {
+	Files         []File            `yaml:"files"`
+	Users         []User            `yaml:"users"`
+	Groups        []Group           `yaml:"groups"`
+	Mounts        []Mount           `yaml:"mounts"`
+	Units         []Unit            `yaml:"units"`
+	Sysctls       map[string]string `yaml:"sysctls"`
+	KernelModules []string          `yaml:"kernel_modules"` // loaded or built in
+	Ports         []Port            `yaml:"ports"`          // listening
+}
+
+// File is the expected state of a file, directory or link.
+type File struct {
+	Path   string `yaml:"path"`
+	Absent bool   `yaml:"absent"`
+	// Type is "file", "directory" or "link".
+	Type   string `yaml:"type"`
+	Mode   string `yaml:"mode"` // octal permissions, e.g. "0644"
+	Owner  string `yaml:"owner"`
+	Group  string `yaml:"group"`
+	SHA256 string `yaml:"sha256"`
+	// Target is the target of a link.
+	Target       string `yaml:"target"`
+	SELinuxLabel string `yaml:"selinux_label"`
+}
+
+// User is the expected state of a user.
+type User struct {
+	Name   string   `yaml:"name"`
+	Absent bool     `yaml:"absent"`
+	UID    *int     `yaml:"uid"`
+	Home   string   `yaml:"home"`
+	Shell  string   `yaml:"shell"`
+	Groups []string `yaml:"groups"` // the user is a member of at least these
+}
+
+// Group is the expected state of a group.
+type Group struct {
+	Name    string   `yaml:"name"`
+	Absent  bool     `yaml:"absent"`
+	GID     *int     `yaml:"gid"`
+	Members []string `yaml:"members"` // at least these are listed as members
+}
+
+// Mount is the expected state of a mount point.
+type Mount struct {
+	Path    string   `yaml:"path"`
+	Absent  bool     `yaml:"absent"`
+	Source  string   `yaml:"source"`
+	FSType  string   `yaml:"fstype"`
+	Options []string `yaml:"options"` // at least these are set
+}
+
+// Unit is the expected state of a systemd unit.
+type Unit struct {
+	Name string `yaml:"name"`
+	// Enabled is the output of systemctl is-enabled, e.g. "enabled".
+	Enabled string `yaml:"enabled"`
+	// Active is the ActiveState, e.g. "active" or "inactive".
+	Active string `yaml:"active"`
+}
+
+// Port is a socket expected to listen.
+type Port struct {
+	Port int `yaml:"port"`
+	// Protocol is "tcp" (the default) or "udp".
+	Protocol string `yaml:"protocol"`
+}
+
+// LoadSpec parses a YAML Spec.
+func LoadSpec(data []byte) (Spec, error) {
+	var spec Spec
+	dec := yaml.NewDecoder(strings.NewReader(string(data)))
+	dec.KnownFields(true)
+	if err := dec.Decode(&spec); err != nil {
+		return Spec{}, fmt.Errorf("parsing state spec: %v", err)
+	}
+	return spec, nil
+}
+
+// query is a command whose output is compared by check.
+type query struct {
+	cmd   string
+	check func(out string) []string
+}
+
+func q(format string, args ...string) string {
+	quoted := make([]interface{}, len(args))
+	for i, a := range args {
+		quoted[i] = shellquote.Join(a)
+	}
+	return fmt.Sprintf(format, quoted...)
+}
+
+// marker separates the outputs of the queries.
+const marker = "--- kola state %d ---"
+
+func (s Spec) queries() []query {
+	var qs []query
+	for _, f := range s.Files {
+		qs = append(qs, f.query())
+	}
+	for _, u := range s.Users {
+		qs = append(qs, u.query())
+	}
+	for _, g := range s.Groups {
+		qs = append(qs, g.query())
+	}
+	for _, m := range s.Mounts {
+		qs = append(qs, m.query())
+	}
+	for _, u := range s.Units {
+		qs = append(qs, u.query())
+	}
+	keys := make([]string, 0, len(s.Sysctls))
+	for k := range s.Sysctls {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		qs = append(qs, sysctlQuery(k, s.Sysctls[k]))
+	}
+	for _, m := range s.KernelModules {
+		qs = append(qs, moduleQuery(m))
+	}
+	for _, p := range s.Ports {
+		qs = append(qs, p.query())
+	}
+	return qs
+}
+
+// Script returns the shell script gathering the state of a machine,
+// which must run as root to read all files.
+func (s Spec) Script() string {
+	var b strings.Builder
+	for i, qu := range s.queries() {
+		fmt.Fprintf(&b, "echo '"+marker+"'\n", i)
+		fmt.Fprintf(&b, "{ %s; } 2>/dev/null\n", qu.cmd)
+	}
+	// failing queries are mismatches, not errors
+	b.WriteString("exit 0\n")
+	return b.String()
+}
+
+// Check compares the output of Script with the spec and returns all
+// mismatches.
+func (s Spec) Check(output string) []string {
+	qs := s.queries()
+	outputs := make([]string, len(qs))
+	current := -1
+	for _, line := range strings.Split(output, "\n") {
+		var i int
+		if n, _ := fmt.Sscanf(line, marker, &i); n == 1 && i >= 0 && i < len(qs) {
+			current = i
+			continue
+		}
+		if current >= 0 {
+			outputs[current] += line + "\n"
+		}
+	}
+
+	var mismatches []string
+	for i, qu := range qs {
+		mismatches = append(mismatches, qu.check(strings.TrimSpace(outputs[i]))...)
+	}
+	return mismatches
+}
+
+func (f File) query() query {
+	cmd := q(`stat -c '%%F|%%a|%%U|%%G' -- %s`, f.Path)
+	if f.SHA256 != "" {
+		cmd += q(`; echo "sha256|$(sha256sum -- %s | cut -d' ' -f1)"`, f.Path)
+	}
+	if f.Target != "" {
+		cmd += q(`; echo "target|$(readlink -- %s)"`, f.Path)
+	}
+	if f.SELinuxLabel != "" {
+		cmd += q(`; echo "label|$(stat -c %%C -- %s)"`, f.Path)
+	}
+	return query{cmd: cmd, check: func(out string) []string {
+		var errs []string
+		lines := strings.Split(out, "\n")
+		stat := strings.Split(lines[0], "|")
+		exists := len(stat) == 4
+		if f.Absent {
+			if exists {
+				errs = append(errs, fmt.Sprintf("file %s exists", f.Path))
+			}
+			return errs
+		}
+		if !exists {
+			return []string{fmt.Sprintf("file %s doesn't exist", f.Path)}
+		}
+
+		typ := map[string]string{
+			"regular file":       "file",
+			"regular empty file": "file",
+			"directory":          "directory",
+			"symbolic link":      "link",
+		}[stat[0]]
+		if f.Type != "" && typ != f.Type {
+			errs = append(errs, fmt.Sprintf("file %s is a %s, want %s", f.Path, stat[0], f.Type))
+		}
+		if f.Mode != "" {
+			want, err1 := strconv.ParseUint(f.Mode, 8, 32)
+			got, err2 := strconv.ParseUint(stat[1], 8, 32)
+			if err1 != nil || err2 != nil || want != got {
+				errs = append(errs, fmt.Sprintf("file %s has mode %04o, want %s", f.Path, got, f.Mode))
+			}
+		}
+		if f.Owner != "" && stat[2] != f.Owner {
+			errs = append(errs, fmt.Sprintf("file %s is owned by %s, want %s", f.Path, stat[2], f.Owner))
+		}
+		if f.Group != "" && stat[3] != f.Group {
+			errs = append(errs, fmt.Sprintf("file %s has group %s, want %s", f.Path, stat[3], f.Group))
+		}
+		extra := make(map[string]string)
+		for _, line := range lines[1:] {
+			if k, v, ok := strings.Cut(line, "|"); ok {
+				extra[k] = v
+			}
+		}
+		if f.SHA256 != "" && extra["sha256"] != f.SHA256 {
+			errs = append(errs, fmt.Sprintf("file %s has SHA256 %s, want %s", f.Path, extra["sha256"], f.SHA256))
+		}
+		if f.Target != "" && extra["target"] != f.Target {
+			errs = append(errs, fmt.Sprintf("file %s links to %q, want %s", f.Path, extra["target"], f.Target))
+		}
+		if f.SELinuxLabel != "" && extra["label"] != f.SELinuxLabel {
+			errs = append(errs, fmt.Sprintf("file %s has SELinux label %q, want %s", f.Path, extra["label"], f.SELinuxLabel))
+		}
+		return errs
+	}}
+}
+
+func (u User) query() query {
+	cmd := q(`getent passwd %s && echo "groups|$(id -Gn -- %s)"`, u.Name, u.Name)
+	return query{cmd: cmd, check: func(out string) []string {
+		lines := strings.Split(out, "\n")
+		fields := strings.Split(lines[0], ":")
+		exists := len(fields) == 7
+		if u.Absent {
+			if exists {
+				return []string{fmt.Sprintf("user %s exists", u.Name)}
+			}
+			return nil
+		}
+		if !exists {
+			return []string{fmt.Sprintf("user %s doesn't exist", u.Name)}
+		}
+
+		var errs []string
+		if u.UID != nil && fields[2] != strconv.Itoa(*u.UID) {
+			errs = append(errs, fmt.Sprintf("user %s has UID %s, want %d", u.Name, fields[2], *u.UID))
+		}
+		if u.Home != "" && fields[5] != u.Home {
+			errs = append(errs, fmt.Sprintf("user %s has home %s, want %s", u.Name, fields[5], u.Home))
+		}
+		if u.Shell != "" && fields[6] != u.Shell {
+			errs = append(errs, fmt.Sprintf("user %s has shell %s, want %s", u.Name, fields[6], u.Shell))
+		}
+		var groups []string
+		if len(lines) > 1 {
+			groups = strings.Fields(strings.TrimPrefix(lines[1], "groups|"))
+		}
+		if missing := missing(u.Groups, groups); len(missing) != 0 {
+			errs = append(errs, fmt.Sprintf("user %s isn't in groups %s", u.Name, strings.Join(missing, ", ")))
+		}
+		return errs
+	}}
+}
+
+func (g Group) query() query {
+	return query{cmd: q(`getent group %s`, g.Name), check: func(out string) []string {
+		fields := strings.Split(out, ":")
+		exists := len(fields) == 4
+		if g.Absent {
+			if exists {
+				return []string{fmt.Sprintf("group %s exists", g.Name)}
+			}
+			return nil
+		}
+		if !exists {
+			return []string{fmt.Sprintf("group %s doesn't exist", g.Name)}
+		}
+
+		var errs []string
+		if g.GID != nil && fields[2] != strconv.Itoa(*g.GID) {
+			errs = append(errs, fmt.Sprintf("group %s has GID %s, want %d", g.Name, fields[2], *g.GID))
+		}
+		if missing := missing(g.Members, strings.Split(fields[3], ",")); len(missing) != 0 {
+			errs = append(errs, fmt.Sprintf("group %s doesn't list members %s", g.Name, strings.Join(missing, ", ")))
+		}
+		return errs
+	}}
+}
+
+func (m Mount) query() query {
+	cmd := q(`findmnt -n -r -o SOURCE,FSTYPE,OPTIONS --mountpoint %s`, m.Path)
+	return query{cmd: cmd, check: func(out string) []string {
+		// the last mount on top of the path is the visible one
+		lines := strings.Split(out, "\n")
+		fields := strings.Fields(lines[len(lines)-1])
+		exists := len(fields) == 3
+		if m.Absent {
+			if exists {
+				return []string{fmt.Sprintf("%s is mounted", m.Path)}
+			}
+			return nil
+		}
+		if !exists {
+			return []string{fmt.Sprintf("%s isn't mounted", m.Path)}
+		}
+
+		var errs []string
+		if m.Source != "" && fields[0] != m.Source {
+			errs = append(errs, fmt.Sprintf("%s is mounted from %s, want %s", m.Path, fields[0], m.Source))
+		}
+		if m.FSType != "" && fields[1] != m.FSType {
+			errs = append(errs, fmt.Sprintf("%s has filesystem %s, want %s", m.Path, fields[1], m.FSType))
+		}
+		if missing := missing(m.Options, strings.Split(fields[2], ",")); len(missing) != 0 {
+			errs = append(errs, fmt.Sprintf("%s is mounted without %s", m.Path, strings.Join(missing, ",")))
+		}
+		return errs
+	}}
+}
+
+func (u Unit) query() query {
+	cmd := q(`echo "enabled|$(systemctl is-enabled -- %s)"; echo "active|$(systemctl show --property=ActiveState --value -- %s)"`, u.Name, u.Name)
+	return query{cmd: cmd, check: func(out string) []string {
+		got := make(map[string]string)
+		for _, line := range strings.Split(out, "\n") {
+			if k, v, ok := strings.Cut(line, "|"); ok {
+				got[k] = v
+			}
+		}
+		var errs []string
+		if u.Enabled != "" && got["enabled"] != u.Enabled {
+			errs = append(errs, fmt.Sprintf("unit %s is %q, want %s", u.Name, got["enabled"], u.Enabled))
+		}
+		if u.Active != "" && got["active"] != u.Active {
+			errs = append(errs, fmt.Sprintf("unit %s is %q, want %s", u.Name, got["active"], u.Active))
+		}
+		return errs
+	}}
+}
+
+func sysctlQuery(key, value string) query {
+	return query{cmd: q(`sysctl -n %s`, key), check: func(out string) []string {
+		// multi-value settings are tab separated
+		if strings.Join(strings.Fields(out), " ") != strings.Join(strings.Fields(value), " ") {
+			return []string{fmt.Sprintf("sysctl %s is %q, want %q", key, out, value)}
+		}
+		return nil
+	}}
+}
+
+func moduleQuery(name string) query {
+	name = strings.ReplaceAll(name, "-", "_")
+	cmd := q(`grep -q "^"%s" " /proc/modules || tr - _ < /lib/modules/$(uname -r)/modules.builtin | grep -q /%s.ko && echo loaded`, name, name)
+	return query{cmd: cmd, check: func(out string) []string {
+		if out != "loaded" {
+			return []string{fmt.Sprintf("kernel module %s isn't loaded", name)}
+		}
+		return nil
+	}}
+}
+
+func (p Port) query() query {
+	proto := p.Protocol
+	if proto == "" {
+		proto = "tcp"
+	}
+	flag := "-t"
+	if proto == "udp" {
+		flag = "-u"
+	}
+	cmd := fmt.Sprintf(`ss -Hln %s 'sport = :%d'`, flag, p.Port)
+	return query{cmd: cmd, check: func(out string) []string {
+		if out == "" {
+			return []string{fmt.Sprintf("nothing listens on %s port %d", proto, p.Port)}
+		}
+		return nil
+	}}
+}
+
+// missing returns the elements of want which aren't in got.
+func missing(want, got []string) []string {
+	have := make(map[string]bool)
+	for _, g := range got {
+		have[g] = true
+	}
+	var m []string
+	for _, w := range want {
+		if !have[w] {
+			m = append(m, w)
+		}
+	}
+	return m
+}
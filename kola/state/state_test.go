@@ -0,0 +1,114 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package state
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// output fakes the output of Script for the given query outputs.
+func output(outs ...string) string {
+	var b strings.Builder
+	for i, out := range outs {
+		fmt.Fprintf(&b, marker+"\n", i)
+		if out != "" {
+			b.WriteString(out + "\n")
+		}
+	}
+	return b.String()
+}
+
+func TestCheck(t *testing.T) {
+	uid := 500
+	spec, err := LoadSpec([]byte(`
+files:
+  - path: /etc/hostname
+    type: file
+    mode: "0644"
+    owner: root
+    sha256: abc
+  - path: /etc/delete-me
+    absent: true
+  - path: /etc/missing
+  - path: /etc/resolv.conf
+    type: link
+    target: /run/systemd/resolve/resolv.conf
+users:
+  - name: core
+    shell: /bin/bash
+    groups: [sudo, docker]
+groups:
+  - name: docker
+    members: [core]
+mounts:
+  - path: /usr
+    fstype: ext4
+    options: [ro]
+units:
+  - name: sshd.socket
+    enabled: enabled
+    active: active
+sysctls:
+  net.ipv4.ip_forward: "1"
+kernel_modules: [overlay]
+ports:
+  - port: 22
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec.Users[0].UID = &uid
+
+	out := output(
+		"regular file|600|root|root\nsha256|abc",
+		"regular empty file|644|root|root",
+		"",
+		"symbolic link|777|root|root\ntarget|../run/systemd/resolve/resolv.conf",
+		"core:x:500:500:Flatcar Admin:/home/core:/bin/bash\ngroups|core sudo",
+		"docker:x:233:core",
+		"/dev/mapper/usr ext4 ro,relatime",
+		"enabled|enabled\nactive|inactive",
+		"1",
+		"loaded",
+		"",
+	)
+
+	expect := []string{
+		"file /etc/hostname has mode 0600, want 0644",
+		"file /etc/delete-me exists",
+		"file /etc/missing doesn't exist",
+		`file /etc/resolv.conf links to "../run/systemd/resolve/resolv.conf", want /run/systemd/resolve/resolv.conf`,
+		"user core isn't in groups docker",
+		`unit sshd.socket is "inactive", want active`,
+		"nothing listens on tcp port 22",
+	}
+	if got := spec.Check(out); !reflect.DeepEqual(got, expect) {
+		t.Errorf("got mismatches:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(expect, "\n"))
+	}
+}
+
+func TestScript(t *testing.T) {
+	spec := Spec{
+		Files: []File{{Path: "/etc/it's here", SHA256: "abc"}},
+	}
+	script := spec.Script()
+	for _, want := range []string{
+		"echo '--- kola state 0 ---'",
+		`stat -c '%F|%a|%U|%G' -- '/etc/it'\''s here'`,
+		`sha256sum -- '/etc/it'\''s here'`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script doesn't contain %q:\n%s", want, script)
+		}
+	}
+}
+
+func TestLoadSpecUnknownField(t *testing.T) {
+	if _, err := LoadSpec([]byte("files:\n  - path: /a\n    permissions: 0644\n")); err == nil {
+		t.Error("unknown field accepted")
+	}
+}
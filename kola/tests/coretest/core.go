@@ -11,6 +11,7 @@ import (
 
 	"github.com/pborman/uuid"
 
+	"github.com/flatcar/mantle/kola/native"
 	"github.com/flatcar/mantle/kola/register"
 )
 
@@ -66,13 +67,29 @@ func init() {
 			"Symlink":          TestSymlinkResolvConf,
 			"SymlinkFlatcar":   TestSymlinkFlatcar,
 			"UpdateEngineKeys": TestInstalledUpdateEngineRsaKeys,
-			"ServicesActive":   TestServicesActive,
 			"ReadOnly":         TestReadOnlyFs,
 			"RandomUUID":       TestFsRandomUUID,
 			"Useradd":          TestUseradd,
 			"MachineID":        TestMachineID,
 			"Microcode":        TestMicrocode,
 		},
+		NativeTests: map[string]func(*native.T){
+			"ServicesActive": native.WithArgs(TestServicesActive),
+		},
+		NativeArgs: map[string]interface{}{
+			"ServicesActive": ServicesActiveArgs{
+				AllOf: []string{
+					"multi-user.target",
+					"docker.socket",
+					"update-engine.service",
+				},
+				AnyOf: []string{
+					"systemd-timesyncd.service",
+					"chronyd.service",
+					"ntpd.service",
+				},
+			},
+		},
 		Distros: []string{"cl"},
 	})
 	register.Register(&register.Test{
@@ -82,12 +99,19 @@ func init() {
 		NativeFuncs: map[string]func() error{
 			"PortSSH":          TestPortSsh,
 			"DbusPerms":        TestDbusPerms,
-			"ServicesActive":   TestServicesActiveCoreOS,
 			"ServicesDisabled": TestServicesDisabledRHCOS,
 			"ReadOnly":         TestReadOnlyFs,
 			"Useradd":          TestUseradd,
 			"MachineID":        TestMachineID,
 		},
+		NativeTests: map[string]func(*native.T){
+			"ServicesActive": native.WithArgs(TestServicesActive),
+		},
+		NativeArgs: map[string]interface{}{
+			"ServicesActive": ServicesActiveArgs{
+				AllOf: []string{"multi-user.target"},
+			},
+		},
 		Distros: []string{"rhcos"},
 	})
 	register.Register(&register.Test{
@@ -95,12 +119,19 @@ func init() {
 		Run:         LocalTests,
 		ClusterSize: 1,
 		NativeFuncs: map[string]func() error{
-			"PortSSH":        TestPortSsh,
-			"DbusPerms":      TestDbusPerms,
-			"ServicesActive": TestServicesActiveCoreOS,
-			"ReadOnly":       TestReadOnlyFs,
-			"Useradd":        TestUseradd,
-			"MachineID":      TestMachineID,
+			"PortSSH":   TestPortSsh,
+			"DbusPerms": TestDbusPerms,
+			"ReadOnly":  TestReadOnlyFs,
+			"Useradd":   TestUseradd,
+			"MachineID": TestMachineID,
+		},
+		NativeTests: map[string]func(*native.T){
+			"ServicesActive": native.WithArgs(TestServicesActive),
+		},
+		NativeArgs: map[string]interface{}{
+			"ServicesActive": ServicesActiveArgs{
+				AllOf: []string{"multi-user.target"},
+			},
 		},
 		Distros: []string{"fcos"},
 	})
@@ -319,42 +350,33 @@ func TestInstalledUpdateEngineRsaKeys() error {
 	}
 }
 
-func TestServicesActive() error {
-	return servicesActive([]string{
-		"multi-user.target",
-		"docker.socket",
-		"update-engine.service",
-	}, []string{
-		"systemd-timesyncd.service",
-		"chronyd.service",
-		"ntpd.service",
-	})
-}
-
-func TestServicesActiveCoreOS() error {
-	return servicesActive([]string{
-		"multi-user.target",
-	}, []string{})
+// ServicesActiveArgs are the units checked by TestServicesActive.
+type ServicesActiveArgs struct {
+	AllOf []string // all of them must be active
+	AnyOf []string // one of them must be active, if set
 }
 
-func servicesActive(allOf []string, anyOf []string) error {
-	//t.Parallel()
-	for _, unit := range allOf {
-		c := exec.Command("systemctl", "is-active", unit)
-		err := c.Run()
-		if err != nil {
-			return fmt.Errorf("services Active: %s: %v", unit, err)
-		}
+func TestServicesActive(t *native.T, args ServicesActiveArgs) {
+	for _, unit := range args.AllOf {
+		t.Run(unit, func(t *native.T) {
+			c := exec.Command("systemctl", "is-active", unit)
+			if err := c.Run(); err != nil {
+				t.Errorf("services Active: %s: %v", unit, err)
+			}
+		})
+	}
+	if len(args.AnyOf) == 0 {
+		return
 	}
 	var err error
-	for _, unit := range anyOf {
+	for _, unit := range args.AnyOf {
 		c := exec.Command("systemctl", "is-active", unit)
 		err = c.Run()
 		if err == nil {
-			return nil
+			return
 		}
 	}
-	return fmt.Errorf("no NTP service active: %v", err)
+	t.Errorf("none of %s active: %v", strings.Join(args.AnyOf, ", "), err)
 }
 
 func TestServicesDisabledRHCOS() error {
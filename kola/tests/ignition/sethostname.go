@@ -76,6 +76,8 @@ func init() {
 		              ]
 		          }
 		      }`)
+	config := conf.NewBuilder().
+		AddFile(conf.File{Path: "/etc/hostname", Contents: "core1", Mode: 0644})
 
 	// These tests are disabled on Azure because the hostname
 	// is required by the API and is overwritten via waagent.service
@@ -100,6 +102,15 @@ func init() {
 		ExcludePlatforms: []string{"azure"},
 		// Should run on all clouds to test for conflicts with DHCP hostnames, afterburn or other mechanisms
 	})
+	register.Register(&register.Test{
+		Name:        "coreos.ignition.sethostname.builder",
+		Run:         setHostname,
+		ClusterSize: 1,
+		Config:      config,
+		Distros:     []string{"cl", "fcos", "rhcos"},
+		// It's enough if coreos.ignition.sethostname runs on all clouds
+		Platforms: []string{"qemu", "qemu-unpriv"},
+	})
 }
 
 func setHostname(c cluster.TestCluster) {
@@ -22,7 +22,6 @@ import (
 	"github.com/flatcar/mantle/kola/cluster"
 	"github.com/flatcar/mantle/kola/register"
 	"github.com/flatcar/mantle/platform/conf"
-	"github.com/flatcar/mantle/util"
 )
 
 var (
@@ -89,6 +88,7 @@ func testNFS(c cluster.TestCluster, nfsversion int, remotePath string) {
 		nfstype = "nfs4"
 	}
 
+	// the server is the only peer of the client
 	c2 := conf.ContainerLinuxConfig(fmt.Sprintf(`storage:
   files:
     - filesystem: "root"
@@ -109,13 +109,13 @@ systemd:
         Requires=rpc-statd.service
 
         [Mount]
-        What=%s:%s
+        What={{ (index .Peers 0).PrivateIPv4 }}:%s
         Where=/var/mnt
         Type=%s
         Options=defaults,noexec,nfsvers=%d
 
         [Install]
-        WantedBy=multi-user.target`, m1.PrivateIP(), remotePath, nfstype, nfsversion))
+        WantedBy=multi-user.target`, remotePath, nfstype, nfsversion)).Template()
 
 	m2, err := c.NewMachine(c2)
 	if err != nil {
@@ -124,19 +124,8 @@ systemd:
 
 	c.Log("NFS client booted.")
 
-	checkmount := func() error {
-		status, err := c.SSH(m2, "systemctl is-active var-mnt.mount")
-		if err != nil || string(status) != "active" {
-			return fmt.Errorf("var-mnt.mount status is %q: %v", status, err)
-		}
-
-		c.Log("Got NFS mount.")
-		return nil
-	}
-
-	if err = util.Retry(10, 3*time.Second, checkmount); err != nil {
-		c.Fatal(err)
-	}
+	c.WaitForUnitState(m2, "var-mnt.mount", "active", 30*time.Second)
+	c.Log("Got NFS mount.")
 
 	c.MustSSH(m2, fmt.Sprintf("stat /var/mnt/%s", path.Base(string(tmp))))
 }
@@ -18,10 +18,9 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/coreos/go-omaha/omaha"
-
 	"github.com/flatcar/mantle/kola/cluster"
 	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/network/omaha"
 	"github.com/flatcar/mantle/platform/conf"
 	"github.com/flatcar/mantle/platform/machine/qemu"
 )
@@ -40,30 +39,12 @@ func init() {
 	})
 }
 
-type pingServer struct {
-	omaha.UpdaterStub
-
-	ping chan struct{}
-}
-
-func (ps *pingServer) Ping(req *omaha.Request, app *omaha.AppRequest) {
-	ps.ping <- struct{}{}
-}
-
 func OmahaPing(c cluster.TestCluster) {
 	qc, ok := c.Cluster.(*qemu.Cluster)
 	if !ok {
 		c.Fatal("test only works in qemu")
 	}
 
-	omahaserver := qc.LocalCluster.OmahaServer
-
-	svc := &pingServer{
-		ping: make(chan struct{}),
-	}
-
-	omahaserver.Updater = svc
-
 	hostport, err := qc.GetOmahaHostPort()
 	if err != nil {
 		c.Fatalf("couldn't get Omaha server address: %v", err)
@@ -82,11 +63,5 @@ func OmahaPing(c cluster.TestCluster) {
 		c.Fatalf("couldn't check for update: %s, %s, %v", out, stderr, err)
 	}
 
-	tc := time.After(30 * time.Second)
-
-	select {
-	case <-tc:
-		c.Fatal("timed out waiting for omaha ping")
-	case <-svc.ping:
-	}
+	c.WaitForOmahaRecord(m, omaha.MatchKind(omaha.RecordPing), 30*time.Second)
 }
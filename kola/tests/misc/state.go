@@ -10,6 +10,7 @@ import (
 
 	"github.com/flatcar/mantle/kola/cluster"
 	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/kola/state"
 	"github.com/flatcar/mantle/platform/conf"
 )
 
@@ -126,7 +127,16 @@ func OsReset(c cluster.TestCluster) {
 	_ = c.MustSSH(m, fmt.Sprintf(ignitionCheck, "after reset"))
 
 	// Check that the local state is as expected
-	_ = c.MustSSH(m, `if test ! -e /etc/keep-dir/file || test ! -e /etc/custom/keep-me || test ! -e /etc/keep-me || test -e /etc/delete-me || test -e /etc/custom/delete-me || test -e /etc/delete-dir ; then echo "Unexpected state: $_" exit 1; fi`)
+	c.AssertState(m, state.Spec{
+		Files: []state.File{
+			{Path: "/etc/keep-dir/file"},
+			{Path: "/etc/custom/keep-me"},
+			{Path: "/etc/keep-me"},
+			{Path: "/etc/delete-me", Absent: true},
+			{Path: "/etc/custom/delete-me", Absent: true},
+			{Path: "/etc/delete-dir", Absent: true},
+		},
+	})
 
 	newMachineID := string(c.MustSSH(m, `cat /etc/machine-id`))
 	if prevMachineId != newMachineID {
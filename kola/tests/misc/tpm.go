@@ -7,6 +7,7 @@ import (
 	"github.com/flatcar/mantle/kola/cluster"
 	"github.com/flatcar/mantle/kola/register"
 	"github.com/flatcar/mantle/kola/tests/util"
+	"github.com/flatcar/mantle/kola/tpm"
 	"github.com/flatcar/mantle/platform"
 	"github.com/flatcar/mantle/platform/conf"
 )
@@ -366,4 +367,30 @@ func eventLogTest(c cluster.TestCluster) {
 
 	// Verify that the TPM event log is working.
 	_ = c.MustSSH(m, "sudo tpm2_eventlog /sys/kernel/security/tpm0/binary_bios_measurements")
+
+	// Verify that replaying the event log results in the PCR values
+	// of the TPM.
+	log, err := tpm.ReadEventLog(m)
+	if err != nil {
+		c.Fatalf("reading event log: %v", err)
+	}
+	pcrs, err := tpm.ReadPCRs(m, tpm.AlgSHA256)
+	if err != nil {
+		c.Fatalf("reading PCRs: %v", err)
+	}
+	if err := log.Verify(tpm.AlgSHA256, pcrs); err != nil {
+		c.Fatal(err)
+	}
+
+	// shim and GRUB are only measured into PCR 4 when booting with UEFI.
+	if _, _, err := m.SSH("test -d /sys/firmware/efi"); err != nil {
+		return
+	}
+	expectations, err := tpm.BootExpectations(m)
+	if err != nil {
+		c.Fatalf("collecting boot artifacts: %v", err)
+	}
+	if err := log.Check(tpm.AlgSHA256, expectations...); err != nil {
+		c.Fatal(err)
+	}
 }
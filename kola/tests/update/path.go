@@ -0,0 +1,102 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package update
+
+import (
+	"os"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+
+	"github.com/flatcar/mantle/kola"
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/register"
+	tutil "github.com/flatcar/mantle/kola/tests/util"
+	"github.com/flatcar/mantle/network/omaha"
+	"github.com/flatcar/mantle/platform/machine/qemu"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Name:        "cl.update.path",
+		Run:         upgradePath,
+		ClusterSize: 1,
+		Distros:     []string{"cl"},
+		// The updates are served by the local Omaha server
+		Platforms:        []string{"qemu"},
+		ExcludePlatforms: []string{"qemu-unpriv"},
+		SkipFunc: func(version semver.Version, channel, arch, platform string) bool {
+			// The booted image is the oldest of the path, the
+			// versions to upgrade through must be given.
+			return len(kola.UpgradePath) == 0
+		},
+		// Skip AVC checks, we will do our own only on the
+		// last boot logs, as the older logs may come from an
+		// old version of Flatcar that still has some AVC
+		// messages.
+		Flags: []register.Flag{register.NoSELinuxAVCChecks},
+	})
+}
+
+// upgradePath upgrades the machine through each version of
+// kola.UpgradePath, checking that the other /usr partition is booted
+// after every hop, and then runs kola.UpgradeTests on the final state.
+func upgradePath(c cluster.TestCluster) {
+	qc, ok := c.Cluster.(*qemu.Cluster)
+	if !ok {
+		c.Fatal("test only works in qemu")
+	}
+	addr, err := qc.GetOmahaHostPort()
+	if err != nil {
+		c.Fatalf("couldn't get Omaha server address: %v", err)
+	}
+
+	arch := strings.SplitN(kola.QEMUOptions.Board, "-", 2)[0]
+	hops, err := kola.ParseUpgradePath(kola.UpgradePath, arch)
+	if err != nil {
+		c.Fatal(err)
+	}
+
+	dir, err := os.MkdirTemp(c.H.OutputDir(), "payloads")
+	if err != nil {
+		c.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := c.OmahaServer()
+	for _, hop := range hops {
+		payload, err := hop.FetchPayload(dir)
+		if err != nil {
+			c.Fatal(err)
+		}
+		if err := srv.AddVersion(omaha.AnyApp, omaha.Version{Version: hop.Version.String(), Payload: payload}); err != nil {
+			c.Fatalf("serving %s: %v", hop.Version, err)
+		}
+	}
+
+	m := c.Machines()[0]
+	usr, other := "USR-A", "USR-B"
+	tutil.AssertBootedUsr(c, m, usr)
+	for _, hop := range hops {
+		c.Logf("Upgrading to %s", hop.Version)
+		if err := srv.SetChannel(omaha.AnyApp, omaha.AnyGroup, omaha.Channel{Version: hop.Version.String(), Rollout: 100}); err != nil {
+			c.Fatal(err)
+		}
+
+		// the previous hop may have installed another payload key
+		configureMachineForUpdate(c, m, addr)
+		updateMachine(c, m)
+		tutil.AssertBootedUsr(c, m, other)
+		tutil.InvalidateUsrPartition(c, m, usr)
+		usr, other = other, usr
+
+		version := strings.TrimSpace(string(c.MustSSH(m, `. /etc/os-release && echo "${VERSION}"`)))
+		if version != hop.Version.String() {
+			c.Fatalf("booted version %s after upgrading to %s", version, hop.Version)
+		}
+	}
+	checkNoAVCMessages(c, m)
+
+	kola.RunUpgradeTests(c)
+}
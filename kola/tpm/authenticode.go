@@ -0,0 +1,89 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package tpm
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// AuthenticodeDigest computes the Authenticode hash of a PE/COFF image,
+// which is what UEFI firmware and shim measure for EFI applications in
+// EV_EFI_BOOT_SERVICES_APPLICATION events.
+func AuthenticodeDigest(image []byte, alg Algorithm) ([]byte, error) {
+	h := alg.Hash()
+	if h == 0 || !h.Available() {
+		return nil, fmt.Errorf("unsupported hash algorithm %v", alg)
+	}
+
+	f, err := pe.NewFile(bytes.NewReader(image))
+	if err != nil {
+		return nil, fmt.Errorf("parsing PE image: %v", err)
+	}
+	defer f.Close()
+
+	if len(image) < 0x40 {
+		return nil, fmt.Errorf("PE image too short")
+	}
+	// The optional header follows the "PE\0\0" signature and the COFF
+	// file header, whose offset is stored in the DOS header.
+	optOffset := int(binary.LittleEndian.Uint32(image[0x3c:])) + 4 + 20
+
+	var sizeOfHeaders uint32
+	var certDir pe.DataDirectory
+	var dirOffset int
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		sizeOfHeaders = oh.SizeOfHeaders
+		dirOffset = optOffset + 96
+		if oh.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_SECURITY {
+			certDir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_SECURITY]
+		}
+	case *pe.OptionalHeader64:
+		sizeOfHeaders = oh.SizeOfHeaders
+		dirOffset = optOffset + 112
+		if oh.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_SECURITY {
+			certDir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_SECURITY]
+		}
+	default:
+		return nil, fmt.Errorf("PE image has no optional header")
+	}
+	checksumOffset := optOffset + 64
+	certDirOffset := dirOffset + 8*pe.IMAGE_DIRECTORY_ENTRY_SECURITY
+	if int(sizeOfHeaders) > len(image) || certDirOffset+8 > int(sizeOfHeaders) {
+		return nil, fmt.Errorf("PE headers exceed image size")
+	}
+
+	d := h.New()
+	d.Write(image[:checksumOffset])
+	d.Write(image[checksumOffset+4 : certDirOffset])
+	d.Write(image[certDirOffset+8 : sizeOfHeaders])
+	hashed := int(sizeOfHeaders)
+
+	sections := make([]*pe.Section, 0, len(f.Sections))
+	for _, s := range f.Sections {
+		if s.Size > 0 {
+			sections = append(sections, s)
+		}
+	}
+	sort.Slice(sections, func(i, j int) bool { return sections[i].Offset < sections[j].Offset })
+	for _, s := range sections {
+		start, end := int(s.Offset), int(s.Offset)+int(s.Size)
+		if end > len(image) {
+			return nil, fmt.Errorf("section %q exceeds image size", s.Name)
+		}
+		d.Write(image[start:end])
+		hashed += int(s.Size)
+	}
+
+	// Anything after the sections except the certificate table is
+	// hashed as well.
+	if end := len(image) - int(certDir.Size); hashed < end {
+		d.Write(image[hashed:end])
+	}
+	return d.Sum(nil), nil
+}
@@ -0,0 +1,358 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package tpm parses and replays TCG event logs so kola tests can verify
+// what firmware, shim and GRUB measured into the TPM during boot.
+package tpm
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Algorithm is a TPM2 hash algorithm identifier (TPM_ALG_ID).
+type Algorithm uint16
+
+const (
+	AlgSHA1   Algorithm = 0x0004
+	AlgSHA256 Algorithm = 0x000B
+	AlgSHA384 Algorithm = 0x000C
+	AlgSHA512 Algorithm = 0x000D
+)
+
+var algorithms = map[Algorithm]struct {
+	name string
+	hash crypto.Hash
+}{
+	AlgSHA1:   {"sha1", crypto.SHA1},
+	AlgSHA256: {"sha256", crypto.SHA256},
+	AlgSHA384: {"sha384", crypto.SHA384},
+	AlgSHA512: {"sha512", crypto.SHA512},
+}
+
+// Hash returns the Go hash function for the algorithm, or 0 if the
+// algorithm is not supported.
+func (a Algorithm) Hash() crypto.Hash {
+	return algorithms[a].hash
+}
+
+func (a Algorithm) String() string {
+	if alg, ok := algorithms[a]; ok {
+		return alg.name
+	}
+	return fmt.Sprintf("alg(0x%04x)", uint16(a))
+}
+
+// Sum returns the digest of data using the algorithm.
+func (a Algorithm) Sum(data []byte) ([]byte, error) {
+	h := a.Hash()
+	if h == 0 || !h.Available() {
+		return nil, fmt.Errorf("unsupported hash algorithm %v", a)
+	}
+	hh := h.New()
+	hh.Write(data)
+	return hh.Sum(nil), nil
+}
+
+// EventType is the type of a TCG event log entry.
+type EventType uint32
+
+const (
+	EvPrebootCert          EventType = 0x00000000
+	EvPostCode             EventType = 0x00000001
+	EvNoAction             EventType = 0x00000003
+	EvSeparator            EventType = 0x00000004
+	EvAction               EventType = 0x00000005
+	EvEventTag             EventType = 0x00000006
+	EvSCRTMContents        EventType = 0x00000007
+	EvSCRTMVersion         EventType = 0x00000008
+	EvCPUMicrocode         EventType = 0x00000009
+	EvPlatformConfigFlags  EventType = 0x0000000A
+	EvTableOfDevices       EventType = 0x0000000B
+	EvCompactHash          EventType = 0x0000000C
+	EvIPL                  EventType = 0x0000000D
+	EvIPLPartitionData     EventType = 0x0000000E
+	EvNonhostCode          EventType = 0x0000000F
+	EvNonhostConfig        EventType = 0x00000010
+	EvNonhostInfo          EventType = 0x00000011
+	EvOmitBootDeviceEvents EventType = 0x00000012
+
+	EvEFIVariableDriverConfig    EventType = 0x80000001
+	EvEFIVariableBoot            EventType = 0x80000002
+	EvEFIBootServicesApplication EventType = 0x80000003
+	EvEFIBootServicesDriver      EventType = 0x80000004
+	EvEFIRuntimeServicesDriver   EventType = 0x80000005
+	EvEFIGPTEvent                EventType = 0x80000006
+	EvEFIAction                  EventType = 0x80000007
+	EvEFIPlatformFirmwareBlob    EventType = 0x80000008
+	EvEFIHandoffTables           EventType = 0x80000009
+	EvEFIPlatformFirmwareBlob2   EventType = 0x8000000A
+	EvEFIHandoffTables2          EventType = 0x8000000B
+	EvEFIVariableBoot2           EventType = 0x8000000C
+	EvEFIHCRTMEvent              EventType = 0x80000010
+	EvEFIVariableAuthority       EventType = 0x800000E0
+)
+
+var eventTypeNames = map[EventType]string{
+	EvPrebootCert:                "EV_PREBOOT_CERT",
+	EvPostCode:                   "EV_POST_CODE",
+	EvNoAction:                   "EV_NO_ACTION",
+	EvSeparator:                  "EV_SEPARATOR",
+	EvAction:                     "EV_ACTION",
+	EvEventTag:                   "EV_EVENT_TAG",
+	EvSCRTMContents:              "EV_S_CRTM_CONTENTS",
+	EvSCRTMVersion:               "EV_S_CRTM_VERSION",
+	EvCPUMicrocode:               "EV_CPU_MICROCODE",
+	EvPlatformConfigFlags:        "EV_PLATFORM_CONFIG_FLAGS",
+	EvTableOfDevices:             "EV_TABLE_OF_DEVICES",
+	EvCompactHash:                "EV_COMPACT_HASH",
+	EvIPL:                        "EV_IPL",
+	EvIPLPartitionData:           "EV_IPL_PARTITION_DATA",
+	EvNonhostCode:                "EV_NONHOST_CODE",
+	EvNonhostConfig:              "EV_NONHOST_CONFIG",
+	EvNonhostInfo:                "EV_NONHOST_INFO",
+	EvOmitBootDeviceEvents:       "EV_OMIT_BOOT_DEVICE_EVENTS",
+	EvEFIVariableDriverConfig:    "EV_EFI_VARIABLE_DRIVER_CONFIG",
+	EvEFIVariableBoot:            "EV_EFI_VARIABLE_BOOT",
+	EvEFIBootServicesApplication: "EV_EFI_BOOT_SERVICES_APPLICATION",
+	EvEFIBootServicesDriver:      "EV_EFI_BOOT_SERVICES_DRIVER",
+	EvEFIRuntimeServicesDriver:   "EV_EFI_RUNTIME_SERVICES_DRIVER",
+	EvEFIGPTEvent:                "EV_EFI_GPT_EVENT",
+	EvEFIAction:                  "EV_EFI_ACTION",
+	EvEFIPlatformFirmwareBlob:    "EV_EFI_PLATFORM_FIRMWARE_BLOB",
+	EvEFIHandoffTables:           "EV_EFI_HANDOFF_TABLES",
+	EvEFIPlatformFirmwareBlob2:   "EV_EFI_PLATFORM_FIRMWARE_BLOB2",
+	EvEFIHandoffTables2:          "EV_EFI_HANDOFF_TABLES2",
+	EvEFIVariableBoot2:           "EV_EFI_VARIABLE_BOOT2",
+	EvEFIHCRTMEvent:              "EV_EFI_HCRTM_EVENT",
+	EvEFIVariableAuthority:       "EV_EFI_VARIABLE_AUTHORITY",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("EV_UNKNOWN(0x%08x)", uint32(t))
+}
+
+// Event is a single entry of the event log.
+type Event struct {
+	// Index is the position of the event in the log, starting at 0.
+	Index   int
+	PCR     uint32
+	Type    EventType
+	Digests map[Algorithm][]byte
+	Data    []byte
+}
+
+// Description returns the event data as a string with trailing NUL bytes
+// removed. GRUB records the measured file name or command this way.
+func (e *Event) Description() string {
+	return string(bytes.TrimRight(e.Data, "\x00"))
+}
+
+func (e *Event) String() string {
+	return fmt.Sprintf("#%d PCR %d %v", e.Index, e.PCR, e.Type)
+}
+
+// EventLog is a parsed TCG event log.
+type EventLog struct {
+	// Algorithms lists the digests recorded for every event. Logs in
+	// the legacy (TPM 1.2) format only contain SHA1 digests.
+	Algorithms []Algorithm
+	Events     []Event
+	// startupLocality is taken from the StartupLocality EV_NO_ACTION
+	// event and determines the initial value of PCR 0.
+	startupLocality byte
+}
+
+const (
+	specIDSignature          = "Spec ID Event03\x00"
+	startupLocalitySignature = "StartupLocality\x00"
+)
+
+var ErrTruncated = errors.New("tpm: event log truncated")
+
+// ParseEventLog parses a TCG PC Client event log as exposed by the kernel
+// in /sys/kernel/security/tpm0/binary_bios_measurements. Both the crypto
+// agile format and the legacy SHA1-only format are supported.
+func ParseEventLog(data []byte) (*EventLog, error) {
+	r := bytes.NewReader(data)
+
+	// The first event always uses the legacy TCG_PCR_EVENT format.
+	first, err := readLegacyEvent(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading first event: %w", err)
+	}
+
+	log := &EventLog{Events: []Event{first}}
+	if first.Type != EvNoAction || !bytes.HasPrefix(first.Data, []byte(specIDSignature)) {
+		log.Algorithms = []Algorithm{AlgSHA1}
+		for r.Len() > 0 {
+			ev, err := readLegacyEvent(r)
+			if err != nil {
+				return nil, fmt.Errorf("reading event %d: %w", len(log.Events), err)
+			}
+			ev.Index = len(log.Events)
+			log.Events = append(log.Events, ev)
+		}
+		return log, nil
+	}
+
+	sizes, err := parseSpecIDEvent(first.Data)
+	if err != nil {
+		return nil, err
+	}
+	log.Algorithms = sortedAlgorithms(sizes)
+
+	for r.Len() > 0 {
+		ev, err := readEvent2(r, sizes)
+		if err != nil {
+			return nil, fmt.Errorf("reading event %d: %w", len(log.Events), err)
+		}
+		ev.Index = len(log.Events)
+		if ev.Type == EvNoAction && bytes.HasPrefix(ev.Data, []byte(startupLocalitySignature)) {
+			if len(ev.Data) > len(startupLocalitySignature) {
+				log.startupLocality = ev.Data[len(startupLocalitySignature)]
+			}
+		}
+		log.Events = append(log.Events, ev)
+	}
+	return log, nil
+}
+
+func readLegacyEvent(r *bytes.Reader) (Event, error) {
+	var hdr struct {
+		PCR    uint32
+		Type   EventType
+		Digest [20]byte
+		Size   uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return Event{}, truncated(err)
+	}
+	data, err := readBytes(r, int(hdr.Size))
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		PCR:     hdr.PCR,
+		Type:    hdr.Type,
+		Digests: map[Algorithm][]byte{AlgSHA1: hdr.Digest[:]},
+		Data:    data,
+	}, nil
+}
+
+func readEvent2(r *bytes.Reader, sizes map[Algorithm]uint16) (Event, error) {
+	var hdr struct {
+		PCR   uint32
+		Type  EventType
+		Count uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return Event{}, truncated(err)
+	}
+
+	ev := Event{
+		PCR:     hdr.PCR,
+		Type:    hdr.Type,
+		Digests: make(map[Algorithm][]byte, hdr.Count),
+	}
+	for i := uint32(0); i < hdr.Count; i++ {
+		var alg Algorithm
+		if err := binary.Read(r, binary.LittleEndian, &alg); err != nil {
+			return Event{}, truncated(err)
+		}
+		size, ok := sizes[alg]
+		if !ok {
+			return Event{}, fmt.Errorf("digest algorithm %v not declared in Spec ID event", alg)
+		}
+		digest, err := readBytes(r, int(size))
+		if err != nil {
+			return Event{}, err
+		}
+		ev.Digests[alg] = digest
+	}
+
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return Event{}, truncated(err)
+	}
+	data, err := readBytes(r, int(size))
+	if err != nil {
+		return Event{}, err
+	}
+	ev.Data = data
+	return ev, nil
+}
+
+// parseSpecIDEvent returns the digest sizes declared in the
+// TCG_EfiSpecIDEventStruct of the first event.
+func parseSpecIDEvent(data []byte) (map[Algorithm]uint16, error) {
+	r := bytes.NewReader(data[len(specIDSignature):])
+	var hdr struct {
+		PlatformClass uint32
+		VersionMinor  uint8
+		VersionMajor  uint8
+		Errata        uint8
+		UintnSize     uint8
+		NumAlgorithms uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("parsing Spec ID event: %w", truncated(err))
+	}
+	if hdr.VersionMajor != 2 {
+		return nil, fmt.Errorf("unsupported event log version %d.%d", hdr.VersionMajor, hdr.VersionMinor)
+	}
+
+	sizes := make(map[Algorithm]uint16, hdr.NumAlgorithms)
+	for i := uint32(0); i < hdr.NumAlgorithms; i++ {
+		var alg struct {
+			ID   Algorithm
+			Size uint16
+		}
+		if err := binary.Read(r, binary.LittleEndian, &alg); err != nil {
+			return nil, fmt.Errorf("parsing Spec ID event: %w", truncated(err))
+		}
+		sizes[alg.ID] = alg.Size
+	}
+	if len(sizes) == 0 {
+		return nil, errors.New("Spec ID event declares no digest algorithms")
+	}
+	return sizes, nil
+}
+
+func sortedAlgorithms(sizes map[Algorithm]uint16) []Algorithm {
+	algs := make([]Algorithm, 0, len(sizes))
+	for alg := range sizes {
+		algs = append(algs, alg)
+	}
+	sort.Slice(algs, func(i, j int) bool { return algs[i] < algs[j] })
+	return algs
+}
+
+func readBytes(r *bytes.Reader, n int) ([]byte, error) {
+	if n > r.Len() {
+		return nil, ErrTruncated
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, truncated(err)
+	}
+	return buf, nil
+}
+
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncated
+	}
+	return err
+}
@@ -0,0 +1,234 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package tpm
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+type testEvent struct {
+	pcr  uint32
+	typ  EventType
+	data []byte
+	// measured is hashed to produce the event digests; data is used
+	// if nil.
+	measured []byte
+}
+
+func (e testEvent) digests() ([]byte, []byte) {
+	m := e.measured
+	if m == nil {
+		m = e.data
+	}
+	s1 := sha1.Sum(m)
+	s256 := sha256.Sum256(m)
+	return s1[:], s256[:]
+}
+
+// buildCryptoAgileLog encodes events in the TCG crypto agile format with
+// SHA1 and SHA256 banks, preceded by the Spec ID event.
+func buildCryptoAgileLog(t *testing.T, events []testEvent) []byte {
+	var buf bytes.Buffer
+	w := func(v interface{}) {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var spec bytes.Buffer
+	spec.WriteString(specIDSignature)
+	binary.Write(&spec, binary.LittleEndian, struct {
+		PlatformClass uint32
+		Minor, Major  uint8
+		Errata, Uintn uint8
+		NumAlgs       uint32
+		SHA1          [2]uint16
+		SHA256        [2]uint16
+		VendorSize    uint8
+	}{0, 0, 2, 0, 2, 2, [2]uint16{uint16(AlgSHA1), 20}, [2]uint16{uint16(AlgSHA256), 32}, 0})
+
+	w(uint32(0))
+	w(EvNoAction)
+	w([20]byte{})
+	w(uint32(spec.Len()))
+	buf.Write(spec.Bytes())
+
+	for _, ev := range events {
+		s1, s256 := ev.digests()
+		w(ev.pcr)
+		w(ev.typ)
+		w(uint32(2))
+		w(AlgSHA1)
+		buf.Write(s1)
+		w(AlgSHA256)
+		buf.Write(s256)
+		w(uint32(len(ev.data)))
+		buf.Write(ev.data)
+	}
+	return buf.Bytes()
+}
+
+func extend(t *testing.T, measurements ...[]byte) []byte {
+	pcr := make([]byte, sha256.Size)
+	for _, m := range measurements {
+		d := sha256.Sum256(m)
+		next := sha256.Sum256(append(pcr, d[:]...))
+		pcr = next[:]
+	}
+	return pcr
+}
+
+var (
+	testKernel  = []byte("not really a kernel")
+	testCmdline = "/flatcar/vmlinuz-a mount.usr=PARTUUID=7130c94a root=LABEL=ROOT"
+	testEvents  = []testEvent{
+		{pcr: 0, typ: EvNoAction, data: []byte(startupLocalitySignature + "\x03")},
+		{pcr: 0, typ: EvSCRTMVersion, data: []byte("firmware")},
+		{pcr: 4, typ: EvSeparator, data: []byte{0, 0, 0, 0}},
+		{pcr: 8, typ: EvIPL, data: []byte("grub_cmd: set timeout=1\x00"), measured: []byte("set timeout=1")},
+		{pcr: 8, typ: EvIPL, data: []byte("kernel_cmdline: " + testCmdline + "\x00"), measured: []byte(testCmdline)},
+		{pcr: 9, typ: EvIPL, data: []byte("(hd0,gpt1)/flatcar/vmlinuz-a\x00"), measured: testKernel},
+	}
+)
+
+func TestParseEventLog(t *testing.T) {
+	log, err := ParseEventLog(buildCryptoAgileLog(t, testEvents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log.Algorithms) != 2 || log.Algorithms[0] != AlgSHA1 || log.Algorithms[1] != AlgSHA256 {
+		t.Errorf("unexpected algorithms %v", log.Algorithms)
+	}
+	// The Spec ID event is included.
+	if len(log.Events) != len(testEvents)+1 {
+		t.Fatalf("expected %d events, got %d", len(testEvents)+1, len(log.Events))
+	}
+	ev := log.Events[len(log.Events)-1]
+	if ev.Index != len(testEvents) || ev.PCR != 9 || ev.Type != EvIPL {
+		t.Errorf("unexpected last event %v", &ev)
+	}
+	if ev.Description() != "(hd0,gpt1)/flatcar/vmlinuz-a" {
+		t.Errorf("unexpected description %q", ev.Description())
+	}
+	if log.startupLocality != 3 {
+		t.Errorf("expected startup locality 3, got %d", log.startupLocality)
+	}
+}
+
+func TestParseEventLogTruncated(t *testing.T) {
+	data := buildCryptoAgileLog(t, testEvents)
+	if _, err := ParseEventLog(data[:len(data)-3]); err == nil || !strings.Contains(err.Error(), ErrTruncated.Error()) {
+		t.Errorf("expected truncation error, got %v", err)
+	}
+}
+
+func TestParseLegacyEventLog(t *testing.T) {
+	var buf bytes.Buffer
+	for _, ev := range testEvents[1:] {
+		s1, _ := ev.digests()
+		binary.Write(&buf, binary.LittleEndian, ev.pcr)
+		binary.Write(&buf, binary.LittleEndian, ev.typ)
+		buf.Write(s1)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(ev.data)))
+		buf.Write(ev.data)
+	}
+	log, err := ParseEventLog(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log.Events) != len(testEvents)-1 {
+		t.Fatalf("expected %d events, got %d", len(testEvents)-1, len(log.Events))
+	}
+	if !log.HasAlgorithm(AlgSHA1) || log.HasAlgorithm(AlgSHA256) {
+		t.Errorf("unexpected algorithms %v", log.Algorithms)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	log, err := ParseEventLog(buildCryptoAgileLog(t, testEvents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcrs, err := log.Replay(AlgSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := PCRs{
+		4: extend(t, []byte{0, 0, 0, 0}),
+		8: extend(t, []byte("set timeout=1"), []byte(testCmdline)),
+		9: extend(t, testKernel),
+	}
+	// PCR 0 starts out with the startup locality.
+	pcr0 := make([]byte, sha256.Size)
+	pcr0[sha256.Size-1] = 3
+	d := sha256.Sum256([]byte("firmware"))
+	sum := sha256.Sum256(append(pcr0, d[:]...))
+	want[0] = sum[:]
+
+	for _, i := range want.Indexes() {
+		if !bytes.Equal(pcrs[i], want[i]) {
+			t.Errorf("PCR %d: expected %x, got %x", i, want[i], pcrs[i])
+		}
+	}
+	if len(pcrs) != len(want) {
+		t.Errorf("expected PCRs %v, got %v", want.Indexes(), pcrs.Indexes())
+	}
+
+	if err := log.Verify(AlgSHA256, want); err != nil {
+		t.Errorf("verify failed: %v", err)
+	}
+	want[8] = make([]byte, sha256.Size)
+	if err := log.Verify(AlgSHA256, want); err == nil || !strings.Contains(err.Error(), "PCR 8") {
+		t.Errorf("expected PCR 8 mismatch, got %v", err)
+	}
+	if err := log.Verify(AlgSHA384, want); err == nil {
+		t.Errorf("expected error for missing bank")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	log, err := ParseEventLog(buildCryptoAgileLog(t, testEvents))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = log.Check(AlgSHA256,
+		Kernel("/flatcar/vmlinuz-a", testKernel),
+		KernelCmdline("BOOT_IMAGE="+testCmdline+"\n"),
+		GRUBCommand("set timeout=1"))
+	if err != nil {
+		t.Errorf("check failed: %v", err)
+	}
+
+	err = log.Check(AlgSHA256,
+		Kernel("/flatcar/vmlinuz-a", []byte("another kernel")),
+		KernelCmdline(testCmdline+" flatcar.autologin"),
+		Initrd("/flatcar/initrd", nil))
+	if err == nil {
+		t.Fatal("expected check to fail")
+	}
+	for _, name := range []string{"kernel:", "kernel command line:", "initrd: not measured"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("expected %q in error %q", name, err)
+		}
+	}
+}
+
+func TestBootImage(t *testing.T) {
+	for cmdline, want := range map[string]string{
+		"BOOT_IMAGE=/flatcar/vmlinuz-a root=LABEL=ROOT":           "/flatcar/vmlinuz-a",
+		"BOOT_IMAGE=(hd0,gpt1)/flatcar/vmlinuz-b root=LABEL=ROOT": "/flatcar/vmlinuz-b",
+		"root=LABEL=ROOT": "",
+	} {
+		if got := bootImage(cmdline); got != want {
+			t.Errorf("bootImage(%q): expected %q, got %q", cmdline, want, got)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package tpm
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// PCRs used by Flatcar's boot chain.
+const (
+	// PCRBootLoaderCode holds the Authenticode hashes of the EFI
+	// applications loaded during boot (shim, GRUB).
+	PCRBootLoaderCode uint32 = 4
+	// PCRGRUBStrings holds the GRUB commands and kernel command line.
+	PCRGRUBStrings uint32 = 8
+	// PCRGRUBFiles holds the files read by GRUB, including the kernel.
+	PCRGRUBFiles uint32 = 9
+)
+
+// Expectation describes a measurement that must be present in an event
+// log.
+type Expectation struct {
+	// Name is used in error messages, e.g. "shim" or "kernel".
+	Name string
+	PCR  uint32
+	Type EventType
+	// Match selects the events this expectation is about, e.g. by
+	// their description. If nil, the expectation is met by any event
+	// of Type in PCR carrying the expected digest.
+	Match func(*Event) bool
+	// Digest computes the expected digest for the given algorithm.
+	Digest func(Algorithm) ([]byte, error)
+}
+
+// EFIApplication expects the Authenticode hash of a PE image to be measured
+// into PCR 4, as firmware does for shim and shim does for GRUB.
+func EFIApplication(name string, image []byte) Expectation {
+	return Expectation{
+		Name: name,
+		PCR:  PCRBootLoaderCode,
+		Type: EvEFIBootServicesApplication,
+		Digest: func(alg Algorithm) ([]byte, error) {
+			return AuthenticodeDigest(image, alg)
+		},
+	}
+}
+
+// GRUBFile expects GRUB to have measured a file into PCR 9. GRUB records
+// the path it opened, which may carry a device prefix, so events are
+// matched by path suffix.
+func GRUBFile(name, path string, contents []byte) Expectation {
+	return Expectation{
+		Name: name,
+		PCR:  PCRGRUBFiles,
+		Type: EvIPL,
+		Match: func(ev *Event) bool {
+			return strings.HasSuffix(ev.Description(), path)
+		},
+		Digest: func(alg Algorithm) ([]byte, error) {
+			return alg.Sum(contents)
+		},
+	}
+}
+
+// Kernel expects GRUB to have measured the kernel image at path.
+func Kernel(path string, contents []byte) Expectation {
+	return GRUBFile("kernel", path, contents)
+}
+
+// Initrd expects GRUB to have measured the initrd image at path.
+func Initrd(path string, contents []byte) Expectation {
+	return GRUBFile("initrd", path, contents)
+}
+
+// KernelCmdline expects GRUB to have measured the kernel command line into
+// PCR 8. GRUB measures the command line without the BOOT_IMAGE= prefix
+// that the kernel shows in /proc/cmdline, so it is stripped if present.
+func KernelCmdline(cmdline string) Expectation {
+	cmdline = strings.TrimPrefix(strings.TrimSpace(cmdline), "BOOT_IMAGE=")
+	return grubString("kernel command line", cmdline, func(desc string) bool {
+		return strings.HasPrefix(desc, "kernel_cmdline: ")
+	})
+}
+
+// GRUBCommand expects GRUB to have executed and measured the command.
+func GRUBCommand(cmd string) Expectation {
+	return grubString(fmt.Sprintf("GRUB command %q", cmd), cmd, func(desc string) bool {
+		return desc == "grub_cmd: "+cmd
+	})
+}
+
+// grubString expects a string measured by GRUB into PCR 8. GRUB logs the
+// string with a prefix as event data but only hashes the string itself.
+func grubString(name, value string, match func(desc string) bool) Expectation {
+	return Expectation{
+		Name: name,
+		PCR:  PCRGRUBStrings,
+		Type: EvIPL,
+		Match: func(ev *Event) bool {
+			return match(ev.Description())
+		},
+		Digest: func(alg Algorithm) ([]byte, error) {
+			return alg.Sum([]byte(value))
+		},
+	}
+}
+
+// Check verifies that every expectation is met by the log using digests
+// of the given algorithm. All failures are reported in a single error.
+func (l *EventLog) Check(alg Algorithm, expectations ...Expectation) error {
+	if !l.HasAlgorithm(alg) {
+		return fmt.Errorf("event log has no %v digests", alg)
+	}
+
+	var failures []string
+	for _, exp := range expectations {
+		if err := l.check(alg, exp); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", exp.Name, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("unexpected measurements:\n%s", strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+func (l *EventLog) check(alg Algorithm, exp Expectation) error {
+	want, err := exp.Digest(alg)
+	if err != nil {
+		return err
+	}
+
+	events := l.Filter(exp.PCR, exp.Type)
+	if exp.Match == nil {
+		for _, ev := range events {
+			if bytes.Equal(ev.Digests[alg], want) {
+				return nil
+			}
+		}
+		return fmt.Errorf("no %v event in PCR %d with digest %x", exp.Type, exp.PCR, want)
+	}
+
+	var matched []Event
+	for i := range events {
+		if exp.Match(&events[i]) {
+			matched = append(matched, events[i])
+		}
+	}
+	if len(matched) == 0 {
+		return fmt.Errorf("not measured into PCR %d", exp.PCR)
+	}
+	var wrong []string
+	for _, ev := range matched {
+		if bytes.Equal(ev.Digests[alg], want) {
+			return nil
+		}
+		wrong = append(wrong, fmt.Sprintf("%v %q has %x", &ev, ev.Description(), ev.Digests[alg]))
+	}
+	return fmt.Errorf("expected digest %x, but %s", want, strings.Join(wrong, ", "))
+}
@@ -0,0 +1,129 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package tpm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/flatcar/mantle/platform"
+)
+
+const (
+	eventLogPath = "/sys/kernel/security/tpm0/binary_bios_measurements"
+	// espMountpoint is where Flatcar mounts the EFI system partition.
+	espMountpoint = "/boot"
+)
+
+// ReadFile fetches a file from the machine as root.
+func ReadFile(m platform.Machine, file string) ([]byte, error) {
+	out, stderr, err := m.SSH(fmt.Sprintf("sudo base64 -w0 %s", file))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v: %s", file, err, stderr)
+	}
+	data, err := base64.StdEncoding.DecodeString(string(out))
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", file, err)
+	}
+	return data, nil
+}
+
+// ReadEventLog retrieves and parses the TCG event log the kernel received
+// from the firmware.
+func ReadEventLog(m platform.Machine) (*EventLog, error) {
+	data, err := ReadFile(m, eventLogPath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseEventLog(data)
+}
+
+// ReadPCRs reads the current PCR bank for alg from sysfs.
+func ReadPCRs(m platform.Machine, alg Algorithm) (PCRs, error) {
+	dir := fmt.Sprintf("/sys/class/tpm/tpm0/pcr-%v", alg)
+	out, stderr, err := m.SSH(fmt.Sprintf("sudo grep -H . %s/*", dir))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v: %s", dir, err, stderr)
+	}
+
+	pcrs := make(PCRs)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		file, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			return nil, fmt.Errorf("unexpected PCR line %q", scanner.Text())
+		}
+		index, err := strconv.ParseUint(path.Base(file), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected PCR file %q", file)
+		}
+		digest, err := hex.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("PCR %d: %v", index, err)
+		}
+		pcrs[uint32(index)] = digest
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return pcrs, nil
+}
+
+// BootExpectations builds the expected measurements of the boot chain from
+// the artifacts on the machine's EFI system partition and its kernel
+// command line: shim and GRUB in PCR 4, the command line in PCR 8 and the
+// booted kernel in PCR 9.
+func BootExpectations(m platform.Machine) ([]Expectation, error) {
+	cmdline, stderr, err := m.SSH("cat /proc/cmdline")
+	if err != nil {
+		return nil, fmt.Errorf("reading kernel command line: %v: %s", err, stderr)
+	}
+	exps := []Expectation{KernelCmdline(string(cmdline))}
+
+	kernel := bootImage(string(cmdline))
+	if kernel == "" {
+		return nil, fmt.Errorf("no BOOT_IMAGE in kernel command line %q", cmdline)
+	}
+	contents, err := ReadFile(m, path.Join(espMountpoint, kernel))
+	if err != nil {
+		return nil, err
+	}
+	exps = append(exps, Kernel(kernel, contents))
+
+	// bootx64.efi/bootaa64.efi is shim, which chainloads
+	// grubx64.efi/grubaa64.efi. Images without shim only ship the
+	// former, which then is GRUB itself.
+	apps, stderr, err := m.SSH(fmt.Sprintf("ls %s/EFI/boot/boot*.efi %s/EFI/boot/grub*.efi 2>/dev/null || true", espMountpoint, espMountpoint))
+	if err != nil {
+		return nil, fmt.Errorf("listing EFI applications: %v: %s", err, stderr)
+	}
+	for _, app := range strings.Fields(string(apps)) {
+		image, err := ReadFile(m, app)
+		if err != nil {
+			return nil, err
+		}
+		exps = append(exps, EFIApplication(path.Base(app), image))
+	}
+	return exps, nil
+}
+
+// bootImage returns the kernel path GRUB passed as BOOT_IMAGE, without any
+// GRUB device prefix such as "(hd0,gpt1)".
+func bootImage(cmdline string) string {
+	for _, arg := range strings.Fields(cmdline) {
+		if img, ok := strings.CutPrefix(arg, "BOOT_IMAGE="); ok {
+			if i := strings.Index(img, ")"); strings.HasPrefix(img, "(") && i >= 0 {
+				img = img[i+1:]
+			}
+			return img
+		}
+	}
+	return ""
+}
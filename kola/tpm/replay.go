@@ -0,0 +1,126 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package tpm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PCRs maps PCR indexes to their values for a single hash algorithm.
+type PCRs map[uint32][]byte
+
+// Indexes returns the PCR indexes in ascending order.
+func (p PCRs) Indexes() []uint32 {
+	idx := make([]uint32, 0, len(p))
+	for i := range p {
+		idx = append(idx, i)
+	}
+	sort.Slice(idx, func(i, j int) bool { return idx[i] < idx[j] })
+	return idx
+}
+
+// HasAlgorithm reports whether the log records digests for alg.
+func (l *EventLog) HasAlgorithm(alg Algorithm) bool {
+	for _, a := range l.Algorithms {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// Replay computes the PCR values that result from extending every measured
+// event in the log. Only PCRs that have at least one event are returned.
+func (l *EventLog) Replay(alg Algorithm) (PCRs, error) {
+	if !l.HasAlgorithm(alg) {
+		return nil, fmt.Errorf("event log has no %v digests", alg)
+	}
+	size := alg.Hash().Size()
+
+	pcrs := make(PCRs)
+	for _, ev := range l.Events {
+		if ev.Type == EvNoAction {
+			continue
+		}
+		digest, ok := ev.Digests[alg]
+		if !ok {
+			return nil, fmt.Errorf("event %v has no %v digest", &ev, alg)
+		}
+		cur, ok := pcrs[ev.PCR]
+		if !ok {
+			cur = make([]byte, size)
+			if ev.PCR == 0 {
+				cur[size-1] = l.startupLocality
+			}
+		}
+		next, err := alg.Sum(append(append([]byte{}, cur...), digest...))
+		if err != nil {
+			return nil, err
+		}
+		pcrs[ev.PCR] = next
+	}
+	return pcrs, nil
+}
+
+// Verify replays the log and compares the result with the given PCR values,
+// as read from the TPM. If no indexes are passed, every PCR with events in
+// the log is compared; PCRs extended without logging through the firmware
+// (e.g. by systemd) must therefore not be passed explicitly.
+func (l *EventLog) Verify(alg Algorithm, actual PCRs, indexes ...uint32) error {
+	replayed, err := l.Replay(alg)
+	if err != nil {
+		return err
+	}
+	if len(indexes) == 0 {
+		indexes = replayed.Indexes()
+	}
+
+	var mismatches []string
+	for _, i := range indexes {
+		want, ok := replayed[i]
+		if !ok {
+			want = make([]byte, alg.Hash().Size())
+		}
+		got, ok := actual[i]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("PCR %d: not read from TPM", i))
+			continue
+		}
+		if !bytes.Equal(want, got) {
+			mismatches = append(mismatches, fmt.Sprintf("PCR %d: replayed %x, TPM has %x", i, want, got))
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("event log does not match TPM %v PCRs:\n%s", alg, strings.Join(mismatches, "\n"))
+	}
+	return nil
+}
+
+// Filter returns the events extended into the given PCR, optionally
+// restricted to the given event types.
+func (l *EventLog) Filter(pcr uint32, types ...EventType) []Event {
+	var events []Event
+	for _, ev := range l.Events {
+		if ev.PCR != pcr {
+			continue
+		}
+		if len(types) > 0 && !hasType(types, ev.Type) {
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func hasType(types []EventType, t EventType) bool {
+	for _, tt := range types {
+		if tt == t {
+			return true
+		}
+	}
+	return false
+}
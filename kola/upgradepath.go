@@ -0,0 +1,152 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package kola
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+
+	"github.com/flatcar/mantle/harness"
+	"github.com/flatcar/mantle/kola/cluster"
+	"github.com/flatcar/mantle/kola/register"
+	"github.com/flatcar/mantle/sdk"
+)
+
+var (
+	// UpgradePath lists the versions the cl.update.path test upgrades
+	// the booted image through, see ParseUpgradePath.
+	UpgradePath []string
+	// UpgradePayloadURL is where payloads of versions without one are
+	// downloaded from, @ARCH@ and @VERSION@ are replaced.
+	UpgradePayloadURL string
+	// UpgradeTests are patterns of the tests run on the upgraded
+	// machine, see RunUpgradeTests.
+	UpgradeTests []string
+
+	// upgradeTests are the tests matching UpgradeTests for the last
+	// version of UpgradePath, filtered by RunTests.
+	upgradeTests map[string]*register.Test
+)
+
+// UpgradeHop is an update of an upgrade path.
+type UpgradeHop struct {
+	Version semver.Version
+	// Payload is the path or URL of the update payload.
+	Payload string
+}
+
+// ParseUpgradePath parses entries of the form VERSION or VERSION=PAYLOAD
+// in the order they are applied. Payloads of versions without one are
+// downloaded from UpgradePayloadURL.
+func ParseUpgradePath(entries []string, arch string) ([]UpgradeHop, error) {
+	var hops []UpgradeHop
+	for _, entry := range entries {
+		version, payload, _ := strings.Cut(entry, "=")
+		var hop UpgradeHop
+		if err := hop.Version.Set(version); err != nil {
+			return nil, fmt.Errorf("upgrade path entry %q: %v", entry, err)
+		}
+		if len(hops) != 0 && !hops[len(hops)-1].Version.LessThan(hop.Version) {
+			return nil, fmt.Errorf("upgrade path entry %q: version not newer than %s", entry, hops[len(hops)-1].Version)
+		}
+		hop.Payload = payload
+		if hop.Payload == "" {
+			if UpgradePayloadURL == "" {
+				return nil, fmt.Errorf("upgrade path entry %q: no payload and no payload URL", entry)
+			}
+			hop.Payload = strings.NewReplacer("@ARCH@", arch, "@VERSION@", version).Replace(UpgradePayloadURL)
+		}
+		hops = append(hops, hop)
+	}
+	return hops, nil
+}
+
+// FetchPayload returns the path of the payload of the hop, downloading it
+// to dir if it is a URL.
+func (hop *UpgradeHop) FetchPayload(dir string) (string, error) {
+	if !strings.Contains(hop.Payload, "://") {
+		return hop.Payload, nil
+	}
+	path := filepath.Join(dir, hop.Version.String(), filepath.Base(hop.Payload))
+	if err := sdk.DownloadFile(path, hop.Payload, nil); err != nil {
+		return "", fmt.Errorf("downloading payload of %s: %v", hop.Version, err)
+	}
+	return path, nil
+}
+
+// filterUpgradeTests checks UpgradePath and selects the tests of
+// UpgradeTests which apply to its last version.
+func filterUpgradeTests(channel, offering, pltfrm string) error {
+	if len(UpgradePath) == 0 {
+		return nil
+	}
+	hops, err := ParseUpgradePath(UpgradePath, architecture(pltfrm))
+	if err != nil {
+		return err
+	}
+	// Downloaded payloads are release payloads signed with the
+	// production key, the machine would reject them after booting.
+	if !ForceFlatcarKey {
+		for _, hop := range hops {
+			if strings.Contains(hop.Payload, "://") {
+				return fmt.Errorf("payload of %s is downloaded from %s, which needs --force-flatcar-key", hop.Version, hop.Payload)
+			}
+		}
+	}
+	if len(UpgradeTests) == 0 {
+		return nil
+	}
+	upgradeTests, err = FilterTests(register.Tests, UpgradeTests, channel, offering, pltfrm, hops[len(hops)-1].Version)
+	return err
+}
+
+// RunUpgradeTests runs the tests matching UpgradeTests as subtests on the
+// single machine of c, after it has been upgraded. Tests needing more
+// machines or their own config are skipped. kolet is uploaded for tests
+// with native functions, which run under the name of the test like in
+// runTest.
+func RunUpgradeTests(c cluster.TestCluster) {
+	names := make([]string, 0, len(upgradeTests))
+	for name := range upgradeTests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	koletUploaded := false
+	for _, name := range names {
+		t := upgradeTests[name]
+		c.H.Run(name, func(h *harness.H) {
+			switch {
+			case t.Name == c.H.Name():
+				h.Skip("test is running the upgrade")
+			case t.ClusterSize != 1:
+				h.Skipf("test runs on %d machines, not the upgraded one", t.ClusterSize)
+			case t.UserData != nil || t.UserDataV3 != nil || t.Config != nil:
+				h.Skip("test needs its own machine config")
+			}
+
+			var natives []string
+			for name := range t.Natives() {
+				natives = append(natives, name)
+			}
+			tcluster := cluster.TestCluster{
+				H:           h,
+				Cluster:     c.Cluster,
+				NativeFuncs: natives,
+				NativeArgs:  t.NativeArgs,
+				TestName:    t.Name,
+				FailFast:    t.FailFast,
+			}
+			if len(natives) != 0 && !koletUploaded {
+				ScpKolet(tcluster, architecture(string(c.Platform())))
+				koletUploaded = true
+			}
+			t.Run(tcluster)
+		})
+	}
+}
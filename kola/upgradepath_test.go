@@ -0,0 +1,67 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package kola
+
+import (
+	"testing"
+)
+
+func TestParseUpgradePath(t *testing.T) {
+	defer func(url string) { UpgradePayloadURL = url }(UpgradePayloadURL)
+	UpgradePayloadURL = "https://example.com/@ARCH@-usr/@VERSION@/update.gz"
+
+	hops, err := ParseUpgradePath([]string{"3510.2.0", "3602.2.0=/tmp/update.gz", "3815.2.0+dev"}, "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expect := range []struct {
+		version, payload string
+	}{
+		{"3510.2.0", "https://example.com/amd64-usr/3510.2.0/update.gz"},
+		{"3602.2.0", "/tmp/update.gz"},
+		{"3815.2.0+dev", "https://example.com/amd64-usr/3815.2.0+dev/update.gz"},
+	} {
+		if hops[i].Version.String() != expect.version || hops[i].Payload != expect.payload {
+			t.Errorf("hop %d: %s from %s, expected %s from %s", i, hops[i].Version, hops[i].Payload, expect.version, expect.payload)
+		}
+	}
+
+	for _, entries := range [][]string{
+		{"3510.2"},
+		{"3602.2.0", "3510.2.0"},
+		{"3510.2.0", "3510.2.0"},
+	} {
+		if _, err := ParseUpgradePath(entries, "amd64"); err == nil {
+			t.Errorf("%v: no error", entries)
+		}
+	}
+
+	UpgradePayloadURL = ""
+	if _, err := ParseUpgradePath([]string{"3510.2.0"}, "amd64"); err == nil {
+		t.Error("version without payload or payload URL: no error")
+	}
+}
+
+func TestFilterUpgradeTestsKey(t *testing.T) {
+	defer func(path []string, url string, force bool) {
+		UpgradePath, UpgradePayloadURL, ForceFlatcarKey = path, url, force
+	}(UpgradePath, UpgradePayloadURL, ForceFlatcarKey)
+	UpgradePayloadURL = "https://example.com/@ARCH@-usr/@VERSION@/update.gz"
+
+	UpgradePath = []string{"3510.2.0", "3602.2.0=/tmp/update.gz"}
+	ForceFlatcarKey = false
+	if err := filterUpgradeTests("", "", "qemu"); err == nil {
+		t.Error("downloaded payload accepted without the production key")
+	}
+	ForceFlatcarKey = true
+	if err := filterUpgradeTests("", "", "qemu"); err != nil {
+		t.Error(err)
+	}
+
+	UpgradePath = []string{"3602.2.0=/tmp/update.gz"}
+	ForceFlatcarKey = false
+	if err := filterUpgradeTests("", "", "qemu"); err != nil {
+		t.Error(err)
+	}
+}
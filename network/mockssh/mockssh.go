@@ -26,6 +26,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"sync"
 
 	"golang.org/x/crypto/ssh"
 
@@ -118,6 +119,37 @@ func NewMockClient(handler SessionHandler) *ssh.Client {
 	return ssh.NewClient(conn, chans, reqs)
 }
 
+// Dialer connects every dialed address to a new ssh server backed by the
+// handler, so that code using a network.Dialer can be tested without real
+// machines. The server accepts any password or public key.
+type Dialer struct {
+	handler SessionHandler
+
+	mu    sync.Mutex
+	addrs []string
+}
+
+// NewMockDialer returns a Dialer for the given handler.
+func NewMockDialer(handler SessionHandler) *Dialer {
+	return &Dialer{handler: handler}
+}
+
+// Dial starts a new mock server and returns the client side of the
+// connection to it.
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	d.mu.Lock()
+	d.addrs = append(d.addrs, address)
+	d.mu.Unlock()
+	return startMockServer(d.handler), nil
+}
+
+// Addrs returns the addresses dialed so far.
+func (d *Dialer) Addrs() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.addrs...)
+}
+
 type mockServer struct {
 	config  ssh.ServerConfig
 	handler SessionHandler
@@ -130,6 +162,9 @@ func startMockServer(handler SessionHandler) net.Conn {
 			PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
 				return nil, nil
 			},
+			PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+				return nil, nil
+			},
 		},
 		handler: handler,
 	}
@@ -17,6 +17,8 @@ package mockssh
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
 	"fmt"
 	"io"
 	"os"
@@ -226,3 +228,49 @@ func TestMain(m *testing.M) {
 		}
 	}
 }
+
+func TestDialerPublicKey(t *testing.T) {
+	dialer := NewMockDialer(func(s *Session) {
+		io.WriteString(s.Stdout, s.Exec)
+		s.Exit(0)
+	})
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.Dial("tcp", "192.0.2.1:22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshconn, chans, reqs, err := ssh.NewClientConn(conn, "192.0.2.1:22", &ssh.ClientConfig{
+		User:            "core",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := ssh.NewClient(sshconn, chans, reqs)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := session.Output("uptime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "uptime" {
+		t.Errorf("unexpected output %q", out)
+	}
+	if addrs := dialer.Addrs(); len(addrs) != 1 || addrs[0] != "192.0.2.1:22" {
+		t.Errorf("unexpected dialed addresses %v", addrs)
+	}
+}
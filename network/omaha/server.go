@@ -0,0 +1,371 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package omaha is an Omaha update server intended for testing. It
+// offers several versions of several apps to groups of machines,
+// optionally rolling them out gradually or forcing downgrades, and records
+// every request so tests can check how machines behaved.
+package omaha
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-omaha/omaha"
+	"github.com/coreos/go-semver/semver"
+	"github.com/coreos/pkg/capnslog"
+)
+
+var plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "network/omaha")
+
+// AnyApp and AnyGroup register versions and channels for apps and groups
+// without their own.
+const (
+	AnyApp   = ""
+	AnyGroup = ""
+)
+
+// Kinds of records.
+const (
+	RecordUpdateCheck = "updatecheck"
+	RecordPing        = "ping"
+	RecordEvent       = "event"
+)
+
+// Version is an update which can be offered to machines.
+type Version struct {
+	// Version is reported to machines. It is compared with the version
+	// of machines unless empty, in which case the update is always
+	// offered.
+	Version string
+	// Payload is the path of the update payload.
+	Payload string
+	// Name is the last component of the payload URL, "update.gz" if
+	// empty.
+	Name string
+}
+
+// Channel decides which version is offered to a group of machines.
+type Channel struct {
+	// Version is the version to offer, see AddVersion.
+	Version string
+	// Rollout is the percentage of machines offered the version. A
+	// machine's bucket is derived from its machine ID, the app, group
+	// and version so it stays the same over update checks.
+	Rollout int
+	// Downgrade also offers the version to machines running a newer
+	// version, forcing a rollback.
+	Downgrade bool
+}
+
+// Record is a request of a machine.
+type Record struct {
+	Time      time.Time
+	MachineID string
+	App       string
+	Group     string
+	Version   string // as reported by the machine
+	Kind      string // RecordUpdateCheck, RecordPing or RecordEvent
+	// Offered is the version offered in response to an update check,
+	// empty if there was no update or it has no version.
+	Offered string
+	Updated bool                // whether an update was offered
+	Event   *omaha.EventRequest // for RecordEvent
+}
+
+func (r Record) String() string {
+	s := fmt.Sprintf("%s %s of %s %s", r.MachineID, r.Kind, r.App, r.Version)
+	switch {
+	case r.Event != nil:
+		s += fmt.Sprintf(": %s %s", r.Event.Type, r.Event.Result)
+		if r.Event.ErrorCode != "" {
+			s += " " + r.Event.ErrorCode
+		}
+	case r.Updated:
+		s += ": offered " + r.Offered
+	}
+	return s
+}
+
+// MatchKind returns a function matching records of a kind, for Wait.
+func MatchKind(kind string) func(Record) bool {
+	return func(r Record) bool {
+		return r.Kind == kind
+	}
+}
+
+// MatchEvent returns a function matching events of a type and result, for
+// Wait.
+func MatchEvent(typ omaha.EventType, result omaha.EventResult) func(Record) bool {
+	return func(r Record) bool {
+		return r.Event != nil && r.Event.Type == typ && r.Event.Result == result
+	}
+}
+
+// Server is an Omaha server. Its Updater may be replaced to handle
+// requests differently, no requests are recorded then.
+type Server struct {
+	*omaha.Server
+
+	mu       sync.Mutex
+	versions map[string]map[string]*omaha.Update // by app and version
+	channels map[string]map[string]Channel       // by app and group
+	packages int                                 // number of served payloads
+	records  []Record
+	changed  chan struct{} // closed when a record is added
+}
+
+type updater struct {
+	omaha.UpdaterStub
+	s *Server
+}
+
+// NewServer creates a server listening on addr, which doesn't offer any
+// update yet.
+func NewServer(addr string) (*Server, error) {
+	s := &Server{
+		versions: make(map[string]map[string]*omaha.Update),
+		channels: make(map[string]map[string]Channel),
+		changed:  make(chan struct{}),
+	}
+
+	srv, err := omaha.NewServer(addr, &updater{s: s})
+	if err != nil {
+		return nil, err
+	}
+	s.Server = srv
+
+	return s, nil
+}
+
+// Destroy stops the server, logging any errors.
+func (s *Server) Destroy() {
+	if err := s.Server.Destroy(); err != nil {
+		plog.Errorf("Error destroying omaha server: %v", err)
+	}
+}
+
+// AddVersion makes a version of app available to channels.
+func (s *Server) AddVersion(app string, v Version) error {
+	if v.Name == "" {
+		v.Name = "update.gz"
+	}
+	// name may not include any path components
+	if path.Base(v.Name) != v.Name || v.Name[0] == '.' {
+		return fmt.Errorf("invalid package name %q", v.Name)
+	}
+
+	update := &omaha.Update{ID: app}
+	update.Manifest.Version = v.Version
+	pkg, err := update.Manifest.AddPackageFromPath(v.Payload)
+	if err != nil {
+		return err
+	}
+	pkg.Name = v.Name
+
+	// update_engine style postinstall action
+	act := update.Manifest.AddAction("postinstall")
+	act.DisablePayloadBackoff = true
+	act.SHA256 = pkg.SHA256
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.versions[app][v.Version]; ok {
+		return fmt.Errorf("version %q of app %q already added", v.Version, app)
+	}
+
+	// versions are served from numbered directories since app IDs
+	// and versions needn't be valid in URLs
+	update.URL.CodeBase = fmt.Sprintf("/packages/%d/", s.packages)
+	s.packages++
+	payload := v.Payload
+	s.Mux.HandleFunc(update.URL.CodeBase+v.Name, func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, payload)
+	})
+
+	if s.versions[app] == nil {
+		s.versions[app] = make(map[string]*omaha.Update)
+	}
+	s.versions[app][v.Version] = update
+	return nil
+}
+
+// SetChannel sets which version is offered to the group of app,
+// replacing the previous channel.
+func (s *Server) SetChannel(app, group string, ch Channel) error {
+	if ch.Rollout < 0 || ch.Rollout > 100 {
+		return fmt.Errorf("invalid rollout percentage %d", ch.Rollout)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.versions[app][ch.Version]; !ok {
+		return fmt.Errorf("version %q of app %q not added", ch.Version, app)
+	}
+	if s.channels[app] == nil {
+		s.channels[app] = make(map[string]Channel)
+	}
+	s.channels[app][group] = ch
+	return nil
+}
+
+// RemoveChannel stops offering updates to the group of app.
+func (s *Server) RemoveChannel(app, group string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.channels[app], group)
+}
+
+// AddPackage offers the update payload file to all machines, like
+// omaha.TrivialServer. name is the final URL component.
+func (s *Server) AddPackage(file, name string) error {
+	if err := s.AddVersion(AnyApp, Version{Payload: file, Name: name}); err != nil {
+		return err
+	}
+	return s.SetChannel(AnyApp, AnyGroup, Channel{Rollout: 100, Downgrade: true})
+}
+
+// History returns the records of a machine, or of all machines if
+// machineID is empty.
+func (s *Server) History(machineID string) []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ret []Record
+	for _, r := range s.records {
+		if machineID == "" || r.MachineID == machineID {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// Wait waits for a record of the machine, or of any machine if machineID
+// is empty, for which match returns true. Records from before the call
+// are considered too.
+func (s *Server) Wait(ctx context.Context, machineID string, match func(Record) bool) (Record, error) {
+	seen := 0
+	for {
+		s.mu.Lock()
+		records := s.records[seen:]
+		seen = len(s.records)
+		changed := s.changed
+		s.mu.Unlock()
+
+		for _, r := range records {
+			if (machineID == "" || r.MachineID == machineID) && match(r) {
+				return r, nil
+			}
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return Record{}, ctx.Err()
+		}
+	}
+}
+
+func (s *Server) record(r Record) {
+	r.Time = time.Now()
+	plog.Infof("Omaha: %s", r)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, r)
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func newRecord(app *omaha.AppRequest, kind string) Record {
+	return Record{
+		MachineID: app.MachineID,
+		App:       app.ID,
+		Group:     app.Track,
+		Version:   app.Version,
+		Kind:      kind,
+	}
+}
+
+// channel returns the channel and its update for a machine, nil if none
+// applies.
+func (s *Server) channel(app *omaha.AppRequest) (*Channel, *omaha.Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	appID := app.ID
+	if s.channels[appID] == nil {
+		appID = AnyApp
+	}
+	ch, ok := s.channels[appID][app.Track]
+	if !ok {
+		if ch, ok = s.channels[appID][AnyGroup]; !ok {
+			return nil, nil
+		}
+	}
+	return &ch, s.versions[appID][ch.Version]
+}
+
+// offer reports whether the version of a channel should be offered to a
+// machine.
+func offer(app *omaha.AppRequest, ch *Channel) bool {
+	if ch.Version != "" {
+		target, err := semver.NewVersion(ch.Version)
+		if err != nil {
+			return false
+		}
+		current, err := semver.NewVersion(app.Version)
+		if err == nil {
+			if !current.LessThan(*target) && !(ch.Downgrade && target.LessThan(*current)) {
+				return false
+			}
+		} else if app.Version == ch.Version {
+			return false
+		}
+	}
+	return rolloutBucket(app, ch) < ch.Rollout
+}
+
+// rolloutBucket returns a machine's bucket in [0, 100) for the rollout of
+// a channel.
+func rolloutBucket(app *omaha.AppRequest, ch *Channel) int {
+	h := fnv.New32a()
+	for _, s := range []string{app.MachineID, app.ID, app.Track, ch.Version} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return int(h.Sum32() % 100)
+}
+
+func (u *updater) CheckUpdate(req *omaha.Request, app *omaha.AppRequest) (*omaha.Update, error) {
+	r := newRecord(app, RecordUpdateCheck)
+	defer func() { u.s.record(r) }()
+
+	ch, update := u.s.channel(app)
+	if ch == nil || !offer(app, ch) {
+		return nil, omaha.NoUpdate
+	}
+
+	r.Offered = ch.Version
+	r.Updated = true
+	ret := *update
+	ret.ID = app.ID
+	return &ret, nil
+}
+
+func (u *updater) Event(req *omaha.Request, app *omaha.AppRequest, event *omaha.EventRequest) {
+	r := newRecord(app, RecordEvent)
+	r.Event = event
+	u.s.record(r)
+}
+
+func (u *updater) Ping(req *omaha.Request, app *omaha.AppRequest) {
+	u.s.record(newRecord(app, RecordPing))
+}
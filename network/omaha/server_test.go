@@ -0,0 +1,223 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package omaha
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-omaha/omaha"
+)
+
+const testApp = "{e96281a6-d1af-4bde-9a0a-97b76e56dc57}"
+
+func newTestServer(t *testing.T) *Server {
+	s, err := NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve()
+	t.Cleanup(s.Destroy)
+	return s
+}
+
+func testPayload(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "update.gz")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// request sends an Omaha request for app to s and returns the response.
+func request(t *testing.T, s *Server, app *omaha.AppRequest) *omaha.AppResponse {
+	req := omaha.NewRequest()
+	req.Apps = append(req.Apps, app)
+	body, err := xml.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(fmt.Sprintf("http://%s/v1/update/", s.Addr()), "text/xml", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	omahaResp, err := omaha.ParseResponse(resp.Header.Get("Content-Type"), resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appResp := omahaResp.GetApp(app.ID)
+	if appResp == nil {
+		t.Fatalf("no response for app %s", app.ID)
+	}
+	return appResp
+}
+
+// check checks for an update, returning the offered version and whether
+// there is an update.
+func check(t *testing.T, s *Server, machineID, group, version string) (string, bool) {
+	app := &omaha.AppRequest{
+		ID:        testApp,
+		Version:   version,
+		Track:     group,
+		MachineID: machineID,
+	}
+	app.AddUpdateCheck()
+	resp := request(t, s, app)
+	switch resp.UpdateCheck.Status {
+	case omaha.NoUpdate:
+		return "", false
+	case omaha.UpdateOK:
+		return resp.UpdateCheck.Manifest.Version, true
+	default:
+		t.Fatalf("unexpected update check status %s", resp.UpdateCheck.Status)
+		return "", false
+	}
+}
+
+func TestServerChannels(t *testing.T) {
+	s := newTestServer(t)
+	for _, v := range []string{"1.0.0", "2.0.0", "3.0.0"} {
+		if err := s.AddVersion(testApp, Version{Version: v, Payload: testPayload(t, v)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddVersion(testApp, Version{Version: "1.0.0", Payload: testPayload(t, "")}); err == nil {
+		t.Error("adding a version twice succeeded")
+	}
+	if err := s.SetChannel(testApp, "beta", Channel{Version: "4.0.0", Rollout: 100}); err == nil {
+		t.Error("setting a channel to an unknown version succeeded")
+	}
+	for group, ch := range map[string]Channel{
+		"stable": {Version: "2.0.0", Rollout: 100},
+		"beta":   {Version: "3.0.0", Rollout: 100},
+		"lts":    {Version: "1.0.0", Rollout: 100, Downgrade: true},
+	} {
+		if err := s.SetChannel(testApp, group, ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		group, version, offered string
+	}{
+		{"stable", "1.0.0", "2.0.0"},
+		{"stable", "2.0.0", ""},
+		{"stable", "3.0.0", ""},
+		{"beta", "1.0.0", "3.0.0"},
+		{"lts", "1.0.0", ""},
+		{"lts", "2.0.0", "1.0.0"},
+		{"alpha", "1.0.0", ""},
+	} {
+		offered, _ := check(t, s, "machine", tt.group, tt.version)
+		if offered != tt.offered {
+			t.Errorf("%s %s: offered %q, expected %q", tt.group, tt.version, offered, tt.offered)
+		}
+	}
+
+	s.RemoveChannel(testApp, "stable")
+	if offered, _ := check(t, s, "machine", "stable", "1.0.0"); offered != "" {
+		t.Errorf("removed channel offered %q", offered)
+	}
+}
+
+func TestServerRollout(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.AddVersion(testApp, Version{Version: "2.0.0", Payload: testPayload(t, "")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetChannel(testApp, AnyGroup, Channel{Version: "2.0.0", Rollout: 30}); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := 0
+	for i := range 1000 {
+		machineID := fmt.Sprintf("machine%d", i)
+		_, ok := check(t, s, machineID, "stable", "1.0.0")
+		if ok {
+			updated++
+		}
+		// machines stay in their bucket
+		if _, again := check(t, s, machineID, "stable", "1.0.0"); again != ok {
+			t.Fatalf("%s: update offered %v, then %v", machineID, ok, again)
+		}
+	}
+	if updated < 250 || updated > 350 {
+		t.Errorf("%d of 1000 machines updated with 30%% rollout", updated)
+	}
+}
+
+func TestServerAddPackage(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.AddPackage(testPayload(t, "payload"), "update.gz"); err != nil {
+		t.Fatal(err)
+	}
+
+	app := &omaha.AppRequest{ID: testApp, Version: "1.0.0", MachineID: "machine"}
+	app.AddUpdateCheck()
+	resp := request(t, s, app)
+	if resp.UpdateCheck.Status != omaha.UpdateOK {
+		t.Fatalf("update check status %s", resp.UpdateCheck.Status)
+	}
+	url := resp.UpdateCheck.URLs[0].CodeBase + resp.UpdateCheck.Manifest.Packages[0].Name
+	download, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer download.Body.Close()
+	data, err := io.ReadAll(download.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "payload" {
+		t.Errorf("downloaded %q from %s", data, url)
+	}
+}
+
+func TestServerHistory(t *testing.T) {
+	s := newTestServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	waited := make(chan error)
+	go func() {
+		_, err := s.Wait(ctx, "machine", MatchEvent(omaha.EventTypeUpdateComplete, omaha.EventResultSuccessReboot))
+		waited <- err
+	}()
+
+	app := &omaha.AppRequest{ID: testApp, Version: "1.0.0", MachineID: "machine"}
+	app.AddUpdateCheck()
+	app.AddPing()
+	request(t, s, app)
+	app = &omaha.AppRequest{ID: testApp, Version: "1.0.0", MachineID: "other"}
+	event := app.AddEvent()
+	event.Type = omaha.EventTypeUpdateComplete
+	event.Result = omaha.EventResultSuccessReboot
+	request(t, s, app)
+	app.MachineID = "machine"
+	request(t, s, app)
+
+	if err := <-waited; err != nil {
+		t.Fatal(err)
+	}
+
+	var kinds []string
+	for _, r := range s.History("machine") {
+		kinds = append(kinds, r.Kind)
+	}
+	if fmt.Sprint(kinds) != "[updatecheck ping event]" {
+		t.Errorf("unexpected history %v", kinds)
+	}
+	if n := len(s.History("")); n != 4 {
+		t.Errorf("%d records of all machines, expected 4", n)
+	}
+}
@@ -0,0 +1,572 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package akamaitest implements an in-process fake of the parts of the
+// Akamai (Linode) API used by mantle, for testing without an account.
+package akamaitest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linode/linodego"
+)
+
+const (
+	// Region is the only region known to the fake.
+	Region = "us-ord"
+	// Type is the only instance type known to the fake.
+	Type = "g6-standard-2"
+
+	// timeLayout is the format of timestamps in the API.
+	timeLayout = "2006-01-02T15:04:05"
+)
+
+// Server is a fake Akamai API. Resources are kept in memory, disks are
+// ready and instances boot right away.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	nextID    int
+	instances map[int]*linodego.Instance
+	userData  map[int]string
+	disks     map[int][]linodego.InstanceDisk
+	configs   map[int][]linodego.InstanceConfig
+	images    map[string]*linodego.Image
+}
+
+// NewServer starts a fake API. Pass its URL as the endpoint of the client
+// and Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		nextID:    1,
+		instances: make(map[int]*linodego.Instance),
+		userData:  make(map[int]string),
+		disks:     make(map[int][]linodego.InstanceDisk),
+		configs:   make(map[int][]linodego.InstanceConfig),
+		images:    make(map[string]*linodego.Image),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v4/linode/types/{id}", s.getType)
+	mux.HandleFunc("GET /v4/linode/instances", s.listInstances)
+	mux.HandleFunc("POST /v4/linode/instances", s.createInstance)
+	mux.HandleFunc("GET /v4/linode/instances/{id}", s.getInstance)
+	mux.HandleFunc("DELETE /v4/linode/instances/{id}", s.deleteInstance)
+	mux.HandleFunc("POST /v4/linode/instances/{id}/boot", s.bootInstance)
+	mux.HandleFunc("GET /v4/linode/instances/{id}/disks", s.listDisks)
+	mux.HandleFunc("POST /v4/linode/instances/{id}/disks", s.createDisk)
+	mux.HandleFunc("POST /v4/linode/instances/{id}/configs", s.createConfig)
+	mux.HandleFunc("GET /v4/images", s.listImages)
+	mux.HandleFunc("POST /v4/images/upload", s.createImageUpload)
+	mux.HandleFunc("GET /v4/images/{id}", s.getImage)
+	mux.HandleFunc("DELETE /v4/images/{id}", s.deleteImage)
+	mux.HandleFunc("PUT /upload/{id}", s.uploadImage)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// AddImage adds an available private image and returns its ID.
+func (s *Server) AddImage(label string, created time.Time, tags []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	img := s.newImage(label, tags)
+	img.Status = linodego.ImageStatusAvailable
+	img.Created = &created
+	return img.ID
+}
+
+// AddInstance adds a running instance and returns its ID.
+func (s *Server) AddInstance(label string, created time.Time, tags []string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst := s.newInstance(label, tags)
+	inst.Created = &created
+	inst.Status = linodego.InstanceRunning
+	return inst.ID
+}
+
+// Instances returns the instances currently existing.
+func (s *Server) Instances() []linodego.Instance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []linodego.Instance
+	for _, inst := range s.sortedInstances() {
+		ret = append(ret, *inst)
+	}
+	return ret
+}
+
+// Images returns the images currently existing.
+func (s *Server) Images() []linodego.Image {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []linodego.Image
+	for _, img := range s.sortedImages() {
+		ret = append(ret, *img)
+	}
+	return ret
+}
+
+// UserData returns the decoded user data of an instance.
+func (s *Server) UserData(id int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.userData[id]
+}
+
+// Disks returns the disks of an instance.
+func (s *Server) Disks(id int) []linodego.InstanceDisk {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]linodego.InstanceDisk(nil), s.disks[id]...)
+}
+
+func (s *Server) id() int {
+	id := s.nextID
+	s.nextID++
+	return id
+}
+
+func (s *Server) newInstance(label string, tags []string) *linodego.Instance {
+	now := time.Now()
+	id := s.id()
+	public := net.ParseIP(fmt.Sprintf("192.0.2.%d", id%250+1))
+	inst := &linodego.Instance{
+		ID:      id,
+		Created: &now,
+		Updated: &now,
+		Region:  Region,
+		IPv4:    []*net.IP{&public},
+		Label:   label,
+		Type:    Type,
+		Status:  linodego.InstanceOffline,
+		Tags:    tags,
+	}
+	s.instances[id] = inst
+	return inst
+}
+
+func (s *Server) newImage(label string, tags []string) *linodego.Image {
+	now := time.Now()
+	img := &linodego.Image{
+		ID:      fmt.Sprintf("private/%d", s.id()),
+		Label:   label,
+		Type:    "manual",
+		Status:  linodego.ImageStatusPendingUpload,
+		Tags:    tags,
+		Created: &now,
+		Updated: &now,
+	}
+	s.images[img.ID] = img
+	return img
+}
+
+func (s *Server) getType(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("id") != Type {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, linodego.LinodeType{
+		ID:     Type,
+		Label:  "Linode 4GB",
+		Class:  linodego.ClassStandard,
+		Disk:   81920,
+		Memory: 4096,
+		VCPUs:  2,
+	})
+}
+
+func (s *Server) listInstances(w http.ResponseWriter, r *http.Request) {
+	filter, ok := readFilter(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var data []instanceJSON
+	for _, inst := range s.sortedInstances() {
+		if filter.match(inst.Label, inst.Tags) {
+			data = append(data, newInstanceJSON(inst))
+		}
+	}
+	writePage(w, data)
+}
+
+// sortedInstances returns the instances ordered by ID.
+func (s *Server) sortedInstances() []*linodego.Instance {
+	ids := make([]int, 0, len(s.instances))
+	for id := range s.instances {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	ret := make([]*linodego.Instance, 0, len(ids))
+	for _, id := range ids {
+		ret = append(ret, s.instances[id])
+	}
+	return ret
+}
+
+func (s *Server) createInstance(w http.ResponseWriter, r *http.Request) {
+	var req linodego.InstanceCreateOptions
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Region != Region || req.Type != Type {
+		writeError(w, http.StatusBadRequest, "region or type not found")
+		return
+	}
+	if req.Booted == nil || *req.Booted {
+		writeError(w, http.StatusBadRequest, "the fake only creates instances without booting them")
+		return
+	}
+	var userData []byte
+	if req.Metadata != nil {
+		var err error
+		if userData, err = base64.StdEncoding.DecodeString(req.Metadata.UserData); err != nil {
+			writeError(w, http.StatusBadRequest, "user_data must be base64 encoded")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst := s.newInstance(req.Label, req.Tags)
+	inst.HasUserData = req.Metadata != nil
+	if req.PrivateIP {
+		private := net.ParseIP(fmt.Sprintf("192.168.128.%d", inst.ID%250+1))
+		inst.IPv4 = append(inst.IPv4, &private)
+	}
+	s.userData[inst.ID] = string(userData)
+	writeJSON(w, http.StatusOK, newInstanceJSON(inst))
+}
+
+func (s *Server) getInstance(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst, ok := s.lookupInstance(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newInstanceJSON(inst))
+}
+
+func (s *Server) deleteInstance(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst, ok := s.lookupInstance(w, r)
+	if !ok {
+		return
+	}
+	delete(s.instances, inst.ID)
+	delete(s.userData, inst.ID)
+	delete(s.disks, inst.ID)
+	delete(s.configs, inst.ID)
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (s *Server) bootInstance(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ConfigID int `json:"config_id"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst, ok := s.lookupInstance(w, r)
+	if !ok {
+		return
+	}
+	found := false
+	for _, cfg := range s.configs[inst.ID] {
+		found = found || cfg.ID == req.ConfigID
+	}
+	if !found {
+		writeError(w, http.StatusBadRequest, "config not found")
+		return
+	}
+	inst.Status = linodego.InstanceRunning
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (s *Server) listDisks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst, ok := s.lookupInstance(w, r)
+	if !ok {
+		return
+	}
+	writePage(w, s.disks[inst.ID])
+}
+
+func (s *Server) createDisk(w http.ResponseWriter, r *http.Request) {
+	var req linodego.InstanceDiskCreateOptions
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst, ok := s.lookupInstance(w, r)
+	if !ok {
+		return
+	}
+	if req.Image != "" {
+		if img, ok := s.images[req.Image]; !ok || img.Status != linodego.ImageStatusAvailable {
+			writeError(w, http.StatusBadRequest, "image not available")
+			return
+		}
+		if req.RootPass == "" {
+			writeError(w, http.StatusBadRequest, "root_pass is required with an image")
+			return
+		}
+	}
+	disk := linodego.InstanceDisk{
+		ID:         s.id(),
+		Label:      req.Label,
+		Status:     linodego.DiskReady,
+		Size:       req.Size,
+		Filesystem: linodego.FilesystemExt4,
+	}
+	s.disks[inst.ID] = append(s.disks[inst.ID], disk)
+	writeJSON(w, http.StatusOK, disk)
+}
+
+func (s *Server) createConfig(w http.ResponseWriter, r *http.Request) {
+	var req linodego.InstanceConfigCreateOptions
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst, ok := s.lookupInstance(w, r)
+	if !ok {
+		return
+	}
+	cfg := linodego.InstanceConfig{
+		ID:       s.id(),
+		Label:    req.Label,
+		Comments: req.Comments,
+		Devices:  &req.Devices,
+		Helpers:  req.Helpers,
+		Kernel:   req.Kernel,
+	}
+	if req.RootDevice != nil {
+		cfg.RootDevice = *req.RootDevice
+	}
+	s.configs[inst.ID] = append(s.configs[inst.ID], cfg)
+	writeJSON(w, http.StatusOK, cfg)
+}
+
+func (s *Server) listImages(w http.ResponseWriter, r *http.Request) {
+	filter, ok := readFilter(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var data []imageJSON
+	for _, img := range s.sortedImages() {
+		if filter.match(img.Label, img.Tags) {
+			data = append(data, newImageJSON(img))
+		}
+	}
+	writePage(w, data)
+}
+
+// sortedImages returns the images ordered by ID.
+func (s *Server) sortedImages() []*linodego.Image {
+	ids := make([]string, 0, len(s.images))
+	for id := range s.images {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	ret := make([]*linodego.Image, 0, len(ids))
+	for _, id := range ids {
+		ret = append(ret, s.images[id])
+	}
+	return ret
+}
+
+func (s *Server) createImageUpload(w http.ResponseWriter, r *http.Request) {
+	var req linodego.ImageCreateUploadOptions
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Region != Region {
+		writeError(w, http.StatusBadRequest, "region not found")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tags []string
+	if req.Tags != nil {
+		tags = *req.Tags
+	}
+	img := s.newImage(req.Label, tags)
+	img.Description = req.Description
+	writeJSON(w, http.StatusOK, struct {
+		Image    imageJSON `json:"image"`
+		UploadTo string    `json:"upload_to"`
+	}{newImageJSON(img), s.URL + "/upload/" + strings.TrimPrefix(img.ID, "private/")})
+}
+
+func (s *Server) uploadImage(w http.ResponseWriter, r *http.Request) {
+	n, err := io.Copy(io.Discard, r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	img, ok := s.images["private/"+r.PathValue("id")]
+	if !ok || img.Status != linodego.ImageStatusPendingUpload {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	img.Status = linodego.ImageStatusAvailable
+	img.Size = int(n >> 20)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) getImage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	img, ok := s.images[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, newImageJSON(img))
+}
+
+func (s *Server) deleteImage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := r.PathValue("id")
+	if _, ok := s.images[id]; !ok {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	delete(s.images, id)
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (s *Server) lookupInstance(w http.ResponseWriter, r *http.Request) (*linodego.Instance, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	inst, ok := s.instances[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not found")
+		return nil, false
+	}
+	return inst, true
+}
+
+// instanceJSON and imageJSON add the timestamps linodego does not
+// marshal to its types.
+type instanceJSON struct {
+	*linodego.Instance
+	Created string `json:"created"`
+	Updated string `json:"updated"`
+}
+
+func newInstanceJSON(inst *linodego.Instance) instanceJSON {
+	return instanceJSON{inst, formatTime(inst.Created), formatTime(inst.Updated)}
+}
+
+type imageJSON struct {
+	*linodego.Image
+	Created string `json:"created"`
+	Updated string `json:"updated"`
+}
+
+func newImageJSON(img *linodego.Image) imageJSON {
+	return imageJSON{img, formatTime(img.Created), formatTime(img.Updated)}
+}
+
+func formatTime(t *time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+// filter implements the subset of X-Filter used by mantle, matching
+// labels and tags exactly.
+type filter map[string]string
+
+func readFilter(w http.ResponseWriter, r *http.Request) (filter, bool) {
+	f := make(filter)
+	if h := r.Header.Get("X-Filter"); h != "" {
+		if err := json.Unmarshal([]byte(h), &f); err != nil {
+			writeError(w, http.StatusBadRequest, "unsupported filter: "+err.Error())
+			return nil, false
+		}
+	}
+	return f, true
+}
+
+func (f filter) match(label string, tags []string) bool {
+	if want, ok := f["label"]; ok && want != label {
+		return false
+	}
+	if want, ok := f["tags"]; ok {
+		found := false
+		for _, tag := range tags {
+			found = found || tag == want
+		}
+		return found
+	}
+	return true
+}
+
+// writePage writes all data as the only page of a list.
+func writePage[T any](w http.ResponseWriter, data []T) {
+	if data == nil {
+		data = []T{}
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Data    []T `json:"data"`
+		Page    int `json:"page"`
+		Pages   int `json:"pages"`
+		Results int `json:"results"`
+	}{data, 1, 1, len(data)})
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, reason string) {
+	writeJSON(w, status, linodego.APIError{Errors: []linodego.APIErrorReason{{Reason: reason}}})
+}
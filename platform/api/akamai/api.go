@@ -28,6 +28,8 @@ type Options struct {
 	Region string
 	// Type of the instance to deploy
 	Type string
+	// Endpoint overrides the URL of the Akamai API.
+	Endpoint string
 }
 
 // New returns an Akamai API instance.
@@ -40,6 +42,9 @@ func New(opts *Options) (*API, error) {
 	}
 
 	client := linodego.NewClient(oauth2Client)
+	if opts.Endpoint != "" {
+		client.SetBaseURL(opts.Endpoint)
+	}
 
 	return &API{
 		client: &client,
@@ -0,0 +1,121 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package akamai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/linode/linodego"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/akamai/akamaitest"
+)
+
+func newTestAPI(t *testing.T, srv *akamaitest.Server, image string) *API {
+	t.Helper()
+	api, err := New(&Options{
+		Options:  &platform.Options{},
+		Token:    "token",
+		Image:    image,
+		Region:   akamaitest.Region,
+		Type:     akamaitest.Type,
+		Endpoint: srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api
+}
+
+func TestCreateServer(t *testing.T) {
+	srv := akamaitest.NewServer()
+	defer srv.Close()
+	image := srv.AddImage("flatcar", time.Now(), nil)
+
+	api := newTestAPI(t, srv, image)
+	ctx := context.Background()
+
+	server, err := api.CreateServer(ctx, "kola-1", "{}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := srv.UserData(server.ID); data != "{}" {
+		t.Errorf("unexpected user data %q", data)
+	}
+	instances := srv.Instances()
+	if len(instances) != 1 || instances[0].Status != linodego.InstanceRunning || len(instances[0].Tags) != 1 || instances[0].Tags[0] != "mantle" {
+		t.Errorf("instance not booted with mantle tags: %+v", instances)
+	}
+	if disks := srv.Disks(server.ID); len(disks) != 1 || disks[0].Size != 81920 {
+		t.Errorf("unexpected disks %+v", disks)
+	}
+
+	if err := api.DeleteServer(ctx, strconv.Itoa(server.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.Instances()) != 0 {
+		t.Errorf("instances left after deletion: %+v", srv.Instances())
+	}
+}
+
+func TestUploadImage(t *testing.T) {
+	srv := akamaitest.NewServer()
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "flatcar.img.gz")
+	if err := os.WriteFile(file, []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	api := newTestAPI(t, srv, "")
+	id, err := api.UploadImage(context.Background(), "flatcar", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := srv.Images()
+	if len(images) != 1 || images[0].ID != id || images[0].Status != linodego.ImageStatusAvailable {
+		t.Errorf("unexpected images %+v", images)
+	}
+}
+
+func TestGC(t *testing.T) {
+	srv := akamaitest.NewServer()
+	defer srv.Close()
+
+	old := time.Now().Add(-10 * time.Hour)
+	mantle := []string{"mantle"}
+	oldInstance := srv.AddInstance("old", old, mantle)
+	srv.AddInstance("new", time.Now(), mantle)
+	srv.AddInstance("foreign", old, nil)
+	oldImage := srv.AddImage("old", old, mantle)
+	srv.AddImage("new", time.Now(), mantle)
+	srv.AddImage("foreign", old, nil)
+
+	api := newTestAPI(t, srv, "")
+	if err := api.GC(context.Background(), 5*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, inst := range srv.Instances() {
+		if inst.ID == oldInstance {
+			t.Errorf("old instance not deleted")
+		}
+	}
+	if len(srv.Instances()) != 2 {
+		t.Errorf("unexpected instances left: %+v", srv.Instances())
+	}
+	for _, img := range srv.Images() {
+		if img.ID == oldImage {
+			t.Errorf("old image not deleted")
+		}
+	}
+	if len(srv.Images()) != 2 {
+		t.Errorf("unexpected images left: %+v", srv.Images())
+	}
+}
@@ -55,6 +55,9 @@ type Options struct {
 	InstanceType       string
 	SecurityGroup      string
 	IAMInstanceProfile string
+
+	// Endpoint overrides the URL of the AWS APIs.
+	Endpoint string
 }
 
 type API struct {
@@ -81,6 +84,9 @@ func New(opts *Options) (*API, error) {
 	} else {
 		awsCfg.Credentials = credentials.NewEnvCredentials()
 	}
+	if opts.Endpoint != "" {
+		awsCfg.Endpoint = aws.String(opts.Endpoint)
+	}
 
 	sess, err := session.NewSessionWithOptions(session.Options{
 		SharedConfigState: session.SharedConfigEnable,
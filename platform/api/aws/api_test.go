@@ -0,0 +1,123 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/aws/awstest"
+)
+
+func newTestAPI(t *testing.T, srv *awstest.Server, ami string) *API {
+	t.Helper()
+	api, err := New(&Options{
+		Options:            &platform.Options{},
+		Region:             awstest.Region,
+		AccessKeyID:        awstest.AccessKeyID,
+		SecretKey:          awstest.SecretKey,
+		AMI:                ami,
+		InstanceType:       awstest.InstanceType,
+		SecurityGroup:      "mantle",
+		IAMInstanceProfile: "mantle",
+		Endpoint:           srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api
+}
+
+func TestCreateInstances(t *testing.T) {
+	srv := awstest.NewServer()
+	defer srv.Close()
+	ami := srv.AddImage("flatcar")
+
+	api := newTestAPI(t, srv, ami)
+	if err := api.PreflightCheck(); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.AddKey("kola", "ssh-ed25519 AAAA"); err != nil {
+		t.Fatal(err)
+	}
+
+	insts, err := api.CreateInstances("kola-1", "kola", "{}", 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(insts) != 2 {
+		t.Fatalf("unexpected instances %+v", insts)
+	}
+	if data := srv.UserData(*insts[0].InstanceId); data != "{}" {
+		t.Errorf("unexpected user data %q", data)
+	}
+	if sgs := srv.SecurityGroups(); len(sgs) != 1 || *sgs[0].GroupName != "mantle" || len(sgs[0].IpPermissions) == 0 {
+		t.Errorf("unexpected security groups %+v", sgs)
+	}
+	if ips := srv.InstanceProfiles(); len(ips) != 1 || len(ips[0].Roles) != 1 {
+		t.Errorf("unexpected instance profiles %+v", ips)
+	}
+	for _, subnet := range srv.Subnets() {
+		if *subnet.VpcId != *insts[0].VpcId {
+			t.Errorf("instance not created in the mantle VPC: %+v", insts[0])
+		}
+	}
+
+	// A second run reuses the security group and instance profile.
+	more, err := api.CreateInstances("kola-2", "", "", 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.SecurityGroups()) != 1 || len(srv.Subnets()) != 1 {
+		t.Errorf("network resources created again: %+v", srv.Subnets())
+	}
+
+	console, err := api.GetConsoleOutput(*more[0].InstanceId)
+	if err != nil || console == "" {
+		t.Errorf("unexpected console %q: %v", console, err)
+	}
+	if err := api.TerminateInstances([]string{*insts[0].InstanceId, *insts[1].InstanceId, *more[0].InstanceId}); err != nil {
+		t.Fatal(err)
+	}
+	for _, inst := range srv.Instances() {
+		if *inst.State.Name != ec2.InstanceStateNameTerminated {
+			t.Errorf("instance %s left in state %s", *inst.InstanceId, *inst.State.Name)
+		}
+	}
+	if after, err := api.GetConsoleOutput(*more[0].InstanceId); err != nil || after == console {
+		t.Errorf("console not updated on termination: %q %v", after, err)
+	}
+
+	if err := api.DeleteKey("kola"); err != nil {
+		t.Fatal(err)
+	}
+	if kps := srv.KeyPairs(); len(kps) != 0 {
+		t.Errorf("key pairs left after deletion: %+v", kps)
+	}
+}
+
+func TestGC(t *testing.T) {
+	srv := awstest.NewServer()
+	defer srv.Close()
+
+	mantle := map[string]string{"CreatedBy": "mantle"}
+	old := srv.AddInstance("old", time.Now().Add(-6*time.Hour), mantle)
+	srv.AddInstance("young", time.Now(), mantle)
+	srv.AddInstance("foreign", time.Now().Add(-6*time.Hour), nil)
+
+	api := newTestAPI(t, srv, "")
+	if err := api.GC(5 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, inst := range srv.Instances() {
+		terminated := *inst.State.Name == ec2.InstanceStateNameTerminated
+		if terminated != (*inst.InstanceId == old) {
+			t.Errorf("unexpected state of %s after gc: %s", *inst.InstanceId, *inst.State.Name)
+		}
+	}
+}
@@ -49,6 +49,8 @@ type Options struct {
 	Size string
 	// Numeric image ID, {alpha, beta, stable}, or user image name
 	Image string
+	// Endpoint overrides the URL of the DigitalOcean API.
+	Endpoint string
 }
 
 type API struct {
@@ -77,14 +79,20 @@ func New(opts *Options) (*API, error) {
 	}
 
 	ctx := context.TODO()
-	client := godo.NewClient(oauth2.NewClient(ctx, &tokenSource{opts.AccessToken}))
+	var clientOpts []godo.ClientOpt
+	if opts.Endpoint != "" {
+		clientOpts = append(clientOpts, godo.SetBaseURL(opts.Endpoint))
+	}
+	client, err := godo.New(oauth2.NewClient(ctx, &tokenSource{opts.AccessToken}), clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating DigitalOcean client: %v", err)
+	}
 
 	a := &API{
 		c:    client,
 		opts: opts,
 	}
 
-	var err error
 	a.image, err = a.resolveImage(ctx, opts.Image)
 	if err != nil {
 		return nil, err
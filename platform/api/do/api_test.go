@@ -0,0 +1,113 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package do
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/do/dotest"
+)
+
+func newTestAPI(t *testing.T, srv *dotest.Server, image string) *API {
+	t.Helper()
+	api, err := New(&Options{
+		Options:     &platform.Options{},
+		AccessToken: "token",
+		Region:      "nyc3",
+		Size:        "s-1vcpu-1gb",
+		Image:       image,
+		Endpoint:    srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api
+}
+
+func TestResolveImage(t *testing.T) {
+	srv := dotest.NewServer()
+	defer srv.Close()
+	srv.AddImage("flatcar", "sfo2")
+	want := srv.AddImage("flatcar", "nyc3")
+
+	for _, spec := range []string{"flatcar", strconv.Itoa(want)} {
+		if api := newTestAPI(t, srv, spec); api.image.ID != want {
+			t.Errorf("%q resolved to %+v, expected ID %d", spec, api.image, want)
+		}
+	}
+	if api := newTestAPI(t, srv, "beta"); api.image.Slug != "coreos-beta" {
+		t.Errorf("beta resolved to %+v", api.image)
+	}
+
+	_, err := New(&Options{
+		Options:     &platform.Options{},
+		AccessToken: "token",
+		Region:      "nyc3",
+		Image:       "missing",
+		Endpoint:    srv.URL,
+	})
+	if err == nil {
+		t.Error("resolving a missing image succeeded")
+	}
+}
+
+func TestCreateDroplet(t *testing.T) {
+	srv := dotest.NewServer()
+	defer srv.Close()
+	srv.AddImage("flatcar", "nyc3")
+
+	api := newTestAPI(t, srv, "flatcar")
+	ctx := context.Background()
+
+	keyID, err := api.AddKey(ctx, "kola", "ssh-ed25519 AAAA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	droplet, err := api.CreateDroplet(ctx, "kola-1", keyID, "{}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip, err := droplet.PublicIPv4(); ip == "" || err != nil {
+		t.Errorf("droplet has no public address: %v", err)
+	}
+	if droplets := srv.Droplets(); len(droplets) != 1 || droplets[0].Tags[0] != "mantle" {
+		t.Errorf("droplet not created with the mantle tag: %+v", droplets)
+	}
+	if data := srv.UserData(droplet.ID); data != "{}" {
+		t.Errorf("droplet created with user data %q", data)
+	}
+
+	if err := api.DeleteDroplet(ctx, droplet.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.DeleteKey(ctx, keyID); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.Droplets()) != 0 || len(srv.Keys()) != 0 {
+		t.Errorf("resources left after deletion: %+v %+v", srv.Droplets(), srv.Keys())
+	}
+}
+
+func TestGC(t *testing.T) {
+	srv := dotest.NewServer()
+	defer srv.Close()
+
+	srv.AddDroplet("old", time.Now().Add(-6*time.Hour), []string{"mantle"})
+	young := srv.AddDroplet("young", time.Now(), []string{"mantle"})
+	other := srv.AddDroplet("other", time.Now().Add(-6*time.Hour), nil)
+
+	api := newTestAPI(t, srv, "stable")
+	if err := api.GC(context.Background(), 5*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	droplets := srv.Droplets()
+	if len(droplets) != 2 || droplets[0].ID != young || droplets[1].ID != other {
+		t.Errorf("unexpected droplets after gc: %+v", droplets)
+	}
+}
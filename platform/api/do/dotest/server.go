@@ -0,0 +1,442 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package dotest implements an in-process fake of the parts of the
+// DigitalOcean API used by mantle, for testing without an account.
+package dotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// Server is a fake DigitalOcean API. Resources are kept in memory,
+// droplets are active and actions are completed right away.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	nextID   int
+	droplets map[int]*godo.Droplet
+	userData map[int]string
+	images   map[int]*godo.Image
+	keys     map[int]*godo.Key
+}
+
+// NewServer starts a fake API. Pass its URL as the endpoint of the client
+// and Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		nextID:   1,
+		droplets: make(map[int]*godo.Droplet),
+		userData: make(map[int]string),
+		images:   make(map[int]*godo.Image),
+		keys:     make(map[int]*godo.Key),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2/account", s.getAccount)
+	mux.HandleFunc("GET /v2/droplets", s.listDroplets)
+	mux.HandleFunc("POST /v2/droplets", s.createDroplet)
+	mux.HandleFunc("GET /v2/droplets/{id}", s.getDroplet)
+	mux.HandleFunc("DELETE /v2/droplets/{id}", s.deleteDroplet)
+	mux.HandleFunc("POST /v2/droplets/{id}/actions", s.dropletAction)
+	mux.HandleFunc("GET /v2/actions/{id}", s.getAction)
+	mux.HandleFunc("GET /v2/images", s.listImages)
+	mux.HandleFunc("POST /v2/images", s.createImage)
+	mux.HandleFunc("GET /v2/images/{id}", s.getImage)
+	mux.HandleFunc("DELETE /v2/images/{id}", s.deleteImage)
+	mux.HandleFunc("GET /v2/account/keys", s.listKeys)
+	mux.HandleFunc("POST /v2/account/keys", s.createKey)
+	mux.HandleFunc("DELETE /v2/account/keys/{id}", s.deleteKey)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// AddImage adds a user image available in region and returns its ID.
+func (s *Server) AddImage(name, region string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	img := &godo.Image{
+		ID:      s.id(),
+		Name:    name,
+		Type:    "custom",
+		Regions: []string{region},
+		Status:  "available",
+		Created: time.Now().UTC().Format(time.RFC3339),
+	}
+	s.images[img.ID] = img
+	return img.ID
+}
+
+// AddDroplet adds an active droplet and returns its ID.
+func (s *Server) AddDroplet(name string, created time.Time, tags []string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.newDroplet(name, tags)
+	d.Created = created.UTC().Format(time.RFC3339)
+	return d.ID
+}
+
+// Droplets returns the droplets currently existing.
+func (s *Server) Droplets() []godo.Droplet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return values(s.droplets)
+}
+
+// UserData returns the user data a droplet was created with.
+func (s *Server) UserData(id int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.userData[id]
+}
+
+// Images returns the user images currently existing.
+func (s *Server) Images() []godo.Image {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return values(s.images)
+}
+
+// Keys returns the SSH keys currently existing.
+func (s *Server) Keys() []godo.Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return values(s.keys)
+}
+
+func (s *Server) id() int {
+	id := s.nextID
+	s.nextID++
+	return id
+}
+
+func (s *Server) newDroplet(name string, tags []string) *godo.Droplet {
+	id := s.id()
+	d := &godo.Droplet{
+		ID:      id,
+		Name:    name,
+		Status:  "active",
+		Created: time.Now().UTC().Format(time.RFC3339),
+		Networks: &godo.Networks{
+			V4: []godo.NetworkV4{
+				{IPAddress: fmt.Sprintf("192.0.2.%d", id%250+1), Type: "public"},
+				{IPAddress: fmt.Sprintf("10.0.0.%d", id%250+1), Type: "private"},
+			},
+		},
+		Tags: tags,
+	}
+	s.droplets[id] = d
+	return d
+}
+
+func (s *Server) getAccount(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"account": godo.Account{Email: "mantle@example.com", Status: "active"},
+	})
+}
+
+func (s *Server) listDroplets(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tag := r.URL.Query().Get("tag_name")
+	var droplets []godo.Droplet
+	for _, d := range values(s.droplets) {
+		if tag == "" || contains(d.Tags, tag) {
+			droplets = append(droplets, d)
+		}
+	}
+	page, meta := paginate(r, droplets)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"droplets": page, "meta": meta})
+}
+
+func (s *Server) createDroplet(w http.ResponseWriter, r *http.Request) {
+	// godo.DropletCreateRequest marshals images and keys as either IDs
+	// or slugs and cannot be unmarshaled.
+	var req struct {
+		Name     string            `json:"name"`
+		Image    json.RawMessage   `json:"image"`
+		SSHKeys  []json.RawMessage `json:"ssh_keys"`
+		UserData string            `json:"user_data"`
+		Tags     []string          `json:"tags"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var image *godo.Image
+	if id, err := strconv.Atoi(string(req.Image)); err == nil {
+		img, ok := s.images[id]
+		if !ok {
+			writeError(w, http.StatusUnprocessableEntity, "unprocessable_entity", "image not found")
+			return
+		}
+		image = img
+	}
+	for _, raw := range req.SSHKeys {
+		id, err := strconv.Atoi(string(raw))
+		if err != nil {
+			continue
+		}
+		if _, ok := s.keys[id]; !ok {
+			writeError(w, http.StatusUnprocessableEntity, "unprocessable_entity", "ssh key not found")
+			return
+		}
+	}
+
+	d := s.newDroplet(req.Name, req.Tags)
+	d.Image = image
+	s.userData[d.ID] = req.UserData
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"droplet": d})
+}
+
+func (s *Server) getDroplet(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := lookup(w, r, s.droplets)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"droplet": d})
+}
+
+func (s *Server) deleteDroplet(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := lookup(w, r, s.droplets)
+	if !ok {
+		return
+	}
+	delete(s.droplets, d.ID)
+	delete(s.userData, d.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) dropletAction(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := lookup(w, r, s.droplets)
+	if !ok {
+		return
+	}
+	if req.Type != "snapshot" {
+		writeError(w, http.StatusUnprocessableEntity, "unprocessable_entity", fmt.Sprintf("action %q not implemented", req.Type))
+		return
+	}
+	img := &godo.Image{
+		ID:      s.id(),
+		Name:    req.Name,
+		Type:    "snapshot",
+		Regions: []string{"nyc3"},
+		Status:  "available",
+		Created: time.Now().UTC().Format(time.RFC3339),
+	}
+	if d.Region != nil {
+		img.Regions = []string{d.Region.Slug}
+	}
+	s.images[img.ID] = img
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"action": godo.Action{ID: s.id(), Status: "completed", Type: "snapshot", ResourceID: d.ID, ResourceType: "droplet"},
+	})
+}
+
+func (s *Server) getAction(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"action": godo.Action{ID: id, Status: "completed"},
+	})
+}
+
+func (s *Server) listImages(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page, meta := paginate(r, values(s.images))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"images": page, "meta": meta})
+}
+
+func (s *Server) createImage(w http.ResponseWriter, r *http.Request) {
+	var req godo.CustomImageCreateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	img := &godo.Image{
+		ID:           s.id(),
+		Name:         req.Name,
+		Type:         "custom",
+		Distribution: req.Distribution,
+		Regions:      []string{req.Region},
+		Status:       "available",
+		Created:      time.Now().UTC().Format(time.RFC3339),
+	}
+	s.images[img.ID] = img
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"image": img})
+}
+
+func (s *Server) getImage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	img, ok := lookup(w, r, s.images)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"image": img})
+}
+
+func (s *Server) deleteImage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	img, ok := lookup(w, r, s.images)
+	if !ok {
+		return
+	}
+	delete(s.images, img.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listKeys(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page, meta := paginate(r, values(s.keys))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"ssh_keys": page, "meta": meta})
+}
+
+func (s *Server) createKey(w http.ResponseWriter, r *http.Request) {
+	var req godo.KeyCreateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range s.keys {
+		if key.PublicKey == req.PublicKey {
+			writeError(w, http.StatusUnprocessableEntity, "unprocessable_entity", "SSH Key is already in use on your account")
+			return
+		}
+	}
+	key := &godo.Key{
+		ID:        s.id(),
+		Name:      req.Name,
+		PublicKey: req.PublicKey,
+	}
+	s.keys[key.ID] = key
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"ssh_key": key})
+}
+
+func (s *Server) deleteKey(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := lookup(w, r, s.keys)
+	if !ok {
+		return
+	}
+	delete(s.keys, key.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// paginate returns the page of items requested by the page and per_page
+// query parameters.
+func paginate[T any](r *http.Request, items []T) ([]T, godo.Meta) {
+	meta := godo.Meta{Total: len(items)}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = 20
+	}
+	start := (page - 1) * perPage
+	if start >= len(items) {
+		return []T{}, meta
+	}
+	end := start + perPage
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end], meta
+}
+
+// lookup finds the resource named by the id path parameter, writing a
+// not found error if it does not exist.
+func lookup[T any](w http.ResponseWriter, r *http.Request, m map[int]*T) (*T, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return nil, false
+	}
+	v, ok := m[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "The resource you were accessing could not be found.")
+		return nil, false
+	}
+	return v, true
+}
+
+// values returns copies of the map values ordered by ID.
+func values[T any](m map[int]*T) []T {
+	ids := make([]int, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	ret := make([]T, 0, len(ids))
+	for _, id := range ids {
+		ret = append(ret, *m[id])
+	}
+	return ret
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, id, message string) {
+	writeJSON(w, status, map[string]string{"id": id, "message": message})
+}
@@ -37,6 +37,8 @@ type Options struct {
 	Location string
 	// Token is used to construct the Hetzner client
 	Token string
+	// Endpoint overrides the URL of the Hetzner Cloud API.
+	Endpoint string
 }
 
 // API is a wrapper around Hetzner instance API.
@@ -57,11 +59,15 @@ type Network struct{ *hcloud.Network }
 
 // New returns a Hetzner API instance.
 func New(opts *Options) (*API, error) {
-	client := hcloud.NewClient(
+	clientOpts := []hcloud.ClientOption{
 		hcloud.WithToken(opts.Token),
 		hcloud.WithApplication("flatcar-mantle", version.Version),
 		hcloud.WithPollBackoffFunc(hcloud.ExponentialBackoff(2, 500*time.Millisecond)),
-	)
+	}
+	if opts.Endpoint != "" {
+		clientOpts = append(clientOpts, hcloud.WithEndpoint(opts.Endpoint))
+	}
+	client := hcloud.NewClient(clientOpts...)
 
 	imagesclient := hcloudimages.NewClient(client)
 
@@ -103,6 +109,7 @@ func (a *API) CreateServer(ctx context.Context, name, userdata string, sshKey *S
 		Image:      a.image,
 		Location:   a.location,
 		UserData:   userdata,
+		Labels:     DefaultLabels,
 	}
 	if sshKey != nil {
 		opts.SSHKeys = []*hcloud.SSHKey{sshKey.SSHKey}
@@ -0,0 +1,107 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package hetzner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/hetzner/hetznertest"
+)
+
+func newTestAPI(t *testing.T, srv *hetznertest.Server, image string) *API {
+	t.Helper()
+	api, err := New(&Options{
+		Options:    &platform.Options{},
+		Image:      image,
+		ServerType: hetznertest.ServerType,
+		Location:   hetznertest.Location,
+		Token:      "token",
+		Endpoint:   srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api
+}
+
+func TestCreateServer(t *testing.T) {
+	srv := hetznertest.NewServer()
+	defer srv.Close()
+	srv.AddImage("flatcar", "x86", time.Now(), nil)
+
+	api := newTestAPI(t, srv, "flatcar")
+	ctx := context.Background()
+
+	network, err := api.CreateNetwork(ctx, "kola-net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := api.CreateServer(ctx, "kola-1", "{}", nil, network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(server.PrivateNet) != 1 || server.PublicNet.IPv4.IP.String() == "" {
+		t.Errorf("unexpected server networking %+v %+v", server.PublicNet, server.PrivateNet)
+	}
+	if servers := srv.Servers(); len(servers) != 1 || servers[0].Labels["managed-by"] != "mantle" {
+		t.Errorf("server not created with mantle labels: %+v", servers)
+	}
+
+	if err := api.DeleteServer(ctx, server.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.DeleteNetwork(ctx, network); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.Servers()) != 0 || len(srv.Networks()) != 0 {
+		t.Errorf("resources left after deletion: %+v %+v", srv.Servers(), srv.Networks())
+	}
+}
+
+func TestGC(t *testing.T) {
+	srv := hetznertest.NewServer()
+	defer srv.Close()
+
+	old := time.Now().Add(-10 * time.Hour)
+	mantle := map[string]string{"managed-by": "mantle"}
+	oldServer := srv.AddServer("old", old, mantle)
+	srv.AddServer("new", time.Now(), mantle)
+	srv.AddServer("foreign", old, nil)
+	oldImage := srv.AddImage("old", "x86", old, mantle)
+	srv.AddImage("foreign", "x86", old, nil)
+	oldKey := srv.AddSSHKey("old", old, mantle)
+	oldNetwork := srv.AddNetwork("old", old, mantle)
+
+	api := newTestAPI(t, srv, "")
+	if err := api.GC(context.Background(), 5*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range srv.Servers() {
+		if s.ID == oldServer {
+			t.Errorf("old server not deleted")
+		}
+	}
+	if len(srv.Servers()) != 2 {
+		t.Errorf("unexpected servers left: %+v", srv.Servers())
+	}
+	for _, img := range srv.Images() {
+		if img.ID == oldImage {
+			t.Errorf("old image not deleted")
+		}
+	}
+	for _, key := range srv.SSHKeys() {
+		if key.ID == oldKey {
+			t.Errorf("old SSH key not deleted")
+		}
+	}
+	for _, network := range srv.Networks() {
+		if network.ID == oldNetwork {
+			t.Errorf("old network not deleted")
+		}
+	}
+}
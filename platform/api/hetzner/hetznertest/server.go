@@ -0,0 +1,518 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package hetznertest implements an in-process fake of the parts of the
+// Hetzner Cloud API used by mantle, for testing without an account.
+package hetznertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+)
+
+const (
+	// ServerType is the only server type known to the fake.
+	ServerType = "cpx22"
+	// Location is the only location known to the fake.
+	Location = "fsn1"
+)
+
+// Server is a fake Hetzner Cloud API. Resources are kept in memory and
+// all actions complete immediately.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	nextID   int64
+	servers  map[int64]*schema.Server
+	images   map[int64]*schema.Image
+	sshKeys  map[int64]*schema.SSHKey
+	networks map[int64]*schema.Network
+}
+
+// NewServer starts a fake API. Pass its URL as the endpoint of the client
+// and Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		nextID:   1,
+		servers:  make(map[int64]*schema.Server),
+		images:   make(map[int64]*schema.Image),
+		sshKeys:  make(map[int64]*schema.SSHKey),
+		networks: make(map[int64]*schema.Network),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /server_types", s.listServerTypes)
+	mux.HandleFunc("GET /locations", s.listLocations)
+	mux.HandleFunc("GET /actions", s.listActions)
+	mux.HandleFunc("GET /servers", s.listServers)
+	mux.HandleFunc("POST /servers", s.createServer)
+	mux.HandleFunc("GET /servers/{id}", s.getServer)
+	mux.HandleFunc("DELETE /servers/{id}", s.deleteServer)
+	mux.HandleFunc("GET /images", s.listImages)
+	mux.HandleFunc("GET /images/{id}", s.getImage)
+	mux.HandleFunc("DELETE /images/{id}", s.deleteImage)
+	mux.HandleFunc("GET /ssh_keys", s.listSSHKeys)
+	mux.HandleFunc("POST /ssh_keys", s.createSSHKey)
+	mux.HandleFunc("DELETE /ssh_keys/{id}", s.deleteSSHKey)
+	mux.HandleFunc("GET /networks", s.listNetworks)
+	mux.HandleFunc("POST /networks", s.createNetwork)
+	mux.HandleFunc("DELETE /networks/{id}", s.deleteNetwork)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// AddImage adds a snapshot image and returns its ID.
+func (s *Server) AddImage(name, architecture string, created time.Time, labels map[string]string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.id()
+	s.images[id] = &schema.Image{
+		ID:           id,
+		Status:       "available",
+		Type:         "snapshot",
+		Description:  name,
+		Name:         &name,
+		Created:      &created,
+		Architecture: architecture,
+		Labels:       labels,
+	}
+	return id
+}
+
+// AddServer adds a running server and returns its ID.
+func (s *Server) AddServer(name string, created time.Time, labels map[string]string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	srv := s.newServer(name, labels)
+	srv.Created = created
+	return srv.ID
+}
+
+// AddSSHKey adds an SSH key and returns its ID.
+func (s *Server) AddSSHKey(name string, created time.Time, labels map[string]string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.id()
+	s.sshKeys[id] = &schema.SSHKey{ID: id, Name: name, Created: created, Labels: labels}
+	return id
+}
+
+// AddNetwork adds a network and returns its ID.
+func (s *Server) AddNetwork(name string, created time.Time, labels map[string]string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.id()
+	s.networks[id] = &schema.Network{ID: id, Name: name, Created: created, IPRange: "10.0.0.0/16", Labels: labels}
+	return id
+}
+
+// Servers returns the servers currently existing.
+func (s *Server) Servers() []schema.Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return values(s.servers)
+}
+
+// Images returns the images currently existing.
+func (s *Server) Images() []schema.Image {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return values(s.images)
+}
+
+// SSHKeys returns the SSH keys currently existing.
+func (s *Server) SSHKeys() []schema.SSHKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return values(s.sshKeys)
+}
+
+// Networks returns the networks currently existing.
+func (s *Server) Networks() []schema.Network {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return values(s.networks)
+}
+
+func (s *Server) id() int64 {
+	id := s.nextID
+	s.nextID++
+	return id
+}
+
+func (s *Server) newServer(name string, labels map[string]string) *schema.Server {
+	id := s.id()
+	srv := &schema.Server{
+		ID:      id,
+		Name:    name,
+		Status:  "running",
+		Created: time.Now(),
+		PublicNet: schema.ServerPublicNet{
+			IPv4: schema.ServerPublicNetIPv4{IP: fmt.Sprintf("192.0.2.%d", id%250+1)},
+		},
+		ServerType: serverType(),
+		Location:   location(),
+		Labels:     labels,
+	}
+	s.servers[id] = srv
+	return srv
+}
+
+func (s *Server) action(command string, resourceID int64, resourceType string) schema.Action {
+	now := time.Now()
+	return schema.Action{
+		ID:        s.id(),
+		Status:    "success",
+		Command:   command,
+		Progress:  100,
+		Started:   now,
+		Finished:  &now,
+		Resources: []schema.ActionResourceReference{{ID: resourceID, Type: resourceType}},
+	}
+}
+
+func serverType() schema.ServerType {
+	return schema.ServerType{ID: 1, Name: ServerType, Cores: 2, Memory: 4, Disk: 80, Architecture: "x86"}
+}
+
+func location() schema.Location {
+	return schema.Location{ID: 1, Name: Location, NetworkZone: "eu-central"}
+}
+
+func (s *Server) listServerTypes(w http.ResponseWriter, r *http.Request) {
+	resp := schema.ServerTypeListResponse{ServerTypes: []schema.ServerType{}}
+	if name := r.URL.Query().Get("name"); name == "" || name == ServerType {
+		resp.ServerTypes = append(resp.ServerTypes, serverType())
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) listLocations(w http.ResponseWriter, r *http.Request) {
+	resp := schema.LocationListResponse{Locations: []schema.Location{}}
+	if name := r.URL.Query().Get("name"); name == "" || name == Location {
+		resp.Locations = append(resp.Locations, location())
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) listActions(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := schema.ActionListResponse{Actions: []schema.Action{}}
+	for _, v := range r.URL.Query()["id"] {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_input", err.Error())
+			return
+		}
+		resp.Actions = append(resp.Actions, schema.Action{ID: id, Status: "success", Progress: 100})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) listServers(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := schema.ServerListResponse{Servers: []schema.Server{}}
+	for _, srv := range values(s.servers) {
+		if matchLabels(srv.Labels, r) && matchName(srv.Name, r) {
+			resp.Servers = append(resp.Servers, srv)
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) createServer(w http.ResponseWriter, r *http.Request) {
+	var req schema.ServerCreateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.ServerType.Name != ServerType && req.ServerType.ID != serverType().ID {
+		writeError(w, http.StatusNotFound, "not_found", "server type not found")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	img, ok := s.images[req.Image.ID]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "image not found")
+		return
+	}
+	var labels map[string]string
+	if req.Labels != nil {
+		labels = *req.Labels
+	}
+	srv := s.newServer(req.Name, labels)
+	image := *img
+	srv.Image = &image
+	for i, network := range req.Networks {
+		if _, ok := s.networks[network]; !ok {
+			writeError(w, http.StatusNotFound, "not_found", "network not found")
+			return
+		}
+		srv.PrivateNet = append(srv.PrivateNet, schema.ServerPrivateNet{
+			Network: network,
+			IP:      fmt.Sprintf("10.0.%d.%d", i, srv.ID%250+2),
+		})
+	}
+	writeJSON(w, http.StatusCreated, schema.ServerCreateResponse{
+		Server:      *srv,
+		Action:      s.action("create_server", srv.ID, "server"),
+		NextActions: []schema.Action{s.action("start_server", srv.ID, "server")},
+	})
+}
+
+func (s *Server) getServer(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	srv, ok := lookup(w, r, s.servers)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, schema.ServerGetResponse{Server: *srv})
+}
+
+func (s *Server) deleteServer(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	srv, ok := lookup(w, r, s.servers)
+	if !ok {
+		return
+	}
+	delete(s.servers, srv.ID)
+	writeJSON(w, http.StatusOK, schema.ServerDeleteResponse{Action: s.action("delete_server", srv.ID, "server")})
+}
+
+func (s *Server) listImages(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := r.URL.Query()
+	resp := schema.ImageListResponse{Images: []schema.Image{}}
+	for _, img := range values(s.images) {
+		if !matchLabels(img.Labels, r) || !matchName(*img.Name, r) {
+			continue
+		}
+		if arch := q.Get("architecture"); arch != "" && arch != img.Architecture {
+			continue
+		}
+		if types := q["type"]; len(types) > 0 && !contains(types, img.Type) {
+			continue
+		}
+		resp.Images = append(resp.Images, img)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) getImage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	img, ok := lookup(w, r, s.images)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, schema.ImageGetResponse{Image: *img})
+}
+
+func (s *Server) deleteImage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	img, ok := lookup(w, r, s.images)
+	if !ok {
+		return
+	}
+	delete(s.images, img.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listSSHKeys(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := schema.SSHKeyListResponse{SSHKeys: []schema.SSHKey{}}
+	for _, key := range values(s.sshKeys) {
+		if matchLabels(key.Labels, r) && matchName(key.Name, r) {
+			resp.SSHKeys = append(resp.SSHKeys, key)
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) createSSHKey(w http.ResponseWriter, r *http.Request) {
+	var req schema.SSHKeyCreateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range s.sshKeys {
+		if key.Name == req.Name {
+			writeError(w, http.StatusConflict, "uniqueness_error", "SSH key with the same name already exists")
+			return
+		}
+	}
+	key := &schema.SSHKey{
+		ID:        s.id(),
+		Name:      req.Name,
+		PublicKey: req.PublicKey,
+		Created:   time.Now(),
+	}
+	if req.Labels != nil {
+		key.Labels = *req.Labels
+	}
+	s.sshKeys[key.ID] = key
+	writeJSON(w, http.StatusCreated, schema.SSHKeyCreateResponse{SSHKey: *key})
+}
+
+func (s *Server) deleteSSHKey(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := lookup(w, r, s.sshKeys)
+	if !ok {
+		return
+	}
+	delete(s.sshKeys, key.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listNetworks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := schema.NetworkListResponse{Networks: []schema.Network{}}
+	for _, network := range values(s.networks) {
+		if matchLabels(network.Labels, r) && matchName(network.Name, r) {
+			resp.Networks = append(resp.Networks, network)
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) createNetwork(w http.ResponseWriter, r *http.Request) {
+	var req schema.NetworkCreateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	network := &schema.Network{
+		ID:      s.id(),
+		Name:    req.Name,
+		Created: time.Now(),
+		IPRange: req.IPRange,
+		Subnets: req.Subnets,
+	}
+	if req.Labels != nil {
+		network.Labels = *req.Labels
+	}
+	s.networks[network.ID] = network
+	writeJSON(w, http.StatusCreated, schema.NetworkCreateResponse{Network: *network})
+}
+
+func (s *Server) deleteNetwork(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	network, ok := lookup(w, r, s.networks)
+	if !ok {
+		return
+	}
+	for _, srv := range s.servers {
+		for _, net := range srv.PrivateNet {
+			if net.Network == network.ID {
+				writeError(w, http.StatusConflict, "conflict", "network is still attached to servers")
+				return
+			}
+		}
+	}
+	delete(s.networks, network.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookup finds the resource named by the id path parameter, writing a
+// not found error if it does not exist.
+func lookup[T any](w http.ResponseWriter, r *http.Request, m map[int64]*T) (*T, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_input", err.Error())
+		return nil, false
+	}
+	v, ok := m[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", fmt.Sprintf("resource %d not found", id))
+		return nil, false
+	}
+	return v, true
+}
+
+// values returns copies of the map values ordered by ID.
+func values[T any](m map[int64]*T) []T {
+	ids := make([]int64, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	ret := make([]T, 0, len(ids))
+	for _, id := range ids {
+		ret = append(ret, *m[id])
+	}
+	return ret
+}
+
+// matchLabels implements the subset of label selectors used by mantle,
+// a comma separated list of key=value pairs.
+func matchLabels(labels map[string]string, r *http.Request) bool {
+	selector := r.URL.Query().Get("label_selector")
+	if selector == "" {
+		return true
+	}
+	for _, term := range strings.Split(selector, ",") {
+		k, v, _ := strings.Cut(term, "=")
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func matchName(name string, r *http.Request) bool {
+	want := r.URL.Query().Get("name")
+	return want == "" || want == name
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_input", err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, schema.ErrorResponse{Error: schema.Error{Code: code, Message: message}})
+}
@@ -0,0 +1,532 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package libvirt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	golibvirt "github.com/digitalocean/go-libvirt"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/util"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/api/libvirt")
+)
+
+// Options hold the specific libvirt options.
+type Options struct {
+	*platform.Options
+	// URI of the libvirtd to connect to, e.g. qemu:///system or
+	// qemu+ssh://user@host/system.
+	URI string
+	// Pool is the storage pool holding images and machine volumes.
+	Pool string
+	// Network is an existing libvirt network to attach machines to.
+	// If empty, a NAT network is created for every cluster.
+	Network string
+	// Image is the name of the volume in Pool to boot machines from.
+	Image string
+	// DomainType is the libvirt domain type, "kvm" or "qemu". If
+	// empty, "kvm" is used for boards matching the local architecture.
+	DomainType string
+	// Memory is the amount of memory per machine in MiB.
+	Memory int
+	// CPUs is the number of virtual CPUs per machine.
+	CPUs int
+}
+
+// API talks to a libvirtd over the libvirt RPC protocol, through its
+// local UNIX socket or the remote transports of the connection URI.
+type API struct {
+	opts *Options
+	conn *golibvirt.Libvirt
+	pool golibvirt.StoragePool
+}
+
+// New returns a libvirt API instance after checking that the connection
+// and the storage pool work.
+func New(opts *Options) (*API, error) {
+	if opts.URI == "" {
+		opts.URI = "qemu:///system"
+	}
+	if opts.Pool == "" {
+		opts.Pool = "default"
+	}
+
+	uri, err := url.Parse(opts.URI)
+	if err != nil {
+		return nil, fmt.Errorf("parsing libvirt URI: %w", err)
+	}
+	conn, err := golibvirt.ConnectToURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := conn.StoragePoolLookupByName(opts.Pool)
+	if err != nil {
+		conn.Disconnect()
+		return nil, fmt.Errorf("checking storage pool %q: %w", opts.Pool, err)
+	}
+	return &API{opts: opts, conn: conn, pool: pool}, nil
+}
+
+// Close disconnects from libvirtd.
+func (a *API) Close() error {
+	return a.conn.Disconnect()
+}
+
+// volumeXML is the definition of a storage volume.
+type volumeXML struct {
+	XMLName  xml.Name `xml:"volume"`
+	Name     string   `xml:"name"`
+	Capacity struct {
+		Unit  string `xml:"unit,attr,omitempty"`
+		Value uint64 `xml:",chardata"`
+	} `xml:"capacity"`
+	Target struct {
+		Format struct {
+			Type string `xml:"type,attr"`
+		} `xml:"format"`
+		Timestamps *struct {
+			Mtime string `xml:"mtime"`
+		} `xml:"timestamps,omitempty"`
+	} `xml:"target"`
+	BackingStore *struct {
+		Path   string `xml:"path"`
+		Format struct {
+			Type string `xml:"type,attr"`
+		} `xml:"format"`
+	} `xml:"backingStore,omitempty"`
+}
+
+func (a *API) createVolume(vol *volumeXML) (golibvirt.StorageVol, error) {
+	vol.Capacity.Unit = "bytes"
+	data, err := xml.Marshal(vol)
+	if err != nil {
+		return golibvirt.StorageVol{}, err
+	}
+	return a.conn.StorageVolCreateXML(a.pool, string(data), 0)
+}
+
+func (a *API) lookupVolume(name string) (golibvirt.StorageVol, error) {
+	vol, err := a.conn.StorageVolLookupByName(a.pool, name)
+	if err != nil {
+		return vol, fmt.Errorf("looking up volume %q: %w", name, err)
+	}
+	return vol, nil
+}
+
+// UploadVolume creates a volume in the pool from a local file. The
+// format is taken from the file.
+func (a *API) UploadVolume(name, path string) error {
+	info, err := util.GetImageInfo(path)
+	if err != nil {
+		return fmt.Errorf("inspecting %s: %w", path, err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var def volumeXML
+	def.Name = name
+	def.Capacity.Value = uint64(st.Size())
+	if info.Format == "qcow2" {
+		def.Capacity.Value = info.VirtualSize
+	}
+	def.Target.Format.Type = info.Format
+	vol, err := a.createVolume(&def)
+	if err != nil {
+		return fmt.Errorf("creating volume %q: %w", name, err)
+	}
+	if err := a.conn.StorageVolUpload(vol, f, 0, uint64(st.Size()), 0); err != nil {
+		a.DeleteVolume(name)
+		return fmt.Errorf("uploading volume %q: %w", name, err)
+	}
+	return nil
+}
+
+// UploadData creates a raw volume with the given contents.
+func (a *API) UploadData(name string, data []byte) error {
+	var def volumeXML
+	def.Name = name
+	def.Capacity.Value = uint64(len(data))
+	def.Target.Format.Type = "raw"
+	vol, err := a.createVolume(&def)
+	if err != nil {
+		return fmt.Errorf("creating volume %q: %w", name, err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if err := a.conn.StorageVolUpload(vol, bytes.NewReader(data), 0, uint64(len(data)), 0); err != nil {
+		a.DeleteVolume(name)
+		return fmt.Errorf("uploading volume %q: %w", name, err)
+	}
+	return nil
+}
+
+// CreateOverlay creates a qcow2 volume backed by the volume base.
+func (a *API) CreateOverlay(name, base string) error {
+	baseVol, err := a.lookupVolume(base)
+	if err != nil {
+		return err
+	}
+	info, err := a.conn.StorageVolGetXMLDesc(baseVol, 0)
+	if err != nil {
+		return err
+	}
+	var baseDef volumeXML
+	if err := xml.Unmarshal([]byte(info), &baseDef); err != nil {
+		return fmt.Errorf("parsing volume %q: %v", base, err)
+	}
+	basePath, err := a.conn.StorageVolGetPath(baseVol)
+	if err != nil {
+		return err
+	}
+
+	var def volumeXML
+	def.Name = name
+	def.Capacity.Value = baseDef.Capacity.Value
+	def.Target.Format.Type = "qcow2"
+	def.BackingStore = &struct {
+		Path   string `xml:"path"`
+		Format struct {
+			Type string `xml:"type,attr"`
+		} `xml:"format"`
+	}{Path: basePath}
+	def.BackingStore.Format.Type = baseDef.Target.Format.Type
+	if _, err := a.createVolume(&def); err != nil {
+		return fmt.Errorf("creating volume %q: %w", name, err)
+	}
+	return nil
+}
+
+// VolumePath returns the path of a volume on the libvirtd host.
+func (a *API) VolumePath(name string) (string, error) {
+	vol, err := a.lookupVolume(name)
+	if err != nil {
+		return "", err
+	}
+	return a.conn.StorageVolGetPath(vol)
+}
+
+// DownloadVolume returns the contents of a volume.
+func (a *API) DownloadVolume(name string) ([]byte, error) {
+	// The size of files written by QEMU is only picked up after a
+	// refresh.
+	if err := a.conn.StoragePoolRefresh(a.pool, 0); err != nil {
+		return nil, err
+	}
+	vol, err := a.lookupVolume(name)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := a.conn.StorageVolDownload(vol, &buf, 0, 0, 0); err != nil {
+		return nil, fmt.Errorf("downloading volume %q: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DeleteVolume deletes a volume from the pool.
+func (a *API) DeleteVolume(name string) error {
+	vol, err := a.lookupVolume(name)
+	if err != nil {
+		return err
+	}
+	return a.conn.StorageVolDelete(vol, golibvirt.StorageVolDeleteNormal)
+}
+
+// ListVolumes returns the names of all volumes in the pool.
+func (a *API) ListVolumes() ([]string, error) {
+	vols, _, err := a.conn.StoragePoolListAllVolumes(a.pool, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(vols))
+	for _, vol := range vols {
+		names = append(names, vol.Name)
+	}
+	return names, nil
+}
+
+// volumeModified returns when a volume was last written, as far as the
+// pool keeps timestamps.
+func (a *API) volumeModified(name string) (time.Time, error) {
+	vol, err := a.lookupVolume(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	info, err := a.conn.StorageVolGetXMLDesc(vol, 0)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var def volumeXML
+	if err := xml.Unmarshal([]byte(info), &def); err != nil {
+		return time.Time{}, fmt.Errorf("parsing volume %q: %v", name, err)
+	}
+	if def.Target.Timestamps == nil || def.Target.Timestamps.Mtime == "" {
+		return time.Time{}, fmt.Errorf("volume %q has no timestamps", name)
+	}
+	return parseTimestamp(def.Target.Timestamps.Mtime)
+}
+
+// parseTimestamp parses the seconds.nanoseconds timestamps of volumes.
+func parseTimestamp(s string) (time.Time, error) {
+	var sec, nsec int64
+	secs, nsecs, _ := strings.Cut(s, ".")
+	if _, err := fmt.Sscanf(secs, "%d", &sec); err != nil {
+		return time.Time{}, fmt.Errorf("parsing timestamp %q: %v", s, err)
+	}
+	if nsecs != "" {
+		if _, err := fmt.Sscanf(nsecs, "%d", &nsec); err != nil {
+			return time.Time{}, fmt.Errorf("parsing timestamp %q: %v", s, err)
+		}
+	}
+	return time.Unix(sec, nsec), nil
+}
+
+// networkXML is the definition of a NAT network with DHCP, carrying
+// mantle metadata like domains do.
+type networkXML struct {
+	XMLName  xml.Name `xml:"network"`
+	Name     string   `xml:"name"`
+	Metadata struct {
+		Instance struct {
+			XMLName xml.Name `xml:"mantle:instance"`
+			NS      string   `xml:"xmlns:mantle,attr"`
+			Created string   `xml:"mantle:created"`
+		}
+	} `xml:"metadata"`
+	Forward struct {
+		Mode string `xml:"mode,attr"`
+	} `xml:"forward"`
+	IP struct {
+		Address string `xml:"address,attr"`
+		Netmask string `xml:"netmask,attr"`
+		DHCP    struct {
+			Range struct {
+				Start string `xml:"start,attr"`
+				End   string `xml:"end,attr"`
+			} `xml:"range"`
+		} `xml:"dhcp"`
+	} `xml:"ip"`
+}
+
+// CreateNetwork creates a transient NAT network with DHCP. The subnet is
+// picked at random from 10.x.y.0/24, retrying on conflicts with existing
+// networks.
+func (a *API) CreateNetwork(name string) error {
+	var def networkXML
+	def.Name = name
+	def.Metadata.Instance.NS = metadataNamespace
+	def.Metadata.Instance.Created = time.Now().UTC().Format(time.RFC3339)
+	def.Forward.Mode = "nat"
+	def.IP.Netmask = "255.255.255.0"
+
+	var err error
+	for try := 0; try < 5; try++ {
+		b := make([]byte, 2)
+		rand.Read(b)
+		prefix := fmt.Sprintf("10.%d.%d", b[0], b[1])
+		def.IP.Address = prefix + ".1"
+		def.IP.DHCP.Range.Start = prefix + ".2"
+		def.IP.DHCP.Range.End = prefix + ".254"
+		data, merr := xml.Marshal(&def)
+		if merr != nil {
+			return merr
+		}
+		if _, err = a.conn.NetworkCreateXML(string(data)); err == nil {
+			return nil
+		}
+		plog.Debugf("creating network %v with %v.0/24 failed, retrying: %v", name, prefix, err)
+	}
+	return err
+}
+
+// DeleteNetwork destroys a transient network.
+func (a *API) DeleteNetwork(name string) error {
+	net, err := a.conn.NetworkLookupByName(name)
+	if err != nil {
+		return fmt.Errorf("looking up network %q: %w", name, err)
+	}
+	return a.conn.NetworkDestroy(net)
+}
+
+// ListNetworks returns the names of all transient networks.
+func (a *API) ListNetworks() ([]string, error) {
+	nets, _, err := a.conn.ConnectListAllNetworks(1, golibvirt.ConnectListNetworksTransient)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(nets))
+	for _, net := range nets {
+		names = append(names, net.Name)
+	}
+	return names, nil
+}
+
+// networkCreated returns the creation time mantle stored with a network.
+// libvirtd only keeps network metadata since version 9.7.0.
+func (a *API) networkCreated(name string) (time.Time, error) {
+	net, err := a.conn.NetworkLookupByName(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	info, err := a.conn.NetworkGetXMLDesc(net, 0)
+	if err != nil {
+		return time.Time{}, err
+	}
+	created, err := parseNetworkCreated([]byte(info))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing network %q: %v", name, err)
+	}
+	return created, nil
+}
+
+func parseNetworkCreated(data []byte) (time.Time, error) {
+	var def struct {
+		Created string `xml:"metadata>instance>created"`
+	}
+	if err := xml.Unmarshal(data, &def); err != nil {
+		return time.Time{}, err
+	}
+	if def.Created == "" {
+		return time.Time{}, fmt.Errorf("no creation time in metadata")
+	}
+	return time.Parse(time.RFC3339, def.Created)
+}
+
+// CreateDomain defines and starts a domain.
+func (a *API) CreateDomain(spec DomainSpec, meta Metadata) error {
+	ignitionPath, err := a.VolumePath(spec.Ignition)
+	if err != nil {
+		return err
+	}
+	consolePath, err := a.VolumePath(spec.Console)
+	if err != nil {
+		return err
+	}
+	data, err := a.domainXMLFor(spec, meta, ignitionPath, consolePath)
+	if err != nil {
+		return err
+	}
+	dom, err := a.conn.DomainDefineXML(string(data))
+	if err != nil {
+		return fmt.Errorf("defining domain %q: %w", spec.Name, err)
+	}
+	if err := a.conn.DomainCreate(dom); err != nil {
+		a.conn.DomainUndefineFlags(dom, golibvirt.DomainUndefineNvram)
+		return fmt.Errorf("starting domain %q: %w", spec.Name, err)
+	}
+	return nil
+}
+
+// DestroyDomain stops and undefines a domain. Its volumes are not
+// deleted.
+func (a *API) DestroyDomain(name string) error {
+	dom, err := a.conn.DomainLookupByName(name)
+	if err != nil {
+		return fmt.Errorf("looking up domain %q: %w", name, err)
+	}
+	if err := a.conn.DomainDestroy(dom); err != nil {
+		plog.Debugf("stopping domain %v: %v", name, err)
+	}
+	return a.conn.DomainUndefineFlags(dom, golibvirt.DomainUndefineNvram)
+}
+
+// DomainMetadata returns the metadata mantle stored with the domain.
+func (a *API) DomainMetadata(name string) (Metadata, error) {
+	dom, err := a.conn.DomainLookupByName(name)
+	if err != nil {
+		return Metadata{}, err
+	}
+	data, err := a.conn.DomainGetMetadata(dom, int32(golibvirt.DomainMetadataElement),
+		golibvirt.OptString{metadataNamespace}, golibvirt.DomainAffectCurrent)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return parseMetadata([]byte(data))
+}
+
+// ListDomains returns the names of all domains, including stopped ones.
+func (a *API) ListDomains() ([]string, error) {
+	doms, _, err := a.conn.ConnectListAllDomains(1, 0)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(doms))
+	for _, dom := range doms {
+		names = append(names, dom.Name)
+	}
+	return names, nil
+}
+
+// WaitForIP waits until the interface with the given MAC address received
+// an IPv4 address, as reported by the network's DHCP leases or the host's
+// ARP table for networks not managed by libvirt.
+func (a *API) WaitForIP(name, mac string, timeout time.Duration) (string, error) {
+	dom, err := a.conn.DomainLookupByName(name)
+	if err != nil {
+		return "", fmt.Errorf("looking up domain %q: %w", name, err)
+	}
+	var ip string
+	err = util.WaitUntilReady(timeout, 2*time.Second, func() (bool, error) {
+		for _, source := range []golibvirt.DomainInterfaceAddressesSource{
+			golibvirt.DomainInterfaceAddressesSrcLease,
+			golibvirt.DomainInterfaceAddressesSrcArp,
+		} {
+			ifaces, err := a.conn.DomainInterfaceAddresses(dom, uint32(source), 0)
+			if err != nil {
+				continue
+			}
+			if ip = interfaceIP(ifaces, mac); ip != "" {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("waiting for IP address of %v: %w", name, err)
+	}
+	return ip, nil
+}
+
+// interfaceIP finds the IPv4 address of the interface with the given MAC
+// address.
+func interfaceIP(ifaces []golibvirt.DomainInterface, mac string) string {
+	for _, iface := range ifaces {
+		if len(iface.Hwaddr) == 0 || !strings.EqualFold(iface.Hwaddr[0], mac) {
+			continue
+		}
+		for _, addr := range iface.Addrs {
+			if addr.Type == int32(golibvirt.IPAddrTypeIpv4) {
+				return addr.Addr
+			}
+		}
+	}
+	return ""
+}
+
+// RandomMAC returns a random MAC address with the QEMU OUI.
+func RandomMAC() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return fmt.Sprintf("52:54:00:%02x:%02x:%02x", b[0], b[1], b[2])
+}
@@ -0,0 +1,243 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package libvirt
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"github.com/flatcar/mantle/platform"
+)
+
+// metadataNamespace identifies the domain metadata written by mantle,
+// which is used to find leftover domains in GC.
+const metadataNamespace = "https://github.com/flatcar/mantle"
+
+// fwCfgConfigName is the QEMU firmware configuration entry Flatcar's
+// Ignition reads the config from on the qemu platform.
+const fwCfgConfigName = "opt/org.flatcar-linux/config"
+
+// board describes how a Flatcar board is run as a libvirt domain.
+type board struct {
+	arch    string
+	machine string
+	efi     bool
+}
+
+var boards = map[string]board{
+	"amd64-usr":   {arch: "x86_64", machine: "q35"},
+	"arm64-usr":   {arch: "aarch64", machine: "virt", efi: true},
+	"riscv64-usr": {arch: "riscv64", machine: "virt", efi: true},
+}
+
+// DomainSpec describes a domain to be created by CreateDomain.
+type DomainSpec struct {
+	Name  string
+	Board string
+	// Disk is the name of the qcow2 volume to boot from.
+	Disk string
+	// Ignition is the name of the volume holding the Ignition config.
+	Ignition string
+	// Console is the name of the volume the serial console is
+	// written to.
+	Console string
+	Network string
+	MAC     string
+}
+
+// Metadata is stored with every domain created by mantle.
+type Metadata struct {
+	Created time.Time
+	// Volumes are deleted together with the domain.
+	Volumes []string
+	// Network is deleted together with the domain if set.
+	Network string
+}
+
+type domainXML struct {
+	XMLName  xml.Name `xml:"domain"`
+	Type     string   `xml:"type,attr"`
+	Name     string   `xml:"name"`
+	Metadata struct {
+		Instance struct {
+			XMLName xml.Name `xml:"mantle:instance"`
+			NS      string   `xml:"xmlns:mantle,attr"`
+			Created string   `xml:"mantle:created"`
+			Volumes []string `xml:"mantle:volume"`
+			Network string   `xml:"mantle:network,omitempty"`
+		}
+	} `xml:"metadata"`
+	Memory struct {
+		Unit  string `xml:"unit,attr"`
+		Value int    `xml:",chardata"`
+	} `xml:"memory"`
+	VCPU int `xml:"vcpu"`
+	OS   struct {
+		Firmware string `xml:"firmware,attr,omitempty"`
+		Type     struct {
+			Arch    string `xml:"arch,attr"`
+			Machine string `xml:"machine,attr"`
+			Value   string `xml:",chardata"`
+		} `xml:"type"`
+	} `xml:"os"`
+	SysInfo struct {
+		Type  string `xml:"type,attr"`
+		Entry struct {
+			Name string `xml:"name,attr"`
+			File string `xml:"file,attr"`
+		} `xml:"entry"`
+	} `xml:"sysinfo"`
+	Features struct {
+		ACPI *struct{} `xml:"acpi"`
+	} `xml:"features"`
+	CPU *struct {
+		Mode string `xml:"mode,attr"`
+	} `xml:"cpu,omitempty"`
+	Devices struct {
+		Disk struct {
+			Type   string `xml:"type,attr"`
+			Device string `xml:"device,attr"`
+			Driver struct {
+				Name string `xml:"name,attr"`
+				Type string `xml:"type,attr"`
+			} `xml:"driver"`
+			Source struct {
+				Pool   string `xml:"pool,attr"`
+				Volume string `xml:"volume,attr"`
+			} `xml:"source"`
+			Target struct {
+				Dev string `xml:"dev,attr"`
+				Bus string `xml:"bus,attr"`
+			} `xml:"target"`
+			Serial string `xml:"serial"`
+			Boot   struct {
+				Order int `xml:"order,attr"`
+			} `xml:"boot"`
+		} `xml:"disk"`
+		Interface struct {
+			Type string `xml:"type,attr"`
+			MAC  struct {
+				Address string `xml:"address,attr"`
+			} `xml:"mac"`
+			Source struct {
+				Network string `xml:"network,attr"`
+			} `xml:"source"`
+			Model struct {
+				Type string `xml:"type,attr"`
+			} `xml:"model"`
+		} `xml:"interface"`
+		Serial struct {
+			Type   string `xml:"type,attr"`
+			Source struct {
+				Path string `xml:"path,attr"`
+			} `xml:"source"`
+		} `xml:"serial"`
+		RNG struct {
+			Model   string `xml:"model,attr"`
+			Backend struct {
+				Model string `xml:"model,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"backend"`
+		} `xml:"rng"`
+	} `xml:"devices"`
+}
+
+// domainXMLFor renders the libvirt domain definition. ignitionPath and
+// consolePath are the paths of the respective volumes on the libvirtd
+// host.
+func (a *API) domainXMLFor(spec DomainSpec, meta Metadata, ignitionPath, consolePath string) ([]byte, error) {
+	b, ok := boards[spec.Board]
+	if !ok {
+		return nil, fmt.Errorf("unsupported libvirt board %q", spec.Board)
+	}
+
+	var d domainXML
+	d.Type = a.opts.DomainType
+	if d.Type == "" {
+		// Without explicit configuration assume that libvirtd
+		// runs on a host of the same architecture.
+		d.Type = "qemu"
+		if qb, err := platform.GetQEMUBoard(spec.Board); err == nil && qb.Native() {
+			d.Type = "kvm"
+		}
+	}
+	if d.Type == "kvm" {
+		d.CPU = &struct {
+			Mode string `xml:"mode,attr"`
+		}{Mode: "host-passthrough"}
+	}
+	d.Name = spec.Name
+
+	inst := &d.Metadata.Instance
+	inst.NS = metadataNamespace
+	inst.Created = meta.Created.UTC().Format(time.RFC3339)
+	inst.Volumes = meta.Volumes
+	inst.Network = meta.Network
+
+	d.Memory.Unit = "MiB"
+	d.Memory.Value = a.opts.Memory
+	d.VCPU = a.opts.CPUs
+
+	if b.efi {
+		d.OS.Firmware = "efi"
+	}
+	d.OS.Type.Arch = b.arch
+	d.OS.Type.Machine = b.machine
+	d.OS.Type.Value = "hvm"
+
+	d.SysInfo.Type = "fwcfg"
+	d.SysInfo.Entry.Name = fwCfgConfigName
+	d.SysInfo.Entry.File = ignitionPath
+	d.Features.ACPI = &struct{}{}
+
+	disk := &d.Devices.Disk
+	disk.Type = "volume"
+	disk.Device = "disk"
+	disk.Driver.Name = "qemu"
+	disk.Driver.Type = "qcow2"
+	disk.Source.Pool = a.opts.Pool
+	disk.Source.Volume = spec.Disk
+	disk.Target.Dev = "vda"
+	disk.Target.Bus = "virtio"
+	disk.Serial = "primary-disk"
+	disk.Boot.Order = 1
+
+	iface := &d.Devices.Interface
+	iface.Type = "network"
+	iface.MAC.Address = spec.MAC
+	iface.Source.Network = spec.Network
+	iface.Model.Type = "virtio"
+
+	d.Devices.Serial.Type = "file"
+	d.Devices.Serial.Source.Path = consolePath
+
+	d.Devices.RNG.Model = "virtio"
+	d.Devices.RNG.Backend.Model = "random"
+	d.Devices.RNG.Backend.Value = "/dev/urandom"
+
+	return xml.MarshalIndent(&d, "", "  ")
+}
+
+// parseMetadata parses the mantle metadata element of a domain, as
+// returned by the DomainGetMetadata RPC for the mantle namespace.
+func parseMetadata(data []byte) (Metadata, error) {
+	var meta struct {
+		Created string   `xml:"created"`
+		Volumes []string `xml:"volume"`
+		Network string   `xml:"network"`
+	}
+	if err := xml.Unmarshal(data, &meta); err != nil {
+		return Metadata{}, err
+	}
+	created, err := time.Parse(time.RFC3339, meta.Created)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("parsing creation time: %v", err)
+	}
+	return Metadata{
+		Created: created,
+		Volumes: meta.Volumes,
+		Network: meta.Network,
+	}, nil
+}
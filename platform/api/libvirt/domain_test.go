@@ -0,0 +1,133 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package libvirt
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	golibvirt "github.com/digitalocean/go-libvirt"
+)
+
+func TestDomainXML(t *testing.T) {
+	a := &API{opts: &Options{Pool: "images", DomainType: "kvm", Memory: 2048, CPUs: 2}}
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	data, err := a.domainXMLFor(DomainSpec{
+		Name:    "kola-abc",
+		Board:   "arm64-usr",
+		Disk:    "kola-abc.qcow2",
+		Network: "kola-net",
+		MAC:     "52:54:00:01:02:03",
+	}, Metadata{
+		Created: created,
+		Volumes: []string{"kola-abc.qcow2", "kola-abc-ignition.json"},
+	}, "/var/lib/libvirt/images/kola-abc-ignition.json", "/var/lib/libvirt/images/kola-abc-console.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`<domain type="kvm">`,
+		`<mantle:instance xmlns:mantle="https://github.com/flatcar/mantle">`,
+		`<mantle:created>2024-05-01T12:00:00Z</mantle:created>`,
+		`<mantle:volume>kola-abc-ignition.json</mantle:volume>`,
+		`<memory unit="MiB">2048</memory>`,
+		`<os firmware="efi">`,
+		`<type arch="aarch64" machine="virt">hvm</type>`,
+		`<entry name="opt/org.flatcar-linux/config" file="/var/lib/libvirt/images/kola-abc-ignition.json"></entry>`,
+		`<source pool="images" volume="kola-abc.qcow2"></source>`,
+		`<mac address="52:54:00:01:02:03"></mac>`,
+		`<cpu mode="host-passthrough"></cpu>`,
+		`<source path="/var/lib/libvirt/images/kola-abc-console.log"></source>`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%s not found in domain XML:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), "mantle:network") {
+		t.Errorf("unexpected network in metadata:\n%s", data)
+	}
+
+	if _, err := a.domainXMLFor(DomainSpec{Board: "sparc-usr"}, Metadata{}, "", ""); err == nil {
+		t.Errorf("expected error for unknown board")
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	meta, err := parseMetadata([]byte(`<instance xmlns="https://github.com/flatcar/mantle">
+  <created>2024-05-01T12:00:00Z</created>
+  <volume>a.qcow2</volume>
+  <volume>a-ignition.json</volume>
+  <network>kola-net</network>
+</instance>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.Created.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected creation time %v", meta.Created)
+	}
+	if len(meta.Volumes) != 2 || meta.Volumes[1] != "a-ignition.json" {
+		t.Errorf("unexpected volumes %v", meta.Volumes)
+	}
+	if meta.Network != "kola-net" {
+		t.Errorf("unexpected network %q", meta.Network)
+	}
+}
+
+func TestInterfaceIP(t *testing.T) {
+	ifaces := []golibvirt.DomainInterface{{
+		Name:   "vnet0",
+		Hwaddr: golibvirt.OptString{"52:54:00:aa:bb:cc"},
+		Addrs: []golibvirt.DomainIPAddr{
+			{Type: int32(golibvirt.IPAddrTypeIpv6), Addr: "fe80::5054:ff:feaa:bbcc", Prefix: 64},
+			{Type: int32(golibvirt.IPAddrTypeIpv4), Addr: "10.12.34.56", Prefix: 24},
+		},
+	}, {
+		Name:   "vnet1",
+		Hwaddr: golibvirt.OptString{"52:54:00:dd:ee:ff"},
+		Addrs:  []golibvirt.DomainIPAddr{{Type: int32(golibvirt.IPAddrTypeIpv4), Addr: "10.12.34.57", Prefix: 24}},
+	}}
+	if ip := interfaceIP(ifaces, "52:54:00:AA:BB:CC"); ip != "10.12.34.56" {
+		t.Errorf("unexpected IP %q", ip)
+	}
+	if ip := interfaceIP(ifaces, "52:54:00:00:00:00"); ip != "" {
+		t.Errorf("unexpected IP %q for unknown MAC", ip)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	ts, err := parseTimestamp("1714564800.250000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 5, 1, 12, 0, 0, 250000000, time.UTC); !ts.Equal(want) {
+		t.Errorf("parsed %v, want %v", ts, want)
+	}
+	if _, err := parseTimestamp("yesterday"); err == nil {
+		t.Errorf("expected error for invalid timestamp")
+	}
+}
+
+func TestNetworkCreated(t *testing.T) {
+	var def networkXML
+	def.Name = "kola-net"
+	def.Metadata.Instance.NS = metadataNamespace
+	def.Metadata.Instance.Created = "2024-05-01T12:00:00Z"
+	data, err := xml.Marshal(&def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := parseNetworkCreated(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected creation time %v", created)
+	}
+	if _, err := parseNetworkCreated([]byte(`<network><name>other</name></network>`)); err == nil {
+		t.Errorf("expected error for network without metadata")
+	}
+}
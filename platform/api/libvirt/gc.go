@@ -0,0 +1,110 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package libvirt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GC deletes domains created by mantle over gracePeriod ago together with
+// their volumes. Other volumes and transient networks named with prefix are
+// deleted independently of domains, so leftovers of crashed runs are
+// collected too, once they are older than gracePeriod and no remaining
+// domain uses them. Volumes are aged by their modification time,
+// networks by the creation time mantle stores in their metadata.
+func (a *API) GC(prefix string, gracePeriod time.Duration) error {
+	createdCutoff := time.Now().Add(-gracePeriod)
+
+	domains, err := a.ListDomains()
+	if err != nil {
+		return fmt.Errorf("listing domains: %w", err)
+	}
+
+	inUse := make(map[string]bool)
+	for _, name := range domains {
+		meta, err := a.DomainMetadata(name)
+		if err != nil {
+			// not created by mantle
+			continue
+		}
+		if meta.Created.After(createdCutoff) {
+			for _, vol := range meta.Volumes {
+				inUse[vol] = true
+			}
+			if meta.Network != "" {
+				inUse[meta.Network] = true
+			}
+			continue
+		}
+		plog.Infof("deleting domain %v created at %v", name, meta.Created)
+		if err := a.DestroyDomain(name); err != nil {
+			return fmt.Errorf("deleting domain %v: %w", name, err)
+		}
+		for _, vol := range meta.Volumes {
+			if err := a.DeleteVolume(vol); err != nil {
+				plog.Errorf("deleting volume %v of domain %v: %v", vol, name, err)
+			}
+		}
+	}
+
+	if err := a.gcVolumes(prefix, createdCutoff, inUse); err != nil {
+		return fmt.Errorf("deleting volumes: %w", err)
+	}
+	if err := a.gcNetworks(prefix, createdCutoff, inUse); err != nil {
+		return fmt.Errorf("deleting networks: %w", err)
+	}
+	return nil
+}
+
+func (a *API) gcVolumes(prefix string, createdCutoff time.Time, inUse map[string]bool) error {
+	volumes, err := a.ListVolumes()
+	if err != nil {
+		return fmt.Errorf("listing volumes: %w", err)
+	}
+	for _, name := range volumes {
+		if !strings.HasPrefix(name, prefix) || inUse[name] {
+			continue
+		}
+		modified, err := a.volumeModified(name)
+		if err != nil {
+			plog.Warningf("not deleting volume %v: %v", name, err)
+			continue
+		}
+		if modified.After(createdCutoff) {
+			continue
+		}
+		plog.Infof("deleting volume %v modified at %v", name, modified)
+		if err := a.DeleteVolume(name); err != nil {
+			return fmt.Errorf("deleting volume %v: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (a *API) gcNetworks(prefix string, createdCutoff time.Time, inUse map[string]bool) error {
+	networks, err := a.ListNetworks()
+	if err != nil {
+		return fmt.Errorf("listing networks: %w", err)
+	}
+	for _, name := range networks {
+		if !strings.HasPrefix(name, prefix) || inUse[name] {
+			continue
+		}
+		created, err := a.networkCreated(name)
+		if err != nil {
+			plog.Warningf("not deleting network %v: %v", name, err)
+			continue
+		}
+		if created.After(createdCutoff) {
+			continue
+		}
+		plog.Infof("deleting network %v created at %v", name, created)
+		if err := a.DeleteNetwork(name); err != nil {
+			return fmt.Errorf("deleting network %v: %w", name, err)
+		}
+	}
+	return nil
+}
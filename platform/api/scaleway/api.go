@@ -43,6 +43,8 @@ type Options struct {
 	SecretKey string
 	// Zone is used as "default" zone for all requests.
 	Zone string
+	// Endpoint overrides the URL of the Scaleway API.
+	Endpoint string
 }
 
 // API is a wrapper around Scaleway instance API and
@@ -65,12 +67,16 @@ func New(opts *Options) (*API, error) {
 		return nil, fmt.Errorf("parsing Scaleway zone: %w", err)
 	}
 
-	client, err := scw.NewClient(
+	clientOpts := []scw.ClientOption{
 		scw.WithDefaultOrganizationID(opts.OrganizationID),
 		scw.WithAuth(opts.AccessKey, opts.SecretKey),
 		scw.WithDefaultRegion(region),
 		scw.WithDefaultZone(zone),
-	)
+	}
+	if opts.Endpoint != "" {
+		clientOpts = append(clientOpts, scw.WithAPIURL(opts.Endpoint))
+	}
+	client, err := scw.NewClient(clientOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("creating Scaleway client: %w", err)
 	}
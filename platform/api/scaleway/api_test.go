@@ -0,0 +1,115 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package scaleway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/scaleway/scalewaytest"
+)
+
+func newTestAPI(t *testing.T, srv *scalewaytest.Server, image string) *API {
+	t.Helper()
+	api, err := New(&Options{
+		Options:        &platform.Options{},
+		AccessKey:      scalewaytest.AccessKey,
+		SecretKey:      scalewaytest.SecretKey,
+		OrganizationID: scalewaytest.OrganizationID,
+		Region:         scalewaytest.Region,
+		Zone:           scalewaytest.Zone,
+		Image:          image,
+		InstanceType:   scalewaytest.InstanceType,
+		Endpoint:       srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api
+}
+
+func TestCreateServer(t *testing.T) {
+	srv := scalewaytest.NewServer()
+	defer srv.Close()
+	image := srv.AddSnapshot("flatcar", time.Now(), nil)
+
+	api := newTestAPI(t, srv, image)
+	ctx := context.Background()
+
+	server, err := api.CreateServer(ctx, "kola-1", "{}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.State != instance.ServerStateRunning || server.PublicIP == nil {
+		t.Errorf("server not started: %+v", server.Server)
+	}
+	if data := srv.UserData(server.ID, userDataKey); data != "{}" {
+		t.Errorf("unexpected user data %q", data)
+	}
+	if servers := srv.Servers(); len(servers) != 1 || len(servers[0].Tags) != 1 || servers[0].Tags[0] != "mantle" {
+		t.Errorf("server not created with mantle tags: %+v", servers)
+	}
+
+	if err := api.DeleteServer(ctx, server.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.Servers()) != 0 || len(srv.Volumes()) != 0 {
+		t.Errorf("resources left after deletion: %+v %+v", srv.Servers(), srv.Volumes())
+	}
+}
+
+func TestCreateSnapshot(t *testing.T) {
+	srv := scalewaytest.NewServer()
+	defer srv.Close()
+
+	api := newTestAPI(t, srv, "")
+	id, err := api.CreateSnapshot(context.Background(), "bucket", "flatcar.qcow2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshots := srv.Snapshots()
+	if len(snapshots) != 1 || snapshots[0].ID != id || snapshots[0].Name != "flatcar.qcow2" {
+		t.Errorf("unexpected snapshots %+v", snapshots)
+	}
+}
+
+func TestGC(t *testing.T) {
+	srv := scalewaytest.NewServer()
+	defer srv.Close()
+
+	old := time.Now().Add(-10 * time.Hour)
+	mantle := []string{"mantle"}
+	oldServer := srv.AddServer("old", old, mantle)
+	srv.AddServer("new", time.Now(), mantle)
+	srv.AddServer("foreign", old, nil)
+	oldSnapshot := srv.AddSnapshot("old", old, mantle)
+	srv.AddSnapshot("new", time.Now(), mantle)
+	srv.AddSnapshot("foreign", old, nil)
+
+	api := newTestAPI(t, srv, "")
+	if err := api.GC(context.Background(), 5*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range srv.Servers() {
+		if s.ID == oldServer {
+			t.Errorf("old server not deleted")
+		}
+	}
+	if len(srv.Servers()) != 2 || len(srv.Volumes()) != 2 {
+		t.Errorf("unexpected resources left: %+v %+v", srv.Servers(), srv.Volumes())
+	}
+	for _, s := range srv.Snapshots() {
+		if s.ID == oldSnapshot {
+			t.Errorf("old snapshot not deleted")
+		}
+	}
+	if len(srv.Snapshots()) != 2 {
+		t.Errorf("unexpected snapshots left: %+v", srv.Snapshots())
+	}
+}
@@ -0,0 +1,448 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package scalewaytest implements an in-process fake of the parts of the
+// Scaleway instance API used by mantle, for testing without an account.
+package scalewaytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+const (
+	// Region is the only region known to the fake.
+	Region = "fr-par"
+	// Zone is the only zone known to the fake.
+	Zone = "fr-par-1"
+	// InstanceType is the commercial type of the created servers.
+	InstanceType = "DEV1-S"
+
+	// AccessKey, SecretKey and OrganizationID are valid credentials
+	// for the client, the fake does not check them.
+	AccessKey      = "SCWXXXXXXXXXXXXXXXXX"
+	SecretKey      = "11111111-1111-4111-8111-111111111111"
+	OrganizationID = "22222222-2222-4222-8222-222222222222"
+)
+
+// Server is a fake Scaleway instance API. Resources are kept in memory,
+// actions complete immediately and snapshots are available right away.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	nextID    int
+	servers   map[string]*instance.Server
+	userData  map[string]map[string]string
+	volumes   map[string]*instance.VolumeServer
+	snapshots map[string]*instance.Snapshot
+}
+
+// NewServer starts a fake API. Pass its URL as the endpoint of the client
+// and Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		nextID:    1,
+		servers:   make(map[string]*instance.Server),
+		userData:  make(map[string]map[string]string),
+		volumes:   make(map[string]*instance.VolumeServer),
+		snapshots: make(map[string]*instance.Snapshot),
+	}
+
+	const prefix = "/instance/v1/zones/{zone}"
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+prefix+"/servers", s.listServers)
+	mux.HandleFunc("POST "+prefix+"/servers", s.createServer)
+	mux.HandleFunc("GET "+prefix+"/servers/{id}", s.getServer)
+	mux.HandleFunc("DELETE "+prefix+"/servers/{id}", s.deleteServer)
+	mux.HandleFunc("POST "+prefix+"/servers/{id}/action", s.serverAction)
+	mux.HandleFunc("PATCH "+prefix+"/servers/{id}/user_data/{key}", s.setUserData)
+	mux.HandleFunc("DELETE "+prefix+"/volumes/{id}", s.deleteVolume)
+	mux.HandleFunc("GET "+prefix+"/snapshots", s.listSnapshots)
+	mux.HandleFunc("POST "+prefix+"/snapshots", s.createSnapshot)
+	mux.HandleFunc("GET "+prefix+"/snapshots/{id}", s.getSnapshot)
+	mux.HandleFunc("DELETE "+prefix+"/snapshots/{id}", s.deleteSnapshot)
+	s.Server = httptest.NewServer(inZone(mux))
+
+	return s
+}
+
+// AddSnapshot adds an available snapshot and returns its ID.
+func (s *Server) AddSnapshot(name string, created time.Time, tags []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.newSnapshot(name, created, tags).ID
+}
+
+// AddServer adds a running server with a boot volume and returns its ID.
+func (s *Server) AddServer(name string, created time.Time, tags []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	srv := s.newServer(name, tags)
+	srv.CreationDate = &created
+	srv.State = instance.ServerStateRunning
+	return srv.ID
+}
+
+// Servers returns the servers currently existing.
+func (s *Server) Servers() []instance.Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return values(s.servers)
+}
+
+// Volumes returns the volumes currently existing.
+func (s *Server) Volumes() []instance.VolumeServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return values(s.volumes)
+}
+
+// Snapshots returns the snapshots currently existing.
+func (s *Server) Snapshots() []instance.Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return values(s.snapshots)
+}
+
+// UserData returns the user data set on a server for key.
+func (s *Server) UserData(id, key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.userData[id][key]
+}
+
+func (s *Server) id() string {
+	n := s.nextID
+	s.nextID++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", n)
+}
+
+func (s *Server) newServer(name string, tags []string) *instance.Server {
+	now := time.Now()
+	n := s.nextID
+	srv := &instance.Server{
+		ID:             s.id(),
+		Name:           name,
+		Tags:           tags,
+		CommercialType: InstanceType,
+		CreationDate:   &now,
+		State:          instance.ServerStateStopped,
+		PrivateIP:      scw.StringPtr(fmt.Sprintf("10.1.0.%d", n%250+2)),
+		PublicIP: &instance.ServerIP{
+			Address: net.ParseIP(fmt.Sprintf("192.0.2.%d", n%250+1)),
+			Family:  instance.ServerIPIPFamilyInet,
+		},
+		Volumes: make(map[string]*instance.VolumeServer),
+		Zone:    Zone,
+	}
+	volumeState := instance.VolumeServerStateAvailable
+	vol := &instance.VolumeServer{
+		ID:           s.id(),
+		Name:         scw.StringPtr(name),
+		Server:       &instance.ServerSummary{ID: srv.ID, Name: name},
+		VolumeType:   instance.VolumeServerVolumeTypeLSSD,
+		CreationDate: &now,
+		State:        &volumeState,
+		Boot:         true,
+		Zone:         Zone,
+	}
+	s.volumes[vol.ID] = vol
+	srv.Volumes["0"] = vol
+	s.servers[srv.ID] = srv
+	return srv
+}
+
+func (s *Server) newSnapshot(name string, created time.Time, tags []string) *instance.Snapshot {
+	snapshot := &instance.Snapshot{
+		ID:           s.id(),
+		Name:         name,
+		Tags:         tags,
+		VolumeType:   instance.VolumeVolumeTypeLSSD,
+		State:        instance.SnapshotStateAvailable,
+		CreationDate: &created,
+		Zone:         Zone,
+	}
+	s.snapshots[snapshot.ID] = snapshot
+	return snapshot
+}
+
+// inZone rejects requests for other zones than Zone.
+func inZone(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/instance/v1/zones/"+Zone+"/") {
+			writeError(w, http.StatusNotFound, "unknown_resource", "", "zone not found")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) listServers(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := instance.ListServersResponse{Servers: []*instance.Server{}}
+	for _, srv := range values(s.servers) {
+		if matchTags(srv.Tags, r) && matchName(srv.Name, r) {
+			resp.Servers = append(resp.Servers, &srv)
+		}
+	}
+	resp.TotalCount = uint32(len(resp.Servers))
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) createServer(w http.ResponseWriter, r *http.Request) {
+	var req instance.CreateServerRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.CommercialType != InstanceType {
+		writeError(w, http.StatusBadRequest, "invalid_arguments", "commercial_type", "unknown commercial type")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if vol, ok := req.Volumes["0"]; ok && vol.BaseSnapshot != nil {
+		if _, ok := s.snapshots[*vol.BaseSnapshot]; !ok {
+			writeError(w, http.StatusNotFound, "unknown_resource", "instance_snapshot", "snapshot not found")
+			return
+		}
+	}
+	srv := s.newServer(req.Name, req.Tags)
+	writeJSON(w, http.StatusCreated, instance.CreateServerResponse{Server: srv})
+}
+
+func (s *Server) getServer(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	srv, ok := lookup(w, r, s.servers, "instance_server")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, instance.GetServerResponse{Server: srv})
+}
+
+func (s *Server) deleteServer(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	srv, ok := lookup(w, r, s.servers, "instance_server")
+	if !ok {
+		return
+	}
+	if srv.State != instance.ServerStateStopped {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", "instance should be powered off")
+		return
+	}
+	// like the real API, volumes are detached but not deleted
+	for _, vol := range srv.Volumes {
+		vol.Server = nil
+	}
+	delete(s.servers, srv.ID)
+	delete(s.userData, srv.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) serverAction(w http.ResponseWriter, r *http.Request) {
+	var req instance.ServerActionRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	srv, ok := lookup(w, r, s.servers, "instance_server")
+	if !ok {
+		return
+	}
+	switch req.Action {
+	case instance.ServerActionPoweron, instance.ServerActionReboot:
+		srv.State = instance.ServerStateRunning
+	case instance.ServerActionPoweroff:
+		srv.State = instance.ServerStateStopped
+	default:
+		writeError(w, http.StatusBadRequest, "invalid_arguments", "action", "unsupported action")
+		return
+	}
+	now := time.Now()
+	writeJSON(w, http.StatusAccepted, instance.ServerActionResponse{Task: &instance.Task{
+		ID:           s.id(),
+		Description:  string(req.Action),
+		Progress:     100,
+		StartedAt:    &now,
+		TerminatedAt: &now,
+		Status:       instance.TaskStatusSuccess,
+		Zone:         Zone,
+	}})
+}
+
+func (s *Server) setUserData(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	srv, ok := lookup(w, r, s.servers, "instance_server")
+	if !ok {
+		return
+	}
+	if s.userData[srv.ID] == nil {
+		s.userData[srv.ID] = make(map[string]string)
+	}
+	s.userData[srv.ID][r.PathValue("key")] = string(data)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteVolume(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vol, ok := lookup(w, r, s.volumes, "instance_volume")
+	if !ok {
+		return
+	}
+	if vol.Server != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", "volume is attached to a server")
+		return
+	}
+	delete(s.volumes, vol.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listSnapshots(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := instance.ListSnapshotsResponse{Snapshots: []*instance.Snapshot{}}
+	for _, snapshot := range values(s.snapshots) {
+		if matchTags(snapshot.Tags, r) && matchName(snapshot.Name, r) {
+			resp.Snapshots = append(resp.Snapshots, &snapshot)
+		}
+	}
+	resp.TotalCount = uint32(len(resp.Snapshots))
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) createSnapshot(w http.ResponseWriter, r *http.Request) {
+	var req instance.CreateSnapshotRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Bucket == nil || req.Key == nil {
+		writeError(w, http.StatusBadRequest, "invalid_arguments", "bucket", "only imports from object storage are supported")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tags []string
+	if req.Tags != nil {
+		tags = *req.Tags
+	}
+	snapshot := s.newSnapshot(req.Name, time.Now(), tags)
+	writeJSON(w, http.StatusCreated, instance.CreateSnapshotResponse{Snapshot: snapshot})
+}
+
+func (s *Server) getSnapshot(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot, ok := lookup(w, r, s.snapshots, "instance_snapshot")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, instance.GetSnapshotResponse{Snapshot: snapshot})
+}
+
+func (s *Server) deleteSnapshot(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot, ok := lookup(w, r, s.snapshots, "instance_snapshot")
+	if !ok {
+		return
+	}
+	delete(s.snapshots, snapshot.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookup finds the resource named by the id path parameter, writing a
+// not found error if it does not exist.
+func lookup[T any](w http.ResponseWriter, r *http.Request, m map[string]*T, resource string) (*T, bool) {
+	id := r.PathValue("id")
+	v, ok := m[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown_resource", resource, fmt.Sprintf("%q not found", id))
+		return nil, false
+	}
+	return v, true
+}
+
+// values returns copies of the map values ordered by ID.
+func values[T any](m map[string]*T) []T {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	ret := make([]T, 0, len(ids))
+	for _, id := range ids {
+		ret = append(ret, *m[id])
+	}
+	return ret
+}
+
+// matchTags checks that a resource has all the comma separated tags of the
+// tags query parameter.
+func matchTags(tags []string, r *http.Request) bool {
+	want := r.URL.Query().Get("tags")
+	if want == "" {
+		return true
+	}
+	for _, tag := range strings.Split(want, ",") {
+		found := false
+		for _, t := range tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func matchName(name string, r *http.Request) bool {
+	want := r.URL.Query().Get("name")
+	return want == "" || strings.Contains(name, want)
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, typ, resource, message string) {
+	writeJSON(w, status, scw.ResponseError{Type: typ, Resource: resource, Message: message})
+}
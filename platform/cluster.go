@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
@@ -34,6 +35,8 @@ type BaseCluster struct {
 	machlock   sync.Mutex
 	machmap    map[string]Machine
 	consolemap map[string]string
+	nextIndex  int
+	endpoints  Endpoints
 
 	bf    *BaseFlight
 	name  string
@@ -136,6 +139,55 @@ func (bc *BaseCluster) Keys() ([]*agent.Key, error) {
 	return bc.bf.Keys()
 }
 
+// Endpoints are the URLs of services provided to the machines of a
+// cluster. They are available to userdata templates.
+type Endpoints struct {
+	Omaha string
+	Etcd  string
+	HTTP  string
+}
+
+// SetEndpoints sets the endpoints for machines created afterwards.
+func (bc *BaseCluster) SetEndpoints(e Endpoints) {
+	bc.machlock.Lock()
+	defer bc.machlock.Unlock()
+	bc.endpoints = e
+}
+
+// facts returns the facts for a new machine and reserves its index.
+func (bc *BaseCluster) facts(user string, ignitionVars map[string]string) conf.Facts {
+	bc.machlock.Lock()
+	index := bc.nextIndex
+	bc.nextIndex++
+	endpoints := bc.endpoints
+	bc.machlock.Unlock()
+
+	facts := conf.Facts{
+		Index:       index,
+		Name:        fmt.Sprintf("%s-%d", bc.bf.baseopts.BaseName, index),
+		PublicIPv4:  ignitionVars["$public_ipv4"],
+		PrivateIPv4: ignitionVars["$private_ipv4"],
+		OmahaURL:    endpoints.Omaha,
+		EtcdURL:     endpoints.Etcd,
+		HTTPURL:     endpoints.HTTP,
+		Platform:    string(bc.Platform()),
+		Board:       bc.bf.baseopts.Board,
+		Version:     bc.bf.baseopts.Version,
+		User:        user,
+	}
+	for _, m := range bc.Machines() {
+		facts.Peers = append(facts.Peers, conf.MachineFacts{
+			ID:          m.ID(),
+			PublicIPv4:  m.IP(),
+			PrivateIPv4: m.PrivateIP(),
+		})
+	}
+	sort.Slice(facts.Peers, func(i, j int) bool {
+		return facts.Peers[i].ID < facts.Peers[j].ID
+	})
+	return facts
+}
+
 func (bc *BaseCluster) RenderUserData(userdata *conf.UserData, ignitionVars map[string]string) (*conf.Conf, error) {
 	if userdata == nil {
 		switch bc.IgnitionVersion() {
@@ -155,6 +207,12 @@ func (bc *BaseCluster) RenderUserData(userdata *conf.UserData, ignitionVars map[
 
 	userdata.User = u
 
+	facts := bc.facts(u, ignitionVars)
+	userdata, err := userdata.ExecuteTemplate(facts)
+	if err != nil {
+		return nil, err
+	}
+
 	// hacky solution for unified ignition metadata variables
 	if userdata.IsIgnitionCompatible() {
 		for k, v := range ignitionVars {
@@ -166,6 +224,12 @@ func (bc *BaseCluster) RenderUserData(userdata *conf.UserData, ignitionVars map[
 		userdata = conf.AddSSHKeys(userdata, bc.bf.AdditionalSshKeys)
 	}
 
+	if bc.bf.baseopts.StrictConfig {
+		if rpt := userdata.Validate(bc.bf.ctPlatform); rpt.HasWarnings() {
+			return nil, fmt.Errorf("validating userdata:\n%s", rpt)
+		}
+	}
+
 	conf, err := userdata.Render(bc.bf.ctPlatform)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,1005 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	v33types "github.com/coreos/ignition/v2/config/v3_3/types"
+	v23types "github.com/flatcar/ignition/config/v2_3/types"
+	"github.com/vincent-petithory/dataurl"
+	"gopkg.in/yaml.v3"
+)
+
+// Target is the configuration format a Builder renders to.
+type Target int
+
+const (
+	// TargetIgnitionV2 renders an Ignition spec 2.3.0 config.
+	TargetIgnitionV2 Target = iota
+	// TargetIgnitionV3 renders an Ignition spec 3.3.0 config.
+	TargetIgnitionV3
+	// TargetContainerLinuxConfig renders a Container Linux Config.
+	TargetContainerLinuxConfig
+	// TargetButane renders a Butane config of the flatcar variant.
+	TargetButane
+)
+
+func (t Target) String() string {
+	switch t {
+	case TargetIgnitionV2:
+		return "Ignition v2"
+	case TargetIgnitionV3:
+		return "Ignition v3"
+	case TargetContainerLinuxConfig:
+		return "Container Linux Config"
+	case TargetButane:
+		return "Butane"
+	}
+	return fmt.Sprintf("Target(%d)", int(t))
+}
+
+// TargetForIgnitionVersion returns the Ignition target matching an
+// Ignition version as used by kola ("v2" or "v3").
+func TargetForIgnitionVersion(version string) (Target, error) {
+	switch version {
+	case "v2":
+		return TargetIgnitionV2, nil
+	case "v3":
+		return TargetIgnitionV3, nil
+	}
+	return 0, fmt.Errorf("unknown ignition version %q", version)
+}
+
+// File is a regular file written by the provisioning config.
+type File struct {
+	Path     string
+	Contents string
+	Mode     int
+	// Append appends Contents to an existing file instead of
+	// replacing it.
+	Append bool
+	// User and Group are the names of the owner, root if empty.
+	User  string
+	Group string
+}
+
+// Directory is a directory created by the provisioning config.
+type Directory struct {
+	Path  string
+	Mode  int
+	User  string
+	Group string
+}
+
+// Link is a symbolic or hard link created by the provisioning config.
+type Link struct {
+	Path   string
+	Target string
+	Hard   bool
+}
+
+// Unit is a systemd unit. A unit without Contents only carries dropins
+// or enables/masks a unit shipped by the OS.
+type Unit struct {
+	Name     string
+	Contents string
+	Enabled  bool
+	Mask     bool
+	Dropins  []Dropin
+}
+
+// Dropin is a systemd unit dropin.
+type Dropin struct {
+	Name     string
+	Contents string
+}
+
+// User is a user account.
+type User struct {
+	Name              string
+	PasswordHash      string
+	SSHAuthorizedKeys []string
+	Groups            []string
+	UID               *int
+	HomeDir           string
+	Shell             string
+	System            bool
+	NoCreateHome      bool
+}
+
+// Group is a user group.
+type Group struct {
+	Name   string
+	GID    *int
+	System bool
+}
+
+// Disk is a partitioned block device.
+type Disk struct {
+	Device     string
+	WipeTable  bool
+	Partitions []Partition
+}
+
+// Partition is a GPT partition. A zero SizeMiB fills the remaining
+// space and a zero StartMiB picks the first free sector.
+type Partition struct {
+	Label    string
+	Number   int
+	SizeMiB  int
+	StartMiB int
+	TypeGUID string
+}
+
+// Filesystem is a filesystem created on a device. If Path is set, files,
+// directories and links below it are written into this filesystem.
+type Filesystem struct {
+	Device         string
+	Format         string
+	Label          string
+	Path           string
+	WipeFilesystem bool
+	MountOptions   []string
+}
+
+// LUKS is an encrypted volume. Only Ignition v3 and Butane support it.
+type LUKS struct {
+	Name       string
+	Device     string
+	Label      string
+	KeyFile    string
+	WipeVolume bool
+}
+
+// Raid is a software RAID array.
+type Raid struct {
+	Name    string
+	Level   string
+	Devices []string
+	Spares  int
+}
+
+// Builder declares a provisioning config once and renders it to the
+// format needed by the machine under test, see Target.
+type Builder struct {
+	files       []File
+	directories []Directory
+	links       []Link
+	units       []Unit
+	users       []User
+	groups      []Group
+	disks       []Disk
+	filesystems []Filesystem
+	luks        []LUKS
+	raid        []Raid
+}
+
+// NewBuilder returns an empty Builder.
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+func (b *Builder) AddFile(f File) *Builder {
+	b.files = append(b.files, f)
+	return b
+}
+
+func (b *Builder) AddDirectory(d Directory) *Builder {
+	b.directories = append(b.directories, d)
+	return b
+}
+
+func (b *Builder) AddLink(l Link) *Builder {
+	b.links = append(b.links, l)
+	return b
+}
+
+func (b *Builder) AddUnit(u Unit) *Builder {
+	b.units = append(b.units, u)
+	return b
+}
+
+// AddDropin adds a dropin to the named unit, declaring the unit if
+// needed.
+func (b *Builder) AddDropin(unit string, d Dropin) *Builder {
+	for i := range b.units {
+		if b.units[i].Name == unit {
+			b.units[i].Dropins = append(b.units[i].Dropins, d)
+			return b
+		}
+	}
+	return b.AddUnit(Unit{Name: unit, Dropins: []Dropin{d}})
+}
+
+func (b *Builder) AddUser(u User) *Builder {
+	b.users = append(b.users, u)
+	return b
+}
+
+func (b *Builder) AddGroup(g Group) *Builder {
+	b.groups = append(b.groups, g)
+	return b
+}
+
+func (b *Builder) AddDisk(d Disk) *Builder {
+	b.disks = append(b.disks, d)
+	return b
+}
+
+func (b *Builder) AddFilesystem(fs Filesystem) *Builder {
+	b.filesystems = append(b.filesystems, fs)
+	return b
+}
+
+func (b *Builder) AddLUKS(l LUKS) *Builder {
+	b.luks = append(b.luks, l)
+	return b
+}
+
+func (b *Builder) AddRaid(r Raid) *Builder {
+	b.raid = append(b.raid, r)
+	return b
+}
+
+// UserData renders the config for target. It returns an error if the
+// config uses features target can't express.
+func (b *Builder) UserData(target Target) (*UserData, error) {
+	switch target {
+	case TargetIgnitionV2:
+		cfg, err := b.ignitionV2()
+		if err != nil {
+			return nil, err
+		}
+		buf, err := json.Marshal(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return Ignition(string(buf)), nil
+	case TargetIgnitionV3:
+		buf, err := json.Marshal(b.ignitionV3())
+		if err != nil {
+			return nil, err
+		}
+		return Ignition(string(buf)), nil
+	case TargetContainerLinuxConfig:
+		cfg, err := b.containerLinuxConfig()
+		if err != nil {
+			return nil, err
+		}
+		buf, err := yaml.Marshal(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return ContainerLinuxConfig(string(buf)), nil
+	case TargetButane:
+		buf, err := yaml.Marshal(b.butane())
+		if err != nil {
+			return nil, err
+		}
+		return Butane(string(buf)), nil
+	}
+	return nil, fmt.Errorf("unknown target %v", target)
+}
+
+// filesystemFor maps an absolute path to the Ignition v2 filesystem
+// holding it and the path relative to that filesystem.
+func (b *Builder) filesystemFor(p string) (string, string) {
+	name, rel, best := "root", p, ""
+	for i, fs := range b.filesystems {
+		if fs.Path == "" || fs.Path == "/" || len(fs.Path) <= len(best) {
+			continue
+		}
+		if p == fs.Path || strings.HasPrefix(p, strings.TrimSuffix(fs.Path, "/")+"/") {
+			name = filesystemName(i)
+			rel = path.Join("/", strings.TrimPrefix(p, fs.Path))
+			best = fs.Path
+		}
+	}
+	return name, rel
+}
+
+// filesystemName is the name of the i-th filesystem in configs which
+// refer to filesystems by name.
+func filesystemName(i int) string {
+	return fmt.Sprintf("fs%d", i)
+}
+
+// unsupported returns an error if the builder declares constructs target
+// can't express.
+func (b *Builder) unsupported(target Target) error {
+	var what []string
+	if len(b.luks) > 0 {
+		what = append(what, "LUKS volumes")
+	}
+	for _, fs := range b.filesystems {
+		if len(fs.MountOptions) > 0 {
+			what = append(what, fmt.Sprintf("mount options on %s", fs.Device))
+		}
+	}
+	if len(what) > 0 {
+		return fmt.Errorf("%v does not support %s", target, strings.Join(what, ", "))
+	}
+	return nil
+}
+
+func (b *Builder) ignitionV2() (*v23types.Config, error) {
+	if err := b.unsupported(TargetIgnitionV2); err != nil {
+		return nil, err
+	}
+
+	cfg := &v23types.Config{
+		Ignition: v23types.Ignition{Version: "2.3.0"},
+	}
+	s := &cfg.Storage
+	for _, f := range b.files {
+		fs, p := b.filesystemFor(f.Path)
+		s.Files = append(s.Files, v23types.File{
+			Node: v23types.Node{
+				Filesystem: fs,
+				Path:       p,
+				User:       v2NodeUser(f.User),
+				Group:      v2NodeGroup(f.Group),
+			},
+			FileEmbedded1: v23types.FileEmbedded1{
+				Append:   f.Append,
+				Contents: v23types.FileContents{Source: dataurl.EncodeBytes([]byte(f.Contents))},
+				Mode:     intPtr(f.Mode),
+			},
+		})
+	}
+	for _, d := range b.directories {
+		fs, p := b.filesystemFor(d.Path)
+		s.Directories = append(s.Directories, v23types.Directory{
+			Node: v23types.Node{
+				Filesystem: fs,
+				Path:       p,
+				User:       v2NodeUser(d.User),
+				Group:      v2NodeGroup(d.Group),
+			},
+			DirectoryEmbedded1: v23types.DirectoryEmbedded1{Mode: intPtr(d.Mode)},
+		})
+	}
+	for _, l := range b.links {
+		fs, p := b.filesystemFor(l.Path)
+		s.Links = append(s.Links, v23types.Link{
+			Node:          v23types.Node{Filesystem: fs, Path: p},
+			LinkEmbedded1: v23types.LinkEmbedded1{Hard: l.Hard, Target: l.Target},
+		})
+	}
+	for _, d := range b.disks {
+		disk := v23types.Disk{Device: d.Device, WipeTable: d.WipeTable}
+		for _, p := range d.Partitions {
+			size, start := p.SizeMiB, p.StartMiB
+			disk.Partitions = append(disk.Partitions, v23types.Partition{
+				Label:    strPtr(p.Label),
+				Number:   p.Number,
+				SizeMiB:  &size,
+				StartMiB: &start,
+				TypeGUID: p.TypeGUID,
+			})
+		}
+		s.Disks = append(s.Disks, disk)
+	}
+	for i, fs := range b.filesystems {
+		s.Filesystems = append(s.Filesystems, v23types.Filesystem{
+			Name: filesystemName(i),
+			Mount: &v23types.Mount{
+				Device:         fs.Device,
+				Format:         fs.Format,
+				Label:          strPtr(fs.Label),
+				WipeFilesystem: fs.WipeFilesystem,
+			},
+		})
+	}
+	for _, r := range b.raid {
+		raid := v23types.Raid{Name: r.Name, Level: r.Level, Spares: r.Spares}
+		for _, d := range r.Devices {
+			raid.Devices = append(raid.Devices, v23types.Device(d))
+		}
+		s.Raid = append(s.Raid, raid)
+	}
+
+	for _, u := range b.units {
+		unit := v23types.Unit{
+			Name:     u.Name,
+			Contents: u.Contents,
+			Enabled:  boolPtr(u.Enabled),
+			Mask:     u.Mask,
+		}
+		for _, d := range u.Dropins {
+			unit.Dropins = append(unit.Dropins, v23types.SystemdDropin{Name: d.Name, Contents: d.Contents})
+		}
+		cfg.Systemd.Units = append(cfg.Systemd.Units, unit)
+	}
+
+	for _, u := range b.users {
+		user := v23types.PasswdUser{
+			Name:         u.Name,
+			PasswordHash: strPtr(u.PasswordHash),
+			UID:          u.UID,
+			HomeDir:      u.HomeDir,
+			Shell:        u.Shell,
+			System:       u.System,
+			NoCreateHome: u.NoCreateHome,
+		}
+		for _, k := range u.SSHAuthorizedKeys {
+			user.SSHAuthorizedKeys = append(user.SSHAuthorizedKeys, v23types.SSHAuthorizedKey(k))
+		}
+		for _, g := range u.Groups {
+			user.Groups = append(user.Groups, v23types.Group(g))
+		}
+		cfg.Passwd.Users = append(cfg.Passwd.Users, user)
+	}
+	for _, g := range b.groups {
+		cfg.Passwd.Groups = append(cfg.Passwd.Groups, v23types.PasswdGroup{
+			Name:   g.Name,
+			Gid:    g.GID,
+			System: g.System,
+		})
+	}
+
+	return cfg, nil
+}
+
+func (b *Builder) ignitionV3() *v33types.Config {
+	cfg := &v33types.Config{
+		Ignition: v33types.Ignition{Version: "3.3.0"},
+	}
+	s := &cfg.Storage
+	for _, f := range b.files {
+		source := dataurl.EncodeBytes([]byte(f.Contents))
+		file := v33types.File{
+			Node: v33types.Node{
+				Path:      f.Path,
+				Overwrite: boolPtr(!f.Append),
+				User:      v33types.NodeUser{Name: strPtr(f.User)},
+				Group:     v33types.NodeGroup{Name: strPtr(f.Group)},
+			},
+			FileEmbedded1: v33types.FileEmbedded1{Mode: intPtr(f.Mode)},
+		}
+		if f.Append {
+			file.Append = []v33types.Resource{{Source: &source}}
+		} else {
+			file.Contents = v33types.Resource{Source: &source}
+		}
+		s.Files = append(s.Files, file)
+	}
+	for _, d := range b.directories {
+		s.Directories = append(s.Directories, v33types.Directory{
+			Node: v33types.Node{
+				Path:  d.Path,
+				User:  v33types.NodeUser{Name: strPtr(d.User)},
+				Group: v33types.NodeGroup{Name: strPtr(d.Group)},
+			},
+			DirectoryEmbedded1: v33types.DirectoryEmbedded1{Mode: intPtr(d.Mode)},
+		})
+	}
+	for _, l := range b.links {
+		target := l.Target
+		s.Links = append(s.Links, v33types.Link{
+			Node:          v33types.Node{Path: l.Path, Overwrite: boolPtr(true)},
+			LinkEmbedded1: v33types.LinkEmbedded1{Hard: boolPtr(l.Hard), Target: &target},
+		})
+	}
+	for _, d := range b.disks {
+		disk := v33types.Disk{Device: d.Device, WipeTable: boolPtr(d.WipeTable)}
+		for _, p := range d.Partitions {
+			size, start := p.SizeMiB, p.StartMiB
+			disk.Partitions = append(disk.Partitions, v33types.Partition{
+				Label:    strPtr(p.Label),
+				Number:   p.Number,
+				SizeMiB:  &size,
+				StartMiB: &start,
+				TypeGUID: strPtr(p.TypeGUID),
+			})
+		}
+		s.Disks = append(s.Disks, disk)
+	}
+	for _, fs := range b.filesystems {
+		filesystem := v33types.Filesystem{
+			Device:         fs.Device,
+			Format:         strPtr(fs.Format),
+			Label:          strPtr(fs.Label),
+			Path:           strPtr(fs.Path),
+			WipeFilesystem: boolPtr(fs.WipeFilesystem),
+		}
+		for _, o := range fs.MountOptions {
+			filesystem.MountOptions = append(filesystem.MountOptions, v33types.MountOption(o))
+		}
+		s.Filesystems = append(s.Filesystems, filesystem)
+	}
+	for _, l := range b.luks {
+		luks := v33types.Luks{
+			Name:       l.Name,
+			Device:     strPtr(l.Device),
+			Label:      strPtr(l.Label),
+			WipeVolume: boolPtr(l.WipeVolume),
+		}
+		if l.KeyFile != "" {
+			source := dataurl.EncodeBytes([]byte(l.KeyFile))
+			luks.KeyFile = v33types.Resource{Source: &source}
+		}
+		s.Luks = append(s.Luks, luks)
+	}
+	for _, r := range b.raid {
+		raid := v33types.Raid{Name: r.Name, Level: strPtr(r.Level), Spares: intPtr(r.Spares)}
+		for _, d := range r.Devices {
+			raid.Devices = append(raid.Devices, v33types.Device(d))
+		}
+		s.Raid = append(s.Raid, raid)
+	}
+
+	for _, u := range b.units {
+		unit := v33types.Unit{
+			Name:     u.Name,
+			Contents: strPtr(u.Contents),
+			Enabled:  boolPtr(u.Enabled),
+			Mask:     boolPtr(u.Mask),
+		}
+		for _, d := range u.Dropins {
+			contents := d.Contents
+			unit.Dropins = append(unit.Dropins, v33types.Dropin{Name: d.Name, Contents: &contents})
+		}
+		cfg.Systemd.Units = append(cfg.Systemd.Units, unit)
+	}
+
+	for _, u := range b.users {
+		user := v33types.PasswdUser{
+			Name:         u.Name,
+			PasswordHash: strPtr(u.PasswordHash),
+			UID:          u.UID,
+			HomeDir:      strPtr(u.HomeDir),
+			Shell:        strPtr(u.Shell),
+			System:       boolPtr(u.System),
+			NoCreateHome: boolPtr(u.NoCreateHome),
+		}
+		for _, k := range u.SSHAuthorizedKeys {
+			user.SSHAuthorizedKeys = append(user.SSHAuthorizedKeys, v33types.SSHAuthorizedKey(k))
+		}
+		for _, g := range u.Groups {
+			user.Groups = append(user.Groups, v33types.Group(g))
+		}
+		cfg.Passwd.Users = append(cfg.Passwd.Users, user)
+	}
+	for _, g := range b.groups {
+		cfg.Passwd.Groups = append(cfg.Passwd.Groups, v33types.PasswdGroup{
+			Name:   g.Name,
+			Gid:    g.GID,
+			System: boolPtr(g.System),
+		})
+	}
+
+	return cfg
+}
+
+// The Container Linux Config and Butane schemas below only carry the
+// fields the Builder emits; the upstream types lack omitempty.
+
+type yamlInline struct {
+	Inline string `yaml:"inline"`
+}
+
+type yamlOwner struct {
+	Name string `yaml:"name"`
+}
+
+type yamlDropin struct {
+	Name     string `yaml:"name"`
+	Contents string `yaml:"contents,omitempty"`
+}
+
+type yamlUnit struct {
+	Name     string       `yaml:"name"`
+	Enabled  *bool        `yaml:"enabled,omitempty"`
+	Mask     bool         `yaml:"mask,omitempty"`
+	Contents string       `yaml:"contents,omitempty"`
+	Dropins  []yamlDropin `yaml:"dropins,omitempty"`
+}
+
+type yamlGroup struct {
+	Name   string `yaml:"name"`
+	GID    *int   `yaml:"gid,omitempty"`
+	System bool   `yaml:"system,omitempty"`
+}
+
+type yamlUser struct {
+	Name              string   `yaml:"name"`
+	PasswordHash      string   `yaml:"password_hash,omitempty"`
+	SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys,omitempty"`
+	Groups            []string `yaml:"groups,omitempty"`
+	UID               *int     `yaml:"uid,omitempty"`
+	HomeDir           string   `yaml:"home_dir,omitempty"`
+	Shell             string   `yaml:"shell,omitempty"`
+	System            bool     `yaml:"system,omitempty"`
+	NoCreateHome      bool     `yaml:"no_create_home,omitempty"`
+}
+
+type yamlPasswd struct {
+	Users  []yamlUser  `yaml:"users,omitempty"`
+	Groups []yamlGroup `yaml:"groups,omitempty"`
+}
+
+type yamlSystemd struct {
+	Units []yamlUnit `yaml:"units,omitempty"`
+}
+
+type yamlRaid struct {
+	Name    string   `yaml:"name"`
+	Level   string   `yaml:"level"`
+	Devices []string `yaml:"devices"`
+	Spares  int      `yaml:"spares,omitempty"`
+}
+
+type clcFile struct {
+	Filesystem string     `yaml:"filesystem"`
+	Path       string     `yaml:"path"`
+	Contents   yamlInline `yaml:"contents"`
+	Mode       int        `yaml:"mode,omitempty"`
+	Append     bool       `yaml:"append,omitempty"`
+	User       *yamlOwner `yaml:"user,omitempty"`
+	Group      *yamlOwner `yaml:"group,omitempty"`
+}
+
+type clcDirectory struct {
+	Filesystem string     `yaml:"filesystem"`
+	Path       string     `yaml:"path"`
+	Mode       int        `yaml:"mode,omitempty"`
+	User       *yamlOwner `yaml:"user,omitempty"`
+	Group      *yamlOwner `yaml:"group,omitempty"`
+}
+
+type clcLink struct {
+	Filesystem string `yaml:"filesystem"`
+	Path       string `yaml:"path"`
+	Target     string `yaml:"target"`
+	Hard       bool   `yaml:"hard,omitempty"`
+}
+
+type clcPartition struct {
+	Label    string `yaml:"label,omitempty"`
+	Number   int    `yaml:"number,omitempty"`
+	Size     string `yaml:"size,omitempty"`
+	Start    string `yaml:"start,omitempty"`
+	TypeGUID string `yaml:"type_guid,omitempty"`
+}
+
+type clcDisk struct {
+	Device     string         `yaml:"device"`
+	WipeTable  bool           `yaml:"wipe_table,omitempty"`
+	Partitions []clcPartition `yaml:"partitions,omitempty"`
+}
+
+type clcMount struct {
+	Device         string `yaml:"device"`
+	Format         string `yaml:"format"`
+	Label          string `yaml:"label,omitempty"`
+	WipeFilesystem bool   `yaml:"wipe_filesystem,omitempty"`
+}
+
+type clcFilesystem struct {
+	Name  string   `yaml:"name"`
+	Mount clcMount `yaml:"mount"`
+}
+
+type clcStorage struct {
+	Disks       []clcDisk       `yaml:"disks,omitempty"`
+	Raid        []yamlRaid      `yaml:"raid,omitempty"`
+	Filesystems []clcFilesystem `yaml:"filesystems,omitempty"`
+	Files       []clcFile       `yaml:"files,omitempty"`
+	Directories []clcDirectory  `yaml:"directories,omitempty"`
+	Links       []clcLink       `yaml:"links,omitempty"`
+}
+
+type clcConfig struct {
+	Storage clcStorage  `yaml:"storage,omitempty"`
+	Systemd yamlSystemd `yaml:"systemd,omitempty"`
+	Passwd  yamlPasswd  `yaml:"passwd,omitempty"`
+}
+
+func (b *Builder) containerLinuxConfig() (*clcConfig, error) {
+	if err := b.unsupported(TargetContainerLinuxConfig); err != nil {
+		return nil, err
+	}
+
+	cfg := &clcConfig{}
+	s := &cfg.Storage
+	for _, f := range b.files {
+		fs, p := b.filesystemFor(f.Path)
+		s.Files = append(s.Files, clcFile{
+			Filesystem: fs,
+			Path:       p,
+			Contents:   yamlInline{f.Contents},
+			Mode:       f.Mode,
+			Append:     f.Append,
+			User:       yamlOwnerPtr(f.User),
+			Group:      yamlOwnerPtr(f.Group),
+		})
+	}
+	for _, d := range b.directories {
+		fs, p := b.filesystemFor(d.Path)
+		s.Directories = append(s.Directories, clcDirectory{
+			Filesystem: fs,
+			Path:       p,
+			Mode:       d.Mode,
+			User:       yamlOwnerPtr(d.User),
+			Group:      yamlOwnerPtr(d.Group),
+		})
+	}
+	for _, l := range b.links {
+		fs, p := b.filesystemFor(l.Path)
+		s.Links = append(s.Links, clcLink{Filesystem: fs, Path: p, Target: l.Target, Hard: l.Hard})
+	}
+	for _, d := range b.disks {
+		disk := clcDisk{Device: d.Device, WipeTable: d.WipeTable}
+		for _, p := range d.Partitions {
+			part := clcPartition{Label: p.Label, Number: p.Number, TypeGUID: p.TypeGUID}
+			if p.SizeMiB != 0 {
+				part.Size = fmt.Sprintf("%dMiB", p.SizeMiB)
+			}
+			if p.StartMiB != 0 {
+				part.Start = fmt.Sprintf("%dMiB", p.StartMiB)
+			}
+			disk.Partitions = append(disk.Partitions, part)
+		}
+		s.Disks = append(s.Disks, disk)
+	}
+	for i, fs := range b.filesystems {
+		s.Filesystems = append(s.Filesystems, clcFilesystem{
+			Name: filesystemName(i),
+			Mount: clcMount{
+				Device:         fs.Device,
+				Format:         fs.Format,
+				Label:          fs.Label,
+				WipeFilesystem: fs.WipeFilesystem,
+			},
+		})
+	}
+	s.Raid = b.yamlRaid()
+	cfg.Systemd = b.yamlSystemd()
+	cfg.Passwd = b.yamlPasswd()
+
+	return cfg, nil
+}
+
+type butaneFile struct {
+	Path      string       `yaml:"path"`
+	Overwrite *bool        `yaml:"overwrite,omitempty"`
+	Contents  *yamlInline  `yaml:"contents,omitempty"`
+	Append    []yamlInline `yaml:"append,omitempty"`
+	Mode      int          `yaml:"mode,omitempty"`
+	User      *yamlOwner   `yaml:"user,omitempty"`
+	Group     *yamlOwner   `yaml:"group,omitempty"`
+}
+
+type butaneDirectory struct {
+	Path  string     `yaml:"path"`
+	Mode  int        `yaml:"mode,omitempty"`
+	User  *yamlOwner `yaml:"user,omitempty"`
+	Group *yamlOwner `yaml:"group,omitempty"`
+}
+
+type butaneLink struct {
+	Path      string `yaml:"path"`
+	Target    string `yaml:"target"`
+	Hard      bool   `yaml:"hard,omitempty"`
+	Overwrite bool   `yaml:"overwrite,omitempty"`
+}
+
+type butanePartition struct {
+	Label    string `yaml:"label,omitempty"`
+	Number   int    `yaml:"number,omitempty"`
+	SizeMiB  int    `yaml:"size_mib,omitempty"`
+	StartMiB int    `yaml:"start_mib,omitempty"`
+	TypeGUID string `yaml:"type_guid,omitempty"`
+}
+
+type butaneDisk struct {
+	Device     string            `yaml:"device"`
+	WipeTable  bool              `yaml:"wipe_table,omitempty"`
+	Partitions []butanePartition `yaml:"partitions,omitempty"`
+}
+
+type butaneFilesystem struct {
+	Device         string   `yaml:"device"`
+	Format         string   `yaml:"format,omitempty"`
+	Label          string   `yaml:"label,omitempty"`
+	Path           string   `yaml:"path,omitempty"`
+	WipeFilesystem bool     `yaml:"wipe_filesystem,omitempty"`
+	MountOptions   []string `yaml:"mount_options,omitempty"`
+}
+
+type butaneLUKS struct {
+	Name       string      `yaml:"name"`
+	Device     string      `yaml:"device"`
+	Label      string      `yaml:"label,omitempty"`
+	KeyFile    *yamlInline `yaml:"key_file,omitempty"`
+	WipeVolume bool        `yaml:"wipe_volume,omitempty"`
+}
+
+type butaneStorage struct {
+	Disks       []butaneDisk       `yaml:"disks,omitempty"`
+	Raid        []yamlRaid         `yaml:"raid,omitempty"`
+	Luks        []butaneLUKS       `yaml:"luks,omitempty"`
+	Filesystems []butaneFilesystem `yaml:"filesystems,omitempty"`
+	Files       []butaneFile       `yaml:"files,omitempty"`
+	Directories []butaneDirectory  `yaml:"directories,omitempty"`
+	Links       []butaneLink       `yaml:"links,omitempty"`
+}
+
+type butaneConfig struct {
+	Variant string        `yaml:"variant"`
+	Version string        `yaml:"version"`
+	Storage butaneStorage `yaml:"storage,omitempty"`
+	Systemd yamlSystemd   `yaml:"systemd,omitempty"`
+	Passwd  yamlPasswd    `yaml:"passwd,omitempty"`
+}
+
+func (b *Builder) butane() *butaneConfig {
+	cfg := &butaneConfig{
+		Variant: "flatcar",
+		Version: "1.0.0",
+	}
+	s := &cfg.Storage
+	for _, f := range b.files {
+		file := butaneFile{
+			Path:  f.Path,
+			Mode:  f.Mode,
+			User:  yamlOwnerPtr(f.User),
+			Group: yamlOwnerPtr(f.Group),
+		}
+		if f.Append {
+			file.Append = []yamlInline{{f.Contents}}
+		} else {
+			file.Overwrite = boolPtr(true)
+			file.Contents = &yamlInline{f.Contents}
+		}
+		s.Files = append(s.Files, file)
+	}
+	for _, d := range b.directories {
+		s.Directories = append(s.Directories, butaneDirectory{
+			Path:  d.Path,
+			Mode:  d.Mode,
+			User:  yamlOwnerPtr(d.User),
+			Group: yamlOwnerPtr(d.Group),
+		})
+	}
+	for _, l := range b.links {
+		s.Links = append(s.Links, butaneLink{Path: l.Path, Target: l.Target, Hard: l.Hard, Overwrite: true})
+	}
+	for _, d := range b.disks {
+		disk := butaneDisk{Device: d.Device, WipeTable: d.WipeTable}
+		for _, p := range d.Partitions {
+			disk.Partitions = append(disk.Partitions, butanePartition{
+				Label:    p.Label,
+				Number:   p.Number,
+				SizeMiB:  p.SizeMiB,
+				StartMiB: p.StartMiB,
+				TypeGUID: p.TypeGUID,
+			})
+		}
+		s.Disks = append(s.Disks, disk)
+	}
+	for _, fs := range b.filesystems {
+		s.Filesystems = append(s.Filesystems, butaneFilesystem{
+			Device:         fs.Device,
+			Format:         fs.Format,
+			Label:          fs.Label,
+			Path:           fs.Path,
+			WipeFilesystem: fs.WipeFilesystem,
+			MountOptions:   fs.MountOptions,
+		})
+	}
+	for _, l := range b.luks {
+		luks := butaneLUKS{
+			Name:       l.Name,
+			Device:     l.Device,
+			Label:      l.Label,
+			WipeVolume: l.WipeVolume,
+		}
+		if l.KeyFile != "" {
+			luks.KeyFile = &yamlInline{l.KeyFile}
+		}
+		s.Luks = append(s.Luks, luks)
+	}
+	s.Raid = b.yamlRaid()
+	cfg.Systemd = b.yamlSystemd()
+	cfg.Passwd = b.yamlPasswd()
+
+	return cfg
+}
+
+func (b *Builder) yamlRaid() []yamlRaid {
+	var ret []yamlRaid
+	for _, r := range b.raid {
+		ret = append(ret, yamlRaid{Name: r.Name, Level: r.Level, Devices: r.Devices, Spares: r.Spares})
+	}
+	return ret
+}
+
+func (b *Builder) yamlSystemd() yamlSystemd {
+	var ret yamlSystemd
+	for _, u := range b.units {
+		unit := yamlUnit{
+			Name:     u.Name,
+			Enabled:  boolPtr(u.Enabled),
+			Mask:     u.Mask,
+			Contents: u.Contents,
+		}
+		for _, d := range u.Dropins {
+			unit.Dropins = append(unit.Dropins, yamlDropin{Name: d.Name, Contents: d.Contents})
+		}
+		ret.Units = append(ret.Units, unit)
+	}
+	return ret
+}
+
+func (b *Builder) yamlPasswd() yamlPasswd {
+	var ret yamlPasswd
+	for _, u := range b.users {
+		ret.Users = append(ret.Users, yamlUser{
+			Name:              u.Name,
+			PasswordHash:      u.PasswordHash,
+			SSHAuthorizedKeys: u.SSHAuthorizedKeys,
+			Groups:            u.Groups,
+			UID:               u.UID,
+			HomeDir:           u.HomeDir,
+			Shell:             u.Shell,
+			System:            u.System,
+			NoCreateHome:      u.NoCreateHome,
+		})
+	}
+	for _, g := range b.groups {
+		ret.Groups = append(ret.Groups, yamlGroup{Name: g.Name, GID: g.GID, System: g.System})
+	}
+	return ret
+}
+
+func v2NodeUser(name string) *v23types.NodeUser {
+	if name == "" {
+		return nil
+	}
+	return &v23types.NodeUser{Name: name}
+}
+
+func v2NodeGroup(name string) *v23types.NodeGroup {
+	if name == "" {
+		return nil
+	}
+	return &v23types.NodeGroup{Name: name}
+}
+
+func yamlOwnerPtr(name string) *yamlOwner {
+	if name == "" {
+		return nil
+	}
+	return &yamlOwner{name}
+}
+
+// strPtr, intPtr and boolPtr return nil for zero values so they are
+// omitted from the rendered config.
+
+func strPtr(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func intPtr(i int) *int {
+	if i == 0 {
+		return nil
+	}
+	return &i
+}
+
+func boolPtr(b bool) *bool {
+	if !b {
+		return nil
+	}
+	return &b
+}
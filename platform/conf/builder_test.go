@@ -0,0 +1,86 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+func testBuilder() *Builder {
+	uid := 1500
+	return NewBuilder().
+		AddFile(File{Path: "/etc/hostname", Contents: "kola", Mode: 0644}).
+		AddFile(File{Path: "/var/lib/data/hello", Contents: "world", Mode: 0600, User: "core"}).
+		AddDirectory(Directory{Path: "/opt/kola", Mode: 0755}).
+		AddLink(Link{Path: "/etc/localtime", Target: "/usr/share/zoneinfo/UTC"}).
+		AddUnit(Unit{Name: "kola.service", Contents: "[Service]\nExecStart=/bin/true\n[Install]\nWantedBy=multi-user.target\n", Enabled: true}).
+		AddDropin("kola.service", Dropin{Name: "10-env.conf", Contents: "[Service]\nEnvironment=KOLA=1\n"}).
+		AddDropin("docker.service", Dropin{Name: "10-debug.conf", Contents: "[Service]\nEnvironment=DEBUG=1\n"}).
+		AddUser(User{Name: "kola", UID: &uid, Groups: []string{"sudo"}, SSHAuthorizedKeys: []string{"ssh-ed25519 AAAA"}}).
+		AddGroup(Group{Name: "kolagroup", System: true}).
+		AddDisk(Disk{Device: "/dev/vdb", WipeTable: true, Partitions: []Partition{{Label: "DATA", Number: 1, SizeMiB: 512}}}).
+		AddFilesystem(Filesystem{Device: "/dev/disk/by-partlabel/DATA", Format: "ext4", Label: "DATA", Path: "/var/lib/data", WipeFilesystem: true}).
+		AddRaid(Raid{Name: "md0", Level: "raid1", Devices: []string{"/dev/vdc", "/dev/vdd"}})
+}
+
+func TestBuilderTargets(t *testing.T) {
+	for _, target := range []Target{TargetIgnitionV2, TargetIgnitionV3, TargetContainerLinuxConfig, TargetButane} {
+		userdata, err := testBuilder().UserData(target)
+		if err != nil {
+			t.Errorf("%v: %v", target, err)
+			continue
+		}
+		c, err := userdata.Render("")
+		if err != nil {
+			t.Errorf("%v: rendering %s: %v", target, userdata.data, err)
+			continue
+		}
+		if !c.ValidConfig() {
+			t.Errorf("%v: invalid config %s", target, c.String())
+		}
+		out := c.String()
+		for _, want := range []string{"/etc/hostname", "kola.service", "10-env.conf", "docker.service", "md0", "kolagroup"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("%v: %q missing from %s", target, want, out)
+			}
+		}
+	}
+}
+
+func TestBuilderFilesystemMapping(t *testing.T) {
+	cfg, err := testBuilder().ignitionV2()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := cfg.Storage.Files
+	if files[0].Filesystem != "root" || files[0].Path != "/etc/hostname" {
+		t.Errorf("unexpected root file %+v", files[0].Node)
+	}
+	if files[1].Filesystem != "fs0" || files[1].Path != "/hello" {
+		t.Errorf("unexpected data file %+v", files[1].Node)
+	}
+	if fs := cfg.Storage.Filesystems; len(fs) != 1 || fs[0].Name != "fs0" {
+		t.Errorf("unexpected filesystems %+v", fs)
+	}
+}
+
+func TestBuilderUnsupported(t *testing.T) {
+	b := testBuilder().AddLUKS(LUKS{Name: "data", Device: "/dev/vde", KeyFile: "secret"})
+	for _, target := range []Target{TargetIgnitionV2, TargetContainerLinuxConfig} {
+		if _, err := b.UserData(target); err == nil || !strings.Contains(err.Error(), "LUKS") {
+			t.Errorf("%v: expected LUKS error, got %v", target, err)
+		}
+	}
+	for _, target := range []Target{TargetIgnitionV3, TargetButane} {
+		userdata, err := b.UserData(target)
+		if err != nil {
+			t.Errorf("%v: %v", target, err)
+			continue
+		}
+		if _, err := userdata.Render(""); err != nil {
+			t.Errorf("%v: %v", target, err)
+		}
+	}
+}
@@ -81,6 +81,13 @@ type UserData struct {
 	kind      kind
 	data      string
 	extraKeys []*agent.Key // SSH keys to be injected during rendering
+	// translate Ignition 2.x to 3.x during rendering, see TranslateV3
+	translateV3 bool
+	fsPaths     map[string]string
+	// execute as a text/template before rendering, see Template
+	template bool
+	// kind was guessed by Unknown
+	guessed bool
 	// user to create.
 	User string
 }
@@ -180,7 +187,8 @@ func isMultipartMime(userdata []byte) bool {
 
 func Unknown(data string) *UserData {
 	u := &UserData{
-		data: data,
+		data:    data,
+		guessed: true,
 	}
 
 	_, _, err := v22.Parse([]byte(data))
@@ -409,6 +417,12 @@ func (u *UserData) Render(ctPlatform string) (*Conf, error) {
 		panic("invalid kind")
 	}
 
+	if u.translateV3 {
+		if err := c.translateV3(u.fsPaths); err != nil {
+			return nil, err
+		}
+	}
+
 	if len(u.extraKeys) > 0 {
 		// not a no-op in the zero-key case
 		c.CopyKeys(u.extraKeys)
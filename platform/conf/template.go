@@ -0,0 +1,94 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package conf
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// MachineFacts describes a machine of the cluster.
+type MachineFacts struct {
+	ID          string
+	PublicIPv4  string
+	PrivateIPv4 string
+}
+
+// Facts are the values available to userdata templates, see
+// UserData.Template.
+type Facts struct {
+	// Index of the machine in the cluster, starting at 0 and
+	// counting the machines in the order their userdata is rendered.
+	Index int
+	// Name is unique in the cluster and usable as a hostname. It is
+	// not the machine's hostname unless the config sets it.
+	Name string
+	// PublicIPv4 and PrivateIPv4 are the addresses of the machine
+	// itself. They aren't known before the machine is created, so
+	// they are expanded to the same platform specific variables as
+	// $public_ipv4 and $private_ipv4 and only work in Ignition
+	// compatible configs.
+	PublicIPv4  string
+	PrivateIPv4 string
+	// Peers are the other machines running in the cluster when the
+	// userdata is rendered.
+	Peers []MachineFacts
+
+	// Endpoints of services provided to the machines by the
+	// cluster, empty if the platform has none. HTTPURL serves the
+	// files tests put in the cluster's HTTP directory.
+	OmahaURL string
+	EtcdURL  string
+	HTTPURL  string
+
+	Platform string
+	Board    string
+	Version  string
+	// User is the user the harness logs in as.
+	User string
+}
+
+// Template marks the userdata as a text/template which is executed
+// with the cluster's Facts before rendering, e.g.
+//
+//	ExecStart=/usr/bin/ping -c1 {{ (index .Peers 0).PrivateIPv4 }}
+//
+// Userdata which isn't marked is never executed, so existing configs
+// may contain "{{" freely. The kind of userdata created with Unknown is
+// guessed again after executing the template.
+func (u *UserData) Template() *UserData {
+	ret := *u
+	ret.template = true
+	return &ret
+}
+
+// IsTemplate returns true if the userdata is marked as a template.
+func (u *UserData) IsTemplate() bool {
+	return u.template
+}
+
+// ExecuteTemplate executes a userdata template with facts and returns
+// the resulting userdata. Userdata which isn't a template is returned
+// unchanged.
+func (u *UserData) ExecuteTemplate(facts Facts) (*UserData, error) {
+	if !u.template {
+		return u, nil
+	}
+	tmpl, err := template.New("userdata").Option("missingkey=error").Parse(u.data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing userdata template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, facts); err != nil {
+		return nil, fmt.Errorf("executing userdata template: %v", err)
+	}
+	ret := *u
+	ret.data = buf.String()
+	ret.template = false
+	if u.guessed {
+		ret.kind = Unknown(ret.data).kind
+	}
+	return &ret, nil
+}
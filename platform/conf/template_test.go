@@ -0,0 +1,92 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExecuteTemplate(t *testing.T) {
+	facts := Facts{
+		Index: 1,
+		Name:  "kola-1",
+		Peers: []MachineFacts{
+			{ID: "a", PublicIPv4: "192.0.2.1", PrivateIPv4: "10.0.0.1"},
+		},
+		OmahaURL: "http://10.0.0.254:30001/v1/update/",
+		HTTPURL:  "http://10.0.0.254:30001/files/",
+		Platform: "qemu",
+		User:     "core",
+	}
+
+	tests := []struct {
+		name     string
+		userdata *UserData
+		want     string
+		wantKind kind
+		wantErr  string
+	}{
+		{
+			name:     "not a template",
+			userdata: ContainerLinuxConfig(`{{ .Name }}`),
+			want:     `{{ .Name }}`,
+			wantKind: kindContainerLinuxConfig,
+		},
+		{
+			name:     "facts",
+			userdata: Butane(`{{ .Index }} {{ .Name }} {{ (index .Peers 0).PrivateIPv4 }} {{ .OmahaURL }} {{ .HTTPURL }}`).Template(),
+			want:     `1 kola-1 10.0.0.1 http://10.0.0.254:30001/v1/update/ http://10.0.0.254:30001/files/`,
+			wantKind: kindButane,
+		},
+		{
+			name: "peers",
+			userdata: ContainerLinuxConfig(`{{ range .Peers }}{{ .ID }}={{ .PublicIPv4 }}
+{{ end }}`).Template(),
+			want:     "a=192.0.2.1\n",
+			wantKind: kindContainerLinuxConfig,
+		},
+		{
+			// not valid JSON before executing the template
+			name:     "guessed kind",
+			userdata: Unknown(`{"ignition": {"version": "{{ "3.3.0" }}"}}`).Template(),
+			want:     `{"ignition": {"version": "3.3.0"}}`,
+			wantKind: kindIgnition,
+		},
+		{
+			name:     "unknown fact",
+			userdata: Butane(`{{ .Nope }}`).Template(),
+			wantErr:  "executing userdata template",
+		},
+		{
+			name:     "syntax error",
+			userdata: Butane(`{{ .Index `).Template(),
+			wantErr:  "parsing userdata template",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := tt.userdata.ExecuteTemplate(facts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.data != tt.want {
+				t.Errorf("got %q, want %q", u.data, tt.want)
+			}
+			if u.kind != tt.wantKind {
+				t.Errorf("got kind %v, want %v", u.kind, tt.wantKind)
+			}
+			if u.IsTemplate() {
+				t.Errorf("result is still a template")
+			}
+		})
+	}
+}
@@ -0,0 +1,375 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package conf
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	v34types "github.com/coreos/ignition/v2/config/v3_4/types"
+	v23 "github.com/flatcar/ignition/config/v2_3"
+	v23types "github.com/flatcar/ignition/config/v2_3/types"
+	"github.com/vincent-petithory/dataurl"
+)
+
+// sectorsPerMiB converts the 512 byte sectors used by Ignition 2.x
+// partition dimensions to the MiB used by 3.x.
+const sectorsPerMiB = 2048
+
+// TranslateV3 returns a new UserData whose rendered Ignition 2.x config,
+// including the output of a Container Linux Config, is translated to
+// Ignition spec 3.4.0. fsPaths maps the names of the 2.x filesystems
+// files are written to onto their mount path; "root" is implicit.
+// Ignition 3.x configs are left untouched.
+func (u *UserData) TranslateV3(fsPaths map[string]string) *UserData {
+	ret := *u
+	ret.translateV3 = true
+	ret.fsPaths = fsPaths
+	return &ret
+}
+
+// translateV3 replaces the Ignition 2.x config of c by its 3.4.0
+// translation.
+func (c *Conf) translateV3(fsPaths map[string]string) error {
+	switch {
+	case c.ignitionV3 != nil || c.ignitionV31 != nil || c.ignitionV32 != nil || c.ignitionV33 != nil || c.ignitionV34 != nil:
+		return nil
+	case c.ignitionV1 != nil:
+		return fmt.Errorf("translating Ignition config: spec 1 is not supported")
+	case !c.IsIgnition():
+		return fmt.Errorf("translating Ignition config: not an Ignition config")
+	}
+
+	// Older 2.x specs are upgraded to 2.3.0 by its parser.
+	old, _, err := v23.Parse([]byte(c.String()))
+	if err != nil {
+		return fmt.Errorf("translating Ignition config: parsing as spec 2.3.0: %v", err)
+	}
+	cfg, err := TranslateV23ToV34(old, fsPaths)
+	if err != nil {
+		return err
+	}
+
+	*c = Conf{ignitionV34: &cfg, user: c.user}
+	return nil
+}
+
+// TranslateV23ToV34 translates an Ignition 2.3.0 config to spec 3.4.0.
+// fsPaths maps filesystem names to mount paths as for
+// UserData.TranslateV3. All constructs which can't be translated are
+// listed in the returned error.
+func TranslateV23ToV34(old v23types.Config, fsPaths map[string]string) (v34types.Config, error) {
+	t := translator{fsPaths: fsPaths}
+	cfg := v34types.Config{
+		Ignition: t.ignition(old.Ignition),
+		Storage:  t.storage(old.Storage),
+		Systemd:  t.systemd(old.Systemd),
+		Passwd:   t.passwd(old.Passwd),
+	}
+	cfg.Storage.Files = append(cfg.Storage.Files, t.networkd(old.Networkd)...)
+
+	if len(t.problems) > 0 {
+		return v34types.Config{}, fmt.Errorf("can't translate Ignition config to spec 3: %s", strings.Join(t.problems, "; "))
+	}
+	return cfg, nil
+}
+
+type translator struct {
+	fsPaths  map[string]string
+	problems []string
+}
+
+func (t *translator) problem(format string, args ...interface{}) {
+	t.problems = append(t.problems, fmt.Sprintf(format, args...))
+}
+
+func (t *translator) resource(source string, hash *string) v34types.Resource {
+	return v34types.Resource{
+		Source:       &source,
+		Verification: v34types.Verification{Hash: hash},
+	}
+}
+
+func (t *translator) ignition(old v23types.Ignition) v34types.Ignition {
+	ign := v34types.Ignition{
+		Version: "3.4.0",
+		Timeouts: v34types.Timeouts{
+			HTTPResponseHeaders: old.Timeouts.HTTPResponseHeaders,
+			HTTPTotal:           old.Timeouts.HTTPTotal,
+		},
+	}
+	for _, ref := range old.Config.Append {
+		ign.Config.Merge = append(ign.Config.Merge, t.resource(ref.Source, ref.Verification.Hash))
+	}
+	if ref := old.Config.Replace; ref != nil {
+		ign.Config.Replace = t.resource(ref.Source, ref.Verification.Hash)
+	}
+	for _, ca := range old.Security.TLS.CertificateAuthorities {
+		ign.Security.TLS.CertificateAuthorities = append(ign.Security.TLS.CertificateAuthorities, t.resource(ca.Source, ca.Verification.Hash))
+	}
+	return ign
+}
+
+// mib converts a partition dimension, preferring the MiB variant.
+func (t *translator) mib(what string, sectors, mib *int) *int {
+	if mib != nil {
+		return copyInt(mib)
+	}
+	if sectors == nil {
+		return nil
+	}
+	if *sectors%sectorsPerMiB != 0 {
+		t.problem("%s of %d sectors is not a multiple of 1 MiB", what, *sectors)
+		return nil
+	}
+	v := *sectors / sectorsPerMiB
+	return &v
+}
+
+// nodePath maps a path in a named 2.x filesystem to an absolute path.
+func (t *translator) nodePath(filesystem, p string) string {
+	if filesystem == "" || filesystem == "root" {
+		return p
+	}
+	mount, ok := t.fsPaths[filesystem]
+	if !ok {
+		t.problem("%s is in filesystem %q which has no mount path", p, filesystem)
+		return p
+	}
+	return path.Join(mount, p)
+}
+
+func (t *translator) node(old v23types.Node, overwriteDefault bool) v34types.Node {
+	node := v34types.Node{
+		Path:      t.nodePath(old.Filesystem, old.Path),
+		Overwrite: old.Overwrite,
+	}
+	if node.Overwrite == nil && overwriteDefault {
+		node.Overwrite = boolPtr(true)
+	}
+	if old.User != nil {
+		node.User = v34types.NodeUser{ID: old.User.ID, Name: strPtr(old.User.Name)}
+	}
+	if old.Group != nil {
+		node.Group = v34types.NodeGroup{ID: old.Group.ID, Name: strPtr(old.Group.Name)}
+	}
+	return node
+}
+
+func (t *translator) storage(old v23types.Storage) v34types.Storage {
+	var s v34types.Storage
+
+	for _, d := range old.Disks {
+		disk := v34types.Disk{Device: d.Device, WipeTable: boolPtr(d.WipeTable)}
+		for _, p := range d.Partitions {
+			disk.Partitions = append(disk.Partitions, v34types.Partition{
+				GUID:               strPtr(p.GUID),
+				Label:              p.Label,
+				Number:             p.Number,
+				ShouldExist:        p.ShouldExist,
+				SizeMiB:            t.mib(fmt.Sprintf("size of partition %d on %s", p.Number, d.Device), p.Size, p.SizeMiB),
+				StartMiB:           t.mib(fmt.Sprintf("start of partition %d on %s", p.Number, d.Device), p.Start, p.StartMiB),
+				TypeGUID:           strPtr(p.TypeGUID),
+				WipePartitionEntry: boolPtr(p.WipePartitionEntry),
+			})
+		}
+		s.Disks = append(s.Disks, disk)
+	}
+
+	for _, r := range old.Raid {
+		raid := v34types.Raid{Name: r.Name, Level: strPtr(r.Level), Spares: intPtr(r.Spares)}
+		for _, d := range r.Devices {
+			raid.Devices = append(raid.Devices, v34types.Device(d))
+		}
+		for _, o := range r.Options {
+			raid.Options = append(raid.Options, v34types.RaidOption(o))
+		}
+		s.Raid = append(s.Raid, raid)
+	}
+
+	for _, fs := range old.Filesystems {
+		if fs.Path != nil {
+			t.problem("filesystem %q refers to the pre-mounted path %s", fs.Name, *fs.Path)
+			continue
+		}
+		if fs.Mount == nil {
+			continue
+		}
+		m := fs.Mount
+		filesystem := v34types.Filesystem{
+			Device:         m.Device,
+			Format:         strPtr(m.Format),
+			Label:          m.Label,
+			UUID:           m.UUID,
+			WipeFilesystem: boolPtr(m.WipeFilesystem),
+		}
+		if mount, ok := t.fsPaths[fs.Name]; ok {
+			filesystem.Path = &mount
+		}
+		// In spec 2.x mount options are passed to mkfs.
+		for _, o := range m.Options {
+			filesystem.Options = append(filesystem.Options, v34types.FilesystemOption(o))
+		}
+		if m.Create != nil {
+			if m.Create.Force {
+				filesystem.WipeFilesystem = boolPtr(true)
+			}
+			for _, o := range m.Create.Options {
+				filesystem.Options = append(filesystem.Options, v34types.FilesystemOption(o))
+			}
+		}
+		s.Filesystems = append(s.Filesystems, filesystem)
+	}
+
+	for _, f := range old.Files {
+		// Files are overwritten by default in spec 2.x but not in
+		// 3.x, appending requires not overwriting.
+		file := v34types.File{
+			Node:          t.node(f.Node, !f.Append),
+			FileEmbedded1: v34types.FileEmbedded1{Mode: copyInt(f.Mode)},
+		}
+		contents := t.resource(f.Contents.Source, f.Contents.Verification.Hash)
+		contents.Compression = strPtr(f.Contents.Compression)
+		if f.Append {
+			if f.Overwrite != nil && *f.Overwrite {
+				t.problem("%s is both appended to and overwritten", f.Path)
+			}
+			file.Append = []v34types.Resource{contents}
+		} else {
+			if f.Contents.Source == "" {
+				// an overwritten file needs a source
+				empty := "data:,"
+				contents.Source = &empty
+			}
+			file.Contents = contents
+		}
+		s.Files = append(s.Files, file)
+	}
+
+	for _, d := range old.Directories {
+		s.Directories = append(s.Directories, v34types.Directory{
+			Node:               t.node(d.Node, false),
+			DirectoryEmbedded1: v34types.DirectoryEmbedded1{Mode: copyInt(d.Mode)},
+		})
+	}
+
+	for _, l := range old.Links {
+		target := l.Target
+		s.Links = append(s.Links, v34types.Link{
+			Node:          t.node(l.Node, false),
+			LinkEmbedded1: v34types.LinkEmbedded1{Hard: boolPtr(l.Hard), Target: &target},
+		})
+	}
+
+	return s
+}
+
+func (t *translator) systemd(old v23types.Systemd) v34types.Systemd {
+	var s v34types.Systemd
+	for _, u := range old.Units {
+		unit := v34types.Unit{
+			Name:     u.Name,
+			Contents: strPtr(u.Contents),
+			Enabled:  u.Enabled,
+			Mask:     boolPtr(u.Mask),
+		}
+		// The deprecated "enable" was replaced by "enabled".
+		if u.Enable && unit.Enabled == nil {
+			unit.Enabled = boolPtr(true)
+		}
+		for _, d := range u.Dropins {
+			unit.Dropins = append(unit.Dropins, v34types.Dropin{Name: d.Name, Contents: strPtr(d.Contents)})
+		}
+		s.Units = append(s.Units, unit)
+	}
+	return s
+}
+
+// networkd translates networkd units, which spec 3.x dropped, to files.
+func (t *translator) networkd(old v23types.Networkd) []v34types.File {
+	var files []v34types.File
+	add := func(p, contents string) {
+		source := dataurl.EncodeBytes([]byte(contents))
+		files = append(files, v34types.File{
+			Node: v34types.Node{Path: p, Overwrite: boolPtr(true)},
+			FileEmbedded1: v34types.FileEmbedded1{
+				Contents: v34types.Resource{Source: &source},
+				Mode:     intPtr(0644),
+			},
+		})
+	}
+	for _, u := range old.Units {
+		p := path.Join("/etc/systemd/network", u.Name)
+		if u.Contents != "" {
+			add(p, u.Contents)
+		}
+		for _, d := range u.Dropins {
+			add(path.Join(p+".d", d.Name), d.Contents)
+		}
+	}
+	return files
+}
+
+func (t *translator) passwd(old v23types.Passwd) v34types.Passwd {
+	var p v34types.Passwd
+	for _, u := range old.Users {
+		user := v34types.PasswdUser{
+			Name:         u.Name,
+			PasswordHash: u.PasswordHash,
+			UID:          u.UID,
+			Gecos:        strPtr(u.Gecos),
+			HomeDir:      strPtr(u.HomeDir),
+			NoCreateHome: boolPtr(u.NoCreateHome),
+			PrimaryGroup: strPtr(u.PrimaryGroup),
+			NoUserGroup:  boolPtr(u.NoUserGroup),
+			NoLogInit:    boolPtr(u.NoLogInit),
+			Shell:        strPtr(u.Shell),
+			System:       boolPtr(u.System),
+		}
+		for _, k := range u.SSHAuthorizedKeys {
+			user.SSHAuthorizedKeys = append(user.SSHAuthorizedKeys, v34types.SSHAuthorizedKey(k))
+		}
+		for _, g := range u.Groups {
+			user.Groups = append(user.Groups, v34types.Group(g))
+		}
+		// The deprecated "create" section holds the same fields.
+		if c := u.Create; c != nil {
+			if user.UID != nil || user.Gecos != nil || user.HomeDir != nil || user.PrimaryGroup != nil || user.Shell != nil || len(user.Groups) > 0 {
+				t.problem("user %q sets both create and its replacement fields", u.Name)
+			}
+			user.UID = c.UID
+			user.Gecos = strPtr(c.Gecos)
+			user.HomeDir = strPtr(c.HomeDir)
+			user.NoCreateHome = boolPtr(c.NoCreateHome)
+			user.PrimaryGroup = strPtr(c.PrimaryGroup)
+			user.NoUserGroup = boolPtr(c.NoUserGroup)
+			user.NoLogInit = boolPtr(c.NoLogInit)
+			user.Shell = strPtr(c.Shell)
+			user.System = boolPtr(c.System)
+			user.Groups = nil
+			for _, g := range c.Groups {
+				user.Groups = append(user.Groups, v34types.Group(g))
+			}
+		}
+		p.Users = append(p.Users, user)
+	}
+	for _, g := range old.Groups {
+		p.Groups = append(p.Groups, v34types.PasswdGroup{
+			Name:         g.Name,
+			Gid:          g.Gid,
+			PasswordHash: strPtr(g.PasswordHash),
+			System:       boolPtr(g.System),
+		})
+	}
+	return p
+}
+
+func copyInt(i *int) *int {
+	if i == nil {
+		return nil
+	}
+	v := *i
+	return &v
+}
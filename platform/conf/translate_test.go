@@ -0,0 +1,104 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTranslateV3(t *testing.T) {
+	userdata := Ignition(`{
+		"ignition": {"version": "2.2.0"},
+		"storage": {
+			"filesystems": [{"name": "oem", "mount": {"device": "/dev/disk/by-label/OEM", "format": "btrfs", "create": {"force": true}}}],
+			"files": [
+				{"filesystem": "root", "path": "/etc/motd", "mode": 420, "contents": {"source": "data:,hello"}},
+				{"filesystem": "oem", "path": "/grub.cfg", "append": true, "contents": {"source": "data:,set%20x=1"}}
+			],
+			"disks": [{"device": "/dev/vdb", "partitions": [{"number": 1, "size": 204800}]}]
+		},
+		"systemd": {"units": [{"name": "kola.service", "enable": true, "contents": "[Service]\nExecStart=/bin/true"}]},
+		"networkd": {"units": [{"name": "00-eth0.network", "contents": "[Match]\nName=eth0\n"}]}
+	}`).TranslateV3(map[string]string{"oem": "/oem"})
+
+	c, err := userdata.Render("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ignitionV34 == nil {
+		t.Fatalf("config not translated: %s", c.String())
+	}
+	cfg := c.ignitionV34
+
+	files := cfg.Storage.Files
+	if len(files) != 3 {
+		t.Fatalf("unexpected files %+v", files)
+	}
+	if files[0].Path != "/etc/motd" || files[0].Overwrite == nil || !*files[0].Overwrite {
+		t.Errorf("replaced file not overwritten: %+v", files[0].Node)
+	}
+	if files[1].Path != "/oem/grub.cfg" || files[1].Overwrite != nil || len(files[1].Append) != 1 || files[1].Contents.Source != nil {
+		t.Errorf("appended file translated to %+v", files[1])
+	}
+	if files[2].Path != "/etc/systemd/network/00-eth0.network" {
+		t.Errorf("networkd unit translated to %+v", files[2].Node)
+	}
+
+	fs := cfg.Storage.Filesystems
+	if len(fs) != 1 || fs[0].Path == nil || *fs[0].Path != "/oem" || fs[0].WipeFilesystem == nil || !*fs[0].WipeFilesystem {
+		t.Errorf("unexpected filesystems %+v", fs)
+	}
+	if size := cfg.Storage.Disks[0].Partitions[0].SizeMiB; size == nil || *size != 100 {
+		t.Errorf("partition size translated to %v", size)
+	}
+	if units := cfg.Systemd.Units; len(units) != 1 || units[0].Enabled == nil || !*units[0].Enabled {
+		t.Errorf("unit not enabled: %+v", units)
+	}
+	if !c.ValidConfig() {
+		t.Errorf("invalid config %s", c.String())
+	}
+}
+
+func TestTranslateV3Problems(t *testing.T) {
+	userdata := Ignition(`{
+		"ignition": {"version": "2.3.0"},
+		"storage": {
+			"files": [{"filesystem": "data", "path": "/x", "contents": {"source": "data:,"}}],
+			"disks": [{"device": "/dev/vdb", "partitions": [{"number": 1, "size": 1000}]}]
+		}
+	}`).TranslateV3(nil)
+
+	_, err := userdata.Render("")
+	if err == nil {
+		t.Fatal("untranslatable config translated")
+	}
+	for _, want := range []string{`filesystem "data"`, "1000 sectors"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't mention %q", err, want)
+		}
+	}
+}
+
+func TestTranslateV3Passthrough(t *testing.T) {
+	c, err := ContainerLinuxConfig("passwd:\n  users:\n    - name: kola\n").TranslateV3(nil).Render("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ignitionV34 == nil || c.ignitionV34.Passwd.Users[0].Name != "kola" {
+		t.Errorf("CLC not translated: %s", c.String())
+	}
+
+	c, err = Ignition(`{"ignition": {"version": "3.2.0"}}`).TranslateV3(nil).Render("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ignitionV32 == nil {
+		t.Errorf("spec 3 config modified: %s", c.String())
+	}
+
+	if _, err := CloudConfig("#cloud-config").TranslateV3(nil).Render(""); err == nil {
+		t.Error("cloud-config translated")
+	}
+}
@@ -0,0 +1,379 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package conf
+
+import (
+	"bufio"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	butane "github.com/coreos/butane/config"
+	"github.com/coreos/butane/config/common"
+	ign3err "github.com/coreos/ignition/v2/config/shared/errors"
+	v34 "github.com/coreos/ignition/v2/config/v3_4"
+	v34types "github.com/coreos/ignition/v2/config/v3_4/types"
+	vreport "github.com/coreos/vcontext/report"
+	ct "github.com/flatcar/container-linux-config-transpiler/config"
+	cci "github.com/flatcar/coreos-cloudinit/config"
+	ignerr "github.com/flatcar/ignition/config/shared/errors"
+	v23 "github.com/flatcar/ignition/config/v2_3"
+	v23types "github.com/flatcar/ignition/config/v2_3/types"
+	"github.com/flatcar/ignition/config/validate/report"
+)
+
+// Severity is the severity of a ValidationEntry.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityInfo
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// ValidationEntry is a problem found in a config. Line and Column are
+// zero if the position is unknown, e.g. for lints of the rendered config.
+type ValidationEntry struct {
+	Severity Severity
+	Message  string
+	Line     int
+	Column   int
+}
+
+func (e ValidationEntry) String() string {
+	if e.Line != 0 {
+		return fmt.Sprintf("%d:%d: %s: %s", e.Line, e.Column, e.Severity, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Severity, e.Message)
+}
+
+// ValidationReport is the result of UserData.Validate.
+type ValidationReport struct {
+	Entries []ValidationEntry
+}
+
+// IsFatal returns true if the config can't be used.
+func (r ValidationReport) IsFatal() bool {
+	for _, e := range r.Entries {
+		if e.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// HasWarnings returns true if the report has errors or warnings.
+func (r ValidationReport) HasWarnings() bool {
+	for _, e := range r.Entries {
+		if e.Severity <= SeverityWarning {
+			return true
+		}
+	}
+	return false
+}
+
+func (r ValidationReport) String() string {
+	var lines []string
+	for _, e := range r.Entries {
+		lines = append(lines, e.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *ValidationReport) add(s Severity, format string, args ...interface{}) {
+	r.Entries = append(r.Entries, ValidationEntry{Severity: s, Message: fmt.Sprintf(format, args...)})
+}
+
+// addV2 adds the entries of a CLC or Ignition 2.x report.
+func (r *ValidationReport) addV2(rpt report.Report) {
+	for _, e := range rpt.Entries {
+		entry := ValidationEntry{Message: e.Message, Line: e.Line, Column: e.Column}
+		switch e.Kind {
+		case report.EntryError:
+			entry.Severity = SeverityError
+		case report.EntryWarning:
+			entry.Severity = SeverityWarning
+		case report.EntryDeprecated:
+			entry.Severity = SeverityWarning
+			entry.Message = "deprecated: " + entry.Message
+		default:
+			entry.Severity = SeverityInfo
+		}
+		r.Entries = append(r.Entries, entry)
+	}
+}
+
+// addV3 adds the entries of a Butane or Ignition 3.x report.
+func (r *ValidationReport) addV3(rpt vreport.Report) {
+	for _, e := range rpt.Entries {
+		entry := ValidationEntry{Message: e.Message}
+		if e.Context.Len() != 0 {
+			entry.Message = fmt.Sprintf("%s: %s", e.Context.String(), e.Message)
+		}
+		switch e.Kind {
+		case vreport.Error:
+			entry.Severity = SeverityError
+		case vreport.Warn:
+			entry.Severity = SeverityWarning
+		default:
+			entry.Severity = SeverityInfo
+		}
+		if e.Marker.StartP != nil {
+			line, col := e.Marker.Start()
+			entry.Line, entry.Column = int(line), int(col)
+		}
+		r.Entries = append(r.Entries, entry)
+	}
+}
+
+// Validate runs the parsers and validators for the kind of u and the
+// Flatcar specific lints on the resulting Ignition config, without
+// rendering it. Parse and validation entries carry their position in
+// the source.
+func (u *UserData) Validate(ctPlatform string) ValidationReport {
+	var r ValidationReport
+
+	switch u.kind {
+	case kindEmpty, kindScript, kindMultipartMime:
+		// nothing to validate
+	case kindCloudConfig:
+		if _, err := cci.NewCloudConfig(u.data); err != nil {
+			r.add(SeverityError, "parsing cloud-config: %v", err)
+		}
+	case kindIgnition:
+		validateIgnition(&r, []byte(u.data))
+	case kindContainerLinuxConfig:
+		clc, ast, rpt := ct.Parse([]byte(u.data))
+		r.addV2(rpt)
+		if rpt.IsFatal() {
+			break
+		}
+		ignc, rpt := ct.Convert(clc, ctPlatform, ast)
+		r.addV2(rpt)
+		if rpt.IsFatal() {
+			break
+		}
+		lintV2(&r, ignc)
+	case kindButane:
+		ignc, rpt, err := butane.TranslateBytes([]byte(u.data), common.TranslateBytesOptions{})
+		r.addV3(rpt)
+		if err != nil {
+			if !rpt.IsFatal() {
+				r.add(SeverityError, "converting Butane to Ignition: %v", err)
+			}
+			break
+		}
+		validateIgnition(&r, ignc)
+	}
+
+	return r
+}
+
+// validateIgnition validates an Ignition config of any supported spec.
+func validateIgnition(r *ValidationReport, data []byte) {
+	// The 2.3.0 parser upgrades older 2.x configs.
+	cfg2, rpt2, err := v23.Parse(data)
+	if err == nil {
+		r.addV2(rpt2)
+		lintV2(r, cfg2)
+		return
+	} else if err != ignerr.ErrUnknownVersion {
+		r.addV2(rpt2)
+		if !rpt2.IsFatal() {
+			r.add(SeverityError, "parsing Ignition config: %v", err)
+		}
+		return
+	}
+
+	cfg3, rpt3, err := v34.ParseCompatibleVersion(data)
+	r.addV3(rpt3)
+	if err != nil {
+		if err == ign3err.ErrUnknownVersion {
+			r.add(SeverityError, "unsupported Ignition config version")
+		} else if !rpt3.IsFatal() {
+			r.add(SeverityError, "parsing Ignition config: %v", err)
+		}
+		return
+	}
+	lintV3(r, cfg3)
+}
+
+// lintUnit is the part of a systemd unit checked by the lints.
+type lintUnit struct {
+	name     string
+	contents []string // unit and dropin contents
+	enabled  bool
+	mask     bool
+}
+
+// lintConfig is the part of an Ignition config checked by the lints.
+type lintConfig struct {
+	nodes []string // absolute paths of written files and links
+	units []lintUnit
+}
+
+func lintV2(r *ValidationReport, cfg v23types.Config) {
+	var lc lintConfig
+	add := func(n v23types.Node) {
+		// paths in other filesystems are relative to an unknown mount
+		if n.Filesystem == "root" {
+			lc.nodes = append(lc.nodes, n.Path)
+		}
+	}
+	for _, f := range cfg.Storage.Files {
+		add(f.Node)
+	}
+	for _, d := range cfg.Storage.Directories {
+		add(d.Node)
+	}
+	for _, l := range cfg.Storage.Links {
+		add(l.Node)
+	}
+	for _, u := range cfg.Systemd.Units {
+		unit := lintUnit{
+			name:     u.Name,
+			contents: []string{u.Contents},
+			enabled:  u.Enable || (u.Enabled != nil && *u.Enabled),
+			mask:     u.Mask,
+		}
+		for _, d := range u.Dropins {
+			unit.contents = append(unit.contents, d.Contents)
+		}
+		lc.units = append(lc.units, unit)
+	}
+	lc.lint(r)
+}
+
+func lintV3(r *ValidationReport, cfg v34types.Config) {
+	var lc lintConfig
+	for _, f := range cfg.Storage.Files {
+		lc.nodes = append(lc.nodes, f.Path)
+	}
+	for _, d := range cfg.Storage.Directories {
+		lc.nodes = append(lc.nodes, d.Path)
+	}
+	for _, l := range cfg.Storage.Links {
+		lc.nodes = append(lc.nodes, l.Path)
+	}
+	for _, u := range cfg.Systemd.Units {
+		unit := lintUnit{
+			name:    u.Name,
+			enabled: u.Enabled != nil && *u.Enabled,
+			mask:    u.Mask != nil && *u.Mask,
+		}
+		if u.Contents != nil {
+			unit.contents = append(unit.contents, *u.Contents)
+		}
+		for _, d := range u.Dropins {
+			if d.Contents != nil {
+				unit.contents = append(unit.contents, *d.Contents)
+			}
+		}
+		lc.units = append(lc.units, unit)
+	}
+	lc.lint(r)
+}
+
+// osPaths are populated by the OS image, files referenced below them are
+// assumed to exist. Most of /etc is left to the user, only the parts set up
+// by the OS are listed.
+var osPaths = []string{"/usr", "/bin", "/sbin", "/lib", "/lib64", "/etc/os-release", "/etc/machine-id", "/etc/ssl", "/run", "/proc", "/sys", "/dev"}
+
+// execKeys are unit settings whose value starts with a path.
+var execKeys = map[string]bool{
+	"ExecCondition":   true,
+	"ExecStartPre":    true,
+	"ExecStart":       true,
+	"ExecStartPost":   true,
+	"ExecReload":      true,
+	"ExecStop":        true,
+	"ExecStopPost":    true,
+	"EnvironmentFile": true,
+}
+
+func under(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+func (lc *lintConfig) lint(r *ValidationReport) {
+	written := make(map[string]bool)
+	for _, n := range lc.nodes {
+		p := path.Clean(n)
+		written[p] = true
+		// the OEM partition used to be mounted below /usr
+		if under(p, "/usr") && !under(p, "/usr/share/oem") {
+			r.add(SeverityWarning, "%s: /usr is read-only on Flatcar", n)
+		}
+	}
+
+	for _, u := range lc.units {
+		if u.mask {
+			continue
+		}
+		var install bool
+		var missing []string
+		for _, contents := range u.contents {
+			s := bufio.NewScanner(strings.NewReader(contents))
+			for s.Scan() {
+				line := strings.TrimSpace(s.Text())
+				if line == "[Install]" {
+					install = true
+					continue
+				}
+				key, value, ok := strings.Cut(line, "=")
+				if !ok || !execKeys[strings.TrimSpace(key)] {
+					continue
+				}
+				value = strings.TrimSpace(value)
+				if strings.HasPrefix(value, "-") && strings.TrimSpace(key) == "EnvironmentFile" {
+					// optional
+					continue
+				}
+				// strip the special executable prefixes
+				value = strings.TrimLeft(value, "-@+!:")
+				fields := strings.Fields(value)
+				if len(fields) == 0 || !path.IsAbs(fields[0]) {
+					continue
+				}
+				p := path.Clean(fields[0])
+				if written[p] || providedByOS(p) {
+					continue
+				}
+				missing = append(missing, p)
+			}
+		}
+		if install && !u.enabled {
+			r.add(SeverityWarning, "unit %s has an [Install] section but is not enabled", u.name)
+		}
+		sort.Strings(missing)
+		for i, p := range missing {
+			if i > 0 && missing[i-1] == p {
+				continue
+			}
+			r.add(SeverityWarning, "unit %s references %s which is neither written by the config nor part of the OS", u.name, p)
+		}
+	}
+}
+
+func providedByOS(p string) bool {
+	for _, dir := range osPaths {
+		if under(p, dir) {
+			return true
+		}
+	}
+	return false
+}
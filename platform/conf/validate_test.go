@@ -0,0 +1,91 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		userdata *UserData
+		fatal    bool
+		want     []string
+	}{
+		{
+			name:     "valid",
+			userdata: Ignition(`{"ignition": {"version": "3.3.0"}, "systemd": {"units": [{"name": "a.service", "enabled": true, "contents": "[Service]\nExecStart=/usr/bin/true\n[Install]\nWantedBy=multi-user.target"}]}}`),
+		},
+		{
+			name:     "ignition position",
+			userdata: Ignition("{\"ignition\": {\"version\": \"3.3.0\"},\n\"storage\": {\"files\": [{\"path\": \"relative\"}]}}"),
+			fatal:    true,
+			want:     []string{"2:", "path not absolute"},
+		},
+		{
+			name:     "clc warning position",
+			userdata: ContainerLinuxConfig("passwd:\n  users:\n    - name: core\n  bogus: true\n"),
+			want:     []string{"4:3: warning", "bogus"},
+		},
+		{
+			name:     "butane error",
+			userdata: Butane("variant: flatcar\nversion: 1.0.0\nstorage:\n  files:\n    - path: relative\n"),
+			fatal:    true,
+			want:     []string{"5:", "path not absolute"},
+		},
+		{
+			name:     "usr",
+			userdata: Ignition(`{"ignition": {"version": "2.2.0"}, "storage": {"files": [{"filesystem": "root", "path": "/usr/lib/foo", "contents": {"source": "data:,"}}]}}`),
+			want:     []string{"/usr/lib/foo: /usr is read-only"},
+		},
+		{
+			name: "missing file",
+			userdata: Butane(`variant: flatcar
+version: 1.0.0
+storage:
+  files:
+    - path: /opt/bin/present
+systemd:
+  units:
+    - name: a.service
+      contents: |
+        [Service]
+        ExecStartPre=/opt/bin/present
+        ExecStart=-/opt/bin/missing --flag
+        EnvironmentFile=-/opt/optional.env
+`),
+			want: []string{"references /opt/bin/missing"},
+		},
+		{
+			name:     "missing file in etc",
+			userdata: ContainerLinuxConfig("systemd:\n  units:\n    - name: a.service\n      contents: |\n        [Service]\n        EnvironmentFile=/etc/os-release\n        EnvironmentFile=/etc/app.env\n        ExecStart=/usr/bin/true\n"),
+			want:     []string{"references /etc/app.env"},
+		},
+		{
+			name:     "not enabled",
+			userdata: ContainerLinuxConfig("systemd:\n  units:\n    - name: a.service\n      contents: |\n        [Service]\n        ExecStart=/usr/bin/true\n        [Install]\n        WantedBy=multi-user.target\n"),
+			want:     []string{"a.service has an [Install] section but is not enabled"},
+		},
+	}
+
+	for _, tt := range tests {
+		rpt := tt.userdata.Validate("")
+		if rpt.IsFatal() != tt.fatal {
+			t.Errorf("%s: expected fatal %v, got report:\n%s", tt.name, tt.fatal, rpt)
+		}
+		if len(tt.want) == 0 && rpt.HasWarnings() {
+			t.Errorf("%s: unexpected report:\n%s", tt.name, rpt)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(rpt.String(), want) {
+				t.Errorf("%s: %q missing from report:\n%s", tt.name, want, rpt)
+			}
+		}
+		if strings.Contains(rpt.String(), "optional.env") || strings.Contains(rpt.String(), "present") || strings.Contains(rpt.String(), "os-release") {
+			t.Errorf("%s: unexpected report:\n%s", tt.name, rpt)
+		}
+	}
+}
@@ -35,6 +35,7 @@ type Journal struct {
 	journalRaw  io.WriteCloser
 	journalPath string
 	recorder    *journal.Recorder
+	entries     *entryLog
 	cancel      context.CancelFunc
 }
 
@@ -79,10 +80,12 @@ func NewJournal(dir string) (*Journal, error) {
 		Writer:     jrz,
 	}
 
+	entries := newEntryLog(journal.ShortWriter(j))
 	return &Journal{
 		journal:     j,
 		journalRaw:  jrzc,
-		recorder:    journal.NewRecorder(journal.ShortWriter(j), jrzc),
+		recorder:    journal.NewRecorder(entries, jrzc),
+		entries:     entries,
 		journalPath: p,
 	}, nil
 }
@@ -0,0 +1,230 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package platform
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/flatcar/mantle/network/journal"
+)
+
+// JournalMachine is implemented by machines which record their journal.
+type JournalMachine interface {
+	Machine
+
+	// Journal returns the recorder of the machine's journal.
+	Journal() *Journal
+}
+
+// entryFields are the fields kept in memory for waiting on entries.
+var entryFields = []string{
+	journal.FIELD_MESSAGE,
+	journal.FIELD_MESSAGE_ID,
+	journal.FIELD_PRIORITY,
+	journal.FIELD_SYSLOG_IDENTIFIER,
+	journal.FIELD_SYSTEMD_UNIT,
+	journal.FIELD_BOOT_ID,
+	journal.FIELD_REALTIME_TIMESTAMP,
+	journal.FIELD_SOURCE_REALTIME_TIMESTAMP,
+	fieldUnit,
+	fieldJobResult,
+}
+
+// Fields systemd adds to messages about units.
+const (
+	fieldUnit      = "UNIT"
+	fieldJobResult = "JOB_RESULT"
+)
+
+// entryLog passes entries on to a Formatter and keeps them for waiters.
+type entryLog struct {
+	journal.Formatter
+
+	mu      sync.Mutex
+	entries []journal.Entry
+	changed chan struct{} // closed and replaced when entries are added
+}
+
+func newEntryLog(f journal.Formatter) *entryLog {
+	return &entryLog{
+		Formatter: f,
+		changed:   make(chan struct{}),
+	}
+}
+
+func (l *entryLog) WriteEntry(entry journal.Entry) error {
+	kept := make(journal.Entry)
+	for _, field := range entryFields {
+		if v, ok := entry[field]; ok {
+			kept[field] = v
+		}
+	}
+
+	l.mu.Lock()
+	l.entries = append(l.entries, kept)
+	close(l.changed)
+	l.changed = make(chan struct{})
+	l.mu.Unlock()
+
+	return l.Formatter.WriteEntry(entry)
+}
+
+// since returns the entries starting at index i and a channel which is
+// closed once more are added.
+func (l *entryLog) since(i int) ([]journal.Entry, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.entries[i:], l.changed
+}
+
+// JournalMatch selects journal entries. Unset fields match any entry.
+type JournalMatch struct {
+	Message *regexp.Regexp
+	Unit    string // _SYSTEMD_UNIT of the process which logged the entry
+	// MaxPriority matches entries at least as important, from 0
+	// (emerg) to 7 (debug).
+	MaxPriority *int
+	BootID      string
+}
+
+func (jm JournalMatch) matches(entry journal.Entry) bool {
+	if jm.Message != nil && !jm.Message.Match(entry[journal.FIELD_MESSAGE]) {
+		return false
+	}
+	if jm.Unit != "" && string(entry[journal.FIELD_SYSTEMD_UNIT]) != jm.Unit {
+		return false
+	}
+	if jm.MaxPriority != nil {
+		priority, err := strconv.Atoi(string(entry[journal.FIELD_PRIORITY]))
+		if err != nil || priority > *jm.MaxPriority {
+			return false
+		}
+	}
+	if jm.BootID != "" && string(entry[journal.FIELD_BOOT_ID]) != jm.BootID {
+		return false
+	}
+	return true
+}
+
+func (jm JournalMatch) String() string {
+	s := "entry"
+	if jm.Message != nil {
+		s += fmt.Sprintf(" matching %q", jm.Message)
+	}
+	if jm.Unit != "" {
+		s += " from " + jm.Unit
+	}
+	if jm.MaxPriority != nil {
+		s += fmt.Sprintf(" with priority <= %d", *jm.MaxPriority)
+	}
+	if jm.BootID != "" {
+		s += " in boot " + jm.BootID
+	}
+	return s
+}
+
+// WaitForEntry waits until the journal has an entry matching match,
+// including entries recorded before the call, and returns it.
+func (j *Journal) WaitForEntry(ctx context.Context, match JournalMatch) (journal.Entry, error) {
+	var last journal.Entry
+	next := 0
+	for {
+		entries, changed := j.entries.since(next)
+		for _, entry := range entries {
+			if match.matches(entry) {
+				return entry, nil
+			}
+		}
+		next += len(entries)
+		if len(entries) != 0 {
+			last = entries[len(entries)-1]
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			if last == nil {
+				return nil, fmt.Errorf("no journal %s: journal is empty", match)
+			}
+			return nil, fmt.Errorf("no journal %s: last entry %q", match, last[journal.FIELD_MESSAGE])
+		}
+	}
+}
+
+// Message IDs of systemd's messages about units, see
+// systemd/catalog/systemd.catalog.in.
+const (
+	msgUnitStarting = "7d4958e842da4a758f6c1cdc7b36dcc5"
+	msgUnitStarted  = "39f53479d3a045ac8e11786248231fbf"
+	msgUnitReloaded = "7b05ebc668384222baa8881179cfda54"
+	msgUnitStopping = "de5b426a63be47a7b6ac3eaac82e2f6f"
+	msgUnitStopped  = "9d1aaa27d60140bd96365438aad20286"
+	msgUnitFailed   = "be02cf6855d2428ba40df7e9d022f03d"
+	msgUnitSuccess  = "7ad2d189f7e94e70a38c781354912448"
+	msgUnitResult   = "d9b373ed55a64feb8242e02dbe79a49c"
+)
+
+// unitState returns the ActiveState of a unit implied by a message of
+// systemd about it, or "" if it doesn't imply one.
+func unitState(entry journal.Entry) string {
+	failed := string(entry[fieldJobResult]) == "failed"
+	switch string(entry[journal.FIELD_MESSAGE_ID]) {
+	case msgUnitStarting:
+		return "activating"
+	case msgUnitStarted, msgUnitReloaded:
+		if failed {
+			return "failed"
+		}
+		return "active"
+	case msgUnitStopping:
+		return "deactivating"
+	case msgUnitStopped, msgUnitSuccess:
+		return "inactive"
+	case msgUnitFailed, msgUnitResult:
+		return "failed"
+	}
+	return ""
+}
+
+// WaitForUnitState waits until systemd reports in the journal that unit
+// entered state, an ActiveState such as "active", "inactive" or "failed".
+// Only the last boot recorded is considered, and a state entered before
+// the call only counts if systemd didn't report a different one since.
+// The returned string is the last state reported, or "" if there was none.
+func (j *Journal) WaitForUnitState(ctx context.Context, unit, state string) (string, error) {
+	var bootID, last string
+	next := 0
+	for {
+		entries, changed := j.entries.since(next)
+		for _, entry := range entries {
+			if id := string(entry[journal.FIELD_BOOT_ID]); id != "" && id != bootID {
+				bootID = id
+				last = ""
+			}
+			if string(entry[fieldUnit]) != unit {
+				continue
+			}
+			if s := unitState(entry); s != "" {
+				last = s
+			}
+		}
+		next += len(entries)
+		if last == state {
+			return last, nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			if last == "" {
+				return "", fmt.Errorf("unit %s not %s: systemd reported no state", unit, state)
+			}
+			return last, fmt.Errorf("unit %s not %s: last state %s", unit, state, last)
+		}
+	}
+}
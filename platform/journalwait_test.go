@@ -0,0 +1,100 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package platform
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flatcar/mantle/network/journal"
+)
+
+func newTestJournal() *Journal {
+	return &Journal{entries: newEntryLog(journal.ShortWriter(io.Discard))}
+}
+
+func entry(fields ...string) journal.Entry {
+	e := journal.Entry{journal.FIELD_REALTIME_TIMESTAMP: []byte("1500000000000000")}
+	for i := 0; i < len(fields); i += 2 {
+		e[fields[i]] = []byte(fields[i+1])
+	}
+	return e
+}
+
+func TestWaitForEntry(t *testing.T) {
+	j := newTestJournal()
+	j.entries.WriteEntry(entry(journal.FIELD_MESSAGE, "early", journal.FIELD_PRIORITY, "6"))
+
+	// entries logged before waiting count
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := j.WaitForEntry(ctx, JournalMatch{Message: regexp.MustCompile("^early$")}); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		j.entries.WriteEntry(entry(journal.FIELD_MESSAGE, "oops", journal.FIELD_PRIORITY, "6", journal.FIELD_SYSTEMD_UNIT, "a.service"))
+		j.entries.WriteEntry(entry(journal.FIELD_MESSAGE, "oops", journal.FIELD_PRIORITY, "3", journal.FIELD_SYSTEMD_UNIT, "a.service"))
+	}()
+	prio := 3
+	e, err := j.WaitForEntry(ctx, JournalMatch{
+		Message:     regexp.MustCompile("oops"),
+		Unit:        "a.service",
+		MaxPriority: &prio,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(e[journal.FIELD_PRIORITY]) != "3" {
+		t.Errorf("got entry %v", e)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = j.WaitForEntry(ctx, JournalMatch{BootID: "other"})
+	if err == nil || !strings.Contains(err.Error(), `last entry "oops"`) {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestWaitForUnitState(t *testing.T) {
+	j := newTestJournal()
+	unit := func(id, unit, msgID, result string) journal.Entry {
+		return entry(journal.FIELD_BOOT_ID, id, fieldUnit, unit, journal.FIELD_MESSAGE_ID, msgID, fieldJobResult, result)
+	}
+	j.entries.WriteEntry(unit("1", "a.service", msgUnitStarted, "done"))
+	j.entries.WriteEntry(unit("1", "b.service", msgUnitStarted, "failed"))
+
+	wait := func(name, state string) (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		return j.WaitForUnitState(ctx, name, state)
+	}
+
+	if _, err := wait("a.service", "active"); err != nil {
+		t.Error(err)
+	}
+	if last, err := wait("b.service", "active"); err == nil || last != "failed" {
+		t.Errorf("got %q, %v", last, err)
+	}
+
+	// states of previous boots don't count
+	j.entries.WriteEntry(unit("2", "c.service", msgUnitStarting, ""))
+	if last, err := wait("a.service", "active"); err == nil || last != "" {
+		t.Errorf("got %q, %v after reboot", last, err)
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		j.entries.WriteEntry(unit("2", "c.service", msgUnitStopped, "done"))
+	}()
+	if _, err := wait("c.service", "inactive"); err != nil {
+		t.Error(err)
+	}
+}
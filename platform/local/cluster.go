@@ -28,6 +28,7 @@ import (
 
 	"github.com/flatcar/mantle/lang/destructor"
 	"github.com/flatcar/mantle/network"
+	"github.com/flatcar/mantle/network/omaha"
 	"github.com/flatcar/mantle/platform"
 	"github.com/flatcar/mantle/system/exec"
 	"github.com/flatcar/mantle/system/ns"
@@ -37,7 +38,10 @@ type LocalCluster struct {
 	destructor.MultiDestructor
 	*platform.BaseCluster
 	flight      *LocalFlight
-	OmahaServer OmahaWrapper
+	OmahaServer *omaha.Server
+	// HTTPDir is served to the machines by the Omaha server under
+	// the HTTP endpoint.
+	HTTPDir string
 }
 
 func (lc *LocalCluster) NewCommand(dir string, name string, arg ...string) exec.Cmd {
@@ -93,6 +97,11 @@ func (lc *LocalCluster) GetOmahaHostPort() (string, error) {
 	return net.JoinHostPort(lc.hostIP(), port), nil
 }
 
+// GetOmahaServer returns the cluster's Omaha server.
+func (lc *LocalCluster) GetOmahaServer() *omaha.Server {
+	return lc.OmahaServer
+}
+
 func (lc *LocalCluster) NewListenerInsideClusterNS() (*net.Listener, error) {
 	nsExit, err := ns.Enter(lc.flight.nshandle)
 	if err != nil {
@@ -108,13 +117,39 @@ func (lc *LocalCluster) NewListenerInsideClusterNS() (*net.Listener, error) {
 }
 
 func (lc *LocalCluster) NewTap(bridge string) (*TunTap, error) {
+	return lc.newTap(bridge, AddLinkTap)
+}
+
+// NewPersistentTap creates a tap device attached to bridge for programs
+// that open the device by name instead of inheriting a file descriptor.
+// The device exists until DelTap is called.
+func (lc *LocalCluster) NewPersistentTap(bridge string) (*TunTap, error) {
+	return lc.newTap(bridge, AddLinkPersistentTap)
+}
+
+// DelTap removes a tap device from the cluster namespace.
+func (lc *LocalCluster) DelTap(name string) error {
+	nsExit, err := ns.Enter(lc.flight.nshandle)
+	if err != nil {
+		return err
+	}
+	defer nsExit()
+
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	return netlink.LinkDel(link)
+}
+
+func (lc *LocalCluster) newTap(bridge string, add func(string) (*TunTap, error)) (*TunTap, error) {
 	nsExit, err := ns.Enter(lc.flight.nshandle)
 	if err != nil {
 		return nil, err
 	}
 	defer nsExit()
 
-	tap, err := AddLinkTap("")
+	tap, err := add("")
 	if err != nil {
 		return nil, fmt.Errorf("tap failed: %v", err)
 	}
@@ -17,20 +17,26 @@ package local
 
 import (
 	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
 	"sync/atomic"
 
-	"github.com/coreos/go-omaha/omaha"
 	"github.com/vishvananda/netns"
 
 	"github.com/flatcar/mantle/lang/destructor"
 	"github.com/flatcar/mantle/network"
 	"github.com/flatcar/mantle/network/ntp"
+	"github.com/flatcar/mantle/network/omaha"
 	"github.com/flatcar/mantle/platform"
 	"github.com/flatcar/mantle/system/ns"
 )
 
 const (
 	listenPortBase = 30000
+
+	// httpPrefix is where the Omaha server serves LocalCluster.HTTPDir.
+	httpPrefix = "/files/"
 )
 
 type LocalFlight struct {
@@ -118,15 +124,32 @@ func (lf *LocalFlight) NewCluster(rconf *platform.RuntimeConfig) (*LocalCluster,
 	}
 	defer nsExit()
 
-	omahaServer, err := omaha.NewTrivialServer(fmt.Sprintf(":%d", lf.newListenPort()))
+	lc.OmahaServer, err = omaha.NewServer(fmt.Sprintf(":%d", lf.newListenPort()))
 	if err != nil {
 		lc.Destroy()
 		return nil, err
 	}
-	lc.OmahaServer = OmahaWrapper{TrivialServer: omahaServer}
 	lc.AddDestructor(lc.OmahaServer)
 	go lc.OmahaServer.Serve()
 
+	omahaHostPort, err := lc.GetOmahaHostPort()
+	if err != nil {
+		lc.Destroy()
+		return nil, err
+	}
+	lc.HTTPDir = filepath.Join(rconf.OutputDir, "http")
+	if err := os.MkdirAll(lc.HTTPDir, 0755); err != nil {
+		lc.Destroy()
+		return nil, err
+	}
+	lc.OmahaServer.Mux.Handle(httpPrefix, http.StripPrefix(httpPrefix, http.FileServer(http.Dir(lc.HTTPDir))))
+
+	lc.SetEndpoints(platform.Endpoints{
+		Omaha: fmt.Sprintf("http://%s/v1/update/", omahaHostPort),
+		Etcd:  lc.etcdEndpoint(),
+		HTTP:  fmt.Sprintf("http://%s%s", omahaHostPort, httpPrefix),
+	})
+
 	// does not lf.AddCluster() since we are not the top-level object
 
 	return lc, nil
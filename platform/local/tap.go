@@ -88,6 +88,21 @@ func newTunTap(name string, flags uint16) (*TunTap, error) {
 	return &tt, nil
 }
 
+// AddLinkPersistentTap creates a tap device that outlives the returned
+// file, so that a program can attach to it by name. It must be removed
+// with netlink.LinkDel.
+func AddLinkPersistentTap(name string) (*TunTap, error) {
+	tt, err := newTunTap(name, syscall.IFF_TAP)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioctl(tt.Fd(), syscall.TUNSETPERSIST, 1); err != nil {
+		tt.Close()
+		return nil, err
+	}
+	return tt, nil
+}
+
 func AddLinkTap(name string) (*TunTap, error) {
 	return newTunTap(name, syscall.IFF_TAP)
 }
@@ -0,0 +1,64 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package akamai
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/flatcar/mantle/platform/api/akamai"
+	"github.com/flatcar/mantle/platform/api/akamai/akamaitest"
+	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/platformtest"
+)
+
+func TestMachineLifecycle(t *testing.T) {
+	srv := akamaitest.NewServer()
+	defer srv.Close()
+	image := srv.AddImage("flatcar", time.Now(), nil)
+
+	dialer := platformtest.NewDialer()
+	flight, err := newFlight(&akamai.Options{
+		Options:  platformtest.Options(),
+		Token:    "token",
+		Image:    image,
+		Region:   akamaitest.Region,
+		Type:     akamaitest.Type,
+		Endpoint: srv.URL,
+	}, dialer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cluster, err := flight.NewCluster(platformtest.RuntimeConfig(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := cluster.NewMachine(conf.Ignition(`{"ignition": {"version": "2.0.0"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances := srv.Instances()
+	if len(instances) != 1 || strconv.Itoa(instances[0].ID) != m.ID() {
+		t.Fatalf("unexpected instances %+v", instances)
+	}
+	if m.IP() != instances[0].IPv4[0].String() {
+		t.Errorf("unexpected machine address %q", m.IP())
+	}
+	if srv.UserData(instances[0].ID) == "" {
+		t.Errorf("machine created without user data")
+	}
+	for _, addr := range dialer.Addrs() {
+		if addr != m.IP()+":22" {
+			t.Errorf("unexpected SSH connection to %q", addr)
+		}
+	}
+
+	flight.Destroy()
+	if len(srv.Instances()) != 0 {
+		t.Errorf("instances left after destroying the flight: %+v", srv.Instances())
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/flatcar/mantle/platform/api/aws"
+	"github.com/flatcar/mantle/platform/api/aws/awstest"
+	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/platformtest"
+)
+
+func TestMachineLifecycle(t *testing.T) {
+	srv := awstest.NewServer()
+	defer srv.Close()
+	ami := srv.AddImage("flatcar")
+
+	dialer := platformtest.NewDialer()
+	flight, err := newFlight(&aws.Options{
+		Options:            platformtest.Options(),
+		Region:             awstest.Region,
+		AccessKeyID:        awstest.AccessKeyID,
+		SecretKey:          awstest.SecretKey,
+		AMI:                ami,
+		InstanceType:       awstest.InstanceType,
+		SecurityGroup:      "mantle",
+		IAMInstanceProfile: "mantle",
+		Endpoint:           srv.URL,
+	}, dialer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kps := srv.KeyPairs(); len(kps) != 1 || *kps[0].KeyName != flight.Name() {
+		t.Errorf("unexpected key pairs %+v", kps)
+	}
+
+	cluster, err := flight.NewCluster(platformtest.RuntimeConfig(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := cluster.NewMachine(conf.Ignition(`{"ignition": {"version": "2.0.0"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	insts := srv.Instances()
+	if len(insts) != 1 {
+		t.Fatalf("unexpected instances %+v", insts)
+	}
+	if m.IP() != *insts[0].PublicIpAddress || m.PrivateIP() != *insts[0].PrivateIpAddress {
+		t.Errorf("unexpected machine addresses %q %q", m.IP(), m.PrivateIP())
+	}
+	if srv.UserData(m.ID()) == "" {
+		t.Errorf("machine created without user data")
+	}
+	for _, addr := range dialer.Addrs() {
+		if addr != m.IP()+":22" {
+			t.Errorf("unexpected SSH connection to %q", addr)
+		}
+	}
+
+	flight.Destroy()
+	if insts := srv.Instances(); *insts[0].State.Name != ec2.InstanceStateNameTerminated {
+		t.Errorf("instance left in state %s after destroying the flight", *insts[0].State.Name)
+	}
+	if m.ConsoleOutput() == "" {
+		t.Errorf("console not saved")
+	}
+	if kps := srv.KeyPairs(); len(kps) != 0 {
+		t.Errorf("key pairs left after destroying the flight: %+v", kps)
+	}
+}
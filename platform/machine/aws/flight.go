@@ -19,6 +19,7 @@ import (
 	"github.com/coreos/pkg/capnslog"
 	ctplatform "github.com/flatcar/container-linux-config-transpiler/config/platform"
 
+	"github.com/flatcar/mantle/network"
 	"github.com/flatcar/mantle/platform"
 	"github.com/flatcar/mantle/platform/api/aws"
 )
@@ -44,12 +45,17 @@ type flight struct {
 // $AWS_ACCESS_KEY_ID, and $AWS_SECRET_ACCESS_KEY to determine the region to
 // spawn instances in and the credentials to use to authenticate.
 func NewFlight(opts *aws.Options) (platform.Flight, error) {
+	return newFlight(opts, network.NewRetryDialer())
+}
+
+// newFlight creates a flight connecting to machines through dialer.
+func newFlight(opts *aws.Options, dialer network.Dialer) (platform.Flight, error) {
 	api, err := aws.New(opts)
 	if err != nil {
 		return nil, err
 	}
 
-	bf, err := platform.NewBaseFlight(opts.Options, Platform, ctplatform.EC2)
+	bf, err := platform.NewBaseFlightWithDialer(opts.Options, Platform, ctplatform.EC2, dialer)
 	if err != nil {
 		return nil, err
 	}
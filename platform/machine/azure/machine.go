@@ -141,6 +141,11 @@ func (am *machine) JournalOutput() string {
 	return string(data)
 }
 
+// Journal returns the recorder of the machine's journal.
+func (am *machine) Journal() *platform.Journal {
+	return am.journal
+}
+
 func (am *machine) Board() string {
 	return am.cluster.flight.Options().Board
 }
@@ -0,0 +1,62 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package do
+
+import (
+	"testing"
+
+	"github.com/flatcar/mantle/platform/api/do"
+	"github.com/flatcar/mantle/platform/api/do/dotest"
+	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/platformtest"
+)
+
+func TestMachineLifecycle(t *testing.T) {
+	srv := dotest.NewServer()
+	defer srv.Close()
+	image := srv.AddImage("flatcar", "nyc3")
+
+	dialer := platformtest.NewDialer()
+	flight, err := newFlight(&do.Options{
+		Options:     platformtest.Options(),
+		AccessToken: "token",
+		Region:      "nyc3",
+		Size:        "s-1vcpu-1gb",
+		Image:       "flatcar",
+		Endpoint:    srv.URL,
+	}, dialer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := srv.Keys(); len(keys) != 2 {
+		t.Errorf("expected the flight and fake SSH keys, got %+v", keys)
+	}
+
+	cluster, err := flight.NewCluster(platformtest.RuntimeConfig(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := cluster.NewMachine(conf.Ignition(`{"ignition": {"version": "2.0.0"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	droplets := srv.Droplets()
+	if len(droplets) != 1 || droplets[0].Image == nil || droplets[0].Image.ID != image {
+		t.Fatalf("unexpected droplets %+v", droplets)
+	}
+	if ip, _ := droplets[0].PublicIPv4(); m.IP() != ip || m.PrivateIP() == "" {
+		t.Errorf("unexpected machine addresses %q %q", m.IP(), m.PrivateIP())
+	}
+	for _, addr := range dialer.Addrs() {
+		if addr != m.IP()+":22" {
+			t.Errorf("unexpected SSH connection to %q", addr)
+		}
+	}
+
+	flight.Destroy()
+	if len(srv.Droplets()) != 0 || len(srv.Keys()) != 0 {
+		t.Errorf("resources left after destroying the flight: %+v %+v", srv.Droplets(), srv.Keys())
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/coreos/pkg/capnslog"
 
 	ctplatform "github.com/flatcar/container-linux-config-transpiler/config/platform"
+	"github.com/flatcar/mantle/network"
 	"github.com/flatcar/mantle/platform"
 	"github.com/flatcar/mantle/platform/api/do"
 )
@@ -41,12 +42,17 @@ type flight struct {
 }
 
 func NewFlight(opts *do.Options) (platform.Flight, error) {
+	return newFlight(opts, network.NewRetryDialer())
+}
+
+// newFlight creates a flight connecting to machines through dialer.
+func newFlight(opts *do.Options, dialer network.Dialer) (platform.Flight, error) {
 	api, err := do.New(opts)
 	if err != nil {
 		return nil, err
 	}
 
-	bf, err := platform.NewBaseFlight(opts.Options, Platform, ctplatform.DO)
+	bf, err := platform.NewBaseFlightWithDialer(opts.Options, Platform, ctplatform.DO, dialer)
 	if err != nil {
 		return nil, err
 	}
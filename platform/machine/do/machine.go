@@ -93,6 +93,11 @@ func (dm *machine) JournalOutput() string {
 	return string(data)
 }
 
+// Journal returns the recorder of the machine's journal.
+func (dm *machine) Journal() *platform.Journal {
+	return dm.journal
+}
+
 func (dm *machine) Board() string {
 	return dm.cluster.flight.Options().Board
 }
@@ -128,6 +128,11 @@ func (em *machine) JournalOutput() string {
 	return string(data)
 }
 
+// Journal returns the recorder of the machine's journal.
+func (em *machine) Journal() *platform.Journal {
+	return em.journal
+}
+
 func (em *machine) Board() string {
 	return em.cluster.flight.Options().Board
 }
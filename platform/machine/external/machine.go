@@ -105,6 +105,11 @@ func (pm *machine) JournalOutput() string {
 	return string(data)
 }
 
+// Journal returns the recorder of the machine's journal.
+func (pm *machine) Journal() *platform.Journal {
+	return pm.journal
+}
+
 func (pm *machine) Board() string {
 	return pm.cluster.flight.Options().Board
 }
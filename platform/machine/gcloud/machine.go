@@ -115,6 +115,11 @@ func (gm *machine) JournalOutput() string {
 	return string(data)
 }
 
+// Journal returns the recorder of the machine's journal.
+func (gm *machine) Journal() *platform.Journal {
+	return gm.journal
+}
+
 func (gm *machine) Board() string {
 	return gm.gc.flight.Options().Board
 }
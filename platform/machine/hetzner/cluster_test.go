@@ -0,0 +1,65 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package hetzner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flatcar/mantle/platform/api/hetzner"
+	"github.com/flatcar/mantle/platform/api/hetzner/hetznertest"
+	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/platformtest"
+)
+
+func TestMachineLifecycle(t *testing.T) {
+	srv := hetznertest.NewServer()
+	defer srv.Close()
+	image := srv.AddImage("flatcar", "x86", time.Now(), nil)
+
+	dialer := platformtest.NewDialer()
+	flight, err := newFlight(&hetzner.Options{
+		Options:    platformtest.Options(),
+		Image:      "flatcar",
+		ServerType: hetznertest.ServerType,
+		Location:   hetznertest.Location,
+		Endpoint:   srv.URL,
+	}, dialer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := srv.SSHKeys(); len(keys) != 1 {
+		t.Errorf("expected the flight SSH key, got %+v", keys)
+	}
+
+	cluster, err := flight.NewCluster(platformtest.RuntimeConfig(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if networks := srv.Networks(); len(networks) != 1 {
+		t.Errorf("expected the cluster network, got %+v", networks)
+	}
+
+	m, err := cluster.NewMachine(conf.Ignition(`{"ignition": {"version": "2.0.0"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers := srv.Servers()
+	if len(servers) != 1 || servers[0].Image.ID != image {
+		t.Fatalf("unexpected servers %+v", servers)
+	}
+	if m.IP() != servers[0].PublicNet.IPv4.IP || m.PrivateIP() == "" {
+		t.Errorf("unexpected machine addresses %q %q", m.IP(), m.PrivateIP())
+	}
+	for _, addr := range dialer.Addrs() {
+		if addr != m.IP()+":22" {
+			t.Errorf("unexpected SSH connection to %q", addr)
+		}
+	}
+
+	flight.Destroy()
+	if len(srv.Servers()) != 0 || len(srv.Networks()) != 0 || len(srv.SSHKeys()) != 0 {
+		t.Errorf("resources left after destroying the flight: %+v %+v %+v", srv.Servers(), srv.Networks(), srv.SSHKeys())
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/coreos/pkg/capnslog"
 	ctplatform "github.com/flatcar/container-linux-config-transpiler/config/platform"
 
+	"github.com/flatcar/mantle/network"
 	"github.com/flatcar/mantle/platform"
 	"github.com/flatcar/mantle/platform/api/hetzner"
 )
@@ -30,13 +31,18 @@ type flight struct {
 }
 
 func NewFlight(opts *hetzner.Options) (platform.Flight, error) {
+	return newFlight(opts, network.NewRetryDialer())
+}
+
+// newFlight creates a flight connecting to machines through dialer.
+func newFlight(opts *hetzner.Options, dialer network.Dialer) (platform.Flight, error) {
 	api, err := hetzner.New(opts)
 	if err != nil {
 		return nil, fmt.Errorf("creating hetzner API client: %w", err)
 	}
 
 	// TODO: Rework the Base Flight to remove the CT dependency.
-	base, err := platform.NewBaseFlight(opts.Options, Platform, ctplatform.Custom)
+	base, err := platform.NewBaseFlightWithDialer(opts.Options, Platform, ctplatform.Custom, dialer)
 	if err != nil {
 		return nil, fmt.Errorf("creating base flight: %w", err)
 	}
@@ -0,0 +1,150 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package libvirt
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/libvirt"
+	"github.com/flatcar/mantle/platform/conf"
+)
+
+type cluster struct {
+	*platform.BaseCluster
+	flight *flight
+
+	network    string
+	ownNetwork bool
+}
+
+func (lc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
+	conf, err := lc.RenderUserData(userdata, map[string]string{
+		"$public_ipv4":  "${COREOS_CUSTOM_PUBLIC_IPV4}",
+		"$private_ipv4": "${COREOS_CUSTOM_PRIVATE_IPV4}",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !conf.IsIgnition() {
+		return nil, fmt.Errorf("libvirt platform only supports Ignition configs")
+	}
+
+	// The address is only known after DHCP, so let the machine
+	// provide the metadata itself.
+	conf.AddSystemdUnit("coreos-metadata.service", `[Unit]
+Description=libvirt metadata agent
+After=nss-lookup.target
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=oneshot
+Environment=OUTPUT=/run/metadata/flatcar
+ExecStart=/usr/bin/mkdir --parent /run/metadata
+ExecStart=/usr/bin/bash -c 'ip=$(ip -4 -o route get 1 | sed -n "s/.* src \([^ ]*\).*/\1/p"); echo -e "COREOS_CUSTOM_PRIVATE_IPV4=$ip\nCOREOS_CUSTOM_PUBLIC_IPV4=$ip" > $${OUTPUT}'
+ExecStartPost=/usr/bin/ln -fs /run/metadata/flatcar /run/metadata/coreos
+`, false)
+
+	name := lc.vmname()
+	mach := &machine{
+		cluster:       lc,
+		name:          name,
+		mac:           libvirt.RandomMAC(),
+		disk:          name + ".qcow2",
+		ignition:      name + "-ignition.json",
+		consoleVolume: name + "-console.log",
+	}
+
+	// machine to destroy
+	m := mach
+	defer func() {
+		if m != nil {
+			m.Destroy()
+		}
+	}()
+
+	mach.dir = filepath.Join(lc.RuntimeConf().OutputDir, mach.ID())
+	if err := os.Mkdir(mach.dir, 0777); err != nil {
+		return nil, err
+	}
+
+	confPath := filepath.Join(mach.dir, "ignition.json")
+	if err := conf.WriteFile(confPath); err != nil {
+		return nil, err
+	}
+
+	api := lc.flight.api
+	if err := api.UploadData(mach.ignition, []byte(conf.String())); err != nil {
+		return nil, fmt.Errorf("uploading Ignition config: %w", err)
+	}
+	mach.volumes = append(mach.volumes, mach.ignition)
+	if err := api.UploadData(mach.consoleVolume, nil); err != nil {
+		return nil, fmt.Errorf("creating console volume: %w", err)
+	}
+	mach.volumes = append(mach.volumes, mach.consoleVolume)
+	if err := api.CreateOverlay(mach.disk, lc.flight.opts.Image); err != nil {
+		return nil, fmt.Errorf("creating disk: %w", err)
+	}
+	mach.volumes = append(mach.volumes, mach.disk)
+
+	meta := libvirt.Metadata{
+		Created: time.Now(),
+		Volumes: mach.volumes,
+	}
+	if lc.ownNetwork {
+		meta.Network = lc.network
+	}
+	err = api.CreateDomain(libvirt.DomainSpec{
+		Name:     name,
+		Board:    lc.flight.opts.Board,
+		Disk:     mach.disk,
+		Ignition: mach.ignition,
+		Console:  mach.consoleVolume,
+		Network:  lc.network,
+		MAC:      mach.mac,
+	}, meta)
+	if err != nil {
+		return nil, fmt.Errorf("creating domain: %w", err)
+	}
+	mach.defined = true
+
+	if mach.ip, err = api.WaitForIP(name, mach.mac, 5*time.Minute); err != nil {
+		return nil, err
+	}
+
+	if mach.journal, err = platform.NewJournal(mach.dir); err != nil {
+		return nil, err
+	}
+
+	if err := platform.StartMachine(mach, mach.journal); err != nil {
+		return nil, err
+	}
+
+	m = nil
+	lc.AddMach(mach)
+
+	return mach, nil
+}
+
+func (lc *cluster) vmname() string {
+	b := make([]byte, 5)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%x", lc.Name()[0:13], b)
+}
+
+func (lc *cluster) Destroy() {
+	lc.BaseCluster.Destroy()
+	if lc.ownNetwork {
+		if err := lc.flight.api.DeleteNetwork(lc.network); err != nil {
+			plog.Errorf("deleting network %v: %v", lc.network, err)
+		}
+	}
+
+	lc.flight.DelCluster(lc)
+}
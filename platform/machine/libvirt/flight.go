@@ -0,0 +1,89 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package libvirt
+
+import (
+	"fmt"
+
+	"github.com/coreos/pkg/capnslog"
+	ctplatform "github.com/flatcar/container-linux-config-transpiler/config/platform"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/api/libvirt"
+)
+
+const (
+	Platform platform.Name = "libvirt"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/machine/libvirt")
+)
+
+type flight struct {
+	*platform.BaseFlight
+	api  *libvirt.API
+	opts *libvirt.Options
+}
+
+func NewFlight(opts *libvirt.Options) (platform.Flight, error) {
+	api, err := libvirt.New(opts)
+	if err != nil {
+		return nil, fmt.Errorf("creating libvirt API client: %w", err)
+	}
+	if opts.Image == "" {
+		api.Close()
+		return nil, fmt.Errorf("no image volume given")
+	}
+
+	base, err := platform.NewBaseFlight(opts.Options, Platform, ctplatform.Custom)
+	if err != nil {
+		api.Close()
+		return nil, fmt.Errorf("creating base flight: %w", err)
+	}
+
+	bf := &flight{
+		BaseFlight: base,
+		api:        api,
+		opts:       opts,
+	}
+
+	return bf, nil
+}
+
+func (bf *flight) Destroy() {
+	bf.BaseFlight.Destroy()
+	if err := bf.api.Close(); err != nil {
+		plog.Errorf("disconnecting from libvirtd: %v", err)
+	}
+}
+
+// NewCluster creates an instance of a Cluster suitable for spawning
+// domains on a libvirt host. Unless an existing network is configured,
+// every cluster gets its own NAT network.
+func (bf *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, error) {
+	bc, err := platform.NewBaseCluster(bf.BaseFlight, rconf)
+	if err != nil {
+		return nil, fmt.Errorf("creating libvirt base cluster: %w", err)
+	}
+
+	c := &cluster{
+		BaseCluster: bc,
+		flight:      bf,
+		network:     bf.opts.Network,
+	}
+
+	if c.network == "" {
+		c.network = bc.Name()
+		if err := bf.api.CreateNetwork(c.network); err != nil {
+			bc.Destroy()
+			return nil, fmt.Errorf("creating network for cluster: %w", err)
+		}
+		c.ownNetwork = true
+	}
+
+	bf.AddCluster(c)
+
+	return c, nil
+}
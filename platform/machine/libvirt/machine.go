@@ -0,0 +1,127 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package libvirt
+
+import (
+	"golang.org/x/crypto/ssh"
+
+	"github.com/flatcar/mantle/platform"
+)
+
+type machine struct {
+	cluster *cluster
+	name    string
+	mac     string
+	ip      string
+	dir     string
+	journal *platform.Journal
+	console string
+
+	// volumes are deleted on Destroy
+	volumes  []string
+	disk     string
+	ignition string
+	// consoleVolume receives the serial console
+	consoleVolume string
+	defined       bool
+}
+
+// ID returns the name of the libvirt domain.
+func (lm *machine) ID() string {
+	return lm.name
+}
+
+// IP returns the IP of the machine.
+func (lm *machine) IP() string {
+	return lm.ip
+}
+
+// PrivateIP returns the private IP of the machine, which is the same as
+// IP as machines only have a single interface.
+func (lm *machine) PrivateIP() string {
+	return lm.ip
+}
+
+// RuntimeConf returns the runtime configuration of the cluster.
+func (lm *machine) RuntimeConf() *platform.RuntimeConfig {
+	return lm.cluster.RuntimeConf()
+}
+
+func (lm *machine) SSHClient() (*ssh.Client, error) {
+	return lm.cluster.SSHClient(lm.IP())
+}
+
+func (lm *machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
+	return lm.cluster.PasswordSSHClient(lm.IP(), user, password)
+}
+
+func (lm *machine) SSH(cmd string) ([]byte, []byte, error) {
+	return lm.cluster.SSH(lm, cmd)
+}
+
+func (lm *machine) Reboot() error {
+	return platform.RebootMachine(lm, lm.journal)
+}
+
+func (lm *machine) Destroy() {
+	api := lm.cluster.flight.api
+	if lm.defined {
+		if err := api.DestroyDomain(lm.name); err != nil {
+			plog.Errorf("deleting domain %v: %v", lm.name, err)
+		}
+		lm.defined = false
+	}
+
+	lm.saveConsole()
+
+	for _, vol := range lm.volumes {
+		if err := api.DeleteVolume(vol); err != nil {
+			plog.Errorf("deleting volume %v: %v", vol, err)
+		}
+	}
+	lm.volumes = nil
+
+	if lm.journal != nil {
+		lm.journal.Destroy()
+	}
+
+	lm.cluster.DelMach(lm)
+}
+
+func (lm *machine) saveConsole() {
+	if lm.consoleVolume == "" {
+		return
+	}
+	data, err := lm.cluster.flight.api.DownloadVolume(lm.consoleVolume)
+	if err != nil {
+		plog.Errorf("reading console for domain %v: %v", lm.name, err)
+		return
+	}
+	lm.console = string(data)
+}
+
+func (lm *machine) ConsoleOutput() string {
+	return lm.console
+}
+
+func (lm *machine) JournalOutput() string {
+	if lm.journal == nil {
+		return ""
+	}
+
+	data, err := lm.journal.Read()
+	if err != nil {
+		plog.Errorf("Reading journal for domain %v: %v", lm.name, err)
+	}
+	return string(data)
+}
+
+// Journal returns the recorder of the machine's journal.
+func (lm *machine) Journal() *platform.Journal {
+	return lm.journal
+}
+
+func (lm *machine) Board() string {
+	return lm.cluster.flight.Options().Board
+}
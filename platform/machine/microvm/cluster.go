@@ -0,0 +1,223 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package microvm
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pborman/uuid"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/local"
+	"github.com/flatcar/mantle/system/exec"
+	"github.com/flatcar/mantle/system/ns"
+)
+
+type cluster struct {
+	flight *flight
+
+	mu sync.Mutex
+	*local.LocalCluster
+}
+
+func (mc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
+	id := uuid.New()
+
+	dir := filepath.Join(mc.RuntimeConf().OutputDir, id)
+	if err := os.Mkdir(dir, 0777); err != nil {
+		return nil, err
+	}
+	// The VMM runs with dir as working directory but gets absolute
+	// paths so that the same paths work in the configuration file.
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	mc.mu.Lock()
+	netif := mc.flight.Dnsmasq.GetInterface("br0")
+	ip := strings.Split(netif.DHCPv4[0].String(), "/")[0]
+
+	conf, err := mc.RenderUserData(userdata, map[string]string{
+		"$public_ipv4":  "${COREOS_CUSTOM_PUBLIC_IPV4}",
+		"$private_ipv4": "${COREOS_CUSTOM_PRIVATE_IPV4}",
+	})
+	mc.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	conf.AddSystemdUnit("coreos-metadata.service", `[Unit]
+Description=microVM metadata agent
+After=nss-lookup.target
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=oneshot
+Environment=OUTPUT=/run/metadata/flatcar
+ExecStart=/usr/bin/mkdir --parent /run/metadata
+ExecStart=/usr/bin/bash -c 'echo "COREOS_CUSTOM_PRIVATE_IPV4=`+ip+`\nCOREOS_CUSTOM_PUBLIC_IPV4=`+ip+`\n" > ${OUTPUT}'
+ExecStartPost=/usr/bin/ln -fs /run/metadata/flatcar /run/metadata/coreos
+`, false)
+
+	if conf.IsIgnition() {
+		if err := conf.WriteFile(filepath.Join(dir, "ignition.json")); err != nil {
+			return nil, err
+		}
+	}
+
+	journal, err := platform.NewJournal(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	mm := &machine{
+		mc:          mc,
+		id:          id,
+		netif:       netif,
+		journal:     journal,
+		consolePath: filepath.Join(dir, "console.txt"),
+		subDir:      dir,
+	}
+
+	// machine to destroy
+	m := mm
+	defer func() {
+		if m != nil {
+			m.Destroy()
+		}
+	}()
+
+	disk := filepath.Join(dir, "disk.img")
+	if err := copyDisk(mc.flight.opts.DiskImage, disk); err != nil {
+		return nil, fmt.Errorf("copying disk image: %v", err)
+	}
+	mm.disk = disk
+
+	// The config drive is always attached, cloud-config is read from
+	// it and Ignition falls back to it if the config does not fit on
+	// the kernel command line.
+	drive, err := makeConfigDriveImage(conf, dir)
+	if err != nil {
+		return nil, fmt.Errorf("creating config drive: %v", err)
+	}
+
+	console, err := mc.flight.vmm.Console(mc.flight.opts.Board)
+	if err != nil {
+		return nil, err
+	}
+	// the disk, the config drive and the network interface
+	const devices = 3
+	cmdline := kernelCmdline(console, "", mc.flight.opts.KernelArgs)
+	if conf.IsIgnition() {
+		dataURL := "data:," + url.PathEscape(conf.String())
+		if withURL := kernelCmdline(console, dataURL, mc.flight.opts.KernelArgs); len(withURL) < mc.flight.vmm.MaxCmdline(devices) {
+			cmdline = withURL
+		} else {
+			plog.Debugf("Ignition config of %v is too large for the kernel command line, using the config drive", id)
+		}
+	}
+
+	mc.mu.Lock()
+	tap, err := mc.NewPersistentTap("br0")
+	if err != nil {
+		mc.mu.Unlock()
+		return nil, err
+	}
+	// The VMM attaches to the tap by name.
+	tap.Close()
+	mm.tap = tap.Attrs().Name
+	mc.mu.Unlock()
+
+	vc := &vmConfig{
+		Binary:  mc.flight.opts.Binary,
+		Kernel:  mc.flight.opts.Kernel,
+		Initrd:  mc.flight.opts.Initrd,
+		Cmdline: cmdline,
+		Disks: []vmDisk{
+			{Path: disk},
+			{Path: drive, ReadOnly: true},
+		},
+		Tap:        mm.tap,
+		MAC:        netif.HardwareAddr.String(),
+		Memory:     mc.flight.opts.Memory,
+		CPUs:       mc.flight.opts.CPUs,
+		Console:    mm.consolePath,
+		ConfigFile: filepath.Join(dir, mc.flight.opts.VMM+".json"),
+	}
+	args, err := mc.flight.vmm.Args(vc)
+	if err != nil {
+		return nil, err
+	}
+
+	plog.Debugf("NewMachine: %q, cwd: %q, %q", args, dir, mm.IP())
+
+	mm.cmd = mc.NewCommand(dir, args[0], args[1:]...)
+	cmd := mm.cmd.(*ns.Cmd)
+	cmd.Stderr = os.Stderr
+	if mc.flight.vmm.ConsoleOnStdout() {
+		f, err := os.Create(mm.consolePath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		cmd.Stdout = f
+	}
+
+	if err := mm.cmd.Start(); err != nil {
+		mm.cmd = nil
+		return nil, err
+	}
+	plog.Debugf("%s PID (manual cleanup needed if --remove=false): %v", mc.flight.opts.VMM, mm.cmd.Pid())
+
+	if err := platform.StartMachine(mm, mm.journal); err != nil {
+		return nil, err
+	}
+
+	m = nil
+	mc.AddMach(mm)
+
+	return mm, nil
+}
+
+func (mc *cluster) Destroy() {
+	mc.LocalCluster.Destroy()
+	mc.flight.DelCluster(mc)
+}
+
+// copyDisk creates a writable copy of the base image, sharing blocks with
+// it where the file system supports it.
+func copyDisk(src, dst string) error {
+	out, err := exec.Command("cp", "--reflink=auto", "--sparse=always", src, dst).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	return nil
+}
+
+// makeConfigDriveImage writes the userdata into a FAT image labeled
+// config-2 and returns its path.
+func makeConfigDriveImage(userdata *conf.Conf, dir string) (string, error) {
+	drivePath, err := local.MakeConfigDrive(userdata, dir)
+	if err != nil {
+		return "", err
+	}
+	image := filepath.Join(dir, "config-2.img")
+	for _, args := range [][]string{
+		{"mkfs.vfat", "-n", "config-2", "-C", image, "2048"},
+		{"mcopy", "-s", "-i", image, filepath.Join(dir, drivePath, "openstack"), "::"},
+	} {
+		if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			return "", fmt.Errorf("%s: %v: %s", args[0], err, out)
+		}
+	}
+	return image, nil
+}
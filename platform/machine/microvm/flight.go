@@ -0,0 +1,105 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package microvm
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/local"
+)
+
+const (
+	Platform platform.Name = "microvm"
+)
+
+// Options contains microVM-specific options for the flight.
+type Options struct {
+	// VMM is the virtual machine monitor, Firecracker or
+	// CloudHypervisor.
+	VMM string
+	// Binary is the VMM executable. Defaults to the VMM name.
+	Binary string
+
+	// Kernel is the uncompressed Flatcar kernel to boot directly.
+	Kernel string
+	// Initrd is an optional initramfs for kernels without an
+	// embedded one.
+	Initrd string
+	// DiskImage is the raw Flatcar disk image providing the USR-A
+	// and ROOT partitions.
+	DiskImage string
+	// KernelArgs are appended to the kernel command line.
+	KernelArgs string
+
+	// Memory is the amount of memory per machine in MiB.
+	Memory int
+	// CPUs is the number of virtual CPUs per machine.
+	CPUs int
+
+	*platform.Options
+}
+
+type flight struct {
+	*local.LocalFlight
+	opts *Options
+	vmm  vmm
+}
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "platform/machine/microvm")
+)
+
+func NewFlight(opts *Options) (platform.Flight, error) {
+	v, err := getVMM(opts.VMM)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := v.Console(opts.Board); err != nil {
+		return nil, err
+	}
+	if opts.Binary == "" {
+		opts.Binary = opts.VMM
+	}
+	if _, err := exec.LookPath(opts.Binary); err != nil {
+		return nil, fmt.Errorf("finding %s: %v", opts.VMM, err)
+	}
+	if opts.Kernel == "" || opts.DiskImage == "" {
+		return nil, fmt.Errorf("both a kernel and a disk image are required")
+	}
+
+	lf, err := local.NewLocalFlight(opts.Options, Platform)
+	if err != nil {
+		return nil, fmt.Errorf("creating local flight failed: %v", err)
+	}
+
+	mf := &flight{
+		LocalFlight: lf,
+		opts:        opts,
+		vmm:         v,
+	}
+
+	return mf, nil
+}
+
+// NewCluster creates a Cluster instance, suitable for running microVMs
+// in the local network namespace.
+func (mf *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, error) {
+	lc, err := mf.LocalFlight.NewCluster(rconf)
+	if err != nil {
+		return nil, err
+	}
+
+	mc := &cluster{
+		flight:       mf,
+		LocalCluster: lc,
+	}
+
+	mf.AddCluster(mc)
+
+	return mc, nil
+}
@@ -0,0 +1,115 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package microvm
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/flatcar/mantle/platform"
+	"github.com/flatcar/mantle/platform/local"
+	"github.com/flatcar/mantle/system/exec"
+)
+
+type machine struct {
+	mc          *cluster
+	id          string
+	cmd         exec.Cmd
+	netif       *local.Interface
+	tap         string
+	disk        string
+	journal     *platform.Journal
+	consolePath string
+	console     string
+	subDir      string
+}
+
+func (m *machine) ID() string {
+	return m.id
+}
+
+func (m *machine) IP() string {
+	return m.netif.DHCPv4[0].IP.String()
+}
+
+func (m *machine) PrivateIP() string {
+	return m.netif.DHCPv4[0].IP.String()
+}
+
+func (m *machine) RuntimeConf() *platform.RuntimeConfig {
+	return m.mc.RuntimeConf()
+}
+
+func (m *machine) SSHClient() (*ssh.Client, error) {
+	return m.mc.SSHClient(m.IP())
+}
+
+func (m *machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
+	return m.mc.PasswordSSHClient(m.IP(), user, password)
+}
+
+func (m *machine) SSH(cmd string) ([]byte, []byte, error) {
+	return m.mc.SSH(m, cmd)
+}
+
+func (m *machine) Reboot() error {
+	if !m.mc.flight.vmm.CanReboot() {
+		return fmt.Errorf("rebooting is unsupported on %s, which exits when the guest reboots", m.mc.flight.opts.VMM)
+	}
+	return platform.RebootMachine(m, m.journal)
+}
+
+func (m *machine) Destroy() {
+	if m.cmd != nil {
+		if err := m.cmd.Kill(); err != nil {
+			plog.Errorf("Error killing instance %v: %v", m.ID(), err)
+		}
+	}
+	if m.tap != "" {
+		if err := m.mc.DelTap(m.tap); err != nil {
+			plog.Errorf("Error deleting tap %v: %v", m.tap, err)
+		}
+	}
+	if m.disk != "" {
+		if err := os.Remove(m.disk); err != nil {
+			plog.Errorf("Error removing disk of instance %v: %v", m.ID(), err)
+		}
+	}
+	m.journal.Destroy()
+
+	if buf, err := os.ReadFile(m.consolePath); err == nil {
+		m.console = string(buf)
+	} else {
+		plog.Errorf("Error reading console for instance %v: %v", m.ID(), err)
+	}
+
+	m.mc.DelMach(m)
+}
+
+func (m *machine) ConsoleOutput() string {
+	return m.console
+}
+
+func (m *machine) JournalOutput() string {
+	if m.journal == nil {
+		return ""
+	}
+
+	data, err := m.journal.Read()
+	if err != nil {
+		plog.Errorf("Reading journal for instance %v: %v", m.ID(), err)
+	}
+	return string(data)
+}
+
+// Journal returns the recorder of the machine's journal.
+func (m *machine) Journal() *platform.Journal {
+	return m.journal
+}
+
+func (m *machine) Board() string {
+	return m.mc.flight.Options().Board
+}
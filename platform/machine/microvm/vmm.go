@@ -0,0 +1,240 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package microvm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	Firecracker     = "firecracker"
+	CloudHypervisor = "cloud-hypervisor"
+
+	// maxCmdline is the kernel command line limit of the supported
+	// architectures. Larger Ignition configs go to the config drive.
+	maxCmdline = 2048
+
+	// firecrackerDeviceArgs is reserved per device for the
+	// virtio_mmio.device= argument Firecracker appends on x86, e.g.
+	// " virtio_mmio.device=4K@0xd0001000:6".
+	firecrackerDeviceArgs = 64
+)
+
+// vmm describes how a virtual machine monitor is started.
+type vmm interface {
+	// Args returns the command line of the VMM, writing its
+	// configuration file if it needs one.
+	Args(c *vmConfig) ([]string, error)
+	// ConsoleOnStdout is true if the VMM writes the serial console to
+	// its standard output instead of a file.
+	ConsoleOnStdout() bool
+	// Console returns the kernel console device.
+	Console(board string) (string, error)
+	// MaxCmdline is the longest kernel command line which can be
+	// passed for a machine with the given number of devices, leaving
+	// room for the arguments the VMM adds.
+	MaxCmdline(devices int) int
+	// CanReboot is false if the VMM exits when the guest reboots.
+	CanReboot() bool
+}
+
+func getVMM(name string) (vmm, error) {
+	switch name {
+	case Firecracker:
+		return firecracker{}, nil
+	case CloudHypervisor:
+		return cloudHypervisor{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported VMM %q, use %q or %q", name, Firecracker, CloudHypervisor)
+	}
+}
+
+type vmDisk struct {
+	Path     string
+	ReadOnly bool
+}
+
+// vmConfig is the VMM independent description of a microVM.
+type vmConfig struct {
+	Binary  string
+	Kernel  string
+	Initrd  string
+	Cmdline string
+	Disks   []vmDisk
+	Tap     string
+	MAC     string
+	Memory  int
+	CPUs    int
+	// Console is the file the serial console is written to.
+	Console string
+	// ConfigFile is the file the VMM configuration is written to if
+	// the VMM takes one.
+	ConfigFile string
+}
+
+type firecracker struct{}
+
+type firecrackerConfig struct {
+	BootSource struct {
+		KernelImagePath string `json:"kernel_image_path"`
+		InitrdPath      string `json:"initrd_path,omitempty"`
+		BootArgs        string `json:"boot_args"`
+	} `json:"boot-source"`
+	Drives        []firecrackerDrive `json:"drives"`
+	Net           []firecrackerNet   `json:"network-interfaces"`
+	MachineConfig struct {
+		VCPUCount  int `json:"vcpu_count"`
+		MemSizeMiB int `json:"mem_size_mib"`
+	} `json:"machine-config"`
+}
+
+type firecrackerDrive struct {
+	DriveID      string `json:"drive_id"`
+	PathOnHost   string `json:"path_on_host"`
+	IsRootDevice bool   `json:"is_root_device"`
+	IsReadOnly   bool   `json:"is_read_only"`
+}
+
+type firecrackerNet struct {
+	IfaceID     string `json:"iface_id"`
+	GuestMAC    string `json:"guest_mac"`
+	HostDevName string `json:"host_dev_name"`
+}
+
+// config renders the file passed to --config-file.
+func (firecracker) config(c *vmConfig) ([]byte, error) {
+	var fc firecrackerConfig
+	fc.BootSource.KernelImagePath = c.Kernel
+	fc.BootSource.InitrdPath = c.Initrd
+	fc.BootSource.BootArgs = c.Cmdline
+	for i, d := range c.Disks {
+		// The root file system is found by label, Firecracker
+		// must not add its own root= argument.
+		fc.Drives = append(fc.Drives, firecrackerDrive{
+			DriveID:    fmt.Sprintf("disk%d", i),
+			PathOnHost: d.Path,
+			IsReadOnly: d.ReadOnly,
+		})
+	}
+	fc.Net = append(fc.Net, firecrackerNet{
+		IfaceID:     "eth0",
+		GuestMAC:    c.MAC,
+		HostDevName: c.Tap,
+	})
+	fc.MachineConfig.VCPUCount = c.CPUs
+	fc.MachineConfig.MemSizeMiB = c.Memory
+	return json.MarshalIndent(&fc, "", "  ")
+}
+
+// Args writes the Firecracker configuration to c.ConfigFile and returns
+// the arguments loading it.
+func (f firecracker) Args(c *vmConfig) ([]string, error) {
+	data, err := f.config(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(c.ConfigFile, data, 0644); err != nil {
+		return nil, err
+	}
+	return []string{c.Binary, "--no-api", "--config-file", c.ConfigFile}, nil
+}
+
+func (firecracker) ConsoleOnStdout() bool {
+	return true
+}
+
+func (firecracker) MaxCmdline(devices int) int {
+	return maxCmdline - devices*firecrackerDeviceArgs
+}
+
+func (firecracker) CanReboot() bool {
+	return false
+}
+
+func (firecracker) Console(board string) (string, error) {
+	switch board {
+	case "amd64-usr", "arm64-usr":
+		return "ttyS0", nil
+	default:
+		return "", fmt.Errorf("board %q is not supported by Firecracker", board)
+	}
+}
+
+type cloudHypervisor struct{}
+
+func (cloudHypervisor) Args(c *vmConfig) ([]string, error) {
+	args := []string{c.Binary,
+		"--kernel", c.Kernel,
+		"--cmdline", c.Cmdline,
+		"--cpus", "boot=" + strconv.Itoa(c.CPUs),
+		"--memory", fmt.Sprintf("size=%dM", c.Memory),
+		"--net", fmt.Sprintf("tap=%s,mac=%s", c.Tap, c.MAC),
+		"--serial", "file=" + c.Console,
+		"--console", "off",
+	}
+	if c.Initrd != "" {
+		args = append(args, "--initramfs", c.Initrd)
+	}
+	disks := []string{"--disk"}
+	for _, d := range c.Disks {
+		disk := "path=" + d.Path
+		if d.ReadOnly {
+			disk += ",readonly=on"
+		}
+		disks = append(disks, disk)
+	}
+	return append(args, disks...), nil
+}
+
+func (cloudHypervisor) ConsoleOnStdout() bool {
+	return false
+}
+
+func (cloudHypervisor) MaxCmdline(devices int) int {
+	return maxCmdline
+}
+
+func (cloudHypervisor) CanReboot() bool {
+	return true
+}
+
+func (cloudHypervisor) Console(board string) (string, error) {
+	switch board {
+	case "amd64-usr":
+		return "ttyS0", nil
+	case "arm64-usr":
+		return "ttyAMA0", nil
+	default:
+		return "", fmt.Errorf("board %q is not supported by cloud-hypervisor", board)
+	}
+}
+
+// kernelCmdline returns the command line booting Flatcar from the first
+// disk without the boot loader. If ignitionURL is set, Ignition fetches
+// the config from it, otherwise it reads the config drive through the
+// OpenStack provider.
+func kernelCmdline(console, ignitionURL, extra string) string {
+	args := []string{
+		"console=" + console,
+		"root=LABEL=ROOT",
+		"rootflags=rw",
+		"mount.usr=PARTLABEL=USR-A",
+		"mount.usrflags=ro",
+		"flatcar.first_boot=1",
+		"flatcar.oem.id=qemu",
+	}
+	if ignitionURL != "" {
+		args = append(args, "ignition.platform.id=metal", "ignition.config.url="+ignitionURL)
+	} else {
+		args = append(args, "ignition.platform.id=openstack")
+	}
+	if extra != "" {
+		args = append(args, extra)
+	}
+	return strings.Join(args, " ")
+}
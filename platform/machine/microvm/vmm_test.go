@@ -0,0 +1,134 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package microvm
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testConfig(t *testing.T) *vmConfig {
+	return &vmConfig{
+		Binary:  "vmm",
+		Kernel:  "/images/vmlinux",
+		Cmdline: kernelCmdline("ttyS0", "", ""),
+		Disks: []vmDisk{
+			{Path: "/m/disk.img"},
+			{Path: "/m/config-2.img", ReadOnly: true},
+		},
+		Tap:        "tap0",
+		MAC:        "02:00:00:00:00:01",
+		Memory:     1024,
+		CPUs:       2,
+		Console:    "/m/console.txt",
+		ConfigFile: filepath.Join(t.TempDir(), "firecracker.json"),
+	}
+}
+
+func TestFirecrackerConfig(t *testing.T) {
+	c := testConfig(t)
+	args, err := firecracker{}.Args(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"vmm", "--no-api", "--config-file", c.ConfigFile}; !reflect.DeepEqual(args, want) {
+		t.Errorf("unexpected args %q", args)
+	}
+
+	data, err := firecracker{}.config(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fc firecrackerConfig
+	if err := json.Unmarshal(data, &fc); err != nil {
+		t.Fatal(err)
+	}
+	if fc.BootSource.KernelImagePath != c.Kernel || fc.BootSource.BootArgs != c.Cmdline {
+		t.Errorf("unexpected boot source %+v", fc.BootSource)
+	}
+	if len(fc.Drives) != 2 || fc.Drives[0].IsRootDevice || !fc.Drives[1].IsReadOnly {
+		t.Errorf("unexpected drives %+v", fc.Drives)
+	}
+	if len(fc.Net) != 1 || fc.Net[0].HostDevName != "tap0" || fc.Net[0].GuestMAC != c.MAC {
+		t.Errorf("unexpected network %+v", fc.Net)
+	}
+	if fc.MachineConfig.MemSizeMiB != 1024 || fc.MachineConfig.VCPUCount != 2 {
+		t.Errorf("unexpected machine config %+v", fc.MachineConfig)
+	}
+}
+
+func TestCloudHypervisorArgs(t *testing.T) {
+	c := testConfig(t)
+	c.Initrd = "/images/initrd"
+	args, err := cloudHypervisor{}.Args(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(args, " ")
+	for _, want := range []string{
+		"--memory size=1024M",
+		"--cpus boot=2",
+		"--net tap=tap0,mac=02:00:00:00:00:01",
+		"--serial file=/m/console.txt",
+		"--initramfs /images/initrd",
+		"--disk path=/m/disk.img path=/m/config-2.img,readonly=on",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("%q not found in %q", want, joined)
+		}
+	}
+}
+
+func TestKernelCmdline(t *testing.T) {
+	cmdline := kernelCmdline("ttyAMA0", "data:,%7B%7D", "systemd.log_level=debug")
+	for _, want := range []string{
+		"console=ttyAMA0",
+		"root=LABEL=ROOT",
+		"mount.usr=PARTLABEL=USR-A",
+		"ignition.platform.id=metal",
+		"ignition.config.url=data:,%7B%7D",
+	} {
+		if !strings.Contains(cmdline, want) {
+			t.Errorf("%q not found in %q", want, cmdline)
+		}
+	}
+	if !strings.HasSuffix(cmdline, " systemd.log_level=debug") {
+		t.Errorf("extra arguments not appended: %q", cmdline)
+	}
+
+	if cmdline := kernelCmdline("ttyS0", "", ""); !strings.Contains(cmdline, "ignition.platform.id=openstack") {
+		t.Errorf("config drive not used: %q", cmdline)
+	}
+}
+
+func TestConsole(t *testing.T) {
+	if _, err := (firecracker{}).Console("riscv64-usr"); err == nil {
+		t.Errorf("expected error for unsupported board")
+	}
+	if c, _ := (cloudHypervisor{}).Console("arm64-usr"); c != "ttyAMA0" {
+		t.Errorf("unexpected console %q", c)
+	}
+	if _, err := getVMM("qemu"); err == nil {
+		t.Errorf("expected error for unknown VMM")
+	}
+}
+
+func TestMaxCmdline(t *testing.T) {
+	// leave room for Firecracker's virtio_mmio.device= arguments
+	if n := (firecracker{}).MaxCmdline(3); n+3*len(" virtio_mmio.device=4K@0xd0002000:7") > maxCmdline {
+		t.Errorf("no room for device arguments in %d bytes", n)
+	}
+	if n := (cloudHypervisor{}).MaxCmdline(3); n != maxCmdline {
+		t.Errorf("unexpected limit %d", n)
+	}
+}
+
+func TestCanReboot(t *testing.T) {
+	if (firecracker{}).CanReboot() || !(cloudHypervisor{}).CanReboot() {
+		t.Errorf("unexpected reboot support")
+	}
+}
@@ -173,6 +173,11 @@ func (om *machine) JournalOutput() string {
 	return string(data)
 }
 
+// Journal returns the recorder of the machine's journal.
+func (om *machine) Journal() *platform.Journal {
+	return om.journal
+}
+
 func (om *machine) Board() string {
 	return om.cluster.flight.Options().Board
 }
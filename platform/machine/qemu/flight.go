@@ -98,7 +98,7 @@ func NewFlight(opts *Options) (platform.Flight, error) {
 	}
 	if !opts.UseVanillaImage {
 		plog.Debug("enabling console logging in base disk")
-		qf.diskImageFile, err = platform.MakeCLDiskTemplate(opts.DiskImage)
+		qf.diskImageFile, err = platform.MakeCLDiskTemplate(opts.Board, opts.DiskImage)
 		if err != nil {
 			qf.Destroy()
 			return nil, fmt.Errorf("creating disk image file failed: %v", err)
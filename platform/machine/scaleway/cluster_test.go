@@ -0,0 +1,66 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package scaleway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flatcar/mantle/platform/api/scaleway"
+	"github.com/flatcar/mantle/platform/api/scaleway/scalewaytest"
+	"github.com/flatcar/mantle/platform/conf"
+	"github.com/flatcar/mantle/platform/platformtest"
+)
+
+func TestMachineLifecycle(t *testing.T) {
+	srv := scalewaytest.NewServer()
+	defer srv.Close()
+	image := srv.AddSnapshot("flatcar", time.Now(), nil)
+
+	dialer := platformtest.NewDialer()
+	flight, err := newFlight(&scaleway.Options{
+		Options:        platformtest.Options(),
+		AccessKey:      scalewaytest.AccessKey,
+		SecretKey:      scalewaytest.SecretKey,
+		OrganizationID: scalewaytest.OrganizationID,
+		Region:         scalewaytest.Region,
+		Zone:           scalewaytest.Zone,
+		Image:          image,
+		InstanceType:   scalewaytest.InstanceType,
+		Endpoint:       srv.URL,
+	}, dialer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cluster, err := flight.NewCluster(platformtest.RuntimeConfig(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := cluster.NewMachine(conf.Ignition(`{"ignition": {"version": "2.0.0"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers := srv.Servers()
+	if len(servers) != 1 {
+		t.Fatalf("unexpected servers %+v", servers)
+	}
+	if m.IP() != servers[0].PublicIP.Address.String() || m.PrivateIP() != *servers[0].PrivateIP {
+		t.Errorf("unexpected machine addresses %q %q", m.IP(), m.PrivateIP())
+	}
+	if srv.UserData(m.ID(), "cloud-init") == "" {
+		t.Errorf("machine created without user data")
+	}
+	for _, addr := range dialer.Addrs() {
+		if addr != m.IP()+":22" {
+			t.Errorf("unexpected SSH connection to %q", addr)
+		}
+	}
+
+	flight.Destroy()
+	if len(srv.Servers()) != 0 || len(srv.Volumes()) != 0 {
+		t.Errorf("resources left after destroying the flight: %+v %+v", srv.Servers(), srv.Volumes())
+	}
+}
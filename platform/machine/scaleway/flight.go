@@ -9,6 +9,7 @@ import (
 	"github.com/coreos/pkg/capnslog"
 	ctplatform "github.com/flatcar/container-linux-config-transpiler/config/platform"
 
+	"github.com/flatcar/mantle/network"
 	"github.com/flatcar/mantle/platform"
 	"github.com/flatcar/mantle/platform/api/scaleway"
 )
@@ -27,13 +28,18 @@ type flight struct {
 }
 
 func NewFlight(opts *scaleway.Options) (platform.Flight, error) {
+	return newFlight(opts, network.NewRetryDialer())
+}
+
+// newFlight creates a flight connecting to machines through dialer.
+func newFlight(opts *scaleway.Options, dialer network.Dialer) (platform.Flight, error) {
 	api, err := scaleway.New(opts)
 	if err != nil {
 		return nil, fmt.Errorf("creating scaleway API client: %w", err)
 	}
 
 	// TODO: Rework the Base Flight to remove the CT dependency.
-	base, err := platform.NewBaseFlight(opts.Options, Platform, ctplatform.Custom)
+	base, err := platform.NewBaseFlightWithDialer(opts.Options, Platform, ctplatform.Custom, dialer)
 	if err != nil {
 		return nil, fmt.Errorf("creating base flight: %w", err)
 	}
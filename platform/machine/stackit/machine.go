@@ -114,6 +114,11 @@ func (bm *machine) JournalOutput() string {
 	return string(data)
 }
 
+// Journal returns the recorder of the machine's journal.
+func (bm *machine) Journal() *platform.Journal {
+	return bm.journal
+}
+
 func (bm *machine) Board() string {
 	return bm.cluster.flight.Options().Board
 }
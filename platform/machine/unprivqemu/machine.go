@@ -113,6 +113,11 @@ func (m *machine) JournalOutput() string {
 	return string(data)
 }
 
+// Journal returns the recorder of the machine's journal.
+func (m *machine) Journal() *platform.Journal {
+	return m.journal
+}
+
 func (m *machine) Board() string {
 	return m.qc.flight.Options().Board
 }
@@ -169,9 +169,16 @@ type Options struct {
 	// Board is the board used by the image
 	Board string
 
+	// Version is the OS version of the image, if known.
+	Version string
+
 	// Toggle to instantiate a secureboot instance.
 	EnableSecureboot bool
 
+	// StrictConfig makes rendering userdata fail if validating it
+	// reports warnings, see conf.UserData.Validate.
+	StrictConfig bool
+
 	// How many times to retry establishing an SSH connection when
 	// creating a journal or when doing a machine check.
 	SSHRetries int
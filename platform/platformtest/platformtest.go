@@ -0,0 +1,56 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package platformtest provides helpers for testing platform
+// implementations against fake cloud APIs.
+package platformtest
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/flatcar/mantle/network/mockssh"
+	"github.com/flatcar/mantle/platform"
+)
+
+// BootedMachine is a mockssh.SessionHandler answering the commands run by
+// platform.StartMachine like a booted Flatcar machine. All other commands
+// succeed without output.
+func BootedMachine(s *mockssh.Session) {
+	switch {
+	case s.Exec == "systemctl is-system-running":
+		io.WriteString(s.Stdout, "running\n")
+	case strings.Contains(s.Exec, "/etc/os-release"):
+		io.WriteString(s.Stdout, "flatcar\n")
+	}
+	s.Exit(0)
+}
+
+// NewDialer returns a dialer connecting every machine to BootedMachine.
+func NewDialer() *mockssh.Dialer {
+	return mockssh.NewMockDialer(BootedMachine)
+}
+
+// Options returns platform options suitable for creating flights in
+// tests.
+func Options() *platform.Options {
+	return &platform.Options{
+		BaseName:        "kola",
+		Distribution:    "cl",
+		IgnitionVersion: "v2",
+		SSHRetries:      1,
+		SSHTimeout:      time.Second,
+	}
+}
+
+// RuntimeConfig returns a cluster configuration writing output to dir and
+// failing fast if a machine cannot be reached.
+func RuntimeConfig(dir string) *platform.RuntimeConfig {
+	return &platform.RuntimeConfig{
+		OutputDir:       dir,
+		NoEnableSelinux: true,
+		SSHRetries:      1,
+		SSHTimeout:      time.Second,
+	}
+}
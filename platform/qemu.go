@@ -23,7 +23,6 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
-	"runtime"
 	"slices"
 	"strconv"
 	"strings"
@@ -61,13 +60,18 @@ var (
 // Copy Container Linux input image and specialize copy for running kola tests.
 // Return FD to the copy, which is a deleted file.
 // This is not mandatory; the tests will do their best without it.
-func MakeCLDiskTemplate(inputPath string) (output *os.File, result error) {
+func MakeCLDiskTemplate(board, inputPath string) (output *os.File, result error) {
 	seterr := func(err error) {
 		if result == nil {
 			result = err
 		}
 	}
 
+	b, err := GetQEMUBoard(board)
+	if err != nil {
+		return nil, err
+	}
+
 	// create output file
 	outputPath, err := mkpath("/var/tmp")
 	if err != nil {
@@ -164,7 +168,7 @@ func MakeCLDiskTemplate(inputPath string) (output *os.File, result error) {
 		return nil, fmt.Errorf("opening grub.cfg: %v", err)
 	}
 	defer f.Close()
-	if _, err = f.WriteString("set linux_console=\"console=ttyS0,115200\"\n"); err != nil {
+	if _, err = fmt.Fprintf(f, "set linux_console=\"console=%s,115200\"\n", b.Console); err != nil {
 		return nil, fmt.Errorf("writing grub.cfg: %v", err)
 	}
 
@@ -308,55 +312,16 @@ func CreateOvmfVarsCopy(dir, ovmfVars string) (string, error) {
 }
 
 func CreateQEMUCommand(board, uuid, firmware, ovmfVars, consolePath, confPath, diskImagePath string, enableSecureboot, isIgnition bool, options MachineOptions) ([]string, []*os.File, error) {
-	var qmCmd []string
-
-	// As we expand this list of supported native + board
-	// archs combos we should coordinate with the
-	// coreos-assembler folks as they utilize something
-	// similar in cosa run
-	var qmBinary string
-	combo := runtime.GOARCH + "--" + board
-	smmFlag := ""
-	if enableSecureboot {
-		smmFlag = ",smm=on"
-	}
-	switch combo {
-	case "amd64--amd64-usr":
-		qmBinary = "qemu-system-x86_64"
-		qmCmd = []string{
-			"qemu-system-x86_64",
-			"-machine", fmt.Sprintf("q35,accel=kvm%s", smmFlag),
-			"-cpu", "host",
-			"-m", "2512",
-		}
-	case "amd64--arm64-usr":
-		qmBinary = "qemu-system-aarch64"
-		qmCmd = []string{
-			"qemu-system-aarch64",
-			"-machine", "virt",
-			"-cpu", "cortex-a57",
-			"-m", "2512",
-		}
-	case "arm64--amd64-usr":
-		qmBinary = "qemu-system-x86_64"
-		qmCmd = []string{
-			"qemu-system-x86_64",
-			"-machine", "pc-q35-2.8",
-			"-cpu", "kvm64",
-			"-m", "2512",
-		}
-	case "arm64--arm64-usr":
-		qmBinary = "qemu-system-aarch64"
-		qmCmd = []string{
-			"qemu-system-aarch64",
-			"-machine", "virt,accel=kvm,gic-version=3",
-			"-cpu", "host",
-			"-m", "2512",
-		}
-	default:
-		panic("host-guest combo not supported: " + combo)
+	b, err := GetQEMUBoard(board)
+	if err != nil {
+		return nil, nil, err
 	}
 
+	qmBinary := b.Binary
+	qmCmd := []string{qmBinary}
+	qmCmd = append(qmCmd, b.MachineArgs(enableSecureboot)...)
+	qmCmd = append(qmCmd, "-m", "2512")
+
 	if ovmfVars == "" {
 		qmCmd = append(qmCmd,
 			"-bios", firmware,
@@ -389,32 +354,16 @@ func CreateQEMUCommand(board, uuid, firmware, ovmfVars, consolePath, confPath, d
 			"-drive", fmt.Sprintf("if=pflash,unit=0,file=%v,format=%v,readonly=on", firmware, fwFormat),
 			"-drive", fmt.Sprintf("if=pflash,unit=1,file=%v,format=%v", ovmfVars, varsFormat),
 		)
-		if enableSecureboot && board == "amd64-usr" {
-			// When OVMF is built for X64 with SMM enabled S3 (suspend/resume)
-			// must be disabled. This is required for secure boot and not very
-			// well documented. The flag comes from here:
-			// https://github.com/tianocore/edk2/blob/b81557a00c61cc80ab118828f16ed9ce79455880/OvmfPkg/README#L213
-			qmCmd = append(qmCmd,
-				"-global", "ICH9-LPC.disable_s3=1",
-				"-global", "driver=cfi.pflash01,property=secure,value=on",
-			)
+		if enableSecureboot {
+			qmCmd = append(qmCmd, b.SecureBootArgs...)
 		}
 	}
 
 	if options.EnableTPM {
-		var tpm string
-		switch board {
-		case "amd64-usr":
-			tpm = "tpm-tis"
-		case "arm64-usr":
-			tpm = "tpm-tis-device"
-		default:
-			panic(board)
-		}
 		qmCmd = append(qmCmd,
 			"-chardev", fmt.Sprintf("socket,id=chrtpm,path=%v", options.SoftwareTPMSocket),
 			"-tpmdev", "emulator,id=tpm0,chardev=chrtpm",
-			"-device", fmt.Sprintf("%s,tpmdev=tpm0", tpm),
+			"-device", fmt.Sprintf("%s,tpmdev=tpm0", b.TPMDevice),
 		)
 	}
 
@@ -490,14 +439,9 @@ func CreateQEMUCommand(board, uuid, firmware, ovmfVars, consolePath, confPath, d
 // The virtio device name differs between machine types but otherwise
 // configuration is the same. Use this to help construct device args.
 func Virtio(board, device, args string) string {
-	var suffix string
-	switch board {
-	case "amd64-usr":
-		suffix = "pci"
-	case "arm64-usr":
-		suffix = "device"
-	default:
+	b, ok := QEMUBoards[board]
+	if !ok {
 		panic(board)
 	}
-	return fmt.Sprintf("virtio-%s-%s,%s", device, suffix, args)
+	return fmt.Sprintf("virtio-%s-%s,%s", device, b.VirtioSuffix, args)
 }
@@ -0,0 +1,145 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package platform
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// QEMUBoard describes how a board is run under QEMU. Adding support for a
+// board only requires adding an entry to QEMUBoards.
+type QEMUBoard struct {
+	// Arch is the GOARCH of the board. Boards matching the host
+	// architecture run with KVM, all others under TCG emulation.
+	Arch string
+	// Binary is the QEMU system emulator for the board.
+	Binary string
+	// KVMMachine and KVMCPU are used when running natively.
+	KVMMachine string
+	KVMCPU     string
+	// TCGMachine and TCGCPU are used when emulating the board.
+	TCGMachine string
+	TCGCPU     string
+	// SecureBootMachineOptions are appended to the -machine argument
+	// when Secure Boot is enabled.
+	SecureBootMachineOptions string
+	// SecureBootArgs are additional QEMU arguments needed for Secure
+	// Boot with the board's UEFI firmware.
+	SecureBootArgs []string
+	// Firmware is the default firmware. If FirmwareFromImage is set,
+	// it names a file built next to the board's production image,
+	// otherwise it is looked up by QEMU in its data directory.
+	Firmware          string
+	FirmwareFromImage bool
+	// Vars optionally names the UEFI variable store built next to the
+	// board's production image. Boards whose firmware only runs from
+	// pflash need it to be used by default.
+	Vars string
+	// VirtioSuffix completes virtio device names, e.g. "pci" for
+	// virtio-blk-pci or "device" for virtio-blk-device (virtio-mmio).
+	VirtioSuffix string
+	// TPMDevice is the QEMU device type for the emulated TPM.
+	TPMDevice string
+	// Console is the guest device connected to the serial console.
+	Console string
+}
+
+// QEMUBoards contains all boards that can be run under QEMU.
+//
+// As we expand this list of supported boards we should coordinate
+// with the coreos-assembler folks as they utilize something similar
+// in cosa run.
+var QEMUBoards = map[string]QEMUBoard{
+	"amd64-usr": {
+		Arch:                     "amd64",
+		Binary:                   "qemu-system-x86_64",
+		KVMMachine:               "q35,accel=kvm",
+		KVMCPU:                   "host",
+		TCGMachine:               "pc-q35-2.8",
+		TCGCPU:                   "kvm64",
+		SecureBootMachineOptions: ",smm=on",
+		// When OVMF is built for X64 with SMM enabled S3 (suspend/resume)
+		// must be disabled. This is required for secure boot and not very
+		// well documented. The flag comes from here:
+		// https://github.com/tianocore/edk2/blob/b81557a00c61cc80ab118828f16ed9ce79455880/OvmfPkg/README#L213
+		SecureBootArgs: []string{
+			"-global", "ICH9-LPC.disable_s3=1",
+			"-global", "driver=cfi.pflash01,property=secure,value=on",
+		},
+		Firmware:     "bios-256k.bin",
+		VirtioSuffix: "pci",
+		TPMDevice:    "tpm-tis",
+		Console:      "ttyS0",
+	},
+	"arm64-usr": {
+		Arch:              "arm64",
+		Binary:            "qemu-system-aarch64",
+		KVMMachine:        "virt,accel=kvm,gic-version=3",
+		KVMCPU:            "host",
+		TCGMachine:        "virt",
+		TCGCPU:            "cortex-a57",
+		Firmware:          "flatcar_production_qemu_uefi_efi_code.qcow2",
+		FirmwareFromImage: true,
+		VirtioSuffix:      "device",
+		TPMDevice:         "tpm-tis-device",
+		Console:           "ttyS0",
+	},
+	"riscv64-usr": {
+		Arch:       "riscv64",
+		Binary:     "qemu-system-riscv64",
+		KVMMachine: "virt,accel=kvm",
+		KVMCPU:     "host",
+		TCGMachine: "virt",
+		TCGCPU:     "rv64",
+		// EDK2 runs from pflash on top of the OpenSBI firmware that
+		// QEMU loads by default, so both flash units are needed.
+		Firmware:          "flatcar_production_qemu_uefi_efi_code.qcow2",
+		FirmwareFromImage: true,
+		Vars:              "flatcar_production_qemu_uefi_efi_vars.qcow2",
+		VirtioSuffix:      "pci",
+		TPMDevice:         "tpm-tis-device",
+		Console:           "ttyS0",
+	},
+}
+
+// QEMUBoardNames returns the names of all boards that can be run under
+// QEMU.
+func QEMUBoardNames() []string {
+	names := make([]string, 0, len(QEMUBoards))
+	for name := range QEMUBoards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetQEMUBoard returns the definition of the given board.
+func GetQEMUBoard(board string) (QEMUBoard, error) {
+	b, ok := QEMUBoards[board]
+	if !ok {
+		return QEMUBoard{}, fmt.Errorf("unsupported QEMU board %q (supported: %s)", board, strings.Join(QEMUBoardNames(), ", "))
+	}
+	return b, nil
+}
+
+// Native reports whether the board can run with KVM on this host.
+func (b QEMUBoard) Native() bool {
+	return b.Arch == runtime.GOARCH
+}
+
+// MachineArgs returns the -machine and -cpu arguments for the board on
+// this host.
+func (b QEMUBoard) MachineArgs(enableSecureboot bool) []string {
+	machine, cpu := b.TCGMachine, b.TCGCPU
+	if b.Native() {
+		machine, cpu = b.KVMMachine, b.KVMCPU
+	}
+	if enableSecureboot {
+		machine += b.SecureBootMachineOptions
+	}
+	return []string{"-machine", machine, "-cpu", cpu}
+}
@@ -0,0 +1,39 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package platform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQEMUBoards(t *testing.T) {
+	for name, b := range QEMUBoards {
+		if !strings.HasPrefix(name, b.Arch+"-") {
+			t.Errorf("%s: board name does not match arch %q", name, b.Arch)
+		}
+		for field, value := range map[string]string{
+			"Binary":       b.Binary,
+			"KVMMachine":   b.KVMMachine,
+			"KVMCPU":       b.KVMCPU,
+			"TCGMachine":   b.TCGMachine,
+			"TCGCPU":       b.TCGCPU,
+			"Firmware":     b.Firmware,
+			"VirtioSuffix": b.VirtioSuffix,
+			"TPMDevice":    b.TPMDevice,
+			"Console":      b.Console,
+		} {
+			if value == "" {
+				t.Errorf("%s: %s is not set", name, field)
+			}
+		}
+		if got := Virtio(name, "blk", "drive=d3"); got != "virtio-blk-"+b.VirtioSuffix+",drive=d3" {
+			t.Errorf("%s: unexpected virtio device %q", name, got)
+		}
+	}
+
+	if _, err := GetQEMUBoard("sparc-usr"); err == nil {
+		t.Errorf("expected error for unknown board")
+	}
+}
@@ -18,29 +18,18 @@ import (
 	"encoding/xml"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 
 	"github.com/coreos/go-omaha/omaha"
 	"github.com/coreos/pkg/capnslog"
 
 	"github.com/flatcar/mantle/sdk"
-)
-
-const (
-	privateKey = "/usr/share/update_engine/update-payload-key.key.pem"
-	publicKey  = "/usr/share/update_engine/update-payload-key.pub.pem"
+	"github.com/flatcar/mantle/update/generator"
+	"github.com/flatcar/mantle/update/signature"
 )
 
 var plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "sdk/omaha")
 
-func run(name string, arg ...string) error {
-	cmd := exec.Command(name, arg...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
-
 func xmlMarshalFile(path string, v interface{}) error {
 	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
@@ -82,7 +71,11 @@ func checkUpdate(dir, update_xml string) error {
 	return u.Packages[0].Verify(pkgdir)
 }
 
-func GenerateFullUpdate(dir string) error {
+// GenerateFullUpdate generates a full update payload and its Omaha update
+// manifest from the update image and kernel in dir, unless a valid manifest
+// exists already. The payload is signed by signer, or the developer key if
+// it is nil, and compressed with the compressors, see generator.FullUpdate.
+func GenerateFullUpdate(dir string, signer signature.Signer, compressors ...generator.Compressor) error {
 	var (
 		update_prefix = filepath.Join(dir, "flatcar_production_update")
 		update_bin    = update_prefix + ".bin"
@@ -97,11 +90,7 @@ func GenerateFullUpdate(dir string) error {
 	}
 
 	plog.Noticef("Generating update payload: %s", update_gz)
-	if err := run("delta_generator",
-		"-new_image", update_bin,
-		"-new_kernel", vmlinuz,
-		"-out_file", update_gz,
-		"-private_key", privateKey); err != nil {
+	if err := generatePayload(update_gz, update_bin, vmlinuz, signer, compressors); err != nil {
 		return err
 	}
 
@@ -124,3 +113,28 @@ func GenerateFullUpdate(dir string) error {
 
 	return xmlMarshalFile(update_xml, &update)
 }
+
+func generatePayload(path, image, kernel string, signer signature.Signer, compressors []generator.Compressor) error {
+	g := generator.Generator{Signer: signer}
+	defer g.Destroy()
+
+	partition, err := generator.FullUpdate(image, compressors...)
+	if err != nil {
+		return err
+	}
+	if err := g.Partition(partition); err != nil {
+		partition.Close()
+		return err
+	}
+
+	vmlinuz, err := generator.KernelUpdate(kernel, compressors...)
+	if err != nil {
+		return err
+	}
+	if err := g.Kernel(vmlinuz); err != nil {
+		vmlinuz.Close()
+		return err
+	}
+
+	return g.Write(path)
+}
@@ -0,0 +1,69 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"io"
+
+	"golang.org/x/net/context"
+	gs "google.golang.org/api/storage/v1"
+)
+
+// Backend is a storage service holding buckets of objects. Object
+// metadata is exchanged in the form of the GCS JSON API for all backends,
+// which fill in what they support but at least Bucket, Name, Size and
+// one of Crc32c or Md5Hash.
+type Backend interface {
+	// Service identifies the service. Objects are copied between
+	// buckets of the same service without downloading them.
+	Service() string
+
+	// List calls fn with the objects under prefix, page by page. Unless
+	// recursive, objects in subdirectories are omitted and the
+	// subdirectories are passed as prefixes instead.
+	List(ctx context.Context, bucket, prefix string, recursive bool, fn func(objs []*gs.Object, prefixes []string) error) error
+
+	// Stat returns an object, or nil if it doesn't exist.
+	Stat(ctx context.Context, bucket, name string) (*gs.Object, error)
+
+	// Open reads length bytes of an object starting at offset, or the
+	// rest of it if length is negative.
+	Open(ctx context.Context, bucket, name string, offset, length int64) (io.ReadCloser, error)
+
+	// Upload writes obj to bucket, replacing old unless it is nil, and
+	// returns the written object as reported by the service. The hashes
+	// of obj are those of media, they are compared to the returned
+	// object's, so backends whose service only keeps them as metadata
+	// must check media was stored intact themselves.
+	Upload(ctx context.Context, bucket string, obj *gs.Object, media io.ReaderAt, old *gs.Object, opts TransferOptions) (*gs.Object, error)
+
+	// Copy copies src, which may be in another bucket of the service,
+	// to dst, replacing old unless it is nil, and returns the written
+	// object.
+	Copy(ctx context.Context, src, dst, old *gs.Object) (*gs.Object, error)
+
+	// Delete deletes an object, which is old unless it is nil.
+	Delete(ctx context.Context, bucket, name string, old *gs.Object) error
+}
+
+// TransferOptions tunes how large objects are transferred, backends apply
+// what their service supports.
+type TransferOptions struct {
+	// ChunkSize is the size of the parts objects are sent and received
+	// in, each of which is retried on its own.
+	ChunkSize int64
+
+	// Concurrency limits the number of parts transferred in parallel.
+	Concurrency int
+
+	// Retries is the number of times a part is retried after errors.
+	Retries int
+}
+
+// DefaultTransferOptions are used by new buckets.
+var DefaultTransferOptions = TransferOptions{
+	ChunkSize:   64 * 1024 * 1024,
+	Concurrency: 4,
+	Retries:     5,
+}
@@ -20,22 +20,25 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"sync"
 
 	"golang.org/x/net/context"
-	"google.golang.org/api/googleapi"
 	"google.golang.org/api/storage/v1"
 )
 
 var (
-	UnknownScheme = errors.New("storage: URL missing gs:// or http(s):// scheme")
+	UnknownScheme = errors.New("storage: URL missing gs://, s3://, file:// or http(s):// scheme")
 	UnknownBucket = errors.New("storage: URL missing bucket name")
+
+	ChecksumMismatch = errors.New("storage: checksum mismatch")
 )
 
 type Bucket struct {
-	service *storage.Service
+	backend Backend
 	name    string
 	prefix  string
 	scheme  string
@@ -48,33 +51,71 @@ type Bucket struct {
 	writeAlways bool
 	// writeDryRun blocks any changes, merely logging them instead
 	writeDryRun bool
+	// transfer tunes uploads and downloads of large objects
+	transfer TransferOptions
 }
 
+// NewBucket returns the bucket at a gs://, s3:// or file:// URL, or an
+// http(s):// URL of a GCS bucket. GCS is accessed with client, S3 is
+// configured by the environment, see NewS3BackendFromEnv. The path of
+// file:// URLs is the directory of a local bucket, see NewLocalBackend.
 func NewBucket(client *http.Client, bucketURL string) (*Bucket, error) {
-	service, err := storage.New(client)
+	parsedURL, err := url.Parse(bucketURL)
 	if err != nil {
 		return nil, err
 	}
 
-	parsedURL, err := url.Parse(bucketURL)
+	var backend Backend
+	switch parsedURL.Scheme {
+	case "gs", "http", "https":
+		backend, err = NewGCSBackend(client)
+	case "s3":
+		backend, err = NewS3BackendFromEnv()
+	case "file":
+		backend = NewLocalBackend()
+	default:
+		return nil, UnknownScheme
+	}
 	if err != nil {
 		return nil, err
 	}
-	if parsedURL.Scheme != "gs" && parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-		return nil, UnknownScheme
-	}
-	if parsedURL.Host == "" {
-		return nil, UnknownBucket
+
+	return newBucket(backend, parsedURL)
+}
+
+// NewBucketWithBackend returns the bucket at a URL of the backend.
+func NewBucketWithBackend(backend Backend, bucketURL string) (*Bucket, error) {
+	parsedURL, err := url.Parse(bucketURL)
+	if err != nil {
+		return nil, err
 	}
+	return newBucket(backend, parsedURL)
+}
 
-	return &Bucket{
-		service:  service,
-		name:     parsedURL.Host,
-		prefix:   FixPrefix(parsedURL.Path),
-		scheme:   parsedURL.Scheme,
+func newBucket(backend Backend, u *url.URL) (*Bucket, error) {
+	b := &Bucket{
+		backend:  backend,
+		name:     u.Host,
+		prefix:   FixPrefix(u.Path),
+		scheme:   u.Scheme,
 		prefixes: make(map[string]struct{}),
 		objects:  make(map[string]*storage.Object),
-	}, nil
+		transfer: DefaultTransferOptions,
+	}
+	switch {
+	case u.Scheme == "":
+		return nil, UnknownScheme
+	case u.Scheme == "file":
+		// the whole path is the directory of the bucket
+		if u.Host != "" && u.Host != "localhost" || u.Path == "" {
+			return nil, UnknownBucket
+		}
+		b.name = filepath.Clean(u.Path)
+		b.prefix = ""
+	case u.Host == "":
+		return nil, UnknownBucket
+	}
+	return b, nil
 }
 
 func (b *Bucket) Name() string {
@@ -86,7 +127,14 @@ func (b *Bucket) Prefix() string {
 }
 
 func (b *Bucket) URL() *url.URL {
-	return &url.URL{Scheme: b.scheme, Host: b.name, Path: b.prefix}
+	return b.objectURL(b.name, b.prefix)
+}
+
+func (b *Bucket) objectURL(bucket, name string) *url.URL {
+	if b.scheme == "file" {
+		return &url.URL{Scheme: b.scheme, Path: path.Join(bucket, name)}
+	}
+	return &url.URL{Scheme: b.scheme, Host: bucket, Path: name}
 }
 
 func (b *Bucket) WriteAlways(always bool) {
@@ -97,6 +145,22 @@ func (b *Bucket) WriteDryRun(dryrun bool) {
 	b.writeDryRun = dryrun
 }
 
+// ChunkSize sets the size of the parts objects are transferred in.
+func (b *Bucket) ChunkSize(size int64) {
+	b.transfer.ChunkSize = size
+}
+
+// Concurrency sets the number of parts of an object transferred in
+// parallel.
+func (b *Bucket) Concurrency(n int) {
+	b.transfer.Concurrency = n
+}
+
+// Retries sets how often a part is retried after network errors.
+func (b *Bucket) Retries(n int) {
+	b.transfer.Retries = n
+}
+
 func (b *Bucket) Object(objName string) *storage.Object {
 	if b.scheme == "http" || b.scheme == "https" {
 		return &storage.Object{}
@@ -154,16 +218,16 @@ func (b *Bucket) addObject(obj *storage.Object) {
 	b.objects[obj.Name] = obj
 }
 
-func (b *Bucket) addObjects(objs *storage.Objects) {
+func (b *Bucket) addObjects(objs []*storage.Object, prefixes []string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	for _, obj := range objs.Items {
+	for _, obj := range objs {
 		if obj.Bucket != b.name {
 			panic(fmt.Errorf("adding gs://%s/%s to bucket %s", obj.Bucket, obj.Name, b.name))
 		}
 		b.objects[obj.Name] = obj
 	}
-	for _, pfx := range objs.Prefixes {
+	for _, pfx := range prefixes {
 		b.prefixes[pfx] = struct{}{}
 	}
 }
@@ -177,16 +241,12 @@ func (b *Bucket) delObject(objName string) {
 func (b *Bucket) mkURL(obj interface{}) *url.URL {
 	switch v := obj.(type) {
 	case string:
-		u := b.URL()
-		u.Path = v
-		return u
+		return b.objectURL(b.name, v)
 	case *storage.Object:
-		u := b.URL()
-		u.Path = v.Name
 		if v.Bucket != "" {
-			u.Host = v.Bucket
+			return b.objectURL(v.Bucket, v.Name)
 		}
-		return u
+		return b.objectURL(b.name, v.Name)
 	case *url.URL:
 		return v
 	case nil:
@@ -197,10 +257,10 @@ func (b *Bucket) mkURL(obj interface{}) *url.URL {
 }
 
 func (b *Bucket) apiErr(op string, obj interface{}, e error) error {
-	if _, ok := e.(*googleapi.Error); ok {
-		return &Error{Op: op, URL: b.mkURL(obj).String(), Err: e}
+	if e == context.Canceled || e == context.DeadlineExceeded {
+		return e
 	}
-	return e
+	return &Error{Op: op, URL: b.mkURL(obj).String(), Err: e}
 }
 
 func (b *Bucket) Fetch(ctx context.Context) error {
@@ -209,24 +269,16 @@ func (b *Bucket) Fetch(ctx context.Context) error {
 
 func (b *Bucket) FetchPrefix(ctx context.Context, prefix string, recursive bool) error {
 	prefix = FixPrefix(prefix)
-	req := b.service.Objects.List(b.name)
-	if prefix != "" {
-		req.Prefix(prefix)
-	}
-	if !recursive {
-		req.Delimiter("/")
-	}
 
 	n := 0
 	p := 0
-	u := b.URL()
-	u.Path = prefix
-	add := func(objs *storage.Objects) error {
-		b.addObjects(objs)
-		n += len(objs.Items)
+	u := b.mkURL(prefix)
+	add := func(objs []*storage.Object, prefixes []string) error {
+		b.addObjects(objs, prefixes)
+		n += len(objs)
 		plog.Infof("Found %d objects under %s", n, u)
-		if len(objs.Prefixes) > 0 {
-			p += len(objs.Prefixes)
+		if len(prefixes) > 0 {
+			p += len(prefixes)
 			plog.Infof("Found %d directories under %s", p, u)
 		}
 		return nil
@@ -234,8 +286,8 @@ func (b *Bucket) FetchPrefix(ctx context.Context, prefix string, recursive bool)
 
 	plog.Noticef("Fetching %s", u)
 
-	if err := req.Pages(ctx, add); err != nil {
-		return b.apiErr("storage.objects.list", nil, err)
+	if err := b.backend.List(ctx, b.name, prefix, recursive, add); err != nil {
+		return b.apiErr("list", prefix, err)
 	}
 
 	if prefix == "" {
@@ -250,13 +302,11 @@ func (b *Bucket) FetchPrefix(ctx context.Context, prefix string, recursive bool)
 		return nil
 	}
 
-	redirReq := b.service.Objects.Get(b.name, redirName)
-	redirReq.Context(ctx)
-	redirObj, err := redirReq.Do()
-	if e, ok := err.(*googleapi.Error); ok && e.Code == 404 {
+	redirObj, err := b.backend.Stat(ctx, b.name, redirName)
+	if err != nil {
+		return b.apiErr("stat", redirName, err)
+	} else if redirObj == nil {
 		return nil // missing is perfectly valid
-	} else if err != nil {
-		return b.apiErr("storage.objects.get", redirName, err)
 	}
 
 	b.addObject(redirObj)
@@ -264,8 +314,8 @@ func (b *Bucket) FetchPrefix(ctx context.Context, prefix string, recursive bool)
 }
 
 func (b *Bucket) Upload(ctx context.Context, obj *storage.Object, media io.ReaderAt) error {
-	// Calculate the checksum to enable upload integrity checking.
-	if obj.Crc32c == "" {
+	// Calculate the checksums to enable upload integrity checking.
+	if obj.Crc32c == "" || obj.Md5Hash == "" {
 		obj = dupObj(obj) // avoid editing the original
 		if err := crcSum(obj, media); err != nil {
 			return err
@@ -281,22 +331,16 @@ func (b *Bucket) Upload(ctx context.Context, obj *storage.Object, media io.Reade
 		return nil
 	}
 
-	req := b.service.Objects.Insert(b.name, obj)
-	// ResumableMedia is documented as deprecated in favor of Media
-	// but Media's retry support was bad and got temporarily removed.
-	// https://github.com/google/google-api-go-client/commit/9737cc9e103c00d06a8f3993361dec083df3d252
-	req.ResumableMedia(ctx, media, int64(obj.Size), obj.ContentType)
-
-	// Watch out for unexpected conflicting updates.
-	if old != nil {
-		req.IfGenerationMatch(old.Generation)
-	}
-
 	plog.Noticef("Writing %s", b.mkURL(obj))
 
-	inserted, err := req.Do()
+	p := b.progress(obj)
+	inserted, err := b.backend.Upload(ctx, b.name, obj, p.readerAt(media), old, b.transfer)
+	p.close()
 	if err != nil {
-		return b.apiErr("storage.objects.insert", obj, err)
+		return b.apiErr("upload", obj, err)
+	}
+	if !crcEq(inserted, obj) {
+		return b.apiErr("upload", obj, ChecksumMismatch)
 	}
 
 	b.addObject(inserted)
@@ -313,10 +357,7 @@ func (b *Bucket) Copy(ctx context.Context, src *storage.Object, dstName string)
 		return nil // up to date!
 	}
 
-	// It does work to pass src directly to the Rewrite API call, the
-	// name and bucket values don't really matter, they just cannot be
-	// blank for whatever reason. We make a copy just to get consistent
-	// results, e.g. always use the destination bucket's default ACL.
+	// The destination has the metadata of src.
 	dst := dupObj(src)
 	dst.Name = dstName
 	dst.Bucket = b.name
@@ -326,31 +367,53 @@ func (b *Bucket) Copy(ctx context.Context, src *storage.Object, dstName string)
 		return nil
 	}
 
-	req := b.service.Objects.Rewrite(
-		src.Bucket, src.Name, dst.Bucket, dst.Name, src)
-	req.Context(ctx)
+	plog.Noticef("Copying %s to %s", b.mkURL(src), b.mkURL(dst))
 
-	// Watch out for unexpected conflicting updates.
-	if old != nil {
-		req.IfGenerationMatch(old.Generation)
+	copied, err := b.backend.Copy(ctx, src, dst, old)
+	if err != nil {
+		return b.apiErr("copy", dst, err)
 	}
-	if src.Generation != 0 {
-		req.IfSourceGenerationMatch(src.Generation)
+
+	b.addObject(copied)
+	return nil
+}
+
+// CopyFrom copies src from the bucket srcBucket to dstName. Objects of
+// other services are downloaded and uploaded again.
+func (b *Bucket) CopyFrom(ctx context.Context, srcBucket *Bucket, src *storage.Object, dstName string) error {
+	if srcBucket.backend.Service() == b.backend.Service() {
+		return b.Copy(ctx, src, dstName)
 	}
 
-	plog.Noticef("Copying %s to %s", b.mkURL(src), b.mkURL(dst))
+	old := b.Object(dstName)
+	if !b.writeAlways && crcEq(old, src) {
+		return nil // up to date!
+	}
 
-	for {
-		resp, err := req.Do()
-		if err != nil {
-			return b.apiErr("storage.objects.rewrite", dst, err)
-		}
-		if resp.Done {
-			b.addObject(resp.Resource)
-			return nil
-		}
-		req.RewriteToken(resp.RewriteToken)
+	dst := dupObj(src)
+	dst.Name = dstName
+	dst.Bucket = b.name
+
+	if b.writeDryRun {
+		plog.Noticef("Would copy %s to %s", srcBucket.mkURL(src), b.mkURL(dst))
+		return nil
+	}
+
+	plog.Noticef("Downloading %s", srcBucket.mkURL(src))
+
+	media, err := os.CreateTemp("", "mantle-storage-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(media.Name())
+	defer media.Close()
+
+	if err := srcBucket.download(ctx, src, media); err != nil {
+		return err
 	}
+
+	// the checksums of the source are those of the download
+	return b.Upload(ctx, dst, media)
 }
 
 func (b *Bucket) Delete(ctx context.Context, objName string) error {
@@ -359,19 +422,10 @@ func (b *Bucket) Delete(ctx context.Context, objName string) error {
 		return nil
 	}
 
-	req := b.service.Objects.Delete(b.name, objName)
-	req.Context(ctx)
-
-	// Watch out for unexpected conflicting updates.
-	if old := b.Object(objName); old != nil {
-		req.IfGenerationMatch(old.Generation)
-		req.IfMetagenerationMatch(old.Metageneration)
-	}
-
 	plog.Noticef("Deleting %s", b.mkURL(objName))
 
-	if err := req.Do(); err != nil {
-		return b.apiErr("storage.objects.delete", objName, err)
+	if err := b.backend.Delete(ctx, b.name, objName, b.Object(objName)); err != nil {
+		return b.apiErr("delete", objName, err)
 	}
 
 	b.delObject(objName)
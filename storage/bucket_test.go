@@ -45,6 +45,10 @@ func TestBucketURL(t *testing.T) {
 		t.Errorf("Unexpected error: %v", err)
 	}
 
+	if _, err := FakeBucket("file://host/dir"); err != UnknownBucket {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
 	for _, test := range []struct {
 		url    string
 		name   string
@@ -56,6 +60,8 @@ func TestBucketURL(t *testing.T) {
 		{"gs://bucket/prefix/", "bucket", "prefix/"},
 		{"gs://bucket/prefix/foo", "bucket", "prefix/foo/"},
 		{"gs://bucket/prefix/foo/", "bucket", "prefix/foo/"},
+		{"s3://bucket/prefix", "bucket", "prefix/"},
+		{"file:///srv/bucket/", "/srv/bucket", ""},
 	} {
 
 		bkt, err := FakeBucket(test.url)
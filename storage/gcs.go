@@ -0,0 +1,140 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+	gs "google.golang.org/api/storage/v1"
+)
+
+// gcsChunkRetryTime is how long a chunk is retried for each retry in
+// TransferOptions, the client backs off exponentially instead of counting.
+const gcsChunkRetryTime = 30 * time.Second
+
+type gcsBackend struct {
+	service *gs.Service
+}
+
+// NewGCSBackend returns a backend for Google Cloud Storage, using client
+// for authentication. Modifications are made only if the objects haven't
+// changed since being fetched.
+func NewGCSBackend(client *http.Client) (Backend, error) {
+	service, err := gs.New(client)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsBackend{service: service}, nil
+}
+
+func (g *gcsBackend) Service() string {
+	return "gs"
+}
+
+func (g *gcsBackend) List(ctx context.Context, bucket, prefix string, recursive bool, fn func([]*gs.Object, []string) error) error {
+	req := g.service.Objects.List(bucket)
+	if prefix != "" {
+		req.Prefix(prefix)
+	}
+	if !recursive {
+		req.Delimiter("/")
+	}
+	return req.Pages(ctx, func(objs *gs.Objects) error {
+		return fn(objs.Items, objs.Prefixes)
+	})
+}
+
+func (g *gcsBackend) Stat(ctx context.Context, bucket, name string) (*gs.Object, error) {
+	req := g.service.Objects.Get(bucket, name)
+	req.Context(ctx)
+	obj, err := req.Do()
+	if e, ok := err.(*googleapi.Error); ok && e.Code == http.StatusNotFound {
+		return nil, nil
+	}
+	return obj, err
+}
+
+func (g *gcsBackend) Open(ctx context.Context, bucket, name string, offset, length int64) (io.ReadCloser, error) {
+	req := g.service.Objects.Get(bucket, name)
+	req.Context(ctx)
+	// Read objects as stored rather than decompressing them, ranges
+	// and hashes refer to the stored data.
+	req.Header().Set("Accept-Encoding", "gzip")
+	if length > 0 {
+		req.Header().Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if length < 0 && offset > 0 {
+		req.Header().Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := req.Download()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (g *gcsBackend) Upload(ctx context.Context, bucket string, obj *gs.Object, media io.ReaderAt, old *gs.Object, opts TransferOptions) (*gs.Object, error) {
+	// GCS rejects uploads not matching the hashes in obj. Objects are
+	// sent in chunks one after another, resuming the upload after
+	// errors, so opts.Concurrency doesn't apply.
+	req := g.service.Objects.Insert(bucket, obj)
+	req.Context(ctx)
+	req.Media(io.NewSectionReader(media, 0, int64(obj.Size)),
+		googleapi.ChunkSize(int(opts.ChunkSize)),
+		googleapi.ChunkRetryDeadline(time.Duration(opts.Retries)*gcsChunkRetryTime))
+	req.WithRetry(nil, nil)
+
+	// Watch out for unexpected conflicting updates.
+	if old != nil {
+		req.IfGenerationMatch(old.Generation)
+	}
+
+	return req.Do()
+}
+
+func (g *gcsBackend) Copy(ctx context.Context, src, dst, old *gs.Object) (*gs.Object, error) {
+	// It does work to pass src directly to the Rewrite API call, the
+	// name and bucket values don't really matter, they just cannot be
+	// blank for whatever reason. We make a copy just to get consistent
+	// results, e.g. always use the destination bucket's default ACL.
+	req := g.service.Objects.Rewrite(
+		src.Bucket, src.Name, dst.Bucket, dst.Name, src)
+	req.Context(ctx)
+
+	// Watch out for unexpected conflicting updates.
+	if old != nil {
+		req.IfGenerationMatch(old.Generation)
+	}
+	if src.Generation != 0 {
+		req.IfSourceGenerationMatch(src.Generation)
+	}
+
+	for {
+		resp, err := req.Do()
+		if err != nil {
+			return nil, err
+		}
+		if resp.Done {
+			return resp.Resource, nil
+		}
+		req.RewriteToken(resp.RewriteToken)
+	}
+}
+
+func (g *gcsBackend) Delete(ctx context.Context, bucket, name string, old *gs.Object) error {
+	req := g.service.Objects.Delete(bucket, name)
+	req.Context(ctx)
+
+	// Watch out for unexpected conflicting updates.
+	if old != nil {
+		req.IfGenerationMatch(old.Generation)
+		req.IfMetagenerationMatch(old.Metageneration)
+	}
+
+	return req.Do()
+}
@@ -0,0 +1,59 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+	gs "google.golang.org/api/storage/v1"
+
+	"github.com/flatcar/mantle/storage"
+)
+
+func TestIndexJobLocal(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	bkt, err := storage.NewBucket(nil, "file://"+dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"amd64-usr/current/version.txt", "amd64-usr/1.2.3/version.txt"} {
+		obj := gs.Object{Name: name}
+		if err := bkt.Upload(ctx, &obj, strings.NewReader(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bkt.Fetch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	job := NewIndexJob(bkt)
+	job.IndexHTML(true)
+	job.Name("mirror")
+	if err := job.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for page, links := range map[string][]string{
+		"index.html":                   {`href="amd64-usr/"`},
+		"amd64-usr/index.html":         {`href="1.2.3/"`, `href="current/"`},
+		"amd64-usr/current/index.html": {`href="version.txt"`},
+		"amd64-usr/1.2.3/index.html":   {`href="version.txt"`},
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, page))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		for _, link := range links {
+			if !strings.Contains(string(data), link) {
+				t.Errorf("%s doesn't link %s:\n%s", page, link, data)
+			}
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	gs "google.golang.org/api/storage/v1"
+)
+
+type localBackend struct{}
+
+// NewLocalBackend returns a backend storing objects as files. Buckets are
+// directories and object names are paths relative to them, so names
+// ending in a slash can't be stored and an object can't be named like the
+// prefix of another. Only the contents of objects are kept, their CRC32c
+// and MD5 hashes are computed when listing.
+func NewLocalBackend() Backend {
+	return localBackend{}
+}
+
+func (localBackend) Service() string {
+	return "file"
+}
+
+func localPath(bucket, name string) (string, error) {
+	if name == "" || strings.HasSuffix(name, "/") {
+		return "", fmt.Errorf("object name %q is not a file name", name)
+	}
+	return filepath.Join(bucket, filepath.FromSlash(name)), nil
+}
+
+// localObject returns the object of the file at path.
+func localObject(bucket, name, path string) (*gs.Object, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	obj := &gs.Object{
+		Bucket:  bucket,
+		Name:    name,
+		Updated: info.ModTime().UTC().Format(time.RFC3339),
+	}
+	if err := crcSum(obj, f); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (localBackend) List(ctx context.Context, bucket, prefix string, recursive bool, fn func([]*gs.Object, []string) error) error {
+	// walk the deepest directory containing all names with the prefix
+	dir := NextPrefix(prefix)
+	if strings.HasSuffix(prefix, "/") {
+		dir = prefix
+	}
+
+	var objs []*gs.Object
+	var prefixes []string
+	err := filepath.WalkDir(filepath.Join(bucket, filepath.FromSlash(dir)), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(bucket, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if d.IsDir() {
+			name += "/"
+		}
+		if !strings.HasPrefix(name, prefix) {
+			if d.IsDir() && !strings.HasPrefix(prefix, name) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if !recursive && name != prefix {
+				prefixes = append(prefixes, name)
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		obj, err := localObject(bucket, name, path)
+		if err != nil {
+			return err
+		}
+		objs = append(objs, obj)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return fn(objs, prefixes)
+}
+
+func (localBackend) Stat(ctx context.Context, bucket, name string) (*gs.Object, error) {
+	path, err := localPath(bucket, name)
+	if err != nil {
+		return nil, nil
+	}
+	// directories only exist as prefixes
+	if info, err := os.Stat(path); os.IsNotExist(err) || err == nil && info.IsDir() {
+		return nil, nil
+	}
+	return localObject(bucket, name, path)
+}
+
+func (localBackend) Open(ctx context.Context, bucket, name string, offset, length int64) (io.ReadCloser, error) {
+	path, err := localPath(bucket, name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		length = math.MaxInt64 - offset
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, offset, length), f}, nil
+}
+
+// write atomically replaces the file of an object with the contents of r.
+func (localBackend) write(bucket, name string, r io.Reader) error {
+	path, err := localPath(bucket, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (l localBackend) Upload(ctx context.Context, bucket string, obj *gs.Object, media io.ReaderAt, old *gs.Object, opts TransferOptions) (*gs.Object, error) {
+	if err := l.write(bucket, obj.Name, io.NewSectionReader(media, 0, int64(obj.Size))); err != nil {
+		return nil, err
+	}
+	path, err := localPath(bucket, obj.Name)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := localObject(bucket, obj.Name, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// the hashes of the file are checked by Bucket.Upload
+	written := dupObj(obj)
+	written.Bucket = bucket
+	written.Size = stored.Size
+	written.Crc32c = stored.Crc32c
+	written.Md5Hash = stored.Md5Hash
+	written.Updated = stored.Updated
+	return written, nil
+}
+
+func (l localBackend) Copy(ctx context.Context, src, dst, old *gs.Object) (*gs.Object, error) {
+	r, err := l.Open(ctx, src.Bucket, src.Name, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if err := l.write(dst.Bucket, dst.Name, r); err != nil {
+		return nil, err
+	}
+	written := dupObj(dst)
+	written.Updated = time.Now().UTC().Format(time.RFC3339)
+	return written, nil
+}
+
+func (localBackend) Delete(ctx context.Context, bucket, name string, old *gs.Object) error {
+	path, err := localPath(bucket, name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	// Directories only exist as prefixes of objects.
+	for dir := filepath.Dir(path); dir != filepath.Clean(bucket); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
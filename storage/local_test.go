@@ -0,0 +1,161 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	gs "google.golang.org/api/storage/v1"
+)
+
+func localBucket(t *testing.T, dir string) *Bucket {
+	bkt, err := NewBucket(nil, "file://"+dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bkt
+}
+
+func upload(t *testing.T, bkt *Bucket, name, data string) {
+	obj := gs.Object{Name: name, ContentType: "text/plain"}
+	if err := bkt.Upload(context.Background(), &obj, strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func objectNames(bkt *Bucket) string {
+	var names []string
+	for _, obj := range bkt.Objects() {
+		names = append(names, obj.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+func TestLocalBucket(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	bkt := localBucket(t, dir)
+	upload(t, bkt, "index.html", testPage)
+	upload(t, bkt, "a/b/c", "c")
+	upload(t, bkt, "a/d", "d")
+
+	if data, err := os.ReadFile(filepath.Join(dir, "a/b/c")); err != nil || string(data) != "c" {
+		t.Fatalf("reading uploaded object: %q, %v", data, err)
+	}
+
+	fetched := localBucket(t, dir)
+	if err := fetched.Fetch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if names := objectNames(fetched); names != "a/b/c a/d index.html" {
+		t.Errorf("fetched %q", names)
+	}
+	obj := fetched.Object("index.html")
+	if obj == nil || obj.Crc32c != testPageCRC || obj.Md5Hash != testPageMD5 || obj.Size != testPageSize {
+		t.Errorf("unexpected object %#v", obj)
+	}
+
+	shallow := localBucket(t, dir)
+	if err := shallow.FetchPrefix(ctx, "a", false); err != nil {
+		t.Fatal(err)
+	}
+	if names := objectNames(shallow); names != "a/d" {
+		t.Errorf("fetched %q without recursion", names)
+	}
+	prefixes := shallow.Prefixes()
+	sort.Strings(prefixes)
+	if strings.Join(prefixes, " ") != " a/ a/b/" {
+		t.Errorf("unexpected prefixes %q", prefixes)
+	}
+
+	if err := fetched.Delete(ctx, "a/b/c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a/b")); !os.IsNotExist(err) {
+		t.Errorf("empty directory not removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a/d")); err != nil {
+		t.Error(err)
+	}
+}
+
+// otherService is a local backend which claims to be another service, so
+// objects are downloaded when copying.
+type otherService struct {
+	Backend
+}
+
+func (otherService) Service() string {
+	return "other"
+}
+
+func TestSyncLocal(t *testing.T) {
+	for _, other := range []bool{false, true} {
+		ctx := context.Background()
+		src := localBucket(t, t.TempDir())
+		upload(t, src, "keep", "keep")
+		upload(t, src, "new", "new")
+		upload(t, src, "sub/skip", "skip")
+
+		dstDir := t.TempDir()
+		dst := localBucket(t, dstDir)
+		if other {
+			var err error
+			dst, err = NewBucketWithBackend(otherService{NewLocalBackend()}, "file://"+dstDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		upload(t, dst, "keep", "keep")
+		upload(t, dst, "old", "old")
+		upload(t, dst, "sub/protected", "protected")
+		// detect whether up-to-date objects are written
+		past := time.Now().Add(-time.Hour).Truncate(time.Second)
+		if err := os.Chtimes(filepath.Join(dstDir, "keep"), past, past); err != nil {
+			t.Fatal(err)
+		}
+
+		// fetch again so objects compare as in a real sync
+		src = localBucket(t, src.Name())
+		if err := src.Fetch(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := dst.Fetch(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		job := SyncJob{Source: src, Destination: dst}
+		job.SourceFilter(func(obj *gs.Object) bool {
+			return obj.Name != "sub/skip"
+		})
+		job.DeleteFilter(func(obj *gs.Object) bool {
+			return !strings.HasPrefix(obj.Name, "sub/")
+		})
+		job.Delete(true)
+		if err := job.Do(ctx); err != nil {
+			t.Fatalf("other service %v: %v", other, err)
+		}
+		if names := objectNames(dst); names != "keep new sub/protected" {
+			t.Errorf("other service %v: synced %q", other, names)
+		}
+		for name, data := range map[string]string{"new": "new", "keep": "keep"} {
+			if got, err := os.ReadFile(filepath.Join(dstDir, name)); err != nil || string(got) != data {
+				t.Errorf("other service %v: %s is %q, %v", other, name, got, err)
+			}
+		}
+		if info, err := os.Stat(filepath.Join(dstDir, "keep")); err != nil || !info.ModTime().Equal(past) {
+			t.Errorf("other service %v: up-to-date object written", other)
+		}
+		if _, err := os.Stat(filepath.Join(dstDir, "old")); !os.IsNotExist(err) {
+			t.Errorf("other service %v: old not deleted: %v", other, err)
+		}
+	}
+}
@@ -15,6 +15,7 @@
 package storage
 
 import (
+	"crypto/md5"
 	"encoding/base64"
 	"hash/crc32"
 	"io"
@@ -33,28 +34,34 @@ func SortObjects(objs []*storage.Object) {
 	})
 }
 
-// Update CRC32c and Size in the given Object
+// Update CRC32c, MD5 and Size in the given Object
 func crcSum(obj *storage.Object, media io.ReaderAt) error {
 	c := crc32.New(crc32.MakeTable(crc32.Castagnoli))
-	n, err := io.Copy(c, reader.AtReader(media))
+	m := md5.New()
+	n, err := io.Copy(io.MultiWriter(c, m), reader.AtReader(media))
 	if err != nil {
 		return err
 	}
 	obj.Size = uint64(n)
 	obj.Crc32c = base64.StdEncoding.EncodeToString(c.Sum(nil))
+	obj.Md5Hash = base64.StdEncoding.EncodeToString(m.Sum(nil))
 	return nil
 }
 
-// Judges whether two Objects are equal based on size and CRC. To guard against
-// uninitialized fields, nil objects and empty CRC values are never equal.
+// Judges whether two Objects are equal based on size and CRC, or MD5 if one
+// lacks a CRC as S3 objects do. To guard against uninitialized fields, nil
+// objects and empty hashes are never equal.
 func crcEq(a, b *storage.Object) bool {
-	if a == nil || b == nil {
+	if a == nil || b == nil || a.Size != b.Size {
 		return false
 	}
-	if a.Crc32c == "" || b.Crc32c == "" {
-		return false
+	if a.Crc32c != "" && b.Crc32c != "" {
+		return a.Crc32c == b.Crc32c
+	}
+	if a.Md5Hash != "" && b.Md5Hash != "" {
+		return a.Md5Hash == b.Md5Hash
 	}
-	return a.Size == b.Size && a.Crc32c == b.Crc32c
+	return false
 }
 
 // Duplicate basic Object metadata, useful for preparing a copy operation.
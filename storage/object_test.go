@@ -53,6 +53,9 @@ func TestCRCSum(t *testing.T) {
 	if obj.Crc32c != testPageCRC {
 		t.Errorf("Bad CRC32c: %q != %q", obj.Crc32c, testPageCRC)
 	}
+	if obj.Md5Hash != testPageMD5 {
+		t.Errorf("Bad Md5Hash: %q != %q", obj.Md5Hash, testPageMD5)
+	}
 	if obj.Size != testPageSize {
 		t.Errorf("Bad Size: %d != %d", obj.Size, testPageSize)
 	}
@@ -78,6 +81,13 @@ func TestCRCEq(t *testing.T) {
 	if !crcEq(&obj, &obj) {
 		t.Errorf("%#v not equal to itself", obj)
 	}
+	md5Obj := storage.Object{Md5Hash: testPageMD5, Size: testPageSize}
+	if !crcEq(&storage.Object{Crc32c: testPageCRC, Md5Hash: testPageMD5, Size: testPageSize}, &md5Obj) {
+		t.Errorf("%#v not equal by MD5", md5Obj)
+	}
+	if crcEq(&obj, &md5Obj) {
+		t.Errorf("%#v equal to %#v without common hash", obj, md5Obj)
+	}
 }
 
 func TestCRCSumAndEq(t *testing.T) {
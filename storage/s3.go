@@ -0,0 +1,431 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"golang.org/x/net/context"
+	gs "google.golang.org/api/storage/v1"
+)
+
+// Hashes are kept in the user metadata under these keys, as the ETag of
+// objects uploaded in parts or encrypted with KMS or customer provided
+// keys isn't the MD5 hash of their contents.
+const (
+	s3Crc32cKey = "crc32c"
+	s3Md5Key    = "md5"
+)
+
+// s3MaxCopySize is the largest object or part a single copy request can
+// copy.
+const s3MaxCopySize = 5 << 30
+
+type s3Backend struct {
+	client   *s3.S3
+	uploader *s3manager.Uploader
+
+	// larger objects are copied in parts of this size
+	copyPartSize int64
+}
+
+// NewS3Backend returns a backend for S3 and compatible services like
+// MinIO, using the session's configuration. The hashes of whole objects
+// are stored in their metadata, uploads are checked against the ETag S3
+// computes from the parts it received.
+func NewS3Backend(sess *session.Session) Backend {
+	client := s3.New(sess)
+	return &s3Backend{
+		client:       client,
+		uploader:     s3manager.NewUploaderWithClient(client),
+		copyPartSize: s3MaxCopySize,
+	}
+}
+
+// NewS3BackendFromEnv returns a backend for S3 configured like the AWS
+// CLI, by the environment and the shared configuration files. The
+// endpoint of S3-compatible services is read from $AWS_ENDPOINT_URL_S3 or
+// $AWS_ENDPOINT_URL, with path style addressing for MinIO.
+func NewS3BackendFromEnv() (Backend, error) {
+	var cfg aws.Config
+	for _, env := range []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"} {
+		if endpoint := os.Getenv(env); endpoint != "" {
+			cfg.Endpoint = aws.String(endpoint)
+			cfg.S3ForcePathStyle = aws.Bool(true)
+			break
+		}
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            cfg,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewS3Backend(sess), nil
+}
+
+func (s *s3Backend) Service() string {
+	return "s3:" + s.client.Endpoint
+}
+
+// md5FromETag returns the MD5 hash in an ETag in the form of Md5Hash,
+// empty if the object was uploaded in parts. Only use it for ETags
+// s3ETagIsMD5 holds for.
+func md5FromETag(etag *string) string {
+	sum, err := hex.DecodeString(strings.Trim(aws.StringValue(etag), `"`))
+	if err != nil || len(sum) != 16 {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(sum)
+}
+
+func s3IsNotFound(err error) bool {
+	if e, ok := err.(awserr.Error); ok {
+		return e.Code() == s3.ErrCodeNoSuchKey || e.Code() == "NotFound"
+	}
+	return false
+}
+
+func (s *s3Backend) List(ctx context.Context, bucket, prefix string, recursive bool, fn func([]*gs.Object, []string) error) error {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}
+	if !recursive {
+		input.Delimiter = aws.String("/")
+	}
+
+	var fnErr error
+	err := s.client.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, last bool) bool {
+		objs := make([]*gs.Object, 0, len(page.Contents))
+		for _, o := range page.Contents {
+			// The hashes are in the metadata and listings
+			// don't tell whether the ETag is an MD5 hash.
+			obj, err := s.Stat(ctx, bucket, aws.StringValue(o.Key))
+			if err != nil {
+				fnErr = err
+				return false
+			} else if obj == nil {
+				continue // deleted meanwhile
+			}
+			objs = append(objs, obj)
+		}
+		var prefixes []string
+		for _, p := range page.CommonPrefixes {
+			prefixes = append(prefixes, aws.StringValue(p.Prefix))
+		}
+		fnErr = fn(objs, prefixes)
+		return fnErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
+
+func (s *s3Backend) Stat(ctx context.Context, bucket, name string) (*gs.Object, error) {
+	out, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	})
+	if s3IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return s3Object(bucket, name, out), nil
+}
+
+func s3Object(bucket, name string, out *s3.HeadObjectOutput) *gs.Object {
+	obj := &gs.Object{
+		Bucket:             bucket,
+		Name:               name,
+		Size:               uint64(aws.Int64Value(out.ContentLength)),
+		Etag:               aws.StringValue(out.ETag),
+		Updated:            aws.TimeValue(out.LastModified).UTC().Format(time.RFC3339),
+		CacheControl:       aws.StringValue(out.CacheControl),
+		ContentDisposition: aws.StringValue(out.ContentDisposition),
+		ContentEncoding:    aws.StringValue(out.ContentEncoding),
+		ContentLanguage:    aws.StringValue(out.ContentLanguage),
+		ContentType:        aws.StringValue(out.ContentType),
+	}
+
+	// S3 capitalizes metadata keys.
+	for k, v := range out.Metadata {
+		switch strings.ToLower(k) {
+		case s3Crc32cKey:
+			obj.Crc32c = aws.StringValue(v)
+		case s3Md5Key:
+			obj.Md5Hash = aws.StringValue(v)
+		default:
+			if obj.Metadata == nil {
+				obj.Metadata = make(map[string]string)
+			}
+			obj.Metadata[k] = aws.StringValue(v)
+		}
+	}
+	if obj.Md5Hash == "" && s3ETagIsMD5(out) {
+		obj.Md5Hash = md5FromETag(out.ETag)
+	}
+	return obj
+}
+
+func (s *s3Backend) Open(ctx context.Context, bucket, name string, offset, length int64) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	}
+	if length > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if length < 0 && offset > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
+	out, err := s.client.GetObjectWithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// s3String returns nil for empty strings, which S3 rejects as header
+// values.
+func s3String(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+// s3Metadata returns the user metadata of obj, including its hashes.
+func s3Metadata(obj *gs.Object) map[string]*string {
+	metadata := aws.StringMap(obj.Metadata)
+	if metadata == nil {
+		metadata = make(map[string]*string)
+	}
+	if obj.Crc32c != "" {
+		metadata[s3Crc32cKey] = aws.String(obj.Crc32c)
+	}
+	if obj.Md5Hash != "" {
+		metadata[s3Md5Key] = aws.String(obj.Md5Hash)
+	}
+	return metadata
+}
+
+func (s *s3Backend) Upload(ctx context.Context, bucket string, obj *gs.Object, media io.ReaderAt, old *gs.Object, opts TransferOptions) (*gs.Object, error) {
+	out, err := s.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:             aws.String(bucket),
+		Key:                aws.String(obj.Name),
+		Body:               io.NewSectionReader(media, 0, int64(obj.Size)),
+		CacheControl:       s3String(obj.CacheControl),
+		ContentDisposition: s3String(obj.ContentDisposition),
+		ContentEncoding:    s3String(obj.ContentEncoding),
+		ContentLanguage:    s3String(obj.ContentLanguage),
+		ContentType:        s3String(obj.ContentType),
+		Metadata:           s3Metadata(obj),
+	}, func(u *s3manager.Uploader) {
+		u.PartSize = max(opts.ChunkSize, s3manager.MinUploadPartSize)
+		u.Concurrency = max(opts.Concurrency, 1)
+		u.RequestOptions = append(u.RequestOptions, func(r *request.Request) {
+			r.Retryer = client.DefaultRetryer{NumMaxRetries: opts.Retries}
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The hashes in the metadata are only what was sent, so the ETag
+	// S3 computed from the parts it received is checked as well.
+	head, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(obj.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	written := s3Object(bucket, obj.Name, head)
+	if strings.Trim(written.Etag, `"`) != strings.Trim(aws.StringValue(out.ETag), `"`) {
+		return nil, fmt.Errorf("object replaced during upload")
+	}
+	if !s3ETagIsMD5(head) {
+		return written, nil
+	}
+	etag, err := s.expectedETag(ctx, bucket, written, media)
+	if err != nil {
+		return nil, err
+	}
+	if written.Etag != etag {
+		return nil, ChecksumMismatch
+	}
+	return written, nil
+}
+
+// s3ETagIsMD5 reports whether the ETag is derived from MD5 hashes of the
+// contents, which isn't the case for objects encrypted with KMS or
+// customer provided keys.
+func s3ETagIsMD5(out *s3.HeadObjectOutput) bool {
+	if out.SSECustomerAlgorithm != nil {
+		return false
+	}
+	switch aws.StringValue(out.ServerSideEncryption) {
+	case s3.ServerSideEncryptionAwsKms, s3.ServerSideEncryptionAwsKmsDsse:
+		return false
+	}
+	return true
+}
+
+// expectedETag returns the ETag of obj if media was stored intact. The
+// ETag of an object uploaded in N parts is the MD5 hash of the MD5 hashes
+// of the parts, followed by -N. The part size is that of the first part.
+func (s *s3Backend) expectedETag(ctx context.Context, bucket string, obj *gs.Object, media io.ReaderAt) (string, error) {
+	size := int64(obj.Size)
+	_, count, multipart := strings.Cut(strings.Trim(obj.Etag, `"`), "-")
+	if !multipart {
+		sum := md5.New()
+		if _, err := io.Copy(sum, io.NewSectionReader(media, 0, size)); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%q", hex.EncodeToString(sum.Sum(nil))), nil
+	}
+
+	part, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(obj.Name),
+		PartNumber: aws.Int64(1),
+	})
+	if err != nil {
+		return "", err
+	}
+	partSize := aws.Int64Value(part.ContentLength)
+	if partSize <= 0 {
+		return "", fmt.Errorf("invalid size %d of the first part", partSize)
+	}
+
+	sums := md5.New()
+	var parts int
+	for offset := int64(0); offset < size; offset += partSize {
+		sum := md5.New()
+		if _, err := io.Copy(sum, io.NewSectionReader(media, offset, min(partSize, size-offset))); err != nil {
+			return "", err
+		}
+		sums.Write(sum.Sum(nil))
+		parts++
+	}
+	if strconv.Itoa(parts) != count {
+		return "", ChecksumMismatch
+	}
+	return fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sums.Sum(nil)), parts), nil
+}
+
+func (s *s3Backend) Copy(ctx context.Context, src, dst, old *gs.Object) (*gs.Object, error) {
+	source := url.URL{Path: src.Bucket + "/" + src.Name}
+	if int64(src.Size) > s.copyPartSize {
+		return s.copyParts(ctx, source.EscapedPath(), src, dst)
+	}
+	out, err := s.client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(dst.Bucket),
+		Key:        aws.String(dst.Name),
+		CopySource: aws.String(source.EscapedPath()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The copy has the contents and so the hashes of src.
+	written := dupObj(dst)
+	if out.CopyObjectResult != nil {
+		written.Etag = aws.StringValue(out.CopyObjectResult.ETag)
+	}
+	return written, nil
+}
+
+// copyParts copies objects too large for a single CopyObject request in
+// a multipart upload. Unlike CopyObject it doesn't take the metadata of
+// the source, so that of dst is set.
+func (s *s3Backend) copyParts(ctx context.Context, source string, src, dst *gs.Object) (*gs.Object, error) {
+	upload, err := s.client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(dst.Bucket),
+		Key:                aws.String(dst.Name),
+		CacheControl:       s3String(dst.CacheControl),
+		ContentDisposition: s3String(dst.ContentDisposition),
+		ContentEncoding:    s3String(dst.ContentEncoding),
+		ContentLanguage:    s3String(dst.ContentLanguage),
+		ContentType:        s3String(dst.ContentType),
+		Metadata:           s3Metadata(dst),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := s.copyPartsOf(ctx, source, int64(src.Size), dst, upload.UploadId)
+	if err != nil {
+		// the parts copied so far are billed until aborted
+		if _, abortErr := s.client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(dst.Bucket),
+			Key:      aws.String(dst.Name),
+			UploadId: upload.UploadId,
+		}); abortErr != nil {
+			plog.Warningf("Aborting the copy to %s failed: %v", dst.Name, abortErr)
+		}
+		return nil, err
+	}
+
+	written := dupObj(dst)
+	written.Etag = aws.StringValue(out.ETag)
+	return written, nil
+}
+
+func (s *s3Backend) copyPartsOf(ctx context.Context, source string, size int64, dst *gs.Object, uploadID *string) (*s3.CompleteMultipartUploadOutput, error) {
+	var parts []*s3.CompletedPart
+	for offset := int64(0); offset < size; offset += s.copyPartSize {
+		number := aws.Int64(int64(len(parts) + 1))
+		last := min(offset+s.copyPartSize, size) - 1
+		out, err := s.client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(dst.Bucket),
+			Key:             aws.String(dst.Name),
+			CopySource:      aws.String(source),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, last)),
+			PartNumber:      number,
+			UploadId:        uploadID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		part := &s3.CompletedPart{PartNumber: number}
+		if out.CopyPartResult != nil {
+			part.ETag = out.CopyPartResult.ETag
+		}
+		parts = append(parts, part)
+	}
+	return s.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(dst.Bucket),
+		Key:             aws.String(dst.Name),
+		UploadId:        uploadID,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+}
+
+func (s *s3Backend) Delete(ctx context.Context, bucket, name string, old *gs.Object) error {
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	})
+	return err
+}
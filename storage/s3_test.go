@@ -0,0 +1,318 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"golang.org/x/net/context"
+	gs "google.golang.org/api/storage/v1"
+)
+
+type s3TestObject struct {
+	parts    [][]byte
+	etag     string
+	metadata http.Header
+}
+
+// s3TestServer implements the requests of uploads, copies, listings and
+// HEAD. If corrupt is set, the first byte of the data received is flipped.
+type s3TestServer struct {
+	mu      sync.Mutex
+	corrupt bool
+	objects map[string]*s3TestObject
+	uploads map[string]*s3TestUpload
+}
+
+// s3TestUpload is a multipart upload in progress.
+type s3TestUpload struct {
+	parts    map[int][]byte
+	metadata http.Header
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *s3TestServer) receive(r *http.Request) ([]byte, error) {
+	data, err := io.ReadAll(r.Body)
+	if err == nil && s.corrupt && len(data) != 0 {
+		data[0] ^= 0xff
+	}
+	return data, err
+}
+
+func (s *s3TestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := r.URL.Path
+	query := r.URL.Query()
+	source := r.Header.Get("X-Amz-Copy-Source")
+	switch {
+	case r.Method == http.MethodPut && source != "" && query.Has("uploadId"):
+		src := s.objects["/"+source]
+		if src == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var first, last int
+		fmt.Sscanf(r.Header.Get("X-Amz-Copy-Source-Range"), "bytes=%d-%d", &first, &last)
+		data := bytes.Join(src.parts, nil)
+		if first > last || last >= len(data) {
+			http.Error(w, "invalid range", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		data = data[first : last+1]
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		s.uploads[query.Get("uploadId")].parts[n] = data
+		fmt.Fprintf(w, "<CopyPartResult><ETag>%s</ETag></CopyPartResult>", xmlEscape(strconv.Quote(md5Hex(data))))
+	case r.Method == http.MethodPut && source != "":
+		src := s.objects["/"+source]
+		if src == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		obj := *src
+		s.objects[key] = &obj
+		fmt.Fprintf(w, "<CopyObjectResult><ETag>%s</ETag></CopyObjectResult>", xmlEscape(obj.etag))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := strconv.Itoa(len(s.uploads))
+		s.uploads[id] = &s3TestUpload{parts: make(map[int][]byte), metadata: r.Header}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		data, err := s.receive(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		s.uploads[query.Get("uploadId")].parts[n] = data
+		w.Header().Set("ETag", strconv.Quote(md5Hex(data)))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		upload := s.uploads[query.Get("uploadId")]
+		parts := upload.parts
+		numbers := make([]int, 0, len(parts))
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		obj := &s3TestObject{metadata: upload.metadata}
+		var sums []byte
+		for _, n := range numbers {
+			sum := md5.Sum(parts[n])
+			sums = append(sums, sum[:]...)
+			obj.parts = append(obj.parts, parts[n])
+		}
+		obj.etag = strconv.Quote(fmt.Sprintf("%s-%d", md5Hex(sums), len(numbers)))
+		s.objects[key] = obj
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><ETag>%s</ETag></CompleteMultipartUploadResult>", xmlEscape(obj.etag))
+	case r.Method == http.MethodPut:
+		data, err := s.receive(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		obj := &s3TestObject{parts: [][]byte{data}, etag: strconv.Quote(md5Hex(data)), metadata: r.Header}
+		s.objects[key] = obj
+		w.Header().Set("ETag", obj.etag)
+	case r.Method == http.MethodHead:
+		obj := s.objects[key]
+		if obj == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		size := 0
+		for _, part := range obj.parts {
+			size += len(part)
+		}
+		if query.Has("partNumber") {
+			n, _ := strconv.Atoi(query.Get("partNumber"))
+			size = len(obj.parts[n-1])
+		}
+		for k, v := range obj.metadata {
+			if k := strings.ToLower(k); strings.HasPrefix(k, "x-amz-meta-") || strings.HasPrefix(k, "x-amz-server-side-encryption") {
+				w.Header()[k] = v
+			}
+		}
+		w.Header().Set("ETag", obj.etag)
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+	case r.Method == http.MethodGet && query.Get("list-type") == "2":
+		prefix := key + "/" + query.Get("prefix")
+		keys := make([]string, 0, len(s.objects))
+		for k := range s.objects {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		fmt.Fprint(w, "<ListBucketResult>")
+		for _, k := range keys {
+			fmt.Fprintf(w, "<Contents><Key>%s</Key><ETag>%s</ETag></Contents>", xmlEscape(strings.TrimPrefix(k, key+"/")), xmlEscape(s.objects[k].etag))
+		}
+		fmt.Fprint(w, "</ListBucketResult>")
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func s3TestBucket(t *testing.T, srv *s3TestServer) *Bucket {
+	server := httptest.NewServer(srv)
+	t.Cleanup(server.Close)
+	sess, err := session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bkt, err := NewBucketWithBackend(NewS3Backend(sess), "s3://bucket/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bkt.ChunkSize(s3manager.MinUploadPartSize)
+	return bkt
+}
+
+func TestS3Upload(t *testing.T) {
+	large := bytes.Repeat([]byte(testPage), int(2*s3manager.MinUploadPartSize)/len(testPage)+1)
+	for _, tt := range []struct {
+		name    string
+		data    []byte
+		corrupt bool
+	}{
+		{"single", []byte(testPage), false},
+		{"single-corrupt", []byte(testPage), true},
+		{"multipart", large, false},
+		{"multipart-corrupt", large, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &s3TestServer{
+				corrupt: tt.corrupt,
+				objects: make(map[string]*s3TestObject),
+				uploads: make(map[string]*s3TestUpload),
+			}
+			bkt := s3TestBucket(t, srv)
+			obj := gs.Object{Name: "obj"}
+			err := bkt.Upload(context.Background(), &obj, bytes.NewReader(tt.data))
+			if tt.corrupt {
+				if !errors.Is(err, ChecksumMismatch) {
+					t.Errorf("expected a checksum mismatch, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored := bkt.Object("obj"); stored == nil || stored.Size != uint64(len(tt.data)) || stored.Crc32c == "" {
+				t.Errorf("unexpected object %+v", stored)
+			}
+		})
+	}
+}
+
+func TestS3ListMd5(t *testing.T) {
+	data := []byte(testPage)
+	sum := md5.Sum(data)
+	md5Hash := base64.StdEncoding.EncodeToString(sum[:])
+	// the ETag of encrypted objects looks like an MD5 hash but isn't
+	fakeETag := strconv.Quote(strings.Repeat("ab", 16))
+	kms := http.Header{"X-Amz-Server-Side-Encryption": {"aws:kms"}}
+	srv := &s3TestServer{
+		objects: map[string]*s3TestObject{
+			"/bucket/plain": {parts: [][]byte{data}, etag: strconv.Quote(md5Hex(data))},
+			"/bucket/kms":   {parts: [][]byte{data}, etag: fakeETag, metadata: kms},
+			"/bucket/kms-md5": {parts: [][]byte{data}, etag: fakeETag, metadata: http.Header{
+				"X-Amz-Server-Side-Encryption": {"aws:kms"},
+				"X-Amz-Meta-Md5":               {md5Hash},
+			}},
+		},
+		uploads: make(map[string]*s3TestUpload),
+	}
+	bkt := s3TestBucket(t, srv)
+	if err := bkt.Fetch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for name, expect := range map[string]string{
+		"plain":   md5Hash,
+		"kms":     "",
+		"kms-md5": md5Hash,
+	} {
+		obj := bkt.Object(name)
+		if obj == nil {
+			t.Errorf("%s not listed", name)
+		} else if obj.Md5Hash != expect {
+			t.Errorf("%s: expected MD5 %q, got %q", name, expect, obj.Md5Hash)
+		}
+	}
+}
+
+func TestS3Copy(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		partSize int64
+		etag     string
+	}{
+		{"single", s3MaxCopySize, strconv.Quote(md5Hex([]byte(testPage)))},
+		{"multipart", 30, fmt.Sprintf(`-%d"`, (len(testPage)+29)/30)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &s3TestServer{
+				objects: make(map[string]*s3TestObject),
+				uploads: make(map[string]*s3TestUpload),
+			}
+			bkt := s3TestBucket(t, srv)
+			bkt.backend.(*s3Backend).copyPartSize = tt.partSize
+			src := gs.Object{Name: "src"}
+			if err := bkt.Upload(context.Background(), &src, strings.NewReader(testPage)); err != nil {
+				t.Fatal(err)
+			}
+			uploaded := bkt.Object("src")
+			if err := bkt.Copy(context.Background(), uploaded, "dst"); err != nil {
+				t.Fatal(err)
+			}
+			if copied := bkt.Object("dst"); copied == nil || !strings.HasSuffix(copied.Etag, tt.etag) {
+				t.Errorf("unexpected copy %+v", copied)
+			}
+			if data := bytes.Join(srv.objects["/bucket/dst"].parts, nil); string(data) != testPage {
+				t.Errorf("copied %q", data)
+			}
+
+			// the hashes are in the metadata of the copy
+			if err := bkt.Fetch(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if stored := bkt.Object("dst"); stored == nil || stored.Crc32c != uploaded.Crc32c || stored.Md5Hash != uploaded.Md5Hash {
+				t.Errorf("unexpected hashes of %+v", stored)
+			}
+		})
+	}
+}
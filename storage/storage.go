@@ -12,7 +12,8 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// storage provides a high level interface for Google Cloud Storage
+// storage provides a high level interface for Google Cloud Storage, S3
+// and local directories
 package storage
 
 import (
@@ -111,7 +111,7 @@ func (sj *SyncJob) Do(ctx context.Context) error {
 		name := sj.newName(srcObj)
 
 		worker := func(c context.Context) error {
-			return sj.Destination.Copy(c, obj, name)
+			return sj.Destination.CopyFrom(c, sj.Source, obj, name)
 		}
 		if err := wg.Start(worker); err != nil {
 			return wg.WaitError(err)
@@ -0,0 +1,245 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"golang.org/x/net/context"
+	gs "google.golang.org/api/storage/v1"
+
+	"github.com/flatcar/mantle/lang/worker"
+	"github.com/flatcar/mantle/util"
+)
+
+// retryDelay is the time to wait before retrying a part of a download.
+var retryDelay = time.Second
+
+// progress draws a progress bar of a transfer made by concurrent
+// requests. util.CopyProgress draws it while reading the number of bytes
+// transferred from the progress.
+type progress struct {
+	counts chan int
+	left   int
+	done   chan struct{}
+
+	mu    sync.Mutex
+	sent  int64
+	total int64
+}
+
+// progress returns the progress of transferring obj, nil for objects
+// small enough to be transferred in one request.
+func (b *Bucket) progress(obj *gs.Object) *progress {
+	if int64(obj.Size) <= b.transfer.ChunkSize {
+		return nil
+	}
+	p := &progress{
+		counts: make(chan int, 64),
+		done:   make(chan struct{}),
+		total:  int64(obj.Size),
+	}
+	go func() {
+		defer close(p.done)
+		util.CopyProgress(capnslog.INFO, path.Base(obj.Name), io.Discard, p, p.total)
+	}()
+	return p
+}
+
+// add counts n transferred bytes. Bytes sent again after errors may be
+// counted twice, so the count is capped at the total.
+func (p *progress) add(n int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	n = int(min(int64(n), p.total-p.sent))
+	p.sent += int64(n)
+	p.mu.Unlock()
+	if n > 0 {
+		p.counts <- n
+	}
+}
+
+func (p *progress) Read(buf []byte) (int, error) {
+	if p.left == 0 {
+		n, ok := <-p.counts
+		if !ok {
+			return 0, io.EOF
+		}
+		p.left = n
+	}
+	n := min(len(buf), p.left)
+	p.left -= n
+	return n, nil
+}
+
+// close waits for the progress bar to be drawn completely.
+func (p *progress) close() {
+	if p == nil {
+		return
+	}
+	close(p.counts)
+	<-p.done
+}
+
+// readerAt counts the bytes read from r.
+func (p *progress) readerAt(r io.ReaderAt) io.ReaderAt {
+	if p == nil {
+		return r
+	}
+	return progressReaderAt{r, p}
+}
+
+type progressReaderAt struct {
+	r io.ReaderAt
+	p *progress
+}
+
+func (pr progressReaderAt) ReadAt(buf []byte, off int64) (int, error) {
+	n, err := pr.r.ReadAt(buf, off)
+	pr.p.add(n)
+	return n, err
+}
+
+// progressWriter counts the bytes written to w.
+type progressWriter struct {
+	w io.Writer
+	p *progress
+}
+
+func (pw progressWriter) Write(buf []byte) (int, error) {
+	n, err := pw.w.Write(buf)
+	pw.p.add(n)
+	return n, err
+}
+
+// Download writes an object to the file at path, unless the file is
+// already up to date. Parts of the object are downloaded in parallel and
+// resumed after network errors, the file is only replaced once its
+// checksums match those of the object.
+func (b *Bucket) Download(ctx context.Context, objName, path string) error {
+	obj := b.Object(objName)
+	if obj == nil || obj.Name == "" {
+		var err error
+		if obj, err = b.backend.Stat(ctx, b.name, objName); err != nil {
+			return b.apiErr("stat", objName, err)
+		} else if obj == nil {
+			return b.apiErr("stat", objName, os.ErrNotExist)
+		}
+	}
+
+	if f, err := os.Open(path); err == nil {
+		local := &gs.Object{}
+		err := crcSum(local, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if crcEq(local, obj) {
+			plog.Infof("%s is up to date", path)
+			return nil
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	plog.Noticef("Downloading %s to %s", b.mkURL(obj), path)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := b.download(ctx, obj, f); err != nil {
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// download writes an object to f and checks the written data.
+func (b *Bucket) download(ctx context.Context, obj *gs.Object, f *os.File) error {
+	size := int64(obj.Size)
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+
+	p := b.progress(obj)
+	chunkSize := max(b.transfer.ChunkSize, 1)
+	wg := worker.NewWorkerGroup(ctx, max(b.transfer.Concurrency, 1))
+	for offset := int64(0); offset < size; offset += chunkSize {
+		offset, length := offset, min(chunkSize, size-offset)
+		worker := func(c context.Context) error {
+			return b.downloadChunk(c, obj, io.NewOffsetWriter(f, offset), offset, length, p)
+		}
+		if err := wg.Start(worker); err != nil {
+			err = wg.WaitError(err)
+			p.close()
+			return b.apiErr("download", obj, err)
+		}
+	}
+	err := wg.Wait()
+	p.close()
+	if err != nil {
+		return b.apiErr("download", obj, err)
+	}
+
+	written := &gs.Object{}
+	if err := crcSum(written, io.NewSectionReader(f, 0, size)); err != nil {
+		return err
+	}
+	ok := crcEq(written, obj)
+	if obj.Crc32c == "" && obj.Md5Hash == "" {
+		plog.Warningf("%s has no checksums, only its size is checked", b.mkURL(obj))
+		ok = written.Size == obj.Size
+	}
+	if !ok {
+		return b.apiErr("download", obj, ChecksumMismatch)
+	}
+	return nil
+}
+
+// downloadChunk writes length bytes of obj starting at offset to w,
+// resuming after errors where the previous attempt stopped.
+func (b *Bucket) downloadChunk(ctx context.Context, obj *gs.Object, w io.Writer, offset, length int64, p *progress) error {
+	var written int64
+	retry := func(err error) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		plog.Warningf("Reading %s failed at byte %d: %v", b.mkURL(obj), offset+written, err)
+		return true
+	}
+	return util.RetryConditional(b.transfer.Retries+1, retryDelay, retry, func() error {
+		r, err := b.backend.Open(ctx, b.name, obj.Name, offset+written, length-written)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		n, err := io.Copy(progressWriter{w, p}, io.LimitReader(r, length-written))
+		written += n
+		if err == nil && written < length {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	})
+}
@@ -0,0 +1,130 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	"golang.org/x/net/context"
+	gs "google.golang.org/api/storage/v1"
+)
+
+const testChunkSize = 100
+
+// flakyBackend breaks off the first read of every chunk halfway, and
+// optionally corrupts the data read.
+type flakyBackend struct {
+	Backend
+	corrupt bool
+
+	mu      sync.Mutex
+	offsets []int64
+}
+
+func (f *flakyBackend) Open(ctx context.Context, bucket, name string, offset, length int64) (io.ReadCloser, error) {
+	r, err := f.Backend.Open(ctx, bucket, name, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.offsets = append(f.offsets, offset)
+	f.mu.Unlock()
+
+	var data io.Reader = r
+	if offset%testChunkSize == 0 {
+		data = io.MultiReader(io.LimitReader(r, length/2), iotest.ErrReader(errors.New("connection reset")))
+	}
+	if f.corrupt {
+		data = io.MultiReader(bytes.NewReader([]byte{0}), data)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{data, r}, nil
+}
+
+func flakyBucket(t *testing.T, corrupt bool) (*Bucket, *flakyBackend, []byte) {
+	retryDelay = 0
+	backend := &flakyBackend{Backend: NewLocalBackend(), corrupt: corrupt}
+	bkt, err := NewBucketWithBackend(backend, "file://"+t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bkt.ChunkSize(testChunkSize)
+	bkt.Concurrency(3)
+
+	data := make([]byte, 10*testChunkSize+testChunkSize/2)
+	rand.New(rand.NewSource(0)).Read(data)
+	obj := gs.Object{Name: "image.bin"}
+	if err := bkt.Upload(context.Background(), &obj, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	return bkt, backend, data
+}
+
+func TestDownloadResume(t *testing.T) {
+	bkt, backend, data := flakyBucket(t, false)
+	path := filepath.Join(t.TempDir(), "dir", "image.bin")
+	if err := bkt.Download(context.Background(), "image.bin", path); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("downloaded %d bytes, %v", len(got), err)
+	}
+
+	// every chunk is read twice, the second time from the middle
+	resumed := make(map[int64]bool)
+	for _, offset := range backend.offsets {
+		resumed[offset] = true
+	}
+	for offset := int64(0); offset < int64(len(data)); offset += testChunkSize {
+		length := min(testChunkSize, int64(len(data))-offset)
+		if !resumed[offset] || !resumed[offset+length/2] {
+			t.Errorf("chunk at %d not resumed: %v", offset, backend.offsets)
+		}
+	}
+	if len(backend.offsets) != 2*11 {
+		t.Errorf("unexpected reads at %v", backend.offsets)
+	}
+
+	// an up-to-date file isn't downloaded again
+	backend.offsets = nil
+	if err := bkt.Download(context.Background(), "image.bin", path); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.offsets) != 0 {
+		t.Errorf("up-to-date file read at %v", backend.offsets)
+	}
+}
+
+func TestDownloadCorrupt(t *testing.T) {
+	bkt, _, _ := flakyBucket(t, true)
+	path := filepath.Join(t.TempDir(), "image.bin")
+	err := bkt.Download(context.Background(), "image.bin", path)
+	if !errors.Is(err, ChecksumMismatch) {
+		t.Fatalf("corrupt download returned %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("corrupt download written: %v", err)
+	}
+	if entries, err := os.ReadDir(filepath.Dir(path)); err != nil || len(entries) != 0 {
+		t.Errorf("temporary files left: %v, %v", entries, err)
+	}
+}
+
+func TestDownloadMissing(t *testing.T) {
+	bkt := localBucket(t, t.TempDir())
+	err := bkt.Download(context.Background(), "missing", filepath.Join(t.TempDir(), "missing"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("downloading a missing object returned %v", err)
+	}
+}
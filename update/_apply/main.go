@@ -1,18 +1,35 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 
 	"github.com/flatcar/mantle/update"
 )
 
+var (
+	srcPartition = flag.String("src", "", "source partition, required by delta payloads")
+	dstPartition = flag.String("dst", "out", "destination partition")
+)
+
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] PAYLOAD\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
 	u := update.Updater{
-		DstPartition: "out",
+		SrcPartition: *srcPartition,
+		DstPartition: *dstPartition,
 	}
 
-	if err := u.OpenPayload(os.Args[1]); err != nil {
+	if err := u.OpenPayload(flag.Arg(0)); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
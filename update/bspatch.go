@@ -0,0 +1,91 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package update
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const bsdiffMagic = "BSDIFF40"
+
+var InvalidBsdiff = errors.New("corrupt bsdiff patch")
+
+// offtin decodes the sign-magnitude integers used by bsdiff.
+func offtin(b []byte) int64 {
+	y := int64(b[7] & 0x7f)
+	for i := 6; i >= 0; i-- {
+		y = y<<8 | int64(b[i])
+	}
+	if b[7]&0x80 != 0 {
+		y = -y
+	}
+	return y
+}
+
+// bspatch applies a patch in the BSDIFF40 format produced by bsdiff 4.x
+// to old, returning the new data. Patches producing anything but
+// newLength bytes are rejected before allocating the new data.
+func bspatch(old, patch []byte, newLength int64) ([]byte, error) {
+	if len(patch) < 32 || string(patch[:8]) != bsdiffMagic {
+		return nil, InvalidBsdiff
+	}
+	ctrlLen := offtin(patch[8:])
+	diffLen := offtin(patch[16:])
+	newSize := offtin(patch[24:])
+	if ctrlLen < 0 || diffLen < 0 || newSize < 0 ||
+		ctrlLen > int64(len(patch))-32 ||
+		diffLen > int64(len(patch))-32-ctrlLen {
+		return nil, InvalidBsdiff
+	}
+	if newSize != newLength {
+		return nil, fmt.Errorf("bsdiff patch produces %d bytes, expected %d", newSize, newLength)
+	}
+
+	body := patch[32:]
+	ctrl := bzip2.NewReader(bytes.NewReader(body[:ctrlLen]))
+	diff := bzip2.NewReader(bytes.NewReader(body[ctrlLen : ctrlLen+diffLen]))
+	extra := bzip2.NewReader(bytes.NewReader(body[ctrlLen+diffLen:]))
+
+	newData := make([]byte, newSize)
+	var oldPos, newPos int64
+	var buf [24]byte
+	for newPos < newSize {
+		if _, err := io.ReadFull(ctrl, buf[:]); err != nil {
+			return nil, fmt.Errorf("reading bsdiff control block: %v", err)
+		}
+		addLen, copyLen, seekLen := offtin(buf[0:]), offtin(buf[8:]), offtin(buf[16:])
+		// compare with the space left, newPos+addLen may overflow
+		if addLen < 0 || copyLen < 0 || addLen > newSize-newPos {
+			return nil, InvalidBsdiff
+		}
+
+		// Add the diff block to the old data.
+		if _, err := io.ReadFull(diff, newData[newPos:newPos+addLen]); err != nil {
+			return nil, fmt.Errorf("reading bsdiff diff block: %v", err)
+		}
+		for i := int64(0); i < addLen; i++ {
+			if oldPos+i >= 0 && oldPos+i < int64(len(old)) {
+				newData[newPos+i] += old[oldPos+i]
+			}
+		}
+		newPos += addLen
+		oldPos += addLen
+
+		// Copy the extra block.
+		if copyLen > newSize-newPos {
+			return nil, InvalidBsdiff
+		}
+		if _, err := io.ReadFull(extra, newData[newPos:newPos+copyLen]); err != nil {
+			return nil, fmt.Errorf("reading bsdiff extra block: %v", err)
+		}
+		newPos += copyLen
+		oldPos += seekLen
+	}
+
+	return newData, nil
+}
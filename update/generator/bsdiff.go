@@ -0,0 +1,301 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package generator
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// This is a port of bsdiff 4.3 by Colin Percival, producing patches in the
+// BSDIFF40 format understood by update_engine.
+
+// split is part of the Larsson-Sadakane suffix sorting.
+func split(I, V []int, start, length, h int) {
+	if length < 16 {
+		for k := start; k < start+length; {
+			j := 1
+			x := V[I[k]+h]
+			for i := 1; k+i < start+length; i++ {
+				if V[I[k+i]+h] < x {
+					x = V[I[k+i]+h]
+					j = 0
+				}
+				if V[I[k+i]+h] == x {
+					I[k+j], I[k+i] = I[k+i], I[k+j]
+					j++
+				}
+			}
+			for i := 0; i < j; i++ {
+				V[I[k+i]] = k + j - 1
+			}
+			if j == 1 {
+				I[k] = -1
+			}
+			k += j
+		}
+		return
+	}
+
+	x := V[I[start+length/2]+h]
+	jj, kk := 0, 0
+	for i := start; i < start+length; i++ {
+		if V[I[i]+h] < x {
+			jj++
+		}
+		if V[I[i]+h] == x {
+			kk++
+		}
+	}
+	jj += start
+	kk += jj
+
+	i, j, k := start, 0, 0
+	for i < jj {
+		if V[I[i]+h] < x {
+			i++
+		} else if V[I[i]+h] == x {
+			I[i], I[jj+j] = I[jj+j], I[i]
+			j++
+		} else {
+			I[i], I[kk+k] = I[kk+k], I[i]
+			k++
+		}
+	}
+	for jj+j < kk {
+		if V[I[jj+j]+h] == x {
+			j++
+		} else {
+			I[jj+j], I[kk+k] = I[kk+k], I[jj+j]
+			k++
+		}
+	}
+
+	if jj > start {
+		split(I, V, start, jj-start, h)
+	}
+
+	for i := 0; i < kk-jj; i++ {
+		V[I[jj+i]] = kk - 1
+	}
+	if jj == kk-1 {
+		I[jj] = -1
+	}
+
+	if start+length > kk {
+		split(I, V, kk, start+length-kk, h)
+	}
+}
+
+// qsufsort returns the suffix array of old.
+func qsufsort(old []byte) []int {
+	var buckets [256]int
+	for _, c := range old {
+		buckets[c]++
+	}
+	for i := 1; i < 256; i++ {
+		buckets[i] += buckets[i-1]
+	}
+	for i := 255; i > 0; i-- {
+		buckets[i] = buckets[i-1]
+	}
+	buckets[0] = 0
+
+	I := make([]int, len(old)+1)
+	V := make([]int, len(old)+1)
+	for i, c := range old {
+		buckets[c]++
+		I[buckets[c]] = i
+	}
+	I[0] = len(old)
+	for i, c := range old {
+		V[i] = buckets[c]
+	}
+	V[len(old)] = 0
+	for i := 1; i < 256; i++ {
+		if buckets[i] == buckets[i-1]+1 {
+			I[buckets[i]] = -1
+		}
+	}
+	I[0] = -1
+
+	for h := 1; I[0] != -(len(old) + 1); h += h {
+		length := 0
+		i := 0
+		for i < len(old)+1 {
+			if I[i] < 0 {
+				length -= I[i]
+				i -= I[i]
+			} else {
+				if length != 0 {
+					I[i-length] = -length
+				}
+				length = V[I[i]] + 1 - i
+				split(I, V, i, length, h)
+				i += length
+				length = 0
+			}
+		}
+		if length != 0 {
+			I[i-length] = -length
+		}
+	}
+
+	for i := 0; i < len(old)+1; i++ {
+		I[V[i]] = i
+	}
+	return I
+}
+
+func matchlen(old, new []byte) int {
+	i := 0
+	for i < len(old) && i < len(new) && old[i] == new[i] {
+		i++
+	}
+	return i
+}
+
+// search finds the longest match of new in old using its suffix array I.
+func search(I []int, old, new []byte) (pos, length int) {
+	st, en := 0, len(old)
+	for en-st >= 2 {
+		x := st + (en-st)/2
+		if bytes.Compare(old[I[x]:min(len(old), I[x]+len(new))], new[:min(len(new), len(old)-I[x])]) < 0 {
+			st = x
+		} else {
+			en = x
+		}
+	}
+
+	x := matchlen(old[I[st]:], new)
+	y := matchlen(old[I[en]:], new)
+	if x > y {
+		return I[st], x
+	}
+	return I[en], y
+}
+
+func offtout(x int) []byte {
+	b := make([]byte, 8)
+	if x < 0 {
+		binary.LittleEndian.PutUint64(b, uint64(-x))
+		b[7] |= 0x80
+	} else {
+		binary.LittleEndian.PutUint64(b, uint64(x))
+	}
+	return b
+}
+
+// Bsdiff returns a patch in the BSDIFF40 format converting old to new.
+func Bsdiff(old, new []byte) ([]byte, error) {
+	I := qsufsort(old)
+
+	var ctrl, diff, extra []byte
+	var scan, pos, length int
+	var lastscan, lastpos, lastoffset int
+	for scan < len(new) {
+		oldscore := 0
+
+		scan += length
+		for scsc := scan; scan < len(new); scan++ {
+			pos, length = search(I, old, new[scan:])
+
+			for ; scsc < scan+length; scsc++ {
+				if scsc+lastoffset < len(old) && old[scsc+lastoffset] == new[scsc] {
+					oldscore++
+				}
+			}
+
+			if (length == oldscore && length != 0) || length > oldscore+8 {
+				break
+			}
+
+			if scan+lastoffset < len(old) && old[scan+lastoffset] == new[scan] {
+				oldscore--
+			}
+		}
+
+		if length == oldscore && scan != len(new) {
+			continue
+		}
+
+		// Extend the previous match forwards.
+		var s, Sf, lenf int
+		for i := 0; lastscan+i < scan && lastpos+i < len(old); {
+			if old[lastpos+i] == new[lastscan+i] {
+				s++
+			}
+			i++
+			if s*2-i > Sf*2-lenf {
+				Sf = s
+				lenf = i
+			}
+		}
+
+		// Extend the current match backwards.
+		lenb := 0
+		if scan < len(new) {
+			s, Sb := 0, 0
+			for i := 1; scan >= lastscan+i && pos >= i; i++ {
+				if old[pos-i] == new[scan-i] {
+					s++
+				}
+				if s*2-i > Sb*2-lenb {
+					Sb = s
+					lenb = i
+				}
+			}
+		}
+
+		// Split overlapping extensions.
+		if lastscan+lenf > scan-lenb {
+			overlap := (lastscan + lenf) - (scan - lenb)
+			s, Ss, lens := 0, 0, 0
+			for i := 0; i < overlap; i++ {
+				if new[lastscan+lenf-overlap+i] == old[lastpos+lenf-overlap+i] {
+					s++
+				}
+				if new[scan-lenb+i] == old[pos-lenb+i] {
+					s--
+				}
+				if s > Ss {
+					Ss = s
+					lens = i + 1
+				}
+			}
+			lenf += lens - overlap
+			lenb -= lens
+		}
+
+		for i := 0; i < lenf; i++ {
+			diff = append(diff, new[lastscan+i]-old[lastpos+i])
+		}
+		extra = append(extra, new[lastscan+lenf:scan-lenb]...)
+
+		ctrl = append(ctrl, offtout(lenf)...)
+		ctrl = append(ctrl, offtout((scan-lenb)-(lastscan+lenf))...)
+		ctrl = append(ctrl, offtout((pos-lenb)-(lastpos+lenf))...)
+
+		lastscan = scan - lenb
+		lastpos = pos - lenb
+		lastoffset = pos - scan
+	}
+
+	var patch bytes.Buffer
+	patch.WriteString("BSDIFF40")
+	blocks := make([][]byte, 3)
+	for i, block := range [][]byte{ctrl, diff, extra} {
+		var err error
+		if blocks[i], err = Bzip2(block); err != nil {
+			return nil, err
+		}
+	}
+	patch.Write(offtout(len(blocks[0])))
+	patch.Write(offtout(len(blocks[1])))
+	patch.Write(offtout(len(new)))
+	for _, block := range blocks {
+		patch.Write(block)
+	}
+	return patch.Bytes(), nil
+}
@@ -0,0 +1,95 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/flatcar/mantle/update/metadata"
+)
+
+// Compressor compresses the data of replace operations.
+type Compressor struct {
+	Name     string
+	Type     metadata.InstallOperation_Type
+	Compress func(data []byte) ([]byte, error)
+}
+
+var (
+	Bzip2Compressor = Compressor{"bzip2", metadata.InstallOperation_REPLACE_BZ, Bzip2}
+	XzCompressor    = Compressor{"xz", metadata.InstallOperation_REPLACE_XZ, Xz}
+	ZstdCompressor  = Compressor{"zstd", metadata.InstallOperation_MANTLE_REPLACE_ZSTD, Zstd}
+
+	// Compressors are the known compressors by name.
+	Compressors = map[string]Compressor{
+		Bzip2Compressor.Name: Bzip2Compressor,
+		XzCompressor.Name:    XzCompressor,
+		ZstdCompressor.Name:  ZstdCompressor,
+	}
+
+	// DefaultCompressors are used if no compressors are given. Only
+	// bzip2 is understood by all update_engine versions.
+	DefaultCompressors = []Compressor{Bzip2Compressor}
+)
+
+// ParseCompressors looks up compressors by name.
+func ParseCompressors(names []string) ([]Compressor, error) {
+	var ret []Compressor
+	for _, name := range names {
+		c, ok := Compressors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown compressor %q", name)
+		}
+		ret = append(ret, c)
+	}
+	return ret, nil
+}
+
+// compress tries all compressors, or DefaultCompressors if there are
+// none, returning the type and data of the smallest replace operation.
+// The data is used as is if no compressor shrinks it.
+func compress(data []byte, compressors []Compressor) (metadata.InstallOperation_Type, []byte, error) {
+	if len(compressors) == 0 {
+		compressors = DefaultCompressors
+	}
+
+	opType, opData := metadata.InstallOperation_REPLACE, data
+	for _, c := range compressors {
+		compressed, err := c.Compress(data)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(compressed) < len(opData) {
+			opType, opData = c.Type, compressed
+		}
+	}
+	return opType, opData, nil
+}
+
+// Xz compresses data in the xz format. The dictionary doesn't need to be
+// larger than a chunk, which keeps the memory needed for decompressing low.
+func Xz(data []byte) ([]byte, error) {
+	return compressCommand(data, "xz", "-c", "--lzma2=preset=9,dict=1MiB", "--check=crc32")
+}
+
+// Zstd compresses data in the zstd format. Only mantle can apply the
+// resulting operations, no update_engine knows them.
+func Zstd(data []byte) ([]byte, error) {
+	return compressCommand(data, "zstd", "-c", "-q", "-19")
+}
+
+func compressCommand(data []byte, name string, args ...string) ([]byte, error) {
+	var buf bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &buf
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,193 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flatcar/mantle/system/exec"
+	"github.com/flatcar/mantle/update"
+	"github.com/flatcar/mantle/update/metadata"
+)
+
+// fakeCompressor "compresses" data to size bytes.
+func fakeCompressor(opType metadata.InstallOperation_Type, size int) Compressor {
+	return Compressor{
+		Name: opType.String(),
+		Type: opType,
+		Compress: func(data []byte) ([]byte, error) {
+			return make([]byte, size), nil
+		},
+	}
+}
+
+func TestCompressSmallest(t *testing.T) {
+	data := make([]byte, 100)
+	for _, tt := range []struct {
+		compressors []Compressor
+		opType      metadata.InstallOperation_Type
+		size        int
+	}{
+		{
+			[]Compressor{
+				fakeCompressor(metadata.InstallOperation_REPLACE_BZ, 50),
+				fakeCompressor(metadata.InstallOperation_REPLACE_XZ, 40),
+			},
+			metadata.InstallOperation_REPLACE_XZ, 40,
+		},
+		{
+			// ties go to the first compressor
+			[]Compressor{
+				fakeCompressor(metadata.InstallOperation_REPLACE_BZ, 40),
+				fakeCompressor(metadata.InstallOperation_REPLACE_XZ, 40),
+			},
+			metadata.InstallOperation_REPLACE_BZ, 40,
+		},
+		{
+			[]Compressor{
+				fakeCompressor(metadata.InstallOperation_REPLACE_BZ, 120),
+				fakeCompressor(metadata.InstallOperation_REPLACE_XZ, 100),
+			},
+			metadata.InstallOperation_REPLACE, 100,
+		},
+	} {
+		opType, opData, err := compress(data, tt.compressors)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opType != tt.opType || len(opData) != tt.size {
+			t.Errorf("compressed to %d bytes with %s, expected %d bytes with %s", len(opData), opType, tt.size, tt.opType)
+		}
+	}
+}
+
+func TestParseCompressors(t *testing.T) {
+	compressors, err := ParseCompressors([]string{"zstd", "bzip2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressors) != 2 || compressors[0].Type != metadata.InstallOperation_MANTLE_REPLACE_ZSTD || compressors[1].Type != metadata.InstallOperation_REPLACE_BZ {
+		t.Errorf("unexpected compressors %v", compressors)
+	}
+	if _, err := ParseCompressors([]string{"gzip"}); err == nil {
+		t.Error("parsing an unknown compressor succeeded")
+	}
+}
+
+// TestFullUpdateCompressors generates payloads with each compressor and
+// checks the updater applies them.
+func TestFullUpdateCompressors(t *testing.T) {
+	source := bytes.Repeat(testOnes, 16)
+	for _, c := range []Compressor{Bzip2Compressor, XzCompressor, ZstdCompressor} {
+		t.Run(c.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			sourcePath := filepath.Join(dir, "source")
+			payloadPath := filepath.Join(dir, "payload")
+			outPath := filepath.Join(dir, "out")
+			if err := os.WriteFile(sourcePath, source, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			proc, err := FullUpdate(sourcePath, c)
+			if exec.IsCmdNotFound(err) {
+				t.Skip(err)
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if len(proc.Operations) != 1 || proc.Operations[0].GetType() != c.Type {
+				t.Errorf("unexpected operations: %v", proc.Operations)
+			}
+
+			g := testGenerator{t: t}
+			defer g.Destroy()
+			if err := g.Partition(proc); err != nil {
+				t.Fatal(err)
+			}
+			if err := g.Write(payloadPath); err != nil {
+				t.Fatal(err)
+			}
+
+			updater := update.Updater{DstPartition: outPath}
+			if err := updater.OpenPayload(payloadPath); err != nil {
+				t.Fatal(err)
+			}
+			if err := updater.Update(); err != nil {
+				t.Fatal(err)
+			}
+			out, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out, source) {
+				t.Fatal("updater did not reproduce the source")
+			}
+		})
+	}
+}
+
+// benchmarkData returns the start of the test binary, which compresses
+// like the binaries making up most of an image.
+func benchmarkData(b *testing.B) []byte {
+	exe, err := os.Executable()
+	if err != nil {
+		b.Fatal(err)
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	data := make([]byte, 4*ChunkSize)
+	n, err := io.ReadFull(f, data)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		b.Fatal(err)
+	}
+	return data[:n-n%BlockSize]
+}
+
+// BenchmarkFullUpdate compares the payload size, reported as bytes/op
+// and the percentage of the image size, and generation time of the
+// compressors.
+func BenchmarkFullUpdate(b *testing.B) {
+	source := filepath.Join(b.TempDir(), "source")
+	data := benchmarkData(b)
+	if err := os.WriteFile(source, data, 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, compressors := range [][]Compressor{
+		{Bzip2Compressor},
+		{XzCompressor},
+		{ZstdCompressor},
+		{Bzip2Compressor, XzCompressor, ZstdCompressor},
+	} {
+		var names []string
+		for _, c := range compressors {
+			names = append(names, c.Name)
+		}
+		b.Run(fmt.Sprint(names), func(b *testing.B) {
+			var size uint64
+			for b.Loop() {
+				proc, err := FullUpdate(source, compressors...)
+				if exec.IsCmdNotFound(err) {
+					b.Skip(err)
+				} else if err != nil {
+					b.Fatal(err)
+				}
+				size = 0
+				for _, op := range proc.Operations {
+					size += uint64(op.GetDataLength())
+				}
+				proc.Close()
+			}
+			b.ReportMetric(float64(size), "bytes/op")
+			b.ReportMetric(100*float64(size)/float64(len(data)), "%")
+		})
+	}
+}
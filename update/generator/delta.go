@@ -0,0 +1,506 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package generator
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/flatcar/mantle/system"
+	"github.com/flatcar/mantle/update/metadata"
+)
+
+// DeltaReport summarizes the operations of a delta update.
+type DeltaReport struct {
+	OldSize     uint64
+	NewSize     uint64
+	PayloadSize uint64
+	Duration    time.Duration
+
+	// Operations and Blocks count the operations and the destination
+	// blocks written by them for each operation type.
+	Operations map[metadata.InstallOperation_Type]int
+	Blocks     map[metadata.InstallOperation_Type]uint64
+}
+
+func (r *DeltaReport) String() string {
+	var types []metadata.InstallOperation_Type
+	for t := range r.Operations {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	var ops []string
+	for _, t := range types {
+		ops = append(ops, fmt.Sprintf("%d %s (%d blocks)", r.Operations[t], t, r.Blocks[t]))
+	}
+	return fmt.Sprintf("delta from %d to %d bytes is %d bytes (%.1f%%), generated in %s: %s",
+		r.OldSize, r.NewSize, r.PayloadSize,
+		100*float64(r.PayloadSize)/float64(max(r.NewSize, 1)),
+		r.Duration.Round(time.Millisecond), strings.Join(ops, ", "))
+}
+
+// DeltaUpdate generates an update Procedure which turns the file at oldPath
+// into the file at newPath. Blocks found in the old file are moved, changed
+// blocks are either diffed against the old blocks at the same position or
+// replaced, whichever makes the payload smaller. Replaced blocks are
+// compressed like in FullUpdate.
+//
+// Like update_engine, the updater applies the operations in place: the
+// old file's size and hash are recorded so it is verified, it is copied to
+// the destination and each operation reads the destination blocks it
+// depends on. The operations are ordered so no block is overwritten
+// before every operation reading it ran; operations in a dependency cycle
+// are replaced until the cycles are broken.
+func DeltaUpdate(oldPath, newPath string, compressors ...Compressor) (*Procedure, *DeltaReport, error) {
+	start := time.Now()
+
+	source, err := os.Open(oldPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer source.Close()
+
+	target, err := os.Open(newPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer target.Close()
+
+	oldInfo, err := NewInstallInfo(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	newInfo, err := NewInstallInfo(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	if oldInfo.GetSize()%BlockSize != 0 {
+		return nil, nil, fmt.Errorf("%s: %v", oldPath, errShortRead)
+	}
+
+	// operation data is collected in scratch and copied to the
+	// payload once the operations are ordered
+	scratch, err := system.PrivateFile("")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer scratch.Close()
+
+	scanner := deltaScanner{
+		scratch: scratch,
+		source:  source,
+		target:  target,
+		report: DeltaReport{
+			OldSize:    oldInfo.GetSize(),
+			NewSize:    newInfo.GetSize(),
+			Operations: make(map[metadata.InstallOperation_Type]int),
+			Blocks:     make(map[metadata.InstallOperation_Type]uint64),
+		},
+		compressors: compressors,
+	}
+	if err = scanner.indexSource(); err == nil {
+		for err == nil {
+			err = scanner.Scan()
+		}
+	}
+	if err == errShortRead {
+		return nil, nil, fmt.Errorf("%s: %v", newPath, err)
+	} else if err != io.EOF {
+		return nil, nil, err
+	}
+
+	if err := scanner.order(); err != nil {
+		return nil, nil, err
+	}
+	payload, err := scanner.writePayload()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &scanner.report
+	report.Duration = time.Since(start)
+	plog.Infof("Generated %s", report)
+
+	return &Procedure{
+		InstallProcedure: metadata.InstallProcedure{
+			OldInfo:    oldInfo,
+			NewInfo:    newInfo,
+			Operations: scanner.installOperations(),
+		},
+		ReadCloser: payload,
+	}, report, nil
+}
+
+type deltaScanner struct {
+	scratch    *os.File
+	source     io.ReaderAt
+	target     *os.File
+	offset     uint64
+	operations []*deltaOperation
+	report     DeltaReport
+
+	compressors []Compressor
+
+	// hashes of the source blocks and the first source block with
+	// each hash
+	sourceHashes []blockHash
+	sourceBlocks map[blockHash]uint64
+}
+
+// deltaOperation is an operation and the location of its data in the
+// scratch file.
+type deltaOperation struct {
+	*metadata.InstallOperation
+	dataOffset int64
+}
+
+type blockHash [sha256.Size]byte
+
+// noBlock marks target blocks which aren't in the source.
+const noBlock = ^uint64(0)
+
+func (d *deltaScanner) indexSource() error {
+	d.sourceBlocks = make(map[blockHash]uint64)
+	block := make([]byte, BlockSize)
+	for i := uint64(0); i < d.report.OldSize/BlockSize; i++ {
+		if _, err := d.source.ReadAt(block, int64(i*BlockSize)); err != nil {
+			return err
+		}
+		sum := blockHash(sha256.Sum256(block))
+		d.sourceHashes = append(d.sourceHashes, sum)
+		if _, ok := d.sourceBlocks[sum]; !ok {
+			d.sourceBlocks[sum] = i
+		}
+	}
+	return nil
+}
+
+// sourceBlock returns the source block identical to the target block at
+// index i, preferring the one at the same position.
+func (d *deltaScanner) sourceBlock(i uint64, block []byte) uint64 {
+	sum := blockHash(sha256.Sum256(block))
+	if i < uint64(len(d.sourceHashes)) && d.sourceHashes[i] == sum {
+		return i
+	}
+	if src, ok := d.sourceBlocks[sum]; ok {
+		return src
+	}
+	return noBlock
+}
+
+func (d *deltaScanner) readChunk() ([]byte, error) {
+	chunk := make([]byte, ChunkSize)
+	n, err := io.ReadFull(d.target, chunk)
+	if (err == io.EOF || err == io.ErrUnexpectedEOF) && n != 0 {
+		err = nil
+	}
+	return chunk[:n], err
+}
+
+// Scan generates the operations for the next chunk of the target.
+func (d *deltaScanner) Scan() error {
+	chunk, err := d.readChunk()
+	if err != nil {
+		return err
+	}
+	if len(chunk)%BlockSize != 0 {
+		return errShortRead
+	}
+
+	startBlock := d.offset / BlockSize
+	numBlocks := uint64(len(chunk)) / BlockSize
+	d.offset += uint64(len(chunk))
+
+	sources := make([]uint64, numBlocks)
+	for i := range sources {
+		sources[i] = d.sourceBlock(startBlock+uint64(i), chunk[i*BlockSize:(i+1)*BlockSize])
+	}
+
+	// Emit an operation for each run of moved or changed blocks.
+	for i := uint64(0); i < numBlocks; {
+		j := i + 1
+		for j < numBlocks && (sources[j] == noBlock) == (sources[i] == noBlock) {
+			j++
+		}
+		if sources[i] == noBlock {
+			err = d.diff(startBlock+i, chunk[i*BlockSize:j*BlockSize])
+		} else {
+			err = d.move(startBlock+i, sources[i:j])
+		}
+		if err != nil {
+			return err
+		}
+		i = j
+	}
+
+	return nil
+}
+
+func (d *deltaScanner) move(dstBlock uint64, sources []uint64) error {
+	var srcExtents []*metadata.Extent
+	for i, src := range sources {
+		if i != 0 && sources[i-1]+1 == src {
+			srcExtents[len(srcExtents)-1].NumBlocks = proto.Uint64(srcExtents[len(srcExtents)-1].GetNumBlocks() + 1)
+			continue
+		}
+		srcExtents = append(srcExtents, &metadata.Extent{
+			StartBlock: proto.Uint64(src),
+			NumBlocks:  proto.Uint64(1),
+		})
+	}
+
+	return d.add(&metadata.InstallOperation{
+		Type:       metadata.InstallOperation_MOVE.Enum(),
+		SrcExtents: srcExtents,
+		DstExtents: []*metadata.Extent{&metadata.Extent{
+			StartBlock: proto.Uint64(dstBlock),
+			NumBlocks:  proto.Uint64(uint64(len(sources))),
+		}},
+	}, nil)
+}
+
+// diff emits the cheapest operation writing data to the blocks starting
+// at dstBlock.
+func (d *deltaScanner) diff(dstBlock uint64, data []byte) error {
+	numBlocks := uint64(len(data)) / BlockSize
+	opType, opData, err := compress(data, d.compressors)
+	if err != nil {
+		return err
+	}
+	op := &metadata.InstallOperation{
+		Type: opType.Enum(),
+		DstExtents: []*metadata.Extent{&metadata.Extent{
+			StartBlock: proto.Uint64(dstBlock),
+			NumBlocks:  proto.Uint64(numBlocks),
+		}},
+	}
+
+	// Diff against the source blocks at the same position, if any.
+	if oldBlocks := uint64(len(d.sourceHashes)); dstBlock < oldBlocks {
+		srcBlocks := min(numBlocks, oldBlocks-dstBlock)
+		old := make([]byte, srcBlocks*BlockSize)
+		if _, err := d.source.ReadAt(old, int64(dstBlock*BlockSize)); err != nil {
+			return err
+		}
+		patch, err := Bsdiff(old, data)
+		if err != nil {
+			return err
+		}
+		if len(patch) < len(opData) {
+			op.Type = metadata.InstallOperation_BSDIFF.Enum()
+			op.SrcExtents = []*metadata.Extent{&metadata.Extent{
+				StartBlock: proto.Uint64(dstBlock),
+				NumBlocks:  proto.Uint64(srcBlocks),
+			}}
+			op.SrcLength = proto.Uint64(uint64(len(old)))
+			op.DstLength = proto.Uint64(uint64(len(data)))
+			opData = patch
+		}
+	}
+
+	return d.add(op, opData)
+}
+
+func (d *deltaScanner) add(op *metadata.InstallOperation, opData []byte) error {
+	dop := &deltaOperation{InstallOperation: op}
+	if err := d.setData(dop, opData); err != nil {
+		return err
+	}
+	d.operations = append(d.operations, dop)
+	d.count(op, false)
+	return nil
+}
+
+// setData appends the operation's data to the scratch file.
+func (d *deltaScanner) setData(op *deltaOperation, opData []byte) error {
+	// Operation.DataOffset is filled in by Generator.updateOffsets
+	op.DataLength, op.DataSha256Hash = nil, nil
+	if opData == nil {
+		return nil
+	}
+	offset, err := d.scratch.Seek(0, os.SEEK_END)
+	if err != nil {
+		return err
+	}
+	if _, err := d.scratch.Write(opData); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(opData)
+	op.dataOffset = offset
+	op.DataLength = proto.Uint32(uint32(len(opData)))
+	op.DataSha256Hash = sum[:]
+	return nil
+}
+
+// count adds the operation to the report, or removes it if remove is set.
+func (d *deltaScanner) count(op *metadata.InstallOperation, remove bool) {
+	opType, blocks := op.GetType(), countBlocks(op.DstExtents)
+	if !remove {
+		d.report.Operations[opType]++
+		d.report.Blocks[opType] += blocks
+		return
+	}
+	d.report.Operations[opType]--
+	d.report.Blocks[opType] -= blocks
+	if d.report.Operations[opType] == 0 {
+		delete(d.report.Operations, opType)
+		delete(d.report.Blocks, opType)
+	}
+}
+
+func countBlocks(extents []*metadata.Extent) uint64 {
+	var blocks uint64
+	for _, extent := range extents {
+		blocks += extent.GetNumBlocks()
+	}
+	return blocks
+}
+
+// order sorts the operations so that every operation runs before the
+// blocks it reads are overwritten by other operations, keeping the scan
+// order where possible. When the remaining operations depend on each
+// other in a cycle, the one writing the fewest blocks is replaced and
+// doesn't read anything anymore.
+func (d *deltaScanner) order() error {
+	// the operation writing each block, the destination extents of
+	// the operations don't overlap
+	writers := make(map[uint64]int)
+	for i, op := range d.operations {
+		for _, extent := range op.DstExtents {
+			for b := extent.GetStartBlock(); b < extent.GetStartBlock()+extent.GetNumBlocks(); b++ {
+				writers[b] = i
+			}
+		}
+	}
+
+	// before[i] are the operations which must run after i as they
+	// overwrite blocks i reads; waiting[j] counts the operations j
+	// waits for.
+	before := make([][]int, len(d.operations))
+	waiting := make([]int, len(d.operations))
+	for i, op := range d.operations {
+		seen := make(map[int]bool)
+		for _, extent := range op.SrcExtents {
+			for b := extent.GetStartBlock(); b < extent.GetStartBlock()+extent.GetNumBlocks(); b++ {
+				j, ok := writers[b]
+				if !ok || j == i || seen[j] {
+					continue
+				}
+				seen[j] = true
+				before[i] = append(before[i], j)
+				waiting[j]++
+			}
+		}
+	}
+
+	ordered := make([]*deltaOperation, 0, len(d.operations))
+	done := make([]bool, len(d.operations))
+	release := func(i int) {
+		for _, j := range before[i] {
+			waiting[j]--
+		}
+		before[i] = nil
+	}
+	for len(ordered) < len(d.operations) {
+		progress := false
+		for i, op := range d.operations {
+			if done[i] || waiting[i] != 0 {
+				continue
+			}
+			ordered = append(ordered, op)
+			done[i] = true
+			release(i)
+			progress = true
+		}
+		if progress {
+			continue
+		}
+
+		// break a cycle
+		cut := -1
+		for i, op := range d.operations {
+			if done[i] || len(before[i]) == 0 {
+				continue
+			}
+			if cut == -1 || countBlocks(op.DstExtents) < countBlocks(d.operations[cut].DstExtents) {
+				cut = i
+			}
+		}
+		if err := d.replace(d.operations[cut]); err != nil {
+			return err
+		}
+		release(cut)
+	}
+
+	d.operations = ordered
+	return nil
+}
+
+// replace turns op into an operation writing the target blocks without
+// reading anything.
+func (d *deltaScanner) replace(op *deltaOperation) error {
+	data := make([]byte, countBlocks(op.DstExtents)*BlockSize)
+	var pos int64
+	for _, extent := range op.DstExtents {
+		n := int64(extent.GetNumBlocks() * BlockSize)
+		if _, err := d.target.ReadAt(data[pos:pos+n], int64(extent.GetStartBlock()*BlockSize)); err != nil {
+			return err
+		}
+		pos += n
+	}
+	opType, opData, err := compress(data, d.compressors)
+	if err != nil {
+		return err
+	}
+
+	d.count(op.InstallOperation, true)
+	op.Type = opType.Enum()
+	op.SrcExtents, op.SrcLength, op.DstLength = nil, nil, nil
+	if err := d.setData(op, opData); err != nil {
+		return err
+	}
+	d.count(op.InstallOperation, false)
+	return nil
+}
+
+// writePayload copies the data of the operations in order to a new
+// payload file.
+func (d *deltaScanner) writePayload() (*os.File, error) {
+	payload, err := system.PrivateFile("")
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range d.operations {
+		if op.DataLength == nil {
+			continue
+		}
+		data := io.NewSectionReader(d.scratch, op.dataOffset, int64(op.GetDataLength()))
+		if _, err := io.Copy(payload, data); err != nil {
+			payload.Close()
+			return nil, err
+		}
+		d.report.PayloadSize += uint64(op.GetDataLength())
+	}
+	if _, err := payload.Seek(0, os.SEEK_SET); err != nil {
+		payload.Close()
+		return nil, err
+	}
+	return payload, nil
+}
+
+func (d *deltaScanner) installOperations() []*metadata.InstallOperation {
+	ops := make([]*metadata.InstallOperation, len(d.operations))
+	for i, op := range d.operations {
+		ops[i] = op.InstallOperation
+	}
+	return ops
+}
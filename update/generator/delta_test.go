@@ -0,0 +1,155 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package generator
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flatcar/mantle/system/exec"
+	"github.com/flatcar/mantle/update"
+	"github.com/flatcar/mantle/update/metadata"
+)
+
+func randomBlocks(r *rand.Rand, blocks int) []byte {
+	data := make([]byte, blocks*BlockSize)
+	r.Read(data)
+	return data
+}
+
+// checkDelta generates a delta payload from old to new, applies it to old
+// and checks the result.
+func checkDelta(t *testing.T, old, new []byte) *DeltaReport {
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old")
+	newPath := filepath.Join(dir, "new")
+	payloadPath := filepath.Join(dir, "payload")
+	outPath := filepath.Join(dir, "out")
+	if err := os.WriteFile(oldPath, old, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newPath, new, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	proc, report, err := DeltaUpdate(oldPath, newPath)
+	if exec.IsCmdNotFound(err) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	g := testGenerator{t: t}
+	defer g.Destroy()
+	if err := g.Partition(proc); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Write(payloadPath); err != nil {
+		t.Fatal(err)
+	}
+
+	updater := update.Updater{
+		SrcPartition: oldPath,
+		DstPartition: outPath,
+	}
+	if err := updater.OpenPayload(payloadPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := updater.Update(); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, new) {
+		t.Fatal("updater did not reproduce the new image")
+	}
+	return report
+}
+
+func TestDeltaUpdateUnchanged(t *testing.T) {
+	old := randomBlocks(rand.New(rand.NewSource(1)), 8)
+	report := checkDelta(t, old, old)
+	if report.Operations[metadata.InstallOperation_MOVE] != 1 || len(report.Operations) != 1 || report.PayloadSize != 0 {
+		t.Errorf("unexpected report: %s", report)
+	}
+}
+
+func TestDeltaUpdateRelocated(t *testing.T) {
+	old := randomBlocks(rand.New(rand.NewSource(1)), 8)
+	new := append(append([]byte{}, old[4*BlockSize:]...), old[:4*BlockSize]...)
+	report := checkDelta(t, old, new)
+	if len(report.Operations) != 1 || report.Blocks[metadata.InstallOperation_MOVE] != 8 {
+		t.Errorf("unexpected report: %s", report)
+	}
+}
+
+func TestDeltaUpdateSwapped(t *testing.T) {
+	// each half is moved from the other chunk, so one of the moves
+	// must be replaced to apply the payload in place
+	old := randomBlocks(rand.New(rand.NewSource(1)), 2*ChunkSize/BlockSize)
+	new := append(append([]byte{}, old[ChunkSize:]...), old[:ChunkSize]...)
+	report := checkDelta(t, old, new)
+	if report.Operations[metadata.InstallOperation_MOVE] != 1 ||
+		report.Blocks[metadata.InstallOperation_REPLACE] != ChunkSize/BlockSize {
+		t.Errorf("unexpected report: %s", report)
+	}
+}
+
+func TestDeltaUpdateChanged(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	old := randomBlocks(r, 8)
+
+	new := append([]byte{}, old...)
+	// small changes are diffed
+	copy(new[3*BlockSize+100:], "changed")
+	// random data is stored as is
+	new = append(new, randomBlocks(r, 2)...)
+	new = append(new, old[:BlockSize]...)
+	// zeros are compressed
+	new = append(new, make([]byte, 2*BlockSize)...)
+
+	report := checkDelta(t, old, new)
+	for opType, blocks := range map[metadata.InstallOperation_Type]uint64{
+		metadata.InstallOperation_MOVE:       8,
+		metadata.InstallOperation_BSDIFF:     1,
+		metadata.InstallOperation_REPLACE:    2,
+		metadata.InstallOperation_REPLACE_BZ: 2,
+	} {
+		if report.Blocks[opType] != blocks {
+			t.Errorf("%s wrote %d blocks, expected %d", opType, report.Blocks[opType], blocks)
+		}
+	}
+	if report.PayloadSize >= 3*BlockSize {
+		t.Errorf("payload too large: %s", report)
+	}
+}
+
+func TestDeltaUpdateShrunk(t *testing.T) {
+	old := randomBlocks(rand.New(rand.NewSource(1)), 8)
+	new := append([]byte{}, old[:5*BlockSize]...)
+	new[0] ^= 0xff
+	checkDelta(t, old, new)
+}
+
+func TestBsdiff(t *testing.T) {
+	old := randomBlocks(rand.New(rand.NewSource(1)), 4)
+	new := append([]byte("prefix"), old...)
+	copy(new[2*BlockSize:], "something else")
+
+	patch, err := Bsdiff(old, new)
+	if exec.IsCmdNotFound(err) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if len(patch) > BlockSize {
+		t.Errorf("patch of %d bytes for a small change", len(patch))
+	}
+}
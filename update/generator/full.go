@@ -33,7 +33,20 @@ var (
 
 // FullUpdate generates an update Procedure for the given file, embedding its
 // entire contents in the payload so it does not depend any previous state.
-func FullUpdate(path string) (*Procedure, error) {
+// Each chunk is compressed with whichever of the compressors, or
+// DefaultCompressors if none are given, makes it smallest.
+func FullUpdate(path string, compressors ...Compressor) (*Procedure, error) {
+	return fullUpdate(path, false, compressors)
+}
+
+// KernelUpdate generates a full update Procedure for the given kernel
+// image, which unlike partition images doesn't need to be a multiple of
+// the block size. Add it to a Generator with Kernel.
+func KernelUpdate(path string, compressors ...Compressor) (*Procedure, error) {
+	return fullUpdate(path, true, compressors)
+}
+
+func fullUpdate(path string, unaligned bool, compressors []Compressor) (*Procedure, error) {
 	source, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -50,7 +63,12 @@ func FullUpdate(path string) (*Procedure, error) {
 		return nil, err
 	}
 
-	scanner := fullScanner{payload: payload, source: source}
+	scanner := fullScanner{
+		payload:     payload,
+		source:      source,
+		unaligned:   unaligned,
+		compressors: compressors,
+	}
 	for err == nil {
 		err = scanner.Scan()
 	}
@@ -81,6 +99,12 @@ type fullScanner struct {
 	source     io.Reader
 	offset     uint64
 	operations []*metadata.InstallOperation
+
+	// unaligned allows the last block to be incomplete. Its extent
+	// still covers the whole block, update_engine only writes the data.
+	unaligned bool
+
+	compressors []Compressor
 }
 
 func (f *fullScanner) readChunk() ([]byte, error) {
@@ -97,27 +121,20 @@ func (f *fullScanner) Scan() error {
 	if err != nil {
 		return err
 	}
-	if len(chunk)%BlockSize != 0 {
+	if len(chunk)%BlockSize != 0 && !f.unaligned {
 		return errShortRead
 	}
 
 	startBlock := uint64(f.offset) / BlockSize
-	numBlocks := uint64(len(chunk)) / BlockSize
+	numBlocks := (uint64(len(chunk)) + BlockSize - 1) / BlockSize
 	f.offset += uint64(len(chunk))
 
-	// Try bzip2 compressing the data, hopefully it will shrink!
-	opType := metadata.InstallOperation_REPLACE_BZ
-	opData, err := Bzip2(chunk)
+	// Try compressing the data, hopefully it will shrink!
+	opType, opData, err := compress(chunk, f.compressors)
 	if err != nil {
 		return err
 	}
 
-	if len(opData) >= len(chunk) {
-		// That was disappointing, use the uncompressed data instead.
-		opType = metadata.InstallOperation_REPLACE
-		opData = chunk
-	}
-
 	if _, err := f.payload.Write(opData); err != nil {
 		return err
 	}
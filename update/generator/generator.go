@@ -42,6 +42,10 @@ var (
 	// ErrProcedureExists indicates that a given procedure type has
 	// already been added to the Generator.
 	ErrProcedureExists = errors.New("generator: procedure already exists")
+
+	// ErrMissingPartition indicates that a procedure was added to the
+	// Generator before the partition.
+	ErrMissingPartition = errors.New("generator: partition procedure missing")
 )
 
 // Generator assembles an update payload from a number of sources. Each of
@@ -50,6 +54,9 @@ type Generator struct {
 	destructor.MultiDestructor
 	manifest metadata.DeltaArchiveManifest
 	payloads []io.Reader
+
+	// Signer signs the payload, signature.DeveloperKey if unset.
+	Signer signature.Signer
 }
 
 // Procedure represent independent update within a payload.
@@ -73,6 +80,32 @@ func (g *Generator) Partition(proc *Procedure) error {
 	return nil
 }
 
+// Kernel adds the given kernel update Procedure to the payload.
+// It must be added after the partition.
+func (g *Generator) Kernel(proc *Procedure) error {
+	if len(g.payloads) == 0 {
+		return ErrMissingPartition
+	}
+	for _, p := range g.manifest.Procedures {
+		if p.GetType() == metadata.InstallProcedure_KERNEL {
+			return ErrProcedureExists
+		}
+	}
+
+	g.AddCloser(proc)
+	proc.Type = metadata.InstallProcedure_KERNEL.Enum()
+	g.manifest.Procedures = append(g.manifest.Procedures, &proc.InstallProcedure)
+	g.payloads = append(g.payloads, proc)
+	return nil
+}
+
+func (g *Generator) signer() signature.Signer {
+	if g.Signer == nil {
+		return signature.DeveloperKey
+	}
+	return g.Signer
+}
+
 // Write finalizes the payload, writing it out to the given file path.
 func (g *Generator) Write(path string) (err error) {
 	if err = g.updateOffsets(); err != nil {
@@ -132,7 +165,7 @@ func (g *Generator) updateOffsets() error {
 		updateOps(proc.Operations)
 	}
 
-	sigSize, err := signature.SignaturesSize()
+	sigSize, err := g.signer().SignaturesSize()
 	g.manifest.SignaturesOffset = proto.Uint64(uint64(offset))
 	g.manifest.SignaturesSize = proto.Uint64(uint64(sigSize))
 	return err
@@ -160,7 +193,7 @@ func (g *Generator) writeManifest(w io.Writer) error {
 }
 
 func (g *Generator) writeSignatures(w io.Writer, sum []byte) error {
-	signatures, err := signature.Sign(sum)
+	signatures, err := g.signer().Sign(sum)
 	if err != nil {
 		return err
 	}
@@ -18,10 +18,12 @@ import (
 	"bytes"
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/golang/protobuf/proto"
 
+	"github.com/flatcar/mantle/system/exec"
 	"github.com/flatcar/mantle/update"
 	"github.com/flatcar/mantle/update/metadata"
 )
@@ -136,3 +138,152 @@ func TestGenerateOneBlockPartition(t *testing.T) {
 		t.Errorf("Updater did not replicate source block")
 	}
 }
+
+func TestGenerateWithKernel(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "image")
+	kernel := filepath.Join(dir, "kernel")
+	payload := filepath.Join(dir, "payload")
+	if err := os.WriteFile(image, testOnes, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(kernel, testUnaligned, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g := testGenerator{t: t}
+	defer g.Destroy()
+
+	partition, err := FullUpdate(image)
+	if exec.IsCmdNotFound(err) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Kernel(partition); err != ErrMissingPartition {
+		t.Fatalf("kernel added before partition: %v", err)
+	}
+	if err := g.Partition(partition); err != nil {
+		t.Fatal(err)
+	}
+	vmlinuz, err := KernelUpdate(kernel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Kernel(vmlinuz); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Write(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	updater := update.Updater{
+		DstPartition: filepath.Join(dir, "partition"),
+		DstKernel:    filepath.Join(dir, "vmlinuz"),
+	}
+	if err := updater.OpenPayload(payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := updater.Update(); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expect := range map[string][]byte{
+		updater.DstPartition: testOnes,
+		updater.DstKernel:    testUnaligned,
+	} {
+		written, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(written, expect) {
+			t.Errorf("Updater did not replicate %s", filepath.Base(path))
+		}
+	}
+}
+
+func TestPayloadInfo(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "image")
+	kernel := filepath.Join(dir, "kernel")
+	if err := os.WriteFile(image, testOnes, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(kernel, testUnaligned, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g := testGenerator{t: t}
+	defer g.Destroy()
+
+	partition, err := FullUpdate(image)
+	if exec.IsCmdNotFound(err) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Partition(partition); err != nil {
+		t.Fatal(err)
+	}
+	vmlinuz, err := KernelUpdate(kernel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Kernel(vmlinuz); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "payload")
+	if err := g.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	payload, err := update.NewPayloadFrom(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := payload.ReadSignatures(); err != nil {
+		t.Fatal(err)
+	}
+
+	info := payload.Info()
+	if info.BlockSize != BlockSize {
+		t.Errorf("block size %d, expected %d", info.BlockSize, BlockSize)
+	}
+	if len(info.Signatures) != 1 {
+		t.Errorf("%d signatures, expected 1", len(info.Signatures))
+	}
+	if len(info.Procedures) != 2 {
+		t.Fatalf("%d procedures, expected 2", len(info.Procedures))
+	}
+	for i, expect := range []struct {
+		typ    string
+		size   uint64
+		blocks uint64
+	}{
+		{"partition", uint64(len(testOnes)), 1},
+		{"KERNEL", uint64(len(testUnaligned)), 2},
+	} {
+		proc := info.Procedures[i]
+		if proc.Type != expect.typ {
+			t.Errorf("procedure %d: type %q, expected %q", i, proc.Type, expect.typ)
+		}
+		if proc.OldInfo != nil {
+			t.Errorf("procedure %d: unexpected old info for full update", i)
+		}
+		if proc.NewInfo == nil || proc.NewInfo.Size != expect.size {
+			t.Errorf("procedure %d: new info %+v, expected size %d", i, proc.NewInfo, expect.size)
+		}
+		var blocks uint64
+		for _, ops := range proc.Operations {
+			blocks += ops.Blocks
+		}
+		if blocks != expect.blocks {
+			t.Errorf("procedure %d: %d blocks, expected %d", i, blocks, expect.blocks)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package update
+
+import (
+	"encoding/hex"
+
+	"github.com/flatcar/mantle/update/metadata"
+)
+
+// Info describes a payload.
+type Info struct {
+	Version          uint64          `json:"version"`
+	ManifestSize     uint64          `json:"manifest_size"`
+	BlockSize        uint32          `json:"block_size"`
+	SignaturesOffset uint64          `json:"signatures_offset"`
+	SignaturesSize   uint64          `json:"signatures_size"`
+	Procedures       []ProcedureInfo `json:"procedures"`
+	Signatures       []SignatureInfo `json:"signatures,omitempty"`
+}
+
+// ProcedureInfo describes a procedure of a payload.
+type ProcedureInfo struct {
+	Type    string       `json:"type"`
+	OldInfo *InstallInfo `json:"old_info,omitempty"` // only set for deltas
+	NewInfo *InstallInfo `json:"new_info,omitempty"`
+	// Operations summarizes the operations by type.
+	Operations map[string]*OperationsInfo `json:"operations"`
+}
+
+// InstallInfo describes the source or destination of a procedure.
+type InstallInfo struct {
+	Size uint64 `json:"size"`
+	Hash string `json:"sha256"`
+}
+
+// OperationsInfo summarizes the operations of a type.
+type OperationsInfo struct {
+	Count int `json:"count"`
+	// Blocks is the number of destination blocks written.
+	Blocks uint64 `json:"blocks"`
+	// DataSize is the size of the operations' data in the payload.
+	DataSize uint64 `json:"data_size"`
+}
+
+// SignatureInfo describes a payload signature.
+type SignatureInfo struct {
+	Version uint32 `json:"version"`
+	Size    int    `json:"size"`
+}
+
+// Info describes the payload. The signatures are only included after
+// they have been read.
+func (p *Payload) Info() *Info {
+	info := &Info{
+		Version:          p.Header.Version,
+		ManifestSize:     p.Header.ManifestSize,
+		BlockSize:        p.Manifest.GetBlockSize(),
+		SignaturesOffset: p.Manifest.GetSignaturesOffset(),
+		SignaturesSize:   p.Manifest.GetSignaturesSize(),
+	}
+
+	for _, proc := range p.Procedures() {
+		procInfo := ProcedureInfo{
+			Type:       procedureName(proc.GetType()),
+			OldInfo:    newInstallInfo(proc.OldInfo),
+			NewInfo:    newInstallInfo(proc.NewInfo),
+			Operations: make(map[string]*OperationsInfo),
+		}
+		for _, op := range proc.Operations {
+			opInfo := procInfo.Operations[op.GetType().String()]
+			if opInfo == nil {
+				opInfo = &OperationsInfo{}
+				procInfo.Operations[op.GetType().String()] = opInfo
+			}
+			opInfo.Count++
+			opInfo.DataSize += uint64(op.GetDataLength())
+			for _, extent := range op.DstExtents {
+				opInfo.Blocks += extent.GetNumBlocks()
+			}
+		}
+		info.Procedures = append(info.Procedures, procInfo)
+	}
+
+	for _, sig := range p.Signatures.Signatures {
+		info.Signatures = append(info.Signatures, SignatureInfo{
+			Version: sig.GetVersion(),
+			Size:    len(sig.Data),
+		})
+	}
+
+	return info
+}
+
+func procedureName(t metadata.InstallProcedure_Type) string {
+	if t == installProcedure_partition {
+		return "partition"
+	}
+	return t.String()
+}
+
+func newInstallInfo(info *metadata.InstallInfo) *InstallInfo {
+	if info.GetSize() == 0 && len(info.GetHash()) == 0 {
+		return nil
+	}
+	return &InstallInfo{
+		Size: info.GetSize(),
+		Hash: hex.EncodeToString(info.GetHash()),
+	}
+}
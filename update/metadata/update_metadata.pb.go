@@ -40,23 +40,29 @@ const _ = proto.ProtoPackageIsVersion1
 type InstallOperation_Type int32
 
 const (
-	InstallOperation_REPLACE    InstallOperation_Type = 0
-	InstallOperation_REPLACE_BZ InstallOperation_Type = 1
-	InstallOperation_MOVE       InstallOperation_Type = 2
-	InstallOperation_BSDIFF     InstallOperation_Type = 3
+	InstallOperation_REPLACE             InstallOperation_Type = 0
+	InstallOperation_REPLACE_BZ          InstallOperation_Type = 1
+	InstallOperation_MOVE                InstallOperation_Type = 2
+	InstallOperation_BSDIFF              InstallOperation_Type = 3
+	InstallOperation_REPLACE_XZ          InstallOperation_Type = 8
+	InstallOperation_MANTLE_REPLACE_ZSTD InstallOperation_Type = 1000
 )
 
 var InstallOperation_Type_name = map[int32]string{
-	0: "REPLACE",
-	1: "REPLACE_BZ",
-	2: "MOVE",
-	3: "BSDIFF",
+	0:    "REPLACE",
+	1:    "REPLACE_BZ",
+	2:    "MOVE",
+	3:    "BSDIFF",
+	8:    "REPLACE_XZ",
+	1000: "MANTLE_REPLACE_ZSTD",
 }
 var InstallOperation_Type_value = map[string]int32{
-	"REPLACE":    0,
-	"REPLACE_BZ": 1,
-	"MOVE":       2,
-	"BSDIFF":     3,
+	"REPLACE":             0,
+	"REPLACE_BZ":          1,
+	"MOVE":                2,
+	"BSDIFF":              3,
+	"REPLACE_XZ":          8,
+	"MANTLE_REPLACE_ZSTD": 1000,
 }
 
 func (x InstallOperation_Type) Enum() *InstallOperation_Type {
@@ -490,40 +496,42 @@ func init() {
 }
 
 var fileDescriptor0 = []byte{
-	// 560 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xa4, 0x53, 0x5d, 0x6f, 0xd3, 0x30,
-	0x14, 0x5d, 0xdb, 0xd0, 0x76, 0x37, 0xdd, 0x1a, 0xcc, 0x80, 0xc0, 0x03, 0xaa, 0xc2, 0x4b, 0x41,
-	0x50, 0x41, 0x61, 0x93, 0x06, 0x48, 0xd0, 0xb1, 0x54, 0xaa, 0xd8, 0xd8, 0xb4, 0x21, 0x1e, 0x78,
-	0xb1, 0x42, 0xeb, 0x2e, 0x11, 0xa9, 0x1d, 0xc5, 0xee, 0x80, 0xfd, 0x09, 0x7e, 0x0a, 0x7f, 0x89,
-	0x9f, 0xc2, 0xb5, 0x9b, 0x26, 0xd3, 0xc4, 0x44, 0xa6, 0xbd, 0xf9, 0xeb, 0x9c, 0x7b, 0xcf, 0xb9,
-	0xc7, 0x70, 0x7b, 0x9e, 0x4c, 0x02, 0xc5, 0xe8, 0x8c, 0xa9, 0x00, 0x17, 0x41, 0x2f, 0x49, 0x85,
-	0x12, 0xe4, 0xce, 0x38, 0x4c, 0xc5, 0x8c, 0x09, 0x49, 0xb3, 0x7b, 0xc6, 0x4f, 0x22, 0xce, 0xbc,
-	0x3f, 0x55, 0x70, 0x46, 0x5c, 0xaa, 0x20, 0x8e, 0x0f, 0x12, 0x96, 0x06, 0x2a, 0x12, 0x9c, 0xbc,
-	0x06, 0x4b, 0xfd, 0x4c, 0x98, 0x5b, 0xe9, 0x54, 0xbb, 0xeb, 0xfd, 0xa7, 0xbd, 0x7f, 0x63, 0x7b,
-	0x17, 0x71, 0xbd, 0x4f, 0x08, 0x22, 0xb7, 0xc0, 0xd6, 0x75, 0xa9, 0x98, 0x4e, 0x25, 0x53, 0x6e,
-	0xb5, 0x53, 0xe9, 0xae, 0xe5, 0x87, 0x31, 0x42, 0x55, 0xe8, 0xd6, 0xcc, 0xe1, 0x0b, 0xb0, 0x65,
-	0x3a, 0xa6, 0xec, 0x87, 0x62, 0x5c, 0x49, 0xd7, 0xea, 0xd4, 0xba, 0x76, 0xff, 0xc1, 0x65, 0xd5,
-	0x7c, 0xf3, 0x8c, 0x10, 0x00, 0x0d, 0xca, 0x88, 0x6e, 0x20, 0x91, 0xa5, 0x89, 0x26, 0x52, 0xe5,
-	0x44, 0xf5, 0xb2, 0x44, 0x1a, 0x94, 0x11, 0x35, 0x0c, 0x91, 0x0b, 0x8e, 0x69, 0x53, 0x86, 0x41,
-	0x7f, 0x73, 0x8b, 0x86, 0x81, 0x0c, 0xdd, 0x26, 0xde, 0xb4, 0xbc, 0x6d, 0xb0, 0x8c, 0x3a, 0x1b,
-	0x1a, 0x47, 0xfe, 0xe1, 0xde, 0xe0, 0xbd, 0xef, 0xac, 0x90, 0x75, 0x80, 0x6c, 0x43, 0x77, 0xbe,
-	0x38, 0x15, 0xd2, 0x04, 0x6b, 0xff, 0xe0, 0xb3, 0xef, 0x54, 0x91, 0xbb, 0xbe, 0x73, 0xbc, 0x3b,
-	0x1a, 0x0e, 0x9d, 0x9a, 0xf7, 0x1c, 0xea, 0x59, 0x49, 0x74, 0x01, 0x1d, 0x4b, 0x15, 0xfd, 0x1a,
-	0x8b, 0xf1, 0x37, 0xb4, 0x57, 0xd7, 0xc4, 0xb7, 0x7c, 0x3e, 0x5b, 0x1c, 0x49, 0x63, 0x97, 0xe5,
-	0x9d, 0x01, 0x1c, 0x47, 0x27, 0x3c, 0x50, 0xf3, 0x94, 0x49, 0xf2, 0x0e, 0x25, 0xe7, 0x3b, 0x44,
-	0x69, 0x75, 0x4f, 0x2e, 0x53, 0x57, 0xe0, 0x8a, 0xe5, 0xfd, 0xc7, 0xb0, 0x9a, 0x6f, 0x48, 0x1b,
-	0x1a, 0xa7, 0x2c, 0x95, 0x38, 0x30, 0xd3, 0xc1, 0x1a, 0x69, 0x81, 0xa5, 0x55, 0x9b, 0xda, 0x2d,
-	0xef, 0x11, 0xd8, 0xd9, 0x60, 0x47, 0x7c, 0x2a, 0xf4, 0xa5, 0x8c, 0xce, 0x58, 0xd6, 0x2c, 0xee,
-	0x8c, 0x29, 0x8b, 0xa7, 0xbf, 0x8a, 0xf0, 0x1c, 0xa6, 0x62, 0xcc, 0x26, 0x9a, 0xfe, 0x6a, 0xe1,
-	0xc9, 0x71, 0x8b, 0xf0, 0xbc, 0x01, 0x10, 0xcb, 0x38, 0x69, 0x33, 0xb4, 0xd4, 0x6e, 0xd9, 0xfc,
-	0x91, 0x4d, 0x68, 0x8a, 0x78, 0x42, 0x23, 0xec, 0xdb, 0x44, 0xcc, 0xee, 0x3f, 0xfc, 0x0f, 0xd6,
-	0x48, 0x44, 0x18, 0x67, 0xdf, 0x17, 0x30, 0xab, 0x34, 0xcc, 0x23, 0x59, 0x24, 0x70, 0xd6, 0x1f,
-	0xfc, 0xa3, 0x8f, 0xfe, 0x9e, 0xb3, 0xe2, 0xfd, 0xae, 0xc1, 0xc6, 0x2e, 0x8b, 0x55, 0x30, 0x48,
-	0xc7, 0x61, 0x74, 0xca, 0xf6, 0x03, 0x1e, 0x4d, 0x99, 0x54, 0x64, 0x08, 0x1b, 0x09, 0x4e, 0x3e,
-	0xd2, 0x7d, 0xd2, 0x73, 0x12, 0x2b, 0x57, 0x94, 0x38, 0x80, 0x36, 0x17, 0x22, 0xa1, 0xd7, 0x70,
-	0xc9, 0x05, 0x30, 0x61, 0xa3, 0x66, 0xae, 0xe6, 0x2b, 0xbe, 0xb2, 0x5e, 0x3e, 0xdb, 0xde, 0x22,
-	0xf7, 0xe0, 0x66, 0x11, 0xb4, 0xe5, 0x07, 0xb6, 0xcc, 0xe0, 0xef, 0x42, 0xfb, 0xdc, 0x95, 0x41,
-	0x2e, 0xfe, 0xde, 0x5b, 0x20, 0xda, 0xf3, 0x42, 0x9c, 0xb1, 0xb1, 0x59, 0xde, 0x7d, 0x24, 0xd0,
-	0xee, 0x5f, 0x20, 0x58, 0x2d, 0x4f, 0x80, 0x99, 0x49, 0x96, 0x29, 0x92, 0x2e, 0x94, 0x72, 0x23,
-	0x8f, 0xdd, 0xdf, 0x00, 0x00, 0x00, 0xff, 0xff, 0x53, 0xd4, 0x06, 0x13, 0x30, 0x05, 0x00, 0x00,
+	// 589 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x93, 0xd1, 0x6e, 0xd3, 0x3e,
+	0x14, 0xc6, 0x97, 0x36, 0xff, 0x36, 0x3b, 0xe9, 0xb6, 0xfc, 0xbd, 0x01, 0x81, 0x0b, 0x54, 0x85,
+	0x9b, 0x80, 0xa0, 0x82, 0xc2, 0x26, 0x01, 0x93, 0x46, 0xc7, 0x32, 0x69, 0x62, 0xdd, 0xa6, 0xb5,
+	0x42, 0xa8, 0x37, 0x96, 0x49, 0xdd, 0x26, 0x22, 0xb5, 0xa3, 0xd8, 0x1d, 0x6c, 0x8f, 0xc0, 0x0d,
+	0x8f, 0xc2, 0x6b, 0xf1, 0x18, 0xc8, 0x6e, 0x9a, 0x56, 0x13, 0x13, 0x99, 0xb8, 0x8b, 0x8f, 0xfd,
+	0x7d, 0x3e, 0xe7, 0xcb, 0xcf, 0x70, 0x67, 0x9a, 0x0e, 0x89, 0xa4, 0x78, 0x42, 0x25, 0x19, 0x12,
+	0x49, 0x5a, 0x69, 0xc6, 0x25, 0x47, 0x77, 0xc3, 0x28, 0xe3, 0x13, 0xca, 0x05, 0xce, 0xf7, 0x29,
+	0x1b, 0xc7, 0x8c, 0x7a, 0xdf, 0xab, 0xe0, 0x1c, 0x31, 0x21, 0x49, 0x92, 0x9c, 0xa6, 0x34, 0x23,
+	0x32, 0xe6, 0x0c, 0xbd, 0x05, 0x53, 0x5e, 0xa6, 0xd4, 0x35, 0x9a, 0x15, 0x7f, 0xbd, 0xfd, 0xac,
+	0xf5, 0x67, 0x6d, 0xeb, 0xba, 0xae, 0xd5, 0xbf, 0x4c, 0x29, 0xda, 0x04, 0x5b, 0xdd, 0x8b, 0xf9,
+	0x68, 0x24, 0xa8, 0x74, 0x2b, 0x4d, 0xc3, 0x5f, 0x2b, 0x8a, 0x09, 0x65, 0x63, 0x19, 0xb9, 0x55,
+	0x5d, 0x7c, 0x09, 0xb6, 0xc8, 0x42, 0x4c, 0xbf, 0x49, 0xca, 0xa4, 0x70, 0xcd, 0x66, 0xd5, 0xb7,
+	0xdb, 0x0f, 0x6f, 0xba, 0x2d, 0xd0, 0xc7, 0x10, 0x02, 0x50, 0xa2, 0xdc, 0xe8, 0xbf, 0xa6, 0xe1,
+	0x9b, 0xca, 0x68, 0x28, 0x64, 0x61, 0x54, 0x2b, 0x6b, 0xa4, 0x44, 0xb9, 0x51, 0x5d, 0x1b, 0xb9,
+	0xe0, 0xe8, 0x36, 0x45, 0x44, 0xda, 0xdb, 0x3b, 0x38, 0x22, 0x22, 0x72, 0xad, 0xa6, 0xe1, 0x37,
+	0xbc, 0x10, 0x4c, 0x3d, 0x9d, 0x0d, 0xf5, 0xf3, 0xe0, 0xec, 0xb8, 0xf3, 0x3e, 0x70, 0x56, 0xd0,
+	0x3a, 0x40, 0xbe, 0xc0, 0xfb, 0x03, 0xc7, 0x40, 0x16, 0x98, 0xdd, 0xd3, 0x8f, 0x81, 0x53, 0x41,
+	0x00, 0xb5, 0xfd, 0xde, 0xc1, 0xd1, 0xe1, 0xa1, 0x53, 0x5d, 0x3e, 0xf5, 0x69, 0xe0, 0x58, 0xc8,
+	0x85, 0xcd, 0x6e, 0xe7, 0xa4, 0x7f, 0x1c, 0xe0, 0x79, 0x79, 0xd0, 0xeb, 0x1f, 0x38, 0xbf, 0xea,
+	0xde, 0x0b, 0xa8, 0xe5, 0xcd, 0x6d, 0x82, 0x2d, 0x24, 0xc9, 0x24, 0xfe, 0x9c, 0xf0, 0xf0, 0x8b,
+	0x6b, 0xe8, 0xee, 0x10, 0x00, 0x9b, 0x4e, 0x66, 0x25, 0xa1, 0x83, 0x35, 0xbd, 0x2b, 0x80, 0x5e,
+	0x3c, 0x66, 0x44, 0x4e, 0x33, 0x2a, 0xd0, 0x3b, 0x00, 0x51, 0xac, 0x5c, 0x43, 0xe7, 0xf0, 0xf4,
+	0xa6, 0x1c, 0x16, 0xba, 0xc5, 0xe7, 0x83, 0x27, 0xb0, 0x5a, 0x2c, 0xd0, 0x06, 0xd4, 0x2f, 0x68,
+	0x26, 0x62, 0xce, 0x74, 0x07, 0x6b, 0xa8, 0x01, 0xa6, 0xca, 0x47, 0xdf, 0xdd, 0xf0, 0x1e, 0x83,
+	0x9d, 0x23, 0x70, 0xc4, 0x46, 0x5c, 0x6d, 0x8a, 0xf8, 0x8a, 0xe6, 0xcd, 0x36, 0xc0, 0xd4, 0xf1,
+	0xcd, 0x8e, 0xfe, 0xa8, 0x14, 0x98, 0x9d, 0x65, 0x3c, 0xa4, 0x43, 0x65, 0x7f, 0x3b, 0xcc, 0x0a,
+	0xdd, 0x0c, 0xb3, 0x5d, 0x00, 0x3e, 0x07, 0x4f, 0x85, 0xa1, 0x46, 0xf5, 0xcb, 0x92, 0x8a, 0xb6,
+	0xc1, 0xe2, 0xc9, 0x10, 0xc7, 0x6c, 0xc4, 0x35, 0x8c, 0x76, 0xfb, 0xd1, 0x5f, 0xb4, 0x7a, 0xc4,
+	0x6d, 0xb0, 0x18, 0xfd, 0x3a, 0x93, 0x99, 0xa5, 0x65, 0x1e, 0xca, 0xe1, 0x01, 0xa8, 0x7d, 0x08,
+	0xce, 0x4f, 0x82, 0x63, 0x67, 0xc5, 0xfb, 0x59, 0x85, 0xad, 0x03, 0x9a, 0x48, 0xd2, 0xc9, 0xc2,
+	0x28, 0xbe, 0xa0, 0x5d, 0xc2, 0xe2, 0x11, 0x15, 0x12, 0x1d, 0xc2, 0x56, 0x4a, 0x32, 0x19, 0xab,
+	0x3e, 0xf1, 0xd2, 0x88, 0xc6, 0x2d, 0x47, 0xec, 0xc0, 0x06, 0xe3, 0x3c, 0xc5, 0xff, 0x90, 0x92,
+	0x0b, 0xa0, 0x61, 0xc3, 0xfa, 0xbf, 0xea, 0x47, 0xfb, 0xc6, 0x7c, 0xf5, 0xfc, 0xf5, 0x0e, 0xba,
+	0x0f, 0xff, 0x2f, 0x40, 0x9b, 0x3f, 0x75, 0x53, 0xff, 0xf8, 0x7b, 0xb0, 0xb1, 0xb4, 0xa5, 0x95,
+	0xb3, 0x57, 0xba, 0x07, 0x48, 0x65, 0xbe, 0x18, 0x4e, 0xc7, 0x68, 0x95, 0x4f, 0x7f, 0x0f, 0x90,
+	0x4a, 0xff, 0x9a, 0xc1, 0x6a, 0x79, 0x83, 0x5d, 0x80, 0x74, 0x4e, 0x91, 0x70, 0xa1, 0x54, 0x1a,
+	0x05, 0x76, 0xbf, 0x07, 0x00, 0xb9, 0x6b, 0x1e, 0x13, 0x5a, 0x05, 0x00, 0x00,
 }
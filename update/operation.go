@@ -21,11 +21,17 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"math"
 	"os"
+	"os/exec"
 
 	"github.com/flatcar/mantle/update/metadata"
 )
 
+// sparseHole is the start block of extents which aren't backed by data.
+// Reading them yields zeros and data written to them is discarded.
+const sparseHole = math.MaxUint64
+
 type Operation struct {
 	hash.Hash
 	io.LimitedReader
@@ -51,9 +57,10 @@ func NewOperation(payload *Payload, proc *metadata.InstallProcedure, op *metadat
 
 func (op *Operation) Verify() error {
 	switch op.Operation.GetType() {
-	case metadata.InstallOperation_REPLACE:
-		fallthrough
-	case metadata.InstallOperation_REPLACE_BZ:
+	case metadata.InstallOperation_REPLACE,
+		metadata.InstallOperation_REPLACE_BZ,
+		metadata.InstallOperation_REPLACE_XZ,
+		metadata.InstallOperation_MANTLE_REPLACE_ZSTD:
 		if err := op.verifyOffset(); err != nil {
 			return err
 		}
@@ -67,14 +74,37 @@ func (op *Operation) Verify() error {
 			return err
 		}
 	case metadata.InstallOperation_MOVE:
-		return fmt.Errorf("MOVE")
+		if err := op.verifyMove(); err != nil {
+			return err
+		}
 	case metadata.InstallOperation_BSDIFF:
-		return fmt.Errorf("BSDIFF")
+		if _, err := op.readPatch(); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+func (op *Operation) verifyMove() error {
+	if op.Operation.GetDataLength() != 0 {
+		return fmt.Errorf("move contains payload data")
+	}
+	src, dst := countBlocks(op.Operation.SrcExtents), countBlocks(op.Operation.DstExtents)
+	if src != dst {
+		return fmt.Errorf("move from %d blocks to %d blocks", src, dst)
+	}
+	return nil
+}
+
+func countBlocks(extents []*metadata.Extent) uint64 {
+	var blocks uint64
+	for _, extent := range extents {
+		blocks += extent.GetNumBlocks()
+	}
+	return blocks
+}
+
 func (op *Operation) verifyOffset() error {
 	if int64(op.Operation.GetDataOffset()) != op.Payload.Offset {
 		return fmt.Errorf("expected payload data offset %d not %d",
@@ -103,6 +133,10 @@ func (op *Operation) Apply(dst, src *os.File) error {
 		return op.replace(dst, op)
 	case metadata.InstallOperation_REPLACE_BZ:
 		return op.replace(dst, bzip2.NewReader(op))
+	case metadata.InstallOperation_REPLACE_XZ:
+		return op.replace(dst, &execReader{op: op, name: "xz", args: []string{"-dc"}})
+	case metadata.InstallOperation_MANTLE_REPLACE_ZSTD:
+		return op.replace(dst, &execReader{op: op, name: "zstd", args: []string{"-dcq"}})
 	case metadata.InstallOperation_MOVE:
 		return op.move(dst, src)
 	case metadata.InstallOperation_BSDIFF:
@@ -161,10 +195,137 @@ func (op *Operation) replace(dst *os.File, src io.Reader) error {
 	return op.verifyHash()
 }
 
+// execReader decompresses the data of an operation with a command, for
+// formats without a Go decoder. The command is run on the first read so
+// the data offset can be verified before.
+type execReader struct {
+	op   *Operation
+	name string
+	args []string
+	r    io.Reader
+}
+
+func (e *execReader) Read(p []byte) (int, error) {
+	if e.r == nil {
+		cmd := exec.Command(e.name, e.args...)
+		cmd.Stdin = e.op
+		out, err := cmd.Output()
+		if err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				err = fmt.Errorf("%v: %s", err, bytes.TrimSpace(exitErr.Stderr))
+			}
+			return 0, fmt.Errorf("%s: %v", e.name, err)
+		}
+		e.r = bytes.NewReader(out)
+	}
+	return e.r.Read(p)
+}
+
 func (op *Operation) move(dst, src *os.File) error {
-	return fmt.Errorf("MOVE")
+	if err := op.verifyMove(); err != nil {
+		return err
+	}
+	if src == nil {
+		return fmt.Errorf("move requires a source partition")
+	}
+
+	// All source extents are read before writing anything so extents
+	// may overlap when updating a partition in place.
+	bs := uint64(op.Payload.Manifest.GetBlockSize())
+	data, err := op.readExtents(src, countBlocks(op.Operation.SrcExtents)*bs)
+	if err != nil {
+		return err
+	}
+	return op.writeExtents(dst, data)
 }
 
 func (op *Operation) bsdiff(dst, src *os.File) error {
-	return fmt.Errorf("BSDIFF")
+	if src == nil {
+		return fmt.Errorf("bsdiff requires a source partition")
+	}
+	patch, err := op.readPatch()
+	if err != nil {
+		return err
+	}
+	old, err := op.readExtents(src, op.Operation.GetSrcLength())
+	if err != nil {
+		return err
+	}
+	data, err := bspatch(old, patch, int64(op.Operation.GetDstLength()))
+	if err != nil {
+		return err
+	}
+
+	// Fill up the last block with zeros, like update_engine.
+	bs := uint64(op.Payload.Manifest.GetBlockSize())
+	if size := countBlocks(op.Operation.DstExtents) * bs; size > uint64(len(data)) {
+		data = append(data, make([]byte, size-uint64(len(data)))...)
+	}
+	return op.writeExtents(dst, data)
+}
+
+// readPatch reads the operation's payload data and verifies its hash.
+func (op *Operation) readPatch() ([]byte, error) {
+	if err := op.verifyOffset(); err != nil {
+		return nil, err
+	}
+	if len(op.Operation.SrcExtents) == 0 {
+		return nil, fmt.Errorf("bsdiff missing source extents")
+	}
+	patch, err := io.ReadAll(op)
+	if err != nil {
+		return nil, err
+	}
+	if op.N != 0 {
+		return nil, fmt.Errorf("bsdiff data truncated by %d bytes", op.N)
+	}
+	if err := op.verifyHash(); err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+// readExtents reads the first length bytes of the source extents.
+func (op *Operation) readExtents(src *os.File, length uint64) ([]byte, error) {
+	bs := uint64(op.Payload.Manifest.GetBlockSize())
+	if size := countBlocks(op.Operation.SrcExtents) * bs; length > size {
+		return nil, fmt.Errorf("source length %d exceeds source extents of %d bytes", length, size)
+	}
+
+	data := make([]byte, length)
+	var pos uint64
+	for _, extent := range op.Operation.SrcExtents {
+		if pos == length {
+			break
+		}
+		n := min(extent.GetNumBlocks()*bs, length-pos)
+		if extent.GetStartBlock() != sparseHole {
+			if _, err := src.ReadAt(data[pos:pos+n], int64(extent.GetStartBlock()*bs)); err != nil {
+				return nil, err
+			}
+		}
+		pos += n
+	}
+	return data, nil
+}
+
+// writeExtents writes data to the destination extents, which must cover
+// exactly the data.
+func (op *Operation) writeExtents(dst *os.File, data []byte) error {
+	bs := uint64(op.Payload.Manifest.GetBlockSize())
+	if size := countBlocks(op.Operation.DstExtents) * bs; size != uint64(len(data)) {
+		return fmt.Errorf("%d bytes don't fit destination extents of %d bytes", len(data), size)
+	}
+
+	var pos uint64
+	for _, extent := range op.Operation.DstExtents {
+		n := extent.GetNumBlocks() * bs
+		if extent.GetStartBlock() != sparseHole {
+			if _, err := dst.WriteAt(data[pos:pos+n], int64(extent.GetStartBlock()*bs)); err != nil {
+				return err
+			}
+		}
+		pos += n
+	}
+	return nil
 }
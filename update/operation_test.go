@@ -0,0 +1,259 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package update
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/flatcar/mantle/update/metadata"
+	"github.com/flatcar/mantle/update/signature"
+)
+
+const testBlockSize = 4096
+
+// testImage returns an image of the given number of blocks, each filled
+// with its index plus one.
+func testImage(blocks int) []byte {
+	img := make([]byte, blocks*testBlockSize)
+	for i := range img {
+		img[i] = byte(i/testBlockSize + 1)
+	}
+	return img
+}
+
+func testFile(t *testing.T, name string, data []byte) *os.File {
+	f, err := os.Create(filepath.Join(t.TempDir(), name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func readFile(t *testing.T, f *os.File) []byte {
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func extents(startAndCount ...uint64) []*metadata.Extent {
+	var ret []*metadata.Extent
+	for i := 0; i < len(startAndCount); i += 2 {
+		ret = append(ret, &metadata.Extent{
+			StartBlock: proto.Uint64(startAndCount[i]),
+			NumBlocks:  proto.Uint64(startAndCount[i+1]),
+		})
+	}
+	return ret
+}
+
+// testOperation wraps an install operation with its payload data.
+func testOperation(op *metadata.InstallOperation, data []byte) *Operation {
+	op.DataOffset = proto.Uint32(0)
+	op.DataLength = proto.Uint32(uint32(len(data)))
+	if len(data) != 0 {
+		sum := sha256.Sum256(data)
+		op.DataSha256Hash = sum[:]
+	}
+	payload := &Payload{
+		h: signature.NewSignatureHash(),
+		r: bytes.NewReader(data),
+		Manifest: metadata.DeltaArchiveManifest{
+			BlockSize: proto.Uint32(testBlockSize),
+		},
+	}
+	return NewOperation(payload, &metadata.InstallProcedure{}, op)
+}
+
+func compress(t *testing.T, data []byte) []byte {
+	cmd := exec.Command("bzip2", "-c")
+	cmd.Stdin = bytes.NewReader(data)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Skipf("bzip2 unavailable: %v", err)
+	}
+	return out
+}
+
+func offtout(x int64) []byte {
+	b := make([]byte, 8)
+	if x < 0 {
+		binary.LittleEndian.PutUint64(b, uint64(-x))
+		b[7] |= 0x80
+	} else {
+		binary.LittleEndian.PutUint64(b, uint64(x))
+	}
+	return b
+}
+
+// testPatch builds a BSDIFF40 patch from control triples and the
+// uncompressed diff and extra blocks.
+func testPatch(t *testing.T, newSize int, ctrl [][3]int64, diff, extra []byte) []byte {
+	var ctrlBlock []byte
+	for _, c := range ctrl {
+		for _, x := range c {
+			ctrlBlock = append(ctrlBlock, offtout(x)...)
+		}
+	}
+	ctrlBlock = compress(t, ctrlBlock)
+	diffBlock := compress(t, diff)
+
+	patch := []byte(bsdiffMagic)
+	patch = append(patch, offtout(int64(len(ctrlBlock)))...)
+	patch = append(patch, offtout(int64(len(diffBlock)))...)
+	patch = append(patch, offtout(int64(newSize))...)
+	patch = append(patch, ctrlBlock...)
+	patch = append(patch, diffBlock...)
+	return append(patch, compress(t, extra)...)
+}
+
+func TestMove(t *testing.T) {
+	src := testFile(t, "src", testImage(4))
+	dst := testFile(t, "dst", nil)
+
+	op := testOperation(&metadata.InstallOperation{
+		Type:       metadata.InstallOperation_MOVE.Enum(),
+		SrcExtents: extents(2, 2, 0, 1),
+		DstExtents: extents(0, 2, sparseHole, 1),
+	}, nil)
+	if err := op.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Apply(dst, src); err != nil {
+		t.Fatal(err)
+	}
+	img := testImage(4)
+	if got := readFile(t, dst); !bytes.Equal(got, img[2*testBlockSize:]) {
+		t.Errorf("got blocks starting with %v", got[0])
+	}
+}
+
+func TestMoveOverlapping(t *testing.T) {
+	f := testFile(t, "img", testImage(3))
+
+	// in-place move of blocks 0 and 1 to 1 and 2
+	op := testOperation(&metadata.InstallOperation{
+		Type:       metadata.InstallOperation_MOVE.Enum(),
+		SrcExtents: extents(0, 2),
+		DstExtents: extents(1, 2),
+	}, nil)
+	if err := op.Apply(f, f); err != nil {
+		t.Fatal(err)
+	}
+	img := testImage(3)
+	expect := append(img[:testBlockSize:testBlockSize], img[:2*testBlockSize]...)
+	if got := readFile(t, f); !bytes.Equal(got, expect) {
+		t.Error("overlapping move corrupted data")
+	}
+}
+
+func TestMoveInvalid(t *testing.T) {
+	op := testOperation(&metadata.InstallOperation{
+		Type:       metadata.InstallOperation_MOVE.Enum(),
+		SrcExtents: extents(0, 2),
+		DstExtents: extents(1, 1),
+	}, nil)
+	if err := op.Verify(); err == nil {
+		t.Error("move with mismatched extents verified")
+	}
+}
+
+func TestBsdiff(t *testing.T) {
+	old := testImage(2)
+	expect := append([]byte{}, old[:testBlockSize+100]...)
+	for i := range 10 {
+		expect[i] = 0xff
+	}
+
+	// add the first 10 bytes with a diff, copy the next ones unchanged
+	// and the rest from the old data
+	diff := make([]byte, testBlockSize+100)
+	for i := range 10 {
+		diff[i] = 0xff - old[i]
+	}
+	patch := testPatch(t, len(expect), [][3]int64{{int64(len(diff)), 0, 0}}, diff, nil)
+
+	src := testFile(t, "src", old)
+	dst := testFile(t, "dst", nil)
+	op := testOperation(&metadata.InstallOperation{
+		Type:       metadata.InstallOperation_BSDIFF.Enum(),
+		SrcExtents: extents(0, 2),
+		SrcLength:  proto.Uint64(uint64(len(old))),
+		DstExtents: extents(1, 1, 0, 1),
+		DstLength:  proto.Uint64(uint64(len(expect))),
+	}, patch)
+	if err := op.Apply(dst, src); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readFile(t, dst)
+	padded := append(expect, make([]byte, 2*testBlockSize-len(expect))...)
+	if !bytes.Equal(got[testBlockSize:], padded[:testBlockSize]) || !bytes.Equal(got[:testBlockSize], padded[testBlockSize:]) {
+		t.Error("bsdiff produced wrong data")
+	}
+}
+
+func TestBsdiffBadHash(t *testing.T) {
+	patch := testPatch(t, 1, [][3]int64{{0, 1, 0}}, nil, []byte{1})
+	op := testOperation(&metadata.InstallOperation{
+		Type:       metadata.InstallOperation_BSDIFF.Enum(),
+		SrcExtents: extents(0, 1),
+		DstExtents: extents(0, 1),
+		DstLength:  proto.Uint64(1),
+	}, patch)
+	op.Operation.DataSha256Hash[0]++
+	if err := op.Verify(); err == nil {
+		t.Error("bsdiff with bad hash verified")
+	}
+}
+
+func TestBspatch(t *testing.T) {
+	old := []byte("abcdefghij")
+	// add 3 bytes of old data, insert "XYZ", skip 4 bytes, add 3 more
+	patch := testPatch(t, 9,
+		[][3]int64{{3, 3, 4}, {3, 0, 0}},
+		[]byte{0, 0, 0, 0, 0, 0x100 + 'H' - 'j'},
+		[]byte("XYZ"))
+	got, err := bspatch(old, patch, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "abcXYZhiH" {
+		t.Errorf("got %q", got)
+	}
+
+	if _, err := bspatch(old, patch[:40], 9); err == nil {
+		t.Error("truncated patch applied")
+	}
+	if _, err := bspatch(old, patch, 10); err == nil {
+		t.Error("patch applied with wrong destination length")
+	}
+}
+
+func TestBspatchHugeControl(t *testing.T) {
+	old := []byte("abcdefghij")
+	for _, ctrl := range [][][3]int64{
+		{{3, 0, 0}, {math.MaxInt64, 0, 0}},
+		{{3, math.MaxInt64, 0}},
+	} {
+		patch := testPatch(t, 9, ctrl, make([]byte, 9), nil)
+		if _, err := bspatch(old, patch, 9); err != InvalidBsdiff {
+			t.Errorf("control %v: expected InvalidBsdiff, got %v", ctrl, err)
+		}
+	}
+}
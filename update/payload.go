@@ -47,6 +47,10 @@ type Payload struct {
 	// excluding the header and manifest.
 	Offset int64
 
+	// Verifier checks the signatures in VerifySignature,
+	// signature.DeveloperVerifier if nil.
+	Verifier *signature.Verifier
+
 	// Parsed metadata contained in the payload.
 	Header     metadata.DeltaArchiveHeader
 	Manifest   metadata.DeltaArchiveManifest
@@ -134,30 +138,51 @@ func (p *Payload) VerifySignature() error {
 			p.Manifest.GetSignaturesOffset(), p.Offset)
 	}
 
+	sum, err := p.ReadSignatures()
+	if err != nil {
+		return err
+	}
+
+	verifier := p.Verifier
+	if verifier == nil {
+		verifier = signature.DeveloperVerifier
+	}
+	return verifier.Verify(sum, &p.Signatures)
+}
+
+// ReadSignatures reads the signatures without verifying them, skipping
+// any payload data which hasn't been read yet. It returns the hash of the
+// signed portion of the payload.
+func (p *Payload) ReadSignatures() ([]byte, error) {
+	offset := int64(p.Manifest.GetSignaturesOffset())
+	if p.Offset > offset {
+		return nil, fmt.Errorf("read %d bytes past the signature offset %d",
+			p.Offset-offset, offset)
+	}
+	if _, err := io.CopyN(io.Discard, p, offset-p.Offset); err != nil {
+		return nil, err
+	}
+
 	// Get the final hash of the signed portion of the payload.
 	sum := p.Sum()
 
 	buf := make([]byte, p.Manifest.GetSignaturesSize())
 	if _, err := io.ReadFull(p, buf); err != nil {
-		return err
+		return nil, err
 	}
 
 	if err := proto.Unmarshal(buf, &p.Signatures); err != nil {
-		return err
-	}
-
-	if err := signature.VerifySignature(sum, &p.Signatures); err != nil {
-		return err
+		return nil, err
 	}
 
 	// There shouldn't be any extra data following the signatures.
 	if n, err := io.Copy(io.Discard, p); err != nil {
-		return fmt.Errorf("trailing read failure: %v", err)
+		return nil, fmt.Errorf("trailing read failure: %v", err)
 	} else if n != 0 {
-		return fmt.Errorf("found %d trailing bytes", n)
+		return nil, fmt.Errorf("found %d trailing bytes", n)
 	}
 
-	return nil
+	return sum, nil
 }
 
 func (p *Payload) Procedures() []*metadata.InstallProcedure {
@@ -0,0 +1,211 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package signature
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// sha256DigestInfo is the DER prefix of a SHA-256 hash in a PKCS #1 v1.5
+// signature, for signers which don't add it themselves.
+var sha256DigestInfo = []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}
+
+// PrivateKey is a Key held in memory.
+type PrivateKey struct {
+	*rsa.PrivateKey
+}
+
+// ParsePrivateKey parses a PEM encoded PKCS #1 or PKCS #8 RSA private key.
+func ParsePrivateKey(data []byte) (*PrivateKey, error) {
+	pemBlock, _ := pem.Decode(data)
+	if pemBlock == nil {
+		return nil, fmt.Errorf("unable to parse key")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(pemBlock.Bytes); err == nil {
+		return &PrivateKey{key}, nil
+	}
+	someKey, err := x509.ParsePKCS8PrivateKey(pemBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := someKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unexpected key type %T", someKey)
+	}
+	return &PrivateKey{key}, nil
+}
+
+// LoadPrivateKey reads a PEM encoded RSA private key file.
+func LoadPrivateKey(path string) (*PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return key, nil
+}
+
+func mustParsePrivateKey(data string) *PrivateKey {
+	key, err := ParsePrivateKey([]byte(data))
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func (k *PrivateKey) Public() *rsa.PublicKey {
+	return &k.PrivateKey.PublicKey
+}
+
+func (k *PrivateKey) SignHash(sum []byte) ([]byte, error) {
+	return rsa.SignPKCS1v15(rand.Reader, k.PrivateKey, signatureHash, sum)
+}
+
+// CommandKey signs by running an external command, which gets the raw
+// SHA-256 hash on stdin and must write the raw signature to stdout.
+type CommandKey struct {
+	Command   []string
+	PublicKey *rsa.PublicKey
+}
+
+func (k *CommandKey) Public() *rsa.PublicKey {
+	return k.PublicKey
+}
+
+func (k *CommandKey) SignHash(sum []byte) ([]byte, error) {
+	if len(k.Command) == 0 {
+		return nil, fmt.Errorf("no signing command")
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(k.Command[0], k.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(sum)
+	cmd.Stderr = &stderr
+	sig, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", k.Command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return sig, nil
+}
+
+// HTTPKey signs using a signing service. The raw SHA-256 hash is POSTed
+// to URL as application/octet-stream and the response body must be the
+// raw signature.
+type HTTPKey struct {
+	URL       string
+	PublicKey *rsa.PublicKey
+	// Client is used for requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+func (k *HTTPKey) Public() *rsa.PublicKey {
+	return k.PublicKey
+}
+
+func (k *HTTPKey) SignHash(sum []byte) ([]byte, error) {
+	client := k.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(k.URL, "application/octet-stream", bytes.NewReader(sum))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// A signature is never larger than the key.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(k.PublicKey.Size())+1))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s: %s", k.URL, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// PKCS11Key signs with a key on a PKCS #11 token, e.g. an HSM or
+// SoftHSM, using pkcs11-tool from OpenSC.
+type PKCS11Key struct {
+	// Module is the path of the PKCS #11 module.
+	Module string
+	// Token is the label of the token, the first token if empty.
+	Token string
+	// ID is the hex encoded object ID of the key. If empty, Label is
+	// used to find it.
+	ID    string
+	Label string
+	// PIN logs in to the token. It is written to the standard input of
+	// pkcs11-tool, which prompts for it, so it doesn't show up in the
+	// process list. If empty, the key is used without logging in.
+	PIN string
+
+	PublicKey *rsa.PublicKey
+}
+
+func (k *PKCS11Key) Public() *rsa.PublicKey {
+	return k.PublicKey
+}
+
+func (k *PKCS11Key) SignHash(sum []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "mantle-pkcs11-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// The RSA-PKCS mechanism only pads, so the DigestInfo is added here.
+	input := filepath.Join(dir, "digest")
+	output := filepath.Join(dir, "signature")
+	if err := os.WriteFile(input, append(append([]byte{}, sha256DigestInfo...), sum...), 0600); err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"--module", k.Module,
+		"--sign", "--mechanism", "RSA-PKCS",
+		"--input-file", input,
+		"--output-file", output,
+	}
+	if k.Token != "" {
+		args = append(args, "--token-label", k.Token)
+	}
+	if k.ID != "" {
+		if _, err := hex.DecodeString(k.ID); err != nil {
+			return nil, fmt.Errorf("invalid key ID %q: %v", k.ID, err)
+		}
+		args = append(args, "--id", k.ID)
+	} else {
+		args = append(args, "--label", k.Label)
+	}
+	if k.PIN != "" {
+		args = append(args, "--login")
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("pkcs11-tool", args...)
+	if k.PIN != "" {
+		cmd.Stdin = strings.NewReader(k.PIN + "\n")
+	}
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("pkcs11-tool: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return os.ReadFile(output)
+}
@@ -0,0 +1,227 @@
+// Copyright The Mantle Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package signature
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func newTestKey(t *testing.T) (*PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return &PrivateKey{key}, path
+}
+
+func writePublicKey(t *testing.T, key *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pub.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// checkSigner signs with key and verifies the signature.
+func checkSigner(t *testing.T, key Key) {
+	signer := NewSigner(key)
+	sigs, err := signer.Sign(testHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := signer.SignaturesSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != proto.Size(sigs) {
+		t.Errorf("signatures are %d bytes, expected %d", proto.Size(sigs), size)
+	}
+	if err := NewVerifier(key.Public()).Verify(testHash, sigs); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPrivateKeyFile(t *testing.T) {
+	_, path := newTestKey(t)
+	key, err := LoadPrivateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSigner(t, key)
+}
+
+func TestMultipleSignatures(t *testing.T) {
+	newKey, _ := newTestKey(t)
+	otherKey, _ := newTestKey(t)
+
+	// sign with the old and new key during a key rotation
+	devKey := mustParsePrivateKey(developerSecKey)
+	signer := NewSigner(devKey, newKey)
+	sigs, err := signer.Sign(testHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs.Signatures) != 2 {
+		t.Fatalf("got %d signatures", len(sigs.Signatures))
+	}
+	if size, _ := signer.SignaturesSize(); size != proto.Size(sigs) {
+		t.Errorf("signatures are %d bytes, expected %d", proto.Size(sigs), size)
+	}
+
+	verifier, err := LoadVerifier(writePublicKey(t, otherKey.Public()), writePublicKey(t, newKey.Public()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.Verify(testHash, sigs); err != nil {
+		t.Error(err)
+	}
+	if err := VerifySignature(testHash, sigs); err != nil {
+		t.Error(err)
+	}
+	if err := NewVerifier(otherKey.Public()).Verify(testHash, sigs); err == nil {
+		t.Error("signatures verified by an unrelated key")
+	}
+}
+
+func TestVerifyAnySignature(t *testing.T) {
+	key, _ := newTestKey(t)
+	sigs, err := NewSigner(mustParsePrivateKey(developerSecKey), key).Sign(testHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a single valid signature is enough
+	sigs.Signatures[0].Data = append([]byte{}, sigs.Signatures[0].Data...)
+	sigs.Signatures[0].Data[0] ^= 0xff
+	if err := NewVerifier(key.Public()).Verify(testHash, sigs); err != nil {
+		t.Errorf("valid signature rejected next to a corrupt one: %v", err)
+	}
+	if err := VerifySignature(testHash, sigs); err == nil {
+		t.Error("corrupt signature verified")
+	}
+
+	sigs.Signatures[1].Data[0] ^= 0xff
+	if err := NewVerifier(key.Public()).Verify(testHash, sigs); err == nil {
+		t.Error("corrupt signatures verified")
+	}
+}
+
+func TestCommandKey(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip(err)
+	}
+	key, path := newTestKey(t)
+	checkSigner(t, &CommandKey{
+		Command:   []string{"openssl", "pkeyutl", "-sign", "-inkey", path, "-pkeyopt", "digest:sha256"},
+		PublicKey: key.Public(),
+	})
+
+	// signatures not matching the public key are rejected
+	otherKey, _ := newTestKey(t)
+	signer := NewSigner(&CommandKey{
+		Command:   []string{"openssl", "pkeyutl", "-sign", "-inkey", path, "-pkeyopt", "digest:sha256"},
+		PublicKey: otherKey.Public(),
+	})
+	if _, err := signer.Sign(testHash); err == nil {
+		t.Error("signature by the wrong key accepted")
+	}
+}
+
+func TestHTTPKey(t *testing.T) {
+	key, _ := newTestKey(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sum, err := io.ReadAll(r.Body)
+		if err != nil || len(sum) != sha256.Size {
+			http.Error(w, "bad hash", http.StatusBadRequest)
+			return
+		}
+		sig, err := key.SignHash(sum)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(sig)
+	}))
+	defer server.Close()
+
+	checkSigner(t, &HTTPKey{URL: server.URL, PublicKey: key.Public()})
+
+	_, err := (&HTTPKey{URL: server.URL + "/missing", PublicKey: key.Public(), Client: server.Client()}).SignHash([]byte("short"))
+	if err == nil {
+		t.Error("error response accepted")
+	}
+}
+
+func TestPKCS11Key(t *testing.T) {
+	for _, tool := range []string{"softhsm2-util", "pkcs11-tool"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skip(err)
+		}
+	}
+	var module string
+	for _, path := range []string{
+		"/usr/lib/softhsm/libsofthsm2.so",
+		"/usr/lib64/softhsm/libsofthsm2.so",
+		"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+		"/usr/lib64/pkcs11/libsofthsm2.so",
+	} {
+		if _, err := os.Stat(path); err == nil {
+			module = path
+			break
+		}
+	}
+	if module == "" {
+		t.Skip("SoftHSM module not found")
+	}
+
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "softhsm2.conf")
+	if err := os.WriteFile(conf, []byte("directories.tokendir = "+dir+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+
+	key, path := newTestKey(t)
+	for _, args := range [][]string{
+		{"--init-token", "--free", "--label", "mantle", "--pin", "1234", "--so-pin", "1234"},
+		{"--import", path, "--token", "mantle", "--label", "payload", "--id", "01", "--pin", "1234"},
+	} {
+		if out, err := exec.Command("softhsm2-util", args...).CombinedOutput(); err != nil {
+			t.Fatalf("softhsm2-util: %v: %s", err, out)
+		}
+	}
+
+	checkSigner(t, &PKCS11Key{
+		Module:    module,
+		Token:     "mantle",
+		ID:        "01",
+		PIN:       "1234",
+		PublicKey: key.Public(),
+	})
+}
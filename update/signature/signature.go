@@ -16,13 +16,13 @@ package signature
 
 import (
 	"crypto"
-	"crypto/rand"
 	"crypto/rsa"
 	_ "crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"hash"
+	"os"
 
 	"github.com/coreos/pkg/capnslog"
 	"github.com/golang/protobuf/proto"
@@ -76,106 +76,175 @@ bsy1Gm/UYLTc8+S3fq/xjg9RCjW9JMwavAwL6oVNNt7nyAXPfvSu
 
 var (
 	plog = capnslog.NewPackageLogger("github.com/flatcar/mantle", "update/signature")
+
+	// DeveloperKey signs payloads with the well-known developer key.
+	DeveloperKey Signer = NewSigner(mustParsePrivateKey(developerSecKey))
+
+	// DeveloperVerifier accepts payloads signed by the developer key.
+	DeveloperVerifier = NewVerifier(mustParsePublicKey(developerPubKey))
 )
 
-func NewSignatureHash() hash.Hash {
-	return signatureHash.New()
+// Signer signs the hashes of update payloads.
+type Signer interface {
+	// SignaturesSize returns the size of the encoded signatures,
+	// which must be known before signing.
+	SignaturesSize() (int, error)
+	Sign(sum []byte) (*metadata.Signatures, error)
 }
 
-func keySize() (int, error) {
-	pemBlock, _ := pem.Decode([]byte(developerPubKey))
-	if pemBlock == nil {
-		return 0, fmt.Errorf("unable to parse key")
-	}
-
-	somePub, err := x509.ParsePKIXPublicKey(pemBlock.Bytes)
-	if err != nil {
-		return 0, err
-	}
+// Key signs hashes with a single RSA private key, which may be held
+// elsewhere.
+type Key interface {
+	// Public returns the public key.
+	Public() *rsa.PublicKey
+	// SignHash returns the PKCS #1 v1.5 signature of a SHA-256 hash.
+	SignHash(sum []byte) ([]byte, error)
+}
 
-	rsaPub, ok := somePub.(*rsa.PublicKey)
-	if !ok {
-		return 0, fmt.Errorf("unexpected key type %T", somePub)
-	}
+type signer []Key
 
-	// This is how the rsa package computes key length.
-	return (rsaPub.N.BitLen() + 7) / 8, nil
+// NewSigner returns a Signer adding a signature by each of the keys.
+// Clients accept payloads with any signature they can verify, so adding
+// the new key next to the old one allows rotating keys.
+func NewSigner(keys ...Key) Signer {
+	return signer(keys)
 }
 
-func SignaturesSize() (int, error) {
-	dataLen, err := keySize()
-	if err != nil {
-		return 0, err
+func (s signer) SignaturesSize() (int, error) {
+	if len(s) == 0 {
+		return 0, fmt.Errorf("no signing keys")
 	}
-	data := make([]byte, dataLen)
-	sigs := &metadata.Signatures{
-		Signatures: []*metadata.Signatures_Signature{
-			&metadata.Signatures_Signature{
-				Version: proto.Uint32(signatureVersion),
-				Data:    data,
-			},
-		},
+	sigs := &metadata.Signatures{}
+	for i, key := range s {
+		if key.Public() == nil {
+			return 0, fmt.Errorf("key %d has no public key", i)
+		}
+		sigs.Signatures = append(sigs.Signatures, &metadata.Signatures_Signature{
+			Version: proto.Uint32(signatureVersion),
+			Data:    make([]byte, key.Public().Size()),
+		})
 	}
 	return proto.Size(sigs), nil
 }
 
-func Sign(sum []byte) (*metadata.Signatures, error) {
-	pemBlock, _ := pem.Decode([]byte(developerSecKey))
-	if pemBlock == nil {
-		return nil, fmt.Errorf("unable to parse key")
+func (s signer) Sign(sum []byte) (*metadata.Signatures, error) {
+	if len(s) == 0 {
+		return nil, fmt.Errorf("no signing keys")
 	}
+	sigs := &metadata.Signatures{}
+	for i, key := range s {
+		sig, err := key.SignHash(sum)
+		if err != nil {
+			return nil, fmt.Errorf("signing with key %d: %v", i, err)
+		}
+		// Catch misconfigured keys before publishing the payload.
+		if err := rsa.VerifyPKCS1v15(key.Public(), signatureHash, sum, sig); err != nil {
+			return nil, fmt.Errorf("signature by key %d doesn't match its public key: %v", i, err)
+		}
+		sigs.Signatures = append(sigs.Signatures, &metadata.Signatures_Signature{
+			Version: proto.Uint32(signatureVersion),
+			Data:    sig,
+		})
+	}
+	return sigs, nil
+}
 
-	rsaKey, err := x509.ParsePKCS1PrivateKey(pemBlock.Bytes)
-	if err != nil {
-		return nil, err
+// Verifier checks payload signatures against a set of trusted public keys.
+type Verifier struct {
+	keys []*rsa.PublicKey
+}
+
+// NewVerifier returns a Verifier trusting the given keys.
+func NewVerifier(keys ...*rsa.PublicKey) *Verifier {
+	return &Verifier{keys: keys}
+}
+
+// LoadVerifier returns a Verifier trusting the PEM encoded public keys in
+// the given files.
+func LoadVerifier(paths ...string) (*Verifier, error) {
+	var keys []*rsa.PublicKey
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParsePublicKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		keys = append(keys, key)
 	}
+	return NewVerifier(keys...), nil
+}
 
-	sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, signatureHash, sum)
-	if err != nil {
-		return nil, err
+// Verify succeeds if any of the signatures is by a trusted key.
+func (v *Verifier) Verify(sum []byte, sigs *metadata.Signatures) error {
+	for _, sig := range sigs.Signatures {
+		ver := sig.GetVersion()
+		if ver != signatureVersion {
+			plog.Debugf("Skipping v%d signature", ver)
+			continue
+		}
+
+		for i, key := range v.keys {
+			if err := rsa.VerifyPKCS1v15(key, signatureHash, sum, sig.Data); err != nil {
+				plog.Debugf("Cannot verify v%d signature with key %d", ver, i)
+			} else {
+				plog.Infof("Good v%d signature by key %d", ver, i)
+				return nil
+			}
+		}
 	}
 
-	return &metadata.Signatures{
-		Signatures: []*metadata.Signatures_Signature{
-			&metadata.Signatures_Signature{
-				Version: proto.Uint32(signatureVersion),
-				Data:    sig,
-			},
-		},
-	}, nil
+	return fmt.Errorf("no valid signatures found")
 }
 
-func VerifySignature(sum []byte, sigs *metadata.Signatures) error {
-	pemBlock, _ := pem.Decode([]byte(developerPubKey))
+func NewSignatureHash() hash.Hash {
+	return signatureHash.New()
+}
+
+// ParsePublicKey parses a PEM encoded RSA public key.
+func ParsePublicKey(data []byte) (*rsa.PublicKey, error) {
+	pemBlock, _ := pem.Decode(data)
 	if pemBlock == nil {
-		return fmt.Errorf("unable to parse key")
+		return nil, fmt.Errorf("unable to parse key")
 	}
 
 	somePub, err := x509.ParsePKIXPublicKey(pemBlock.Bytes)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	rsaPub, ok := somePub.(*rsa.PublicKey)
 	if !ok {
-		return fmt.Errorf("unexpected key type %T", somePub)
+		return nil, fmt.Errorf("unexpected key type %T", somePub)
 	}
+	return rsaPub, nil
+}
 
-	for _, sig := range sigs.Signatures {
-		v := sig.GetVersion()
-		if v != signatureVersion {
-			plog.Debugf("Skipping v%d signature", v)
-			continue
-		}
+func mustParsePublicKey(data string) *rsa.PublicKey {
+	key, err := ParsePublicKey([]byte(data))
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
 
-		if err := rsa.VerifyPKCS1v15(rsaPub, signatureHash, sum, sig.Data); err != nil {
-			plog.Debugf("Cannot verify v%d signature with dev key", v)
-		} else {
-			plog.Infof("Good v%d signature by dev key", v)
-			return nil
-		}
+func keySize() (int, error) {
+	return DeveloperVerifier.keys[0].Size(), nil
+}
 
-	}
+// SignaturesSize returns the size of signatures by the developer key.
+func SignaturesSize() (int, error) {
+	return DeveloperKey.SignaturesSize()
+}
 
-	return fmt.Errorf("no valid signatures found")
+// Sign signs with the developer key.
+func Sign(sum []byte) (*metadata.Signatures, error) {
+	return DeveloperKey.Sign(sum)
+}
+
+// VerifySignature verifies signatures against the developer key.
+func VerifySignature(sum []byte, sigs *metadata.Signatures) error {
+	return DeveloperVerifier.Verify(sum, sigs)
 }
@@ -25,6 +25,7 @@ import (
 	"github.com/golang/protobuf/proto"
 
 	"github.com/flatcar/mantle/update/metadata"
+	"github.com/flatcar/mantle/update/signature"
 )
 
 var (
@@ -35,6 +36,13 @@ type Updater struct {
 	SrcPartition string
 	DstPartition string
 
+	// DstKernel is where the kernel is written. If unset, kernel
+	// procedures are only verified.
+	DstKernel string
+
+	// Verifier checks the payload signatures, see Payload.Verifier.
+	Verifier *signature.Verifier
+
 	payload *Payload
 }
 
@@ -51,6 +59,9 @@ func (u *Updater) OpenPayload(file string) error {
 
 func (u *Updater) UsePayload(r io.Reader) (err error) {
 	u.payload, err = NewPayloadFrom(r)
+	if err == nil {
+		u.payload.Verifier = u.Verifier
+	}
 	return err
 }
 
@@ -77,12 +88,29 @@ func (u *Updater) UpdatePartition(proc *metadata.InstallProcedure) error {
 }
 
 func (u *Updater) UpdateKernel(proc *metadata.InstallProcedure) error {
-	return fmt.Errorf("KERNEL")
+	if u.DstKernel == "" {
+		for _, op := range u.payload.Operations(proc) {
+			if err := op.Verify(); err != nil {
+				return fmt.Errorf("kernel operation: %v", err)
+			}
+		}
+		return nil
+	}
+	return u.updateCommon(proc, "kernel", "", u.DstKernel)
 }
 
+// updateCommon applies the procedure to dstPath. Delta procedures are
+// applied in place like update_engine does: the verified source is
+// copied to the destination first, unless both are the same file, and the
+// operations then read from and write to the destination.
 func (u *Updater) updateCommon(proc *metadata.InstallProcedure, procName, srcPath, dstPath string) (err error) {
 	var srcFile, dstFile *os.File
-	if proc.OldInfo.GetSize() != 0 && len(proc.OldInfo.Hash) != 0 {
+	delta := proc.OldInfo.GetSize() != 0 && len(proc.OldInfo.Hash) != 0
+	inPlace := false
+	if delta {
+		if srcPath == "" {
+			return fmt.Errorf("%s update is a delta, the source is required", procName)
+		}
 		if srcFile, err = os.Open(srcPath); err != nil {
 			return err
 		}
@@ -91,28 +119,66 @@ func (u *Updater) updateCommon(proc *metadata.InstallProcedure, procName, srcPat
 		if err = VerifyInfo(srcFile, proc.OldInfo); err != nil {
 			return err
 		}
+		inPlace = sameFile(srcFile, dstPath)
 	}
 
-	dstFile, err = os.OpenFile(u.DstPartition, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if inPlace {
+		dstFile, err = os.OpenFile(dstPath, os.O_RDWR, 0)
+	} else {
+		dstFile, err = os.OpenFile(dstPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	}
 	if err != nil {
 		return err
 	}
 	defer dstFile.Close()
 
+	if delta && !inPlace {
+		if _, err := srcFile.Seek(0, os.SEEK_SET); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(dstFile, srcFile, int64(proc.OldInfo.GetSize())); err != nil {
+			return fmt.Errorf("copying %s to %s: %v", srcPath, dstPath, err)
+		}
+	}
+
+	// operations of a delta read the blocks they update
+	opSrc := srcFile
+	if delta {
+		opSrc = dstFile
+	}
 	progress := 0
 	for _, op := range u.payload.Operations(proc) {
 		progress++
 		plog.Infof("%s operation %d", procName, progress)
-		if err := op.Apply(dstFile, srcFile); err != nil {
+		if err := op.Apply(dstFile, opSrc); err != nil {
 			return fmt.Errorf("%s operation %d: %v\n%s",
 				procName, progress, err,
 				proto.MarshalTextString(op.Operation))
 		}
 	}
 
+	// drop the rest of a larger source
+	if info, err := dstFile.Stat(); err != nil {
+		return err
+	} else if info.Mode().IsRegular() && info.Size() > int64(proc.NewInfo.GetSize()) {
+		if err := dstFile.Truncate(int64(proc.NewInfo.GetSize())); err != nil {
+			return err
+		}
+	}
+
 	return VerifyInfo(dstFile, proc.NewInfo)
 }
 
+// sameFile reports whether path refers to the already opened file.
+func sameFile(file *os.File, path string) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	pathInfo, err := os.Stat(path)
+	return err == nil && os.SameFile(info, pathInfo)
+}
+
 func VerifyInfo(file *os.File, info *metadata.InstallInfo) error {
 	if _, err := file.Seek(0, os.SEEK_SET); err != nil {
 		return err